@@ -5,17 +5,22 @@
 package main
 
 import (
+	"bufio"
+	"flag"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 
+	"github.com/skx/rss2email/discover"
 	"github.com/skx/rss2email/feedlist"
-	"github.com/skx/subcommands"
 )
 
 // Structure for our options and state.
 type addCmd struct {
 
-	// We embed the NoFlags option, because we accept no command-line flags.
-	subcommands.NoFlags
+	// Should we add the first feed a page advertises, without asking?
+	first bool
 }
 
 // Info is part of the subcommand-API
@@ -24,15 +29,56 @@ func (a *addCmd) Info() (string, string) {
 
 Add one or more specified URLs to our feed-list.
 
+If a URL is a page, rather than a feed, we add the feed it advertises
+instead.  If it advertises several you'll be asked which to add, unless
+you use '-first' to add the first of them.
+
 Example:
 
     $ rss2email add https://blog.steve.fi/index.rss
+    $ rss2email add -first https://blog.steve.fi/
 `
 }
 
+// Arguments handles our flag-setup.
+func (a *addCmd) Arguments(f *flag.FlagSet) {
+	f.BoolVar(&a.first, "first", false, "Add the first feed a page advertises, rather than asking which to add.")
+}
+
+// choose returns the feed to add, from those a page advertises, or ""
+// if none should be added.
+func (a *addCmd) choose(page string, found []discover.Candidate) string {
+
+	if len(found) == 1 || a.first {
+		return found[0].URL
+	}
+
+	fmt.Printf("%s advertises %d feeds:\n", page, len(found))
+	for i, c := range found {
+		fmt.Printf("  %d. %s (%s, %d entries)\n", i+1, c.URL, c.Title, c.Entries)
+	}
+	fmt.Printf("Add which feed? [1] ")
+
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return found[0].URL
+	}
+
+	n, err := strconv.Atoi(answer)
+	if err != nil || n < 1 || n > len(found) {
+		return ""
+	}
+	return found[n-1].URL
+}
+
 // Execute is invoked if the user specifies `add` as the subcommand.
 func (a *addCmd) Execute(args []string) int {
 
+	if readOnly("add feeds") {
+		return 1
+	}
+
 	// Get the feed-list, from the default location.
 	list := feedlist.New("")
 
@@ -42,6 +88,21 @@ func (a *addCmd) Execute(args []string) int {
 		// Add the entry
 		errors := list.Add(entry)
 
+		// If it wasn't a feed it might be a page which tells us
+		// where the feed is.
+		if len(errors) > 0 && !duplicate(errors[0]) {
+			found, err := discover.Advertised(entry)
+			if err == nil && len(found) > 0 {
+				feed := a.choose(entry, found)
+				if feed == "" {
+					fmt.Printf("%s: not added\n", entry)
+					continue
+				}
+				fmt.Printf("%s is not a feed, adding %s\n", entry, feed)
+				errors = list.Add(feed)
+			}
+		}
+
 		// Errors?
 		for _, err := range errors {
 			fmt.Printf("%s\n", (err.Error()))
@@ -58,3 +119,9 @@ func (a *addCmd) Execute(args []string) int {
 	// All done, with no errors.
 	return 0
 }
+
+// duplicate returns true if the error is that the feed is already present.
+func duplicate(err error) bool {
+	_, ok := err.(*feedlist.DuplicateError)
+	return ok
+}
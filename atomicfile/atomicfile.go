@@ -0,0 +1,45 @@
+// Package atomicfile writes files atomically, so that a crash, or a full
+// disk, never leaves a partially-written file behind.
+//
+// The data is written to a temporary file beside the destination, synced
+// to disk, and then renamed over it.  Readers see either the old file or
+// the new one, never a mixture.
+//
+// Processes which read a file, change it, and write it back, may also
+// take an advisory lock, so that their changes aren't lost to each other.
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// WriteFile writes data to the named file, atomically, creating it with
+// the given permissions if necessary.
+func WriteFile(name string, data []byte, perm os.FileMode) error {
+
+	tmp, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	// Tidy up, unless the file was renamed into place.
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
@@ -0,0 +1,89 @@
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestWriteFile tests writing, and replacing, a file.
+func TestWriteFile(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "atomicfile")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "state")
+	for _, content := range []string{"one\n", "two\n"} {
+		err = WriteFile(file, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("failed to write: %s", err)
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil || string(data) != content {
+			t.Fatalf("unexpected content %q: %v", data, err)
+		}
+	}
+
+	fi, err := os.Stat(file)
+	if err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("unexpected permissions: %v %v", fi.Mode(), err)
+	}
+
+	// No temporary files are left behind.
+	entries, _ := ioutil.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("unexpected files: %d", len(entries))
+	}
+
+	// A missing directory is an error.
+	if WriteFile(filepath.Join(dir, "missing", "state"), nil, 0644) == nil {
+		t.Errorf("expected an error writing to a missing directory")
+	}
+}
+
+// TestLock tests that a lock excludes others until it is released.
+func TestLock(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "atomicfile")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The directory of the lock is created.
+	file := filepath.Join(dir, "state", ".lock")
+	unlock, err := Lock(file)
+	if err != nil {
+		t.Fatalf("failed to lock: %s", err)
+	}
+
+	taken := make(chan func())
+	go func() {
+		second, err := Lock(file)
+		if err != nil {
+			t.Errorf("failed to lock again: %s", err)
+		}
+		taken <- second
+	}()
+
+	select {
+	case <-taken:
+		t.Fatalf("the lock was taken twice")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case second := <-taken:
+		if second != nil {
+			second()
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the lock wasn't released")
+	}
+}
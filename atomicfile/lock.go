@@ -0,0 +1,37 @@
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Lock takes an exclusive, advisory, lock upon the named file, creating
+// it if necessary, and waits until it can be taken.  The function
+// returned releases the lock.
+//
+// The lock only excludes others who take it too, and it is released when
+// the process exits, so a crash never leaves it held.  Upon systems which
+// lack advisory locks taking it always succeeds.
+func Lock(name string) (func(), error) {
+
+	err := os.MkdirAll(filepath.Dir(name), os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	fh, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	err = lock(fh)
+	if err != nil {
+		fh.Close()
+		return nil, err
+	}
+
+	return func() {
+		unlock(fh)
+		fh.Close()
+	}, nil
+}
@@ -0,0 +1,16 @@
+//go:build windows || plan9 || js
+// +build windows plan9 js
+
+package atomicfile
+
+import "os"
+
+// lock does nothing, as advisory locks aren't available here.
+func lock(fh *os.File) error {
+	return nil
+}
+
+// unlock does nothing, as advisory locks aren't available here.
+func unlock(fh *os.File) error {
+	return nil
+}
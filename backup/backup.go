@@ -0,0 +1,168 @@
+// Package backup pushes a snapshot of our feed-list to somewhere off the
+// machine, so that the list of subscriptions survives its loss.
+//
+// The snapshot may be an OPML document, or a JSON document which also
+// holds the comments above each feed, and optionally their statistics.
+// It may be uploaded to a WebDAV server, an S3 bucket, or committed to a
+// git repository.
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/feedlist"
+	"github.com/skx/rss2email/feedstate"
+)
+
+// The formats in which we may write a snapshot.
+const (
+	OPML = "opml"
+	JSON = "json"
+)
+
+// Stats are the statistics of a feed, included in a JSON snapshot if
+// requested.
+type Stats struct {
+	LastFetched time.Time       `json:"last_fetched"`
+	Failures    int             `json:"failures,omitempty"`
+	LastError   string          `json:"last_error,omitempty"`
+	Dedup       feedstate.Dedup `json:"dedup"`
+}
+
+// Feed is a single feed within a JSON snapshot.
+type Feed struct {
+	URL      string   `json:"url"`
+	Comments []string `json:"comments,omitempty"`
+	Options  []string `json:"options,omitempty"`
+	Stats    *Stats   `json:"stats,omitempty"`
+}
+
+// Document is a JSON snapshot.
+type Document struct {
+	Taken time.Time `json:"taken"`
+	Feeds []Feed    `json:"feeds"`
+}
+
+// Snapshot returns a snapshot of the given feed-list, in the given
+// format.  Statistics are only included in JSON snapshots.
+func Snapshot(list *feedlist.FeedList, format string, stats bool) ([]byte, error) {
+
+	switch format {
+	case OPML:
+		var out strings.Builder
+		err := list.WriteOPML(&out)
+		return []byte(out.String()), err
+
+	case JSON:
+		doc := Document{Taken: time.Now().UTC(), Feeds: []Feed{}}
+		for _, entry := range list.Feeds() {
+			feed := Feed{URL: entry.URL, Comments: entry.Comments, Options: entry.Inline}
+			if stats {
+				state := entry.State()
+				feed.Stats = &Stats{
+					LastFetched: state.LastFetched,
+					Failures:    state.Failures,
+					LastError:   state.LastError,
+					Dedup:       state.Dedup,
+				}
+			}
+			doc.Feeds = append(doc.Feeds, feed)
+		}
+		return json.MarshalIndent(doc, "", "  ")
+	}
+
+	return nil, fmt.Errorf("invalid %s %q, expected %q or %q", config.BackupFormat, format, OPML, JSON)
+}
+
+// Push uploads the snapshot to the given target, which is the URL of a
+// file upon a WebDAV server, "s3://bucket/path", or "git:/path", a file
+// within the working tree of a git repository.
+func Push(target string, data []byte) error {
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %s", config.BackupTarget, err.Error())
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return pushWebDAV(u, data)
+	case "s3":
+		return pushS3(u, data)
+	case "git":
+		return pushGit(u.Path, data)
+	}
+	return fmt.Errorf("invalid %s, expected a http, https, s3, or git URL", config.BackupTarget)
+}
+
+// Run pushes a snapshot of the given feed-list, as configured, if
+// BACKUP_INTERVAL has passed since the last.  It returns true if it did
+// so.
+func Run(list *feedlist.FeedList) (bool, error) {
+
+	target := config.Get(config.BackupTarget)
+	if target == "" {
+		return false, nil
+	}
+
+	interval, err := time.ParseDuration(config.Get(config.BackupInterval))
+	if err != nil || interval < 0 {
+		return false, fmt.Errorf("invalid %s %q, expected a duration such as \"24h\"", config.BackupInterval, config.Get(config.BackupInterval))
+	}
+	if time.Since(last()) < interval {
+		return false, nil
+	}
+
+	data, err := Snapshot(list, config.Get(config.BackupFormat), config.Get(config.BackupStats) == "true")
+	if err != nil {
+		return false, err
+	}
+
+	err = Push(target, data)
+	if err != nil {
+		return false, fmt.Errorf("failed to back up the feed-list: %s", err.Error())
+	}
+	return true, record(time.Now())
+}
+
+// path returns the file which records the time of our last backup.
+func path() string {
+	return filepath.Join(config.StateDirectory(), "backup")
+}
+
+// last returns the time of our last backup, or the zero time if there
+// hasn't been one.
+func last() time.Time {
+	data, err := ioutil.ReadFile(path())
+	if err != nil {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// record records the time of our last backup.
+func record(t time.Time) error {
+
+	file := path()
+
+	err := os.MkdirAll(filepath.Dir(file), os.ModePerm)
+	if err == nil {
+		err = ioutil.WriteFile(file, []byte(t.Format(time.RFC3339)+"\n"), 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record backup time: %s", err.Error())
+	}
+	return nil
+}
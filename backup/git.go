@@ -0,0 +1,52 @@
+package backup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// pushGit writes the snapshot to the given file, within the working tree
+// of a git repository, commits it if it changed, and pushes the commit
+// if the repository has a remote.
+func pushGit(file string, data []byte) error {
+
+	if file == "" {
+		return fmt.Errorf("invalid backup target, expected git:/path/to/repository/feeds.opml")
+	}
+	dir, name := filepath.Split(file)
+
+	git := func(args ...string) (string, error) {
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("git %s: %s %s", args[0], err.Error(), strings.TrimSpace(string(out)))
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+
+	err := ioutil.WriteFile(file, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	status, err := git("status", "--porcelain", "--", name)
+	if err != nil || status == "" {
+		return err
+	}
+
+	if _, err = git("add", "--", name); err != nil {
+		return err
+	}
+	if _, err = git("commit", "--quiet", "-m", "Update "+name, "--", name); err != nil {
+		return err
+	}
+
+	remotes, err := git("remote")
+	if err != nil || remotes == "" {
+		return err
+	}
+	_, err = git("push", "--quiet")
+	return err
+}
@@ -0,0 +1,119 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/network"
+)
+
+// pushS3 uploads the snapshot to the bucket and key named by the given
+// URL, "s3://bucket/path/feeds.opml", authenticating with the access key
+// BACKUP_USERNAME and the secret key BACKUP_PASSWORD.
+//
+// Buckets upon Amazon S3 are addressed by their region, BACKUP_S3_REGION,
+// other services by their endpoint, BACKUP_S3_ENDPOINT.
+func pushS3(u *url.URL, data []byte) error {
+
+	bucket := u.Host
+	key := strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || key == "" {
+		return fmt.Errorf("invalid %s, expected s3://bucket/path", config.BackupTarget)
+	}
+
+	region := config.Get(config.BackupS3Region)
+	target := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, region, escapePath(key))
+	if endpoint := config.Get(config.BackupS3Endpoint); endpoint != "" {
+		target = strings.TrimSuffix(endpoint, "/") + "/" + bucket + "/" + escapePath(key)
+	}
+
+	client, err := network.HTTPClient()
+	if err != nil {
+		return err
+	}
+	client.Timeout = 60 * time.Second
+
+	req, err := http.NewRequest("PUT", target, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType())
+
+	sign(req, data, region, config.Get(config.BackupUsername), config.Get(config.BackupPassword), time.Now().UTC())
+	return do(client, req)
+}
+
+// sign adds the headers which authenticate the request to S3, using
+// version 4 of the AWS signature scheme.  Every header the request has
+// been given is signed, along with its host.
+func sign(req *http.Request, payload []byte, region string, access string, secret string, now time.Time) {
+
+	sum := sha256.Sum256(payload)
+	payloadHash := hex.EncodeToString(sum[:])
+	stamp := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	canonical.WriteString(req.Method + "\n" + req.URL.EscapedPath() + "\n" + req.URL.RawQuery + "\n")
+	for _, name := range names {
+		canonical.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signed := strings.Join(names, ";")
+	canonical.WriteString("\n" + signed + "\n" + payloadHash)
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	hashed := sha256.Sum256([]byte(canonical.String()))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := []byte("AWS4" + secret)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", access, scope, signed, signature))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of the data, with the given key.
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// escapePath escapes each segment of the given path as S3 expects, which
+// is more strictly than url.PathEscape does.
+func escapePath(path string) string {
+	var out strings.Builder
+	for _, b := range []byte(path) {
+		switch {
+		case b >= 'A' && b <= 'Z', b >= 'a' && b <= 'z', b >= '0' && b <= '9', strings.IndexByte("-._~/", b) >= 0:
+			out.WriteByte(b)
+		default:
+			fmt.Fprintf(&out, "%%%02X", b)
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,60 @@
+package backup
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/network"
+)
+
+// pushWebDAV uploads the snapshot to the given URL, via a PUT request,
+// authenticating with BACKUP_USERNAME and BACKUP_PASSWORD if set.
+//
+// The collection the file lives in must exist already.
+func pushWebDAV(u *url.URL, data []byte) error {
+
+	client, err := network.HTTPClient()
+	if err != nil {
+		return err
+	}
+	client.Timeout = 60 * time.Second
+
+	req, err := http.NewRequest("PUT", u.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", config.Get(config.UserAgent))
+	req.Header.Set("Content-Type", contentType())
+	if user := config.Get(config.BackupUsername); user != "" {
+		req.SetBasicAuth(user, config.Get(config.BackupPassword))
+	}
+
+	return do(client, req)
+}
+
+// do sends the request, returning an error unless it succeeded.
+func do(client *http.Client, req *http.Request) error {
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failed to upload to %s: %s", req.URL.Redacted(), resp.Status)
+	}
+	return nil
+}
+
+// contentType returns the type of our snapshots.
+func contentType() string {
+	if config.Get(config.BackupFormat) == JSON {
+		return "application/json"
+	}
+	return "text/x-opml"
+}
@@ -0,0 +1,183 @@
+//
+// Remove old messages from an IMAP mailbox.
+//
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/feedlist"
+	"github.com/skx/rss2email/mailbox"
+	"github.com/skx/rss2email/network"
+)
+
+// ttlDirective is the directive which sets the time-to-live of the
+// messages generated from the following feed.
+const ttlDirective = "ttl"
+
+// Structure for our options and state.
+type cleanupCmd struct {
+
+	// Should we be verbose in operation?
+	verbose bool
+
+	// Should we show what we'd remove, rather than removing it?
+	dryRun bool
+}
+
+// Info is part of the subcommand-API
+func (c *cleanupCmd) Info() (string, string) {
+	return "cleanup", `Remove old messages from an IMAP mailbox.
+
+Some feeds are only of interest for a short time, for example news
+headlines.  To avoid such messages accumulating forever you may give a
+feed a time-to-live by adding a '#ttl' comment above it in your feed
+list:
+
+     #ttl 7d
+     https://news.example.com/headlines.rss
+
+This sub-command connects to the IMAP server configured via the
+IMAP_SERVER, IMAP_USERNAME, and IMAP_PASSWORD variables, and removes
+the messages from each such feed which were delivered longer ago than
+the feed's TTL.  The TTL may be given in days ("7d"), weeks ("2w"), or
+as a duration such as "36h".
+
+Messages are removed from the IMAP_FOLDER folder, which defaults to
+INBOX.  If IMAP_ARCHIVE is set they're moved to that folder instead of
+being deleted.
+
+The server must support the UIDPLUS extension, so that messages you've
+marked as deleted yourself aren't expunged along with ours.  Unless it
+listens on port 993 it must also support STARTTLS, set IMAP_INSECURE to
+"true" to allow an unencrypted connection.
+
+Messages are identified by the X-RSS-Source header, so only those sent
+by this version of rss2email, or later, will be found.
+
+You might wish to run this daily, via cron.
+
+Example:
+
+    $ rss2email cleanup -dry-run
+    $ rss2email cleanup
+`
+}
+
+// Arguments handles our flag-setup.
+func (c *cleanupCmd) Arguments(f *flag.FlagSet) {
+	f.BoolVar(&c.verbose, "verbose", false, "Should we be extra verbose?")
+	f.BoolVar(&c.dryRun, "dry-run", false, "Show how many messages would be removed, without removing them.")
+}
+
+// Execute is invoked if the user specifies `cleanup` as the subcommand.
+func (c *cleanupCmd) Execute(args []string) int {
+
+	if !c.dryRun && readOnly("remove messages") {
+		return 1
+	}
+
+	if !config.IsSet(config.IMAPServer) {
+		fmt.Printf("IMAP_SERVER must be set to use the cleanup sub-command\n")
+		return 1
+	}
+
+	// Find the feeds which have a TTL.
+	list := feedlist.New("")
+
+	ttls := make(map[string]time.Duration)
+	for _, entry := range list.Feeds() {
+		uri := entry.URL
+		values := entry.Directives(ttlDirective)
+		if len(values) == 0 {
+			continue
+		}
+
+		// The last value wins.
+		ttl, err := mailbox.ParseTTL(values[len(values)-1])
+		if err != nil {
+			fmt.Printf("error processing %s - %s\n", feedlist.Redact(uri), err.Error())
+			return 1
+		}
+		ttls[uri] = ttl
+	}
+
+	if len(ttls) == 0 {
+		if c.verbose {
+			fmt.Printf("No feeds have a TTL, nothing to do\n")
+		}
+		return 0
+	}
+
+	dialer, err := network.Dialer()
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return 1
+	}
+
+	client, err := mailbox.Dial(dialer, config.Get(config.IMAPServer), config.Get(config.IMAPInsecure) == "true")
+	if err != nil {
+		fmt.Printf("failed to connect to %s: %s\n", config.Get(config.IMAPServer), err.Error())
+		return 1
+	}
+	defer client.Close()
+
+	err = c.expire(client, list.Entries(), ttls)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return 1
+	}
+	return 0
+}
+
+// expire removes the expired messages of each feed, via the given client.
+func (c *cleanupCmd) expire(client *mailbox.Client, feeds []string, ttls map[string]time.Duration) error {
+
+	if config.IsSet(config.IMAPUsername) {
+		err := client.Login(config.Get(config.IMAPUsername), config.Get(config.IMAPPassword))
+		if err != nil {
+			return err
+		}
+	}
+
+	folder := config.Get(config.IMAPFolder)
+	err := client.Select(folder)
+	if err != nil {
+		return err
+	}
+
+	archive := config.Get(config.IMAPArchive)
+
+	for _, uri := range feeds {
+		ttl, ok := ttls[uri]
+		if !ok {
+			continue
+		}
+
+		// Our messages record the feed without its credentials.
+		uri = feedlist.Redact(uri)
+
+		uids, err := client.Expired(uri, time.Now().Add(-ttl))
+		if err != nil {
+			return fmt.Errorf("error processing %s - %s", uri, err.Error())
+		}
+
+		if c.verbose || c.dryRun {
+			fmt.Printf("%s: %d messages older than %s\n", uri, len(uids), ttl)
+		}
+		if c.dryRun {
+			continue
+		}
+
+		err = client.Remove(uids, archive)
+		if err != nil {
+			return fmt.Errorf("error processing %s - %s", uri, err.Error())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,656 @@
+// Package config holds the registry of environmental variables which
+// are used to configure our behaviour.
+//
+// Every variable the application reads should be declared here, and
+// looked up via Get, so that the `env` sub-command can document them
+// all without anybody needing to read the source.
+//
+// Variables may also be set in a configuration file, config.toml within
+// our configuration directory, values in the environment take precedence
+// over those in the file.
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// Variable describes a single configuration setting.
+type Variable struct {
+
+	// Name is the name of the environmental variable.
+	Name string
+
+	// Default is the value used if the variable is unset, or empty.
+	Default string
+
+	// Description is a human-readable summary of the setting.
+	Description string
+
+	// Secret is true if the value should not be displayed.
+	Secret bool
+}
+
+// The names of the variables we understand.
+const (
+	Directory  = "RSS2EMAIL_DIR"
+	Recipients = "RECIPIENTS"
+	Template   = "TEMPLATE"
+	ReadOnly   = "READ_ONLY"
+
+	FeedList         = "FEED_LIST"
+	FeedListUsername = "FEED_LIST_USERNAME"
+	FeedListPassword = "FEED_LIST_PASSWORD"
+
+	SMTPHost     = "SMTP_HOST"
+	SMTPPort     = "SMTP_PORT"
+	SMTPUsername = "SMTP_USERNAME"
+	SMTPPassword = "SMTP_PASSWORD"
+	SMTPHelo     = "SMTP_HELO"
+	Sleep        = "SLEEP"
+
+	SMTPTLS           = "SMTP_TLS"
+	SMTPTLSMinVersion = "SMTP_TLS_MIN_VERSION"
+	SMTPTLSCiphers    = "SMTP_TLS_CIPHERS"
+	SMTPTLSServerName = "SMTP_TLS_SERVER_NAME"
+
+	SendmailPath    = "SENDMAIL_PATH"
+	SendmailArgs    = "SENDMAIL_ARGS"
+	SendmailTimeout = "SENDMAIL_TIMEOUT"
+
+	AttachEnclosures = "ATTACH_ENCLOSURES"
+	EnclosureMaxSize = "ENCLOSURE_MAX_SIZE"
+	TranscodeMaxSize = "TRANSCODE_MAX_SIZE"
+	TranscodeTimeout = "TRANSCODE_TIMEOUT"
+
+	SubjectTemplate = "SUBJECT_TEMPLATE"
+	BodyEncoding    = "BODY_ENCODING"
+	Preview         = "PREVIEW"
+	EmptyContent    = "EMPTY_CONTENT"
+	AutoSubmitted   = "AUTO_SUBMITTED"
+	Precedence      = "PRECEDENCE"
+	ResendAfter     = "RESEND_AFTER"
+	DuplicateStorm  = "DUPLICATE_STORM"
+	RunBudget       = "RUN_BUDGET"
+	DripInterval    = "DRIP_INTERVAL"
+	FetchTimeout    = "FETCH_TIMEOUT"
+	FeedMaxSize     = "FEED_MAX_SIZE"
+	FeedCache       = "FEED_CACHE"
+	FetchTries      = "FETCH_TRIES"
+	FetchRetryDelay = "FETCH_RETRY_DELAY"
+	FetchRetryMax   = "FETCH_RETRY_MAX_DELAY"
+	FetchJitter     = "FETCH_JITTER"
+	FailureLimit    = "FAILURE_LIMIT"
+	FailureCooldown = "FAILURE_COOLDOWN"
+	ArchiveLinks    = "ARCHIVE_LINKS"
+
+	TextWrap     = "TEXT_WRAP"
+	TextLinks    = "TEXT_LINKS"
+	TextBullet   = "TEXT_BULLET"
+	TextNumbered = "TEXT_NUMBERED"
+
+	Encrypt    = "ENCRYPT"
+	GPGPath    = "GPG_PATH"
+	GPGHome    = "GPG_HOME"
+	GPGKeyFile = "GPG_KEY_FILE"
+
+	MaxMessageSize    = "MAX_MESSAGE_SIZE"
+	MessageSizePolicy = "MESSAGE_SIZE_POLICY"
+
+	TemplateMaxSize = "TEMPLATE_MAX_SIZE"
+	TemplateTimeout = "TEMPLATE_TIMEOUT"
+
+	BindAddress = "BIND_ADDRESS"
+	UserAgent   = "USER_AGENT"
+
+	SubmissionSocket  = "SUBMISSION_SOCKET"
+	SubmissionCommand = "SUBMISSION_COMMAND"
+
+	LMTPAddress = "LMTP_ADDRESS"
+
+	NNTPServer      = "NNTP_SERVER"
+	NNTPUsername    = "NNTP_USERNAME"
+	NNTPPassword    = "NNTP_PASSWORD"
+	NNTPGroupPrefix = "NNTP_GROUP_PREFIX"
+
+	SlugStyle = "SLUG_STYLE"
+	Folder    = "FOLDER"
+
+	Keyring = "KEYRING"
+
+	Backends = "BACKENDS"
+
+	Headers = "HEADERS"
+
+	Threading = "THREADING"
+
+	InstanceHeaders = "INSTANCE_HEADERS"
+
+	ReplyTo = "REPLY_TO"
+
+	GroupRecipients = "GROUP_RECIPIENTS"
+	Bcc             = "BCC"
+
+	IMAPServer   = "IMAP_SERVER"
+	IMAPUsername = "IMAP_USERNAME"
+	IMAPPassword = "IMAP_PASSWORD"
+	IMAPFolder   = "IMAP_FOLDER"
+	IMAPArchive  = "IMAP_ARCHIVE"
+	IMAPInsecure = "IMAP_INSECURE"
+
+	BackupTarget     = "BACKUP_TARGET"
+	BackupFormat     = "BACKUP_FORMAT"
+	BackupStats      = "BACKUP_STATS"
+	BackupInterval   = "BACKUP_INTERVAL"
+	BackupUsername   = "BACKUP_USERNAME"
+	BackupPassword   = "BACKUP_PASSWORD"
+	BackupS3Region   = "BACKUP_S3_REGION"
+	BackupS3Endpoint = "BACKUP_S3_ENDPOINT"
+)
+
+// registry contains the known variables, in the order in which they
+// should be documented.
+var registry = []Variable{
+	{
+		Name:        Directory,
+		Description: "The directory holding our configuration and state, overriding ~/.rss2email and the XDG directories.",
+	},
+	{
+		Name:        Recipients,
+		Description: "A comma-separated list of the recipients to email, if none are given on the command-line.",
+	},
+	{
+		Name:        Template,
+		Description: "The path to the email template, overriding email.tmpl in the configuration directory.",
+	},
+	{
+		Name:        ReadOnly,
+		Default:     "false",
+		Description: "Set to \"true\" to refuse to run commands which would modify the feed-list or state, as does the -read-only flag.",
+	},
+	{
+		Name:        FeedList,
+		Description: "The feed-list to read, overriding feeds in the configuration directory, either a path or an https:// URL from which a shared feed-list is fetched.",
+	},
+	{
+		Name:        FeedListUsername,
+		Description: "The username to authenticate with when fetching the feed-list from a URL.",
+	},
+	{
+		Name:        FeedListPassword,
+		Description: "The password to authenticate with when fetching the feed-list from a URL.",
+		Secret:      true,
+	},
+	{
+		Name:        SMTPHost,
+		Description: "The SMTP server to send email via, if unset sendmail is used.",
+	},
+	{
+		Name:        SMTPPort,
+		Default:     "587",
+		Description: "The port of the SMTP server.",
+	},
+	{
+		Name:        SMTPUsername,
+		Description: "The username to authenticate to the SMTP server with.",
+	},
+	{
+		Name:        SMTPPassword,
+		Description: "The password to authenticate to the SMTP server with.",
+		Secret:      true,
+	},
+	{
+		Name:        SMTPHelo,
+		Description: "The hostname we introduce ourselves as, via EHLO, by default \"localhost\".",
+	},
+	{
+		Name:        SMTPTLS,
+		Default:     "auto",
+		Description: "How TLS is used with the SMTP server, \"implicit\" from the start, or via \"starttls\"; \"auto\" uses implicit TLS on port 465.",
+	},
+	{
+		Name:        SMTPTLSMinVersion,
+		Description: "The minimum TLS version permitted with the SMTP server, e.g. \"1.2\".",
+	},
+	{
+		Name:        SMTPTLSCiphers,
+		Description: "A comma-separated list of the TLS cipher suites permitted with the SMTP server, e.g. \"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256\".",
+	},
+	{
+		Name:        SMTPTLSServerName,
+		Description: "The name sent via SNI, and expected in the SMTP server's certificate, if it differs from SMTP_HOST.",
+	},
+	{
+		Name:        SendmailPath,
+		Default:     "/usr/sbin/sendmail",
+		Description: "The sendmail binary to deliver via, if no other method is configured, e.g. \"/usr/bin/msmtp\".",
+	},
+	{
+		Name:        SendmailArgs,
+		Default:     "-i -f {from}",
+		Description: "The arguments given to sendmail, {from} is replaced by the sender, and {to} by the recipients which are otherwise appended.",
+	},
+	{
+		Name:        SendmailTimeout,
+		Default:     "5m",
+		Description: "The maximum time sendmail may run for, per message, before it is killed.",
+	},
+	{
+		Name:        Sleep,
+		Default:     "15",
+		Description: "The number of minutes between the daemon's polls of each feed, unless it has an \"#interval\".",
+	},
+	{
+		Name:        AttachEnclosures,
+		Default:     "false",
+		Description: "Set to \"true\" to attach feed enclosures to emails.",
+	},
+	{
+		Name:        EnclosureMaxSize,
+		Default:     "10485760",
+		Description: "The maximum size of an enclosure to attach, in bytes; larger ones are linked instead.",
+	},
+	{
+		Name:        TranscodeMaxSize,
+		Default:     "104857600",
+		Description: "The maximum size of an enclosure to download for a feed's #transcode command, in bytes.",
+	},
+	{
+		Name:        TranscodeTimeout,
+		Default:     "2m",
+		Description: "The maximum time a feed's #transcode command may run for, per enclosure.",
+	},
+	{
+		Name:        SubjectTemplate,
+		Default:     "[rss2email] {{.Subject}}",
+		Description: "The template used to generate the Subject of each email, e.g. \"[{{.FeedTitle}}] {{.Subject}}\".",
+	},
+	{
+		Name:        BodyEncoding,
+		Default:     "auto",
+		Description: "The transfer encoding of the text and HTML parts, \"quoted-printable\" or \"base64\"; \"auto\" picks the more compact for each part.",
+	},
+	{
+		Name:        TextWrap,
+		Default:     "0",
+		Description: "The column at which the text part of each email is wrapped, or 0 to leave it unwrapped.",
+	},
+	{
+		Name:        TextLinks,
+		Default:     "footnotes",
+		Description: "How links are shown in the text part, as numbered \"footnotes\", \"inline\" after their text, or \"none\".",
+	},
+	{
+		Name:        TextBullet,
+		Default:     "*",
+		Description: "The bullet placed before list items in the text part.",
+	},
+	{
+		Name:        TextNumbered,
+		Default:     "false",
+		Description: "Set to \"true\" to number the items of ordered lists in the text part.",
+	},
+	{
+		Name:        AutoSubmitted,
+		Default:     "auto-generated",
+		Description: "The value of the Auto-Submitted header, which stops vacation responders replying, or \"no\" to omit it.",
+	},
+	{
+		Name:        Precedence,
+		Description: "The value of the Precedence header, e.g. \"bulk\", if any.",
+	},
+	{
+		Name:        Encrypt,
+		Default:     "false",
+		Description: "Set to \"true\" to encrypt each email to its recipients, via PGP/MIME.",
+	},
+	{
+		Name:        GPGPath,
+		Default:     "gpg",
+		Description: "The gpg binary used to encrypt emails.",
+	},
+	{
+		Name:        GPGHome,
+		Description: "The directory holding the keyring in which we find the keys of recipients, by default that of gpg.",
+	},
+	{
+		Name:        GPGKeyFile,
+		Description: "A comma-separated list of armored public key files to encrypt to, instead of looking up recipients in the keyring.",
+	},
+	{
+		Name:        MaxMessageSize,
+		Default:     "0",
+		Description: "The maximum size of an email, in bytes, larger ones are shortened to fit; 0 for no limit.",
+	},
+	{
+		Name:        MessageSizePolicy,
+		Default:     "truncate",
+		Description: "How emails larger than MAX_MESSAGE_SIZE are shortened, \"truncate\" their content or replace it with a \"link\".",
+	},
+	{
+		Name:        ArchiveLinks,
+		Description: "Link to a Wayback Machine snapshot of each item, \"lookup\" the latest or \"save\" a new one.",
+	},
+	{
+		Name:        RunBudget,
+		Description: "The maximum time a run may take, e.g. \"10m\"; the next run resumes with the feeds which weren't processed.",
+	},
+	{
+		Name:        FetchTimeout,
+		Default:     "60s",
+		Description: "The maximum time fetching a single feed may take, e.g. \"30s\", before we give up and try again.",
+	},
+	{
+		Name:        FeedMaxSize,
+		Default:     "20971520",
+		Description: "The maximum size of a feed to download, in bytes, or 0 for no limit; larger feeds are refused.",
+	},
+	{
+		Name:        FeedCache,
+		Default:     "true",
+		Description: "Set to \"false\" to stop keeping a copy of each feed, which is reused while the server's Cache-Control allows and revalidated via its ETag after.",
+	},
+	{
+		Name:        FetchTries,
+		Default:     "5",
+		Description: "The number of times we try to fetch a feed, before giving up.",
+	},
+	{
+		Name:        FetchRetryDelay,
+		Default:     "200ms",
+		Description: "The time we wait before retrying a failed fetch, which doubles after each retry, with some random jitter.",
+	},
+	{
+		Name:        FetchRetryMax,
+		Default:     "30s",
+		Description: "The longest we wait before retrying a failed fetch, a server asking us to wait longer via Retry-After isn't retried.",
+	},
+	{
+		Name:        FetchJitter,
+		Default:     "0",
+		Description: "The most by which fetches are randomly delayed, e.g. \"5m\", so that they're spread out; 'cron' waits that long at most before starting, the daemon's feeds are each due that much later.",
+	},
+	{
+		Name:        FailureLimit,
+		Default:     "5",
+		Description: "The number of runs in a row a feed may fail to be fetched before we leave it alone for FAILURE_COOLDOWN, 0 to always fetch it.",
+	},
+	{
+		Name:        FailureCooldown,
+		Default:     "24h",
+		Description: "How long we leave a feed which keeps failing alone, before trying it again.",
+	},
+	{
+		Name:        DripInterval,
+		Description: "The minimum time between deliveries, e.g. \"5m\"; a run waits between new items, rather than sending them in a burst.",
+	},
+	{
+		Name:        ResendAfter,
+		Default:     "0",
+		Description: "Send items again if they reappear in their feed more than this many days after they were first seen, 0 to never do so.",
+	},
+	{
+		Name:        DuplicateStorm,
+		Default:     "50",
+		Description: "Warn when more than this percentage of a feed's items reappear with new GUIDs in a single run, or 0 to never warn.",
+	},
+	{
+		Name:        EmptyContent,
+		Default:     "send",
+		Description: "How items without content are handled, \"send\" them anyway, \"synthesize\" content from their title and link, \"fetch\" it from their link, or \"skip\" them.",
+	},
+	{
+		Name:        Preview,
+		Description: "Send a preview of each item, rather than all of it, as a number of words (\"100w\") or paragraphs (\"2p\").",
+	},
+	{
+		Name:        TemplateMaxSize,
+		Default:     "67108864",
+		Description: "The maximum size of the email a template may generate, in bytes.",
+	},
+	{
+		Name:        TemplateTimeout,
+		Default:     "30s",
+		Description: "The maximum time a template may take to generate an email, e.g. \"30s\".",
+	},
+	{
+		Name:        BindAddress,
+		Description: "The local IP address, or interface, to make outgoing HTTP and SMTP connections from.",
+	},
+	{
+		Name:        UserAgent,
+		Default:     "rss2email (https://github.com/skx/rss2email)",
+		Description: "The User-Agent sent with our HTTP requests, a feed may override it with a #user-agent comment.",
+	},
+	{
+		Name:        SubmissionSocket,
+		Description: "A Unix socket speaking SMTP to deliver via, e.g. \"/var/run/smtpd.sock\".",
+	},
+	{
+		Name:        SubmissionCommand,
+		Description: "A command speaking SMTP upon STDIN/STDOUT to deliver via, e.g. \"/usr/sbin/sendmail -bs\".",
+	},
+	{
+		Name:        LMTPAddress,
+		Description: "An LMTP server to deliver to, either a Unix socket such as \"/var/run/dovecot/lmtp\" or \"host:port\".",
+	},
+	{
+		Name:        NNTPServer,
+		Description: "A news server to post items to, rather than emailing them, e.g. \"localhost:119\".",
+	},
+	{
+		Name:        NNTPUsername,
+		Description: "The username to authenticate to the news server with.",
+	},
+	{
+		Name:        NNTPPassword,
+		Description: "The password to authenticate to the news server with.",
+		Secret:      true,
+	},
+	{
+		Name:        NNTPGroupPrefix,
+		Default:     "rss2email.",
+		Description: "The prefix of the newsgroups items are posted to, the rest of the name comes from the feed title.",
+	},
+	{
+		Name:        Folder,
+		Description: "A template naming the folder each item is filed in, e.g. \"Feeds.{{.Slug}}\", which is sent as the X-RSS-Folder header and as the detail of LMTP recipients.",
+	},
+	{
+		Name:        SlugStyle,
+		Default:     "ascii",
+		Description: "How feed titles become names: \"ascii\" drops other characters, \"transliterate\" converts accented, Greek, and Cyrillic letters to ASCII first, and \"unicode\" keeps the letters of every script.",
+	},
+	{
+		Name:        Keyring,
+		Default:     "false",
+		Description: "Set to \"true\" to read unset passwords from the OS keyring, via secret-tool or the macOS keychain.",
+	},
+	{
+		Name:        Backends,
+		Description: "A comma-separated list of the backends to deliver via, e.g. \"smtp,nntp\", by default only the highest-priority configured backend is used.",
+	},
+	{
+		Name:        Headers,
+		Description: "Additional headers to add to each email, separated by commas, e.g. \"X-Label: news, X-Source: rss2email\".",
+	},
+	{
+		Name:        Threading,
+		Default:     "false",
+		Description: "Set to \"true\" to add Message-ID and References headers, so that mail clients group the items of each feed into a thread.",
+	},
+	{
+		Name:        InstanceHeaders,
+		Default:     "false",
+		Description: "Set to \"true\" to add X-RSS2Email-Host and X-RSS2Email-Version headers, naming the host and version which sent each email.",
+	},
+	{
+		Name:        ReplyTo,
+		Description: "The address replies to our emails should be sent to, e.g. \"Steve <steve@example.com>\".",
+	},
+	{
+		Name:        GroupRecipients,
+		Default:     "false",
+		Description: "Set to \"true\" to send a single message addressed to all recipients, rather than one message to each.",
+	},
+	{
+		Name:        Bcc,
+		Description: "A comma-separated list of addresses to send a blind-copy of each message to.",
+	},
+	{
+		Name:        IMAPServer,
+		Description: "The IMAP server holding the mailbox the cleanup sub-command tidies, e.g. \"imap.example.com:993\".",
+	},
+	{
+		Name:        IMAPUsername,
+		Description: "The username to authenticate to the IMAP server with.",
+	},
+	{
+		Name:        IMAPPassword,
+		Description: "The password to authenticate to the IMAP server with.",
+		Secret:      true,
+	},
+	{
+		Name:        IMAPFolder,
+		Default:     "INBOX",
+		Description: "The IMAP folder from which expired messages are removed.",
+	},
+	{
+		Name:        IMAPArchive,
+		Description: "If set expired messages are moved to this IMAP folder, rather than being deleted.",
+	},
+	{
+		Name:        IMAPInsecure,
+		Default:     "false",
+		Description: "If \"true\" connect to an IMAP server which doesn't support STARTTLS, sending the credentials unencrypted.",
+	},
+	{
+		Name:        BackupTarget,
+		Description: "Where the daemon backs up the feed-list, the URL of a file upon a WebDAV server, \"s3://bucket/path\", or \"git:/path\" within a git repository.",
+	},
+	{
+		Name:        BackupFormat,
+		Default:     "opml",
+		Description: "The format of the backup, \"opml\" or \"json\", which also holds the comments above each feed.",
+	},
+	{
+		Name:        BackupStats,
+		Default:     "false",
+		Description: "Set to \"true\" to include the statistics of each feed in JSON backups.",
+	},
+	{
+		Name:        BackupInterval,
+		Default:     "24h",
+		Description: "How often the daemon backs up the feed-list.",
+	},
+	{
+		Name:        BackupUsername,
+		Description: "The username, or S3 access key, to authenticate to the backup target with.",
+	},
+	{
+		Name:        BackupPassword,
+		Description: "The password, or S3 secret key, to authenticate to the backup target with.",
+		Secret:      true,
+	},
+	{
+		Name:        BackupS3Region,
+		Default:     "us-east-1",
+		Description: "The region of the S3 bucket we back up to.",
+	},
+	{
+		Name:        BackupS3Endpoint,
+		Description: "The endpoint of an S3-compatible service to back up to, rather than Amazon S3, e.g. \"https://minio.example.com\".",
+	},
+}
+
+// Variables returns all the variables which we understand.
+func Variables() []Variable {
+	return registry
+}
+
+// Lookup returns the named variable, and a boolean to indicate whether
+// it was found.
+//
+// Variables within a named profile, such as SMTP_GMAIL_HOST, are found
+// too, as are those for a particular tag, such as TAG_WORK_RECIPIENTS.
+func Lookup(name string) (Variable, bool) {
+	for _, v := range registry {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	if v, ok := lookupProfiled(name); ok {
+		return v, true
+	}
+	return lookupTagged(name)
+}
+
+// Get returns the value of the named variable from the environment, or
+// the configuration file, falling back to the registered default if it
+// is unset or empty.
+//
+// Secrets may additionally be read from a file, or the OS keyring.
+func Get(name string) string {
+	val, _ := lookup(name)
+	if val != "" {
+		return val
+	}
+
+	v, ok := Lookup(name)
+	if ok {
+		return v.Default
+	}
+	return ""
+}
+
+// lookup returns the value the named variable has been set to, if any,
+// along with a description of where it came from.
+func lookup(name string) (string, string) {
+	val := os.Getenv(name)
+	if val != "" {
+		return val, "environment"
+	}
+
+	val = fromFile(name)
+	if val != "" {
+		return val, "config file"
+	}
+
+	v, ok := Lookup(name)
+	if ok && v.Secret {
+		return secret(name)
+	}
+	return "", ""
+}
+
+// List returns the value of the named variable as a list, splitting it
+// upon commas.  Empty elements are discarded.
+func List(name string) []string {
+	var out []string
+	for _, s := range strings.Split(Get(name), ",") {
+		s = strings.TrimSpace(s)
+		if s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// IsSet returns true if the named variable has been set to a non-empty
+// value in the environment, or the configuration file.  Secrets may also
+// be set via a file, or the OS keyring.
+func IsSet(name string) bool {
+	val, _ := lookup(name)
+	return val != ""
+}
+
+// Source describes where the value of the named variable comes from,
+// "environment", "config file", "default", or for secrets the file or
+// keyring they were read from.
+func Source(name string) string {
+	_, src := lookup(name)
+	if src == "" {
+		return "default"
+	}
+	return src
+}
@@ -0,0 +1,326 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDefaults ensures that defaults are used for unset variables.
+func TestDefaults(t *testing.T) {
+
+	cur := os.Getenv(SMTPPort)
+	defer os.Setenv(SMTPPort, cur)
+
+	os.Setenv(SMTPPort, "")
+	if Get(SMTPPort) != "587" {
+		t.Fatalf("unexpected default: %s", Get(SMTPPort))
+	}
+	if IsSet(SMTPPort) {
+		t.Fatalf("empty variable regarded as set")
+	}
+
+	os.Setenv(SMTPPort, "25")
+	if Get(SMTPPort) != "25" {
+		t.Fatalf("environment didn't override default: %s", Get(SMTPPort))
+	}
+}
+
+// TestUnknown ensures unknown variables are handled.
+func TestUnknown(t *testing.T) {
+
+	_, ok := Lookup("STEVE_KEMP")
+	if ok {
+		t.Fatalf("found unknown variable")
+	}
+	if Get("STEVE_KEMP") != "" {
+		t.Fatalf("unknown variable had a value")
+	}
+}
+
+// TestRegistry ensures that each variable is documented.
+func TestRegistry(t *testing.T) {
+
+	for _, v := range Variables() {
+		if v.Description == "" {
+			t.Errorf("variable %s has no description", v.Name)
+		}
+	}
+}
+
+// TestDirectories tests our choice of directories.
+func TestDirectories(t *testing.T) {
+
+	tmp, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, name := range []string{"HOME", "XDG_CONFIG_HOME", "XDG_DATA_HOME", Directory} {
+		cur := os.Getenv(name)
+		defer os.Setenv(name, cur)
+		os.Setenv(name, "")
+	}
+	os.Setenv("HOME", tmp)
+
+	legacy := filepath.Join(tmp, ".rss2email")
+
+	// By default we use the legacy directory.
+	if ConfigDirectory() != legacy || StateDirectory() != legacy {
+		t.Fatalf("unexpected directories: %s %s", ConfigDirectory(), StateDirectory())
+	}
+
+	// XDG directories are used if requested.
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join(tmp, "config"))
+	if ConfigDirectory() != filepath.Join(tmp, "config", "rss2email") {
+		t.Fatalf("unexpected config directory: %s", ConfigDirectory())
+	}
+	if StateDirectory() != filepath.Join(tmp, ".local", "share", "rss2email") {
+		t.Fatalf("unexpected state directory: %s", StateDirectory())
+	}
+
+	// Unless the legacy directory exists.
+	os.Mkdir(legacy, 0755)
+	if ConfigDirectory() != legacy || StateDirectory() != legacy {
+		t.Fatalf("unexpected directories: %s %s", ConfigDirectory(), StateDirectory())
+	}
+
+	// An explicit choice overrides everything.
+	os.Setenv(Directory, "/etc/rss2email")
+	if ConfigDirectory() != "/etc/rss2email" || StateDirectory() != "/etc/rss2email" {
+		t.Fatalf("unexpected directories: %s %s", ConfigDirectory(), StateDirectory())
+	}
+
+	SetDirectory("/srv/rss2email")
+	defer SetDirectory("")
+	if ConfigDirectory() != "/srv/rss2email" {
+		t.Fatalf("unexpected directory: %s", ConfigDirectory())
+	}
+}
+
+// TestFile tests reading our configuration file.
+func TestFile(t *testing.T) {
+
+	tmp, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	SetDirectory(tmp)
+	defer SetDirectory("")
+
+	for _, name := range []string{SMTPHost, SMTPPort, Recipients} {
+		cur := os.Getenv(name)
+		defer os.Setenv(name, cur)
+		os.Setenv(name, "")
+	}
+
+	content := `# A comment
+subject_template = "[{{.FeedTitle}}] # {{.Subject}}"  # trailing comment
+recipients = [ "steve@example.com", 'bob@example.com' ]
+
+[smtp]
+host = 'smtp.example.com'
+port = 25
+`
+	err = ioutil.WriteFile(filepath.Join(tmp, "config.toml"), []byte(content), 0600)
+	if err != nil {
+		t.Fatalf("failed to write configuration file: %s", err)
+	}
+
+	if err = Load(); err != nil {
+		t.Fatalf("unexpected error loading file: %s", err)
+	}
+	if Get(SMTPHost) != "smtp.example.com" || Source(SMTPHost) != "config file" {
+		t.Errorf("unexpected value: %s", Get(SMTPHost))
+	}
+	if Get(SubjectTemplate) != "[{{.FeedTitle}}] # {{.Subject}}" {
+		t.Errorf("unexpected value: %s", Get(SubjectTemplate))
+	}
+	if len(List(Recipients)) != 2 || List(Recipients)[1] != "bob@example.com" {
+		t.Errorf("unexpected value: %v", List(Recipients))
+	}
+
+	// The environment takes precedence
+	os.Setenv(SMTPPort, "2525")
+	if Get(SMTPPort) != "2525" || Source(SMTPPort) != "environment" {
+		t.Errorf("unexpected value: %s", Get(SMTPPort))
+	}
+
+	// Errors are reported.
+	broken := []string{
+		"smtp_host",
+		"unknown = 3",
+		"[smtp\nhost = 3",
+		"smtp_host = \"unterminated",
+		"smtp_host = 3.5",
+	}
+	for _, txt := range broken {
+		_, err := parse(strings.NewReader(txt))
+		if err == nil {
+			t.Errorf("expected error parsing %q", txt)
+		}
+	}
+}
+
+// TestSecrets tests reading secrets from files, and the keyring.
+func TestSecrets(t *testing.T) {
+
+	tmp, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	SetDirectory(tmp)
+	defer SetDirectory("")
+
+	for _, name := range []string{SMTPPassword, SMTPPassword + "_FILE", NNTPPassword, NNTPPassword + "_FILE", Keyring} {
+		cur := os.Getenv(name)
+		defer os.Setenv(name, cur)
+		os.Setenv(name, "")
+	}
+
+	// A secret may be read from a file, named in the environment.
+	path := filepath.Join(tmp, "password")
+	err = ioutil.WriteFile(path, []byte("s3cret\n"), 0600)
+	if err != nil {
+		t.Fatalf("failed to write secret: %s", err)
+	}
+	os.Setenv(SMTPPassword+"_FILE", path)
+	if Get(SMTPPassword) != "s3cret" || !IsSet(SMTPPassword) {
+		t.Errorf("unexpected value: %q", Get(SMTPPassword))
+	}
+	if Source(SMTPPassword) != "file "+path {
+		t.Errorf("unexpected source: %s", Source(SMTPPassword))
+	}
+	if err = Load(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	// The variable itself takes precedence.
+	os.Setenv(SMTPPassword, "direct")
+	if Get(SMTPPassword) != "direct" {
+		t.Errorf("unexpected value: %q", Get(SMTPPassword))
+	}
+	os.Setenv(SMTPPassword, "")
+
+	// A missing file is reported.
+	os.Setenv(SMTPPassword+"_FILE", filepath.Join(tmp, "missing"))
+	if err = Load(); err == nil {
+		t.Errorf("expected error for missing secret file")
+	}
+	if IsSet(SMTPPassword) {
+		t.Errorf("missing secret regarded as set")
+	}
+	os.Setenv(SMTPPassword+"_FILE", "")
+
+	// The path may be given in the configuration file.
+	content := "[nntp]\npassword_file = \"" + path + "\"\n"
+	err = ioutil.WriteFile(filepath.Join(tmp, "config.toml"), []byte(content), 0600)
+	if err != nil {
+		t.Fatalf("failed to write configuration file: %s", err)
+	}
+	reset()
+	if Get(NNTPPassword) != "s3cret" {
+		t.Errorf("unexpected value: %q", Get(NNTPPassword))
+	}
+
+	// Only secrets have file variants.
+	_, err = parse(strings.NewReader("smtp_host_file = \"/etc/passwd\""))
+	if err == nil {
+		t.Errorf("expected error for non-secret file")
+	}
+
+	// The keyring is consulted only if enabled.
+	old := keyringCommand
+	defer func() { keyringCommand = old }()
+	keyringCommand = func(name string) *exec.Cmd {
+		return exec.Command("echo", "from-keyring-"+name)
+	}
+	if IsSet(SMTPPassword) {
+		t.Errorf("keyring consulted when disabled")
+	}
+	os.Setenv(Keyring, "true")
+	if Get(SMTPPassword) != "from-keyring-SMTP_PASSWORD" || Source(SMTPPassword) != "keyring" {
+		t.Errorf("unexpected value: %q", Get(SMTPPassword))
+	}
+}
+
+// TestProfiles tests variables within named profiles.
+func TestProfiles(t *testing.T) {
+
+	if Profile(SMTPHost, "gmail") != "SMTP_GMAIL_HOST" || Profile(SMTPHost, "") != SMTPHost {
+		t.Fatalf("unexpected name: %s", Profile(SMTPHost, "gmail"))
+	}
+
+	v, ok := Lookup("SMTP_GMAIL_PASSWORD")
+	if !ok || !v.Secret || v.Name != "SMTP_GMAIL_PASSWORD" {
+		t.Fatalf("unexpected variable: %v", v)
+	}
+	if Get("SMTP_GMAIL_PORT") != "587" {
+		t.Fatalf("profile didn't inherit default: %s", Get("SMTP_GMAIL_PORT"))
+	}
+	for _, name := range []string{"SMTP__HOST", "SMTP_GMAIL_SLEEP", "SMTP_G-MAIL_HOST"} {
+		if _, ok := Lookup(name); ok {
+			t.Errorf("unexpected variable %s", name)
+		}
+	}
+
+	// Profiles may be given as nested tables.
+	values, err := parse(strings.NewReader("[smtp.gmail]\nhost = \"smtp.gmail.com\"\npassword_file = \"/run/secrets/gmail\"\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if values["SMTP_GMAIL_HOST"] != "smtp.gmail.com" || values["SMTP_GMAIL_PASSWORD_FILE"] != "/run/secrets/gmail" {
+		t.Fatalf("unexpected values: %v", values)
+	}
+}
+
+// TestTagged tests variables for the feeds with a particular tag.
+func TestTagged(t *testing.T) {
+
+	if Tagged(Recipients, "work") != "TAG_WORK_RECIPIENTS" || Tagged(Recipients, "day-job") != "" {
+		t.Fatalf("unexpected name: %s", Tagged(Recipients, "work"))
+	}
+
+	v, ok := Lookup("TAG_WORK_TEMPLATE")
+	if !ok || v.Name != "TAG_WORK_TEMPLATE" || v.Default != "" {
+		t.Fatalf("unexpected variable: %v", v)
+	}
+	for _, name := range []string{"TAG__RECIPIENTS", "TAG_WORK_SLEEP", "TAG_DAY-JOB_TEMPLATE"} {
+		if _, ok := Lookup(name); ok {
+			t.Errorf("unexpected variable %s", name)
+		}
+	}
+}
+
+// TestReadOnly ensures read-only mode may be set via the environment,
+// or the command-line.
+func TestReadOnly(t *testing.T) {
+
+	cur := os.Getenv(ReadOnly)
+	defer os.Setenv(ReadOnly, cur)
+	defer func() { readOnly = false }()
+
+	os.Setenv(ReadOnly, "")
+	if IsReadOnly() {
+		t.Fatalf("read-only by default")
+	}
+
+	os.Setenv(ReadOnly, "true")
+	if !IsReadOnly() {
+		t.Fatalf("READ_ONLY was ignored")
+	}
+
+	os.Setenv(ReadOnly, "")
+	SetReadOnly()
+	if !IsReadOnly() {
+		t.Fatalf("SetReadOnly was ignored")
+	}
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/skx/rss2email/internal/toml"
+)
+
+// fileValues holds the values read from our configuration file, keyed
+// by the name of the variable they set.
+var fileValues map[string]string
+
+// fileOnce ensures we only read our configuration file once.
+var fileOnce sync.Once
+
+// fileError holds any error encountered reading the configuration file.
+var fileError error
+
+// File returns the path to our configuration file.
+func File() string {
+	return filepath.Join(ConfigDirectory(), "config.toml")
+}
+
+// Load reads our configuration file, if it exists, returning any error
+// encountered.  Any files which hold secrets are checked too.
+//
+// It is not necessary to call this function, as the file is read on
+// first use, but doing so allows errors to be reported.
+func Load() error {
+	err := loadFile()
+	if err != nil {
+		return err
+	}
+	return checkSecrets()
+}
+
+// loadFile reads our configuration file, once.
+func loadFile() error {
+	fileOnce.Do(func() {
+		fileValues, fileError = readFile(File())
+	})
+	return fileError
+}
+
+// reset discards the values read from our configuration file, so that
+// it will be read again on next use.
+func reset() {
+	fileOnce = sync.Once{}
+	fileValues = nil
+	fileError = nil
+
+	keyringMutex.Lock()
+	keyringCache = map[string]string{}
+	keyringMutex.Unlock()
+}
+
+// fromFile returns the value set for the named variable in the
+// configuration file, if any.
+func fromFile(name string) string {
+	loadFile()
+	return fileValues[name]
+}
+
+// readFile reads the configuration file at the given path, a missing
+// file is not an error.
+func readFile(path string) (map[string]string, error) {
+
+	fh, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return map[string]string{}, err
+	}
+	defer fh.Close()
+
+	values, err := parse(fh)
+	if err != nil {
+		return map[string]string{}, fmt.Errorf("error reading %s: %s", path, err.Error())
+	}
+	return values, nil
+}
+
+// parse reads a configuration file, which is a simple subset of TOML.
+//
+// Keys are the names of our variables, in lower-case.  The prefix of a
+// key may instead be given as a table-name, so these are equivalent:
+//
+//	smtp_host = "smtp.example.com"
+//
+//	[smtp]
+//	host = "smtp.example.com"
+//
+// Tables may be nested, so "[smtp.gmail]" sets the variables of the SMTP
+// profile named "gmail".
+//
+// Values may be strings, integers, booleans, or arrays of strings - which
+// are joined with commas.  Secrets may be given as the path to a file
+// which contains them, via keys such as `smtp_password_file`.
+func parse(in io.Reader) (map[string]string, error) {
+
+	values := make(map[string]string)
+	section := ""
+
+	scanner := bufio.NewScanner(in)
+	line := 0
+	for scanner.Scan() {
+		line++
+		txt := strings.TrimSpace(toml.StripComment(scanner.Text()))
+
+		if txt == "" {
+			continue
+		}
+
+		// A table
+		if strings.HasPrefix(txt, "[") {
+			if !strings.HasSuffix(txt, "]") {
+				return nil, fmt.Errorf("line %d: malformed table %q", line, txt)
+			}
+			// Nested tables, "[smtp.gmail]", are flattened.
+			section = strings.ReplaceAll(strings.TrimSpace(txt[1:len(txt)-1]), ".", "_")
+			continue
+		}
+
+		// A key/value pair
+		parts := strings.SplitN(txt, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: expected key = value, got %q", line, txt)
+		}
+
+		key := strings.TrimSpace(parts[0])
+		if section != "" {
+			key = section + "_" + key
+		}
+		name := strings.ToUpper(key)
+
+		if _, ok := Lookup(name); !ok && !isSecretFile(name) {
+			return nil, fmt.Errorf("line %d: unknown setting %q", line, key)
+		}
+
+		vals, err := toml.ParseValue(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		values[name] = strings.Join(vals, ",")
+	}
+
+	return values, scanner.Err()
+}
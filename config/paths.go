@@ -0,0 +1,113 @@
+package config
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+)
+
+// directory holds a directory explicitly chosen by the user, via the
+// command-line, which overrides everything else.
+var directory string
+
+// SetDirectory sets the directory beneath which all of our configuration
+// and state is stored, overriding the defaults.
+func SetDirectory(dir string) {
+	directory = dir
+
+	// Our configuration file will have moved.
+	reset()
+}
+
+// home returns the home directory of the current user.
+func home() string {
+
+	// Default to using $HOME
+	home := os.Getenv("HOME")
+
+	// If that fails then get the current user, and use
+	// their home if possible.
+	if home == "" {
+		usr, err := user.Current()
+		if err == nil {
+			home = usr.HomeDir
+		}
+	}
+
+	return home
+}
+
+// legacyDirectory returns the directory we've historically used for
+// both configuration and state.
+func legacyDirectory() string {
+	return filepath.Join(home(), ".rss2email")
+}
+
+// useXDG returns true if we should store files in the locations given
+// by the XDG base directory specification.
+//
+// For compatibility we only do so if the user has set one of the XDG
+// environmental variables, and they don't already have a legacy
+// ~/.rss2email directory.
+func useXDG() bool {
+	if os.Getenv("XDG_CONFIG_HOME") == "" && os.Getenv("XDG_DATA_HOME") == "" {
+		return false
+	}
+
+	_, err := os.Stat(legacyDirectory())
+	return os.IsNotExist(err)
+}
+
+// override returns the directory the user has chosen, via the command
+// line or the environment, if any.
+//
+// NOTE: We don't use Get here, as the location of the configuration file
+// depends upon this value.
+func override() string {
+	if directory != "" {
+		return directory
+	}
+	return os.Getenv(Directory)
+}
+
+// ConfigDirectory returns the directory holding our configuration, such
+// as the feed-list and any email template.
+//
+// This is ~/.rss2email by default, or $XDG_CONFIG_HOME/rss2email if
+// XDG directories are in use.
+func ConfigDirectory() string {
+	if dir := override(); dir != "" {
+		return dir
+	}
+
+	if useXDG() {
+		base := os.Getenv("XDG_CONFIG_HOME")
+		if base == "" {
+			base = filepath.Join(home(), ".config")
+		}
+		return filepath.Join(base, "rss2email")
+	}
+
+	return legacyDirectory()
+}
+
+// StateDirectory returns the directory beneath which we record state,
+// such as the items we've already seen.
+//
+// This is ~/.rss2email by default, or $XDG_DATA_HOME/rss2email if XDG
+// directories are in use.
+func StateDirectory() string {
+	if dir := override(); dir != "" {
+		return dir
+	}
+
+	if useXDG() {
+		base := os.Getenv("XDG_DATA_HOME")
+		if base == "" {
+			base = filepath.Join(home(), ".local", "share")
+		}
+		return filepath.Join(base, "rss2email")
+	}
+
+	return legacyDirectory()
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"regexp"
+	"strings"
+)
+
+// profilePrefix is the prefix of the variables which may be given for
+// a named profile, as well as globally.
+const profilePrefix = "SMTP_"
+
+// profiled are the variables which may be set for a named profile.
+//
+// The profile's name is inserted after the prefix, so the host of the
+// "gmail" profile is SMTP_GMAIL_HOST.
+var profiled = []string{SMTPHost, SMTPPort, SMTPUsername, SMTPPassword, SMTPHelo,
+	SMTPTLS, SMTPTLSMinVersion, SMTPTLSCiphers, SMTPTLSServerName}
+
+// profileName matches valid profile names.
+var profileName = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+// ValidProfile returns true if the given name may be used as a profile.
+func ValidProfile(profile string) bool {
+	return profileName.MatchString(profile)
+}
+
+// Profile returns the name of the given variable within the named
+// profile.  If the profile is empty the name is returned unchanged.
+func Profile(name string, profile string) string {
+	if profile == "" || !strings.HasPrefix(name, profilePrefix) {
+		return name
+	}
+	return profilePrefix + strings.ToUpper(profile) + "_" + strings.TrimPrefix(name, profilePrefix)
+}
+
+// lookupProfiled returns the variable for the given name, if it is one of
+// our profiled variables within a named profile.  The variable shares the
+// default, description, and secrecy of the global one.
+func lookupProfiled(name string) (Variable, bool) {
+
+	for _, base := range profiled {
+		field := "_" + strings.TrimPrefix(base, profilePrefix)
+		if !strings.HasPrefix(name, profilePrefix) || !strings.HasSuffix(name, field) {
+			continue
+		}
+
+		profile := strings.TrimSuffix(strings.TrimPrefix(name, profilePrefix), field)
+		if !ValidProfile(profile) {
+			continue
+		}
+
+		for _, v := range registry {
+			if v.Name == base {
+				v.Name = name
+				return v, true
+			}
+		}
+	}
+	return Variable{}, false
+}
@@ -0,0 +1,15 @@
+package config
+
+// readOnly is true if read-only mode was chosen via the command-line.
+var readOnly bool
+
+// SetReadOnly enables read-only mode, regardless of the configuration.
+func SetReadOnly() {
+	readOnly = true
+}
+
+// IsReadOnly returns true if we're in read-only mode, in which nothing
+// may modify the feed-list, or our state.
+func IsReadOnly() bool {
+	return readOnly || Get(ReadOnly) == "true"
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// keyringService is the service-name under which secrets are stored in
+// the OS keyring, the account-name is the name of the variable.
+const keyringService = "rss2email"
+
+// keyringCache holds the secrets we've retrieved from the keyring, so
+// that we only spawn a helper once for each.
+var keyringCache = map[string]string{}
+
+// keyringMutex protects keyringCache.
+var keyringMutex sync.Mutex
+
+// keyringCommand returns the command used to retrieve the named secret
+// from the keyring on this platform.  It is a variable so that it may be
+// replaced in our test-cases.
+var keyringCommand = func(name string) *exec.Cmd {
+	if runtime.GOOS == "darwin" {
+		return exec.Command("security", "find-generic-password", "-s", keyringService, "-a", name, "-w")
+	}
+	return exec.Command("secret-tool", "lookup", "service", keyringService, "account", name)
+}
+
+// isSecretFile returns true if the given name is the `_FILE` variant of
+// a secret variable, such as SMTP_PASSWORD_FILE.
+func isSecretFile(name string) bool {
+	if !strings.HasSuffix(name, "_FILE") {
+		return false
+	}
+	v, ok := Lookup(strings.TrimSuffix(name, "_FILE"))
+	return ok && v.Secret
+}
+
+// secretPath returns the path of the file holding the named secret, from
+// the environment or the configuration file, if any.
+func secretPath(name string) string {
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		path = fromFile(name + "_FILE")
+	}
+	return path
+}
+
+// readSecret reads a secret from the given file.  Trailing newlines are
+// removed, as most editors add one.
+func readSecret(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// fromKeyring returns the named secret from the OS keyring, if the
+// keyring has been enabled and the secret is present.
+func fromKeyring(name string) string {
+	if os.Getenv(Keyring) != "true" && fromFile(Keyring) != "true" {
+		return ""
+	}
+
+	keyringMutex.Lock()
+	defer keyringMutex.Unlock()
+
+	if val, ok := keyringCache[name]; ok {
+		return val
+	}
+
+	// A missing secret is not an error, so we don't report failures.
+	val := ""
+	out, err := keyringCommand(name).Output()
+	if err == nil {
+		val = strings.TrimRight(string(out), "\r\n")
+	}
+	keyringCache[name] = val
+	return val
+}
+
+// secret returns the value of the named secret variable, and where it
+// came from, when it wasn't set directly.
+//
+// Secrets may be read from a file named by the `_FILE` variant of the
+// variable, for example SMTP_PASSWORD_FILE, or from the OS keyring.
+func secret(name string) (string, string) {
+	path := secretPath(name)
+	if path != "" {
+		val, err := readSecret(path)
+		if err == nil && val != "" {
+			return val, "file " + path
+		}
+	}
+
+	val := fromKeyring(name)
+	if val != "" {
+		return val, "keyring"
+	}
+	return "", ""
+}
+
+// checkSecrets ensures that any files which are configured to hold our
+// secrets may be read, so that problems are reported at startup rather
+// than when we come to send email.
+func checkSecrets() error {
+	for _, v := range registry {
+		if !v.Secret {
+			continue
+		}
+		path := secretPath(v.Name)
+		if path == "" {
+			continue
+		}
+		_, err := readSecret(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s_FILE: %s", v.Name, err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package config
+
+import "strings"
+
+// tagPrefix is the prefix of the variables which may be given for the
+// feeds with a particular tag.
+const tagPrefix = "TAG_"
+
+// tagged are the variables which may be set for the feeds with a
+// particular tag, as well as globally.
+//
+// The tag's name is inserted after the prefix, so the recipients of the
+// feeds tagged "work" are TAG_WORK_RECIPIENTS.
+var tagged = []string{Recipients, Template}
+
+// Tagged returns the name of the given variable for the feeds with the
+// given tag, or "" if the tag cannot have settings of its own, because
+// its name isn't alphanumeric.
+func Tagged(name string, tag string) string {
+	if !ValidProfile(tag) {
+		return ""
+	}
+	return tagPrefix + strings.ToUpper(tag) + "_" + name
+}
+
+// lookupTagged returns the variable for the given name, if it is one of
+// our tagged variables for a particular tag.  The variable shares the
+// description of the global one, but has no default.
+func lookupTagged(name string) (Variable, bool) {
+
+	for _, base := range tagged {
+		field := "_" + base
+		if !strings.HasPrefix(name, tagPrefix) || !strings.HasSuffix(name, field) {
+			continue
+		}
+
+		tag := strings.TrimSuffix(strings.TrimPrefix(name, tagPrefix), field)
+		if !ValidProfile(tag) {
+			continue
+		}
+
+		for _, v := range registry {
+			if v.Name == base {
+				v.Name = name
+				v.Default = ""
+				return v, true
+			}
+		}
+	}
+	return Variable{}, false
+}
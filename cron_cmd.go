@@ -9,8 +9,12 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/feedlist"
 	"github.com/skx/rss2email/processor"
+	"github.com/skx/rss2email/schedule"
 )
 
 // Structure for our options and state.
@@ -18,8 +22,23 @@ type cronCmd struct {
 	// Should we be verbose in operation?
 	verbose bool
 
+	// Should we try to minimize our memory usage?
+	lowMemory bool
+
 	// Should we send emails?
 	send bool
+
+	// Should we show the emails we'd send, rather than sending them?
+	dryRun bool
+
+	// Directory to write dry-run emails to, rather than STDOUT.
+	dryRunDir string
+
+	// Only process the feeds with these tags, comma-separated.
+	tag string
+
+	// Should feeds which have moved be updated in the feed-list?
+	updateMoved bool
 }
 
 // Info is part of the subcommand-API.
@@ -51,6 +70,50 @@ wish to use SMTP you need to configure the following environmental variables:
     SMTP_USERNAME   (e.g. "user@domain.com")
     SMTP_PASSWORD   (e.g. "secret!word#here")
 
+The username and password may be omitted if your server doesn't require
+authentication, such as a relay upon your local network.
+
+
+Dry Run:
+
+If you wish to test a template change, or a new feed, you can use the
+'-dry-run' flag.  This will render each email which would be sent and
+print it to STDOUT, rather than sending it.  No state is updated, so the
+same items will be processed the next time you run.  To save each message
+as a distinct '.eml' file instead add '-dry-run-dir /path/to/dir'.
+
+    $ rss2email cron -dry-run user@example.com
+
+
+Tags:
+
+Feeds may be tagged by adding '#tag name' comments above them in the
+feed-list.  If you specify '-tag name' only the feeds with that tag are
+processed, which allows different feeds to be processed on different
+schedules, via distinct cron entries.  Several tags may be separated by
+commas.
+
+    $ rss2email cron -tag work user@example.com
+
+
+Local Feeds:
+
+Feeds may be read from files, rather than fetched, by adding their
+'file://' URLs to the feed-list.  To process a single feed read from
+STDIN, such as one generated by another program, give '-' before the
+recipients.  Its items are remembered like those of any other feed.
+
+    $ make-feed | rss2email cron - user@example.com
+
+
+Low Memory:
+
+On small devices, such as routers, you may add the '-low-memory' flag.
+Feeds are processed one at a time, and the memory used by each is released
+before the next is fetched.  Feeds larger than 2MiB are refused, and
+reported as errors, rather than read, and enclosures will never be
+downloaded for attachment.
+
 
 Email Template:
 
@@ -64,7 +127,12 @@ may create a local override for this, for more details see :
 // Arguments handles our flag-setup.
 func (c *cronCmd) Arguments(f *flag.FlagSet) {
 	f.BoolVar(&c.verbose, "verbose", false, "Should we be extra verbose?")
+	f.BoolVar(&c.lowMemory, "low-memory", false, "Minimize memory usage, for small devices.")
 	f.BoolVar(&c.send, "send", true, "Should we send emails, or just pretend to?")
+	f.BoolVar(&c.dryRun, "dry-run", false, "Show the emails which would be sent, rather than sending them.")
+	f.StringVar(&c.dryRunDir, "dry-run-dir", "", "Write dry-run emails as .eml files beneath this directory, rather than to STDOUT.")
+	f.StringVar(&c.tag, "tag", "", "Only process the feeds with this tag, several may be comma-separated.")
+	f.BoolVar(&c.updateMoved, "update-moved", false, "Update the feed-list with the new location of feeds which have moved permanently.")
 }
 
 //
@@ -72,9 +140,27 @@ func (c *cronCmd) Arguments(f *flag.FlagSet) {
 //
 func (c *cronCmd) Execute(args []string) int {
 
-	// No argument?  That's a bug
+	// A dry-run changes nothing, so it is always permitted.
+	if !c.dryRun && c.dryRunDir == "" && readOnly("process feeds, other than via -dry-run") {
+		return 1
+	}
+
+	// Process a single feed, read from STDIN, rather than the
+	// feed-list?
+	feed := ""
+	if len(args) > 0 && args[0] == feedlist.Stdin {
+		feed = feedlist.Stdin
+		args = args[1:]
+	}
+
+	// No argument?  Use the configured recipients.
+	if len(args) == 0 {
+		args = config.List(config.Recipients)
+	}
+
+	// Still nothing?  That's a bug
 	if len(args) == 0 {
-		fmt.Printf("Usage: rss2email cron email1@example.com .. emailN@example.com\n")
+		fmt.Printf("Usage: rss2email cron [-] email1@example.com .. emailN@example.com\n")
 		return 1
 	}
 
@@ -86,7 +172,7 @@ func (c *cronCmd) Execute(args []string) int {
 		if strings.Contains(email, "@") {
 			recipients = append(recipients, email)
 		} else {
-			fmt.Printf("Usage: rss2email cron [flags] email1 .. emailN\n")
+			fmt.Printf("Usage: rss2email cron [flags] [-] email1 .. emailN\n")
 			return 1
 		}
 	}
@@ -96,7 +182,39 @@ func (c *cronCmd) Execute(args []string) int {
 
 	// Setup the state
 	p.SetVerbose(c.verbose)
+	p.SetLowMemory(c.lowMemory)
 	p.SetSendEmail(c.send)
+	p.SetDryRun(c.dryRun || c.dryRunDir != "")
+	p.SetDryRunDirectory(c.dryRunDir)
+	p.SetTags(strings.FieldsFunc(c.tag, func(r rune) bool { return r == ',' }))
+
+	// Stop cleanly if we're interrupted.
+	ctx, stop := interruptible()
+	defer stop()
+	p.SetContext(ctx)
+	p.SetVersion(version)
+	p.SetUpdateMoved(c.updateMoved)
+	p.SetFeed(feed)
+
+	// Wait a random time before a scheduled run, if we should, so
+	// that many hosts don't fetch the same feeds in the same second.
+	if feed == "" && !c.dryRun && c.dryRunDir == "" {
+		jitter, err := schedule.Jitter()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+
+		delay := schedule.Delay(jitter)
+		if c.verbose && delay > 0 {
+			fmt.Printf("waiting %s before fetching our feeds.\n", delay.Round(time.Second))
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return 0
+		}
+	}
 
 	errors := p.ProcessFeeds(recipients)
 
@@ -5,14 +5,25 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
-	"strconv"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/skx/rss2email/backup"
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/feedlist"
 	"github.com/skx/rss2email/processor"
+	"github.com/skx/rss2email/receipts"
+	"github.com/skx/rss2email/schedule"
+	"github.com/skx/rss2email/websub"
 )
 
 // Structure for our options and state.
@@ -20,6 +31,48 @@ type daemonCmd struct {
 
 	// Should we be verbose in operation?
 	verbose bool
+
+	// Should we try to minimize our memory usage?
+	lowMemory bool
+
+	// The address to serve our status upon, if any.
+	status string
+
+	// Should feeds which have moved be updated in the feed-list?
+	updateMoved bool
+
+	// Only process the feeds with these tags, comma-separated.
+	tag string
+
+	// The address to receive WebSub notifications upon, if any, and
+	// the public URL by which hubs reach it.
+	websub         string
+	websubCallback string
+
+	// mutex protects the fields which follow, which are shown in
+	// our status.
+	mutex sync.Mutex
+
+	// started is the time at which we started.
+	started time.Time
+
+	// runs is the number of times we've processed our feeds.
+	runs int
+
+	// lastRun is the time at which we last processed our feeds.
+	lastRun time.Time
+
+	// lastErrors are the errors encountered in the last run.
+	lastErrors []string
+}
+
+// daemonStatus is the status we report from our HTTP server.
+type daemonStatus struct {
+	Started    time.Time          `json:"started"`
+	Runs       int                `json:"runs"`
+	LastRun    time.Time          `json:"last_run"`
+	LastErrors []string           `json:"last_errors"`
+	Recipients []receipts.Receipt `json:"recipients"`
 }
 
 // Info is part of the subcommand-API.
@@ -27,8 +80,18 @@ func (d *daemonCmd) Info() (string, string) {
 	return "daemon", `Send emails for each new entry in our feed lists.
 
 This sub-command polls all configured feeds, sending an email for
-each item which is new.  Once the list of feeds has been processed
-the command will pause for 15 minutes, before beginning again.
+each item which is new.  Each feed is polled again after 15 minutes,
+or $SLEEP minutes if that is set, unless it has an interval of its own:
+
+    #interval 4h
+    https://blog.example.com/rss.xml
+
+Or a cron expression, giving the times at which it should be polled:
+
+    #cron 0 8 * * MON-FRI
+    https://news.example.com/feed.xml
+
+Send the process SIGHUP to have it reload the feed-list at once.
 
 In terms of implementation this command follows everything documented
 in the 'cron' sub-command.  The only difference is this one never
@@ -38,12 +101,166 @@ terminates - even if email-generation fails.
 Example:
 
     $ rss2email daemon user1@example.com user2@example.com
+
+As with 'cron', '-tag' restricts us to the feeds with the given tags.
+
+
+Status:
+
+If you specify an address with '-status' we'll serve our status, as
+JSON, from the '/status' endpoint upon it.  This includes the number of
+deliveries made to each recipient, as shown by 'rss2email stats':
+
+    $ rss2email daemon -status 127.0.0.1:8080 user@example.com
+    $ curl http://127.0.0.1:8080/status
+
+
+WebSub:
+
+Feeds which advertise a WebSub hub can push their updates to us, so that
+new items are sent within moments of being published.  To receive those
+notifications give '-websub' the address to listen upon, and
+'-websub-callback' the public URL by which hubs reach it, perhaps via a
+reverse proxy.  Other feeds are polled as usual, and those which push to
+us are still polled once a day, in case a notification was lost.
+
+    $ rss2email daemon -websub :8081 \
+        -websub-callback https://rss.example.com/websub user@example.com
 `
 }
 
 // Arguments handles our flag-setup.
 func (d *daemonCmd) Arguments(f *flag.FlagSet) {
 	f.BoolVar(&d.verbose, "verbose", false, "Should we be extra verbose?")
+	f.BoolVar(&d.lowMemory, "low-memory", false, "Minimize memory usage, for small devices.")
+	f.StringVar(&d.status, "status", "", "Serve our status upon this address, e.g. \"127.0.0.1:8080\".")
+	f.StringVar(&d.tag, "tag", "", "Only process the feeds with this tag, several may be comma-separated.")
+	f.BoolVar(&d.updateMoved, "update-moved", false, "Update the feed-list with the new location of feeds which have moved permanently.")
+	f.StringVar(&d.websub, "websub", "", "Receive WebSub notifications upon this address, e.g. \":8081\".")
+	f.StringVar(&d.websubCallback, "websub-callback", "", "The public URL by which WebSub hubs reach the '-websub' address.")
+}
+
+// processor returns a processor configured for our runs.
+func (d *daemonCmd) processor(ctx context.Context) *processor.Processor {
+
+	p := processor.New()
+
+	// Setup the state - note we ALWAYS send emails in this mode.
+	p.SetVerbose(d.verbose)
+	p.SetLowMemory(d.lowMemory)
+	p.SetSendEmail(true)
+	p.SetContext(ctx)
+	p.SetVersion(version)
+	p.SetUpdateMoved(d.updateMoved)
+	p.SetTags(strings.FieldsFunc(d.tag, func(r rune) bool { return r == ',' }))
+	return p
+}
+
+// pushed returns the feeds whose updates are pushed to us, and which have
+// been fetched recently enough that they needn't be polled.
+func pushed(subs *websub.Manager, list *feedlist.FeedList) []string {
+
+	var feeds []string
+	now := time.Now()
+	for _, entry := range list.Feeds() {
+		if subs.Active(entry.URL, now) && now.Sub(entry.State().LastFetched) < websub.PollInterval {
+			feeds = append(feeds, entry.URL)
+		}
+	}
+	return feeds
+}
+
+// subscribe subscribes to the feeds which advertise a hub, renewing our
+// existing subscriptions as necessary, and forgets the rest.
+func (d *daemonCmd) subscribe(subs *websub.Manager, list *feedlist.FeedList) []error {
+
+	var errors []error
+	var feeds []string
+	for _, entry := range list.Feeds() {
+		state := entry.State()
+		if entry.Disabled() || state.Hub == "" {
+			continue
+		}
+		feeds = append(feeds, entry.URL)
+
+		asked, err := subs.Subscribe(entry.URL, state.Hub, state.Topic, time.Now())
+		if err != nil {
+			errors = append(errors, err)
+		}
+		if asked && d.verbose {
+			fmt.Printf("subscribing to %s via %s\n", feedlist.Redact(entry.URL), state.Hub)
+		}
+	}
+
+	if err := subs.Prune(feeds); err != nil {
+		errors = append(errors, err)
+	}
+	return errors
+}
+
+// run processes all the feeds but those to skip, subscribes to those
+// which will push to us, and records the outcome in our status.
+func (d *daemonCmd) run(ctx context.Context, recipients []string, skip []string, subs *websub.Manager) {
+
+	// Create the helper
+	p := d.processor(ctx)
+	p.SetSkip(skip)
+
+	errors := p.ProcessFeeds(recipients)
+
+	// Subscribe to the feeds which will push to us.
+	if subs != nil {
+		errors = append(errors, d.subscribe(subs, feedlist.New(""))...)
+	}
+
+	// Back up the feed-list, if it's time to.
+	pushed, err := backup.Run(feedlist.New(""))
+	if err != nil {
+		errors = append(errors, err)
+	}
+	if pushed && d.verbose {
+		fmt.Printf("backed up the feed-list.\n")
+	}
+
+	// Update our status.
+	d.mutex.Lock()
+	d.runs++
+	d.lastRun = time.Now()
+	d.lastErrors = []string{}
+	for _, err := range errors {
+		d.lastErrors = append(d.lastErrors, err.Error())
+	}
+	d.mutex.Unlock()
+
+	// If we found errors then show them.
+	for _, err := range errors {
+		fmt.Fprintln(os.Stderr, err.Error())
+	}
+}
+
+// serveStatus handles requests for our status.
+func (d *daemonCmd) serveStatus(w http.ResponseWriter, r *http.Request) {
+
+	all, err := receipts.All()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	d.mutex.Lock()
+	status := daemonStatus{
+		Started:    d.started,
+		Runs:       d.runs,
+		LastRun:    d.lastRun,
+		LastErrors: append([]string{}, d.lastErrors...),
+		Recipients: all,
+	}
+	d.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(status)
 }
 
 //
@@ -51,7 +268,16 @@ func (d *daemonCmd) Arguments(f *flag.FlagSet) {
 //
 func (d *daemonCmd) Execute(args []string) int {
 
-	// No argument?  That's a bug
+	if readOnly("process feeds") {
+		return 1
+	}
+
+	// No argument?  Use the configured recipients.
+	if len(args) == 0 {
+		args = config.List(config.Recipients)
+	}
+
+	// Still nothing?  That's a bug
 	if len(args) == 0 {
 		fmt.Printf("Usage: rss2email daemon email1@example.com .. emailN@example.com\n")
 		return 1
@@ -70,40 +296,134 @@ func (d *daemonCmd) Execute(args []string) int {
 		}
 	}
 
+	d.started = time.Now()
+
+	// Serve our status, if we should.
+	if d.status != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/status", d.serveStatus)
+		go func() {
+			err := http.ListenAndServe(d.status, mux)
+			fmt.Fprintf(os.Stderr, "failed to serve status upon %s: %s\n", d.status, err.Error())
+		}()
+	}
+
+	// Receive WebSub notifications, if we should.
+	var subs *websub.Manager
+	var notified <-chan string
+	if d.websub != "" {
+		if d.websubCallback == "" {
+			fmt.Fprintf(os.Stderr, "-websub requires -websub-callback, the URL by which hubs reach %s\n", d.websub)
+			return 1
+		}
+
+		var err error
+		subs, err = websub.New(d.websubCallback)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			return 1
+		}
+		notified = subs.Pushed()
+
+		go func() {
+			err := http.ListenAndServe(d.websub, subs)
+			fmt.Fprintf(os.Stderr, "failed to receive WebSub notifications upon %s: %s\n", d.websub, err.Error())
+		}()
+	}
+
+	// Stop cleanly if we're interrupted.
+	ctx, stop := interruptible()
+	defer stop()
+
+	// Reload the feed-list when we receive SIGHUP.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	// When each feed is next due to be polled.
+	sched := schedule.New()
+
 	for {
 
-		// Create the helper
-		p := processor.New()
+		list := feedlist.New("")
+		interval := schedule.Default()
+		now := time.Now()
 
-		// Setup the state - note we ALWAYS send emails in this mode.
-		p.SetVerbose(d.verbose)
-		p.SetSendEmail(true)
+		// Spread our fetches out, if we should.
+		jitter, err := schedule.Jitter()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
+		sched.SetJitter(jitter)
 
-		errors := p.ProcessFeeds(recipients)
+		// Skip the feeds which aren't yet due, and those which are
+		// pushed to us, which needn't be polled.
+		due, skip := sched.Due(list.Feeds(), now)
+		if subs != nil {
+			skip = append(skip, pushed(subs, list)...)
+		}
 
-		// If we found errors then show them.
-		if len(errors) > 0 {
-			for _, err := range errors {
-				fmt.Fprintln(os.Stderr, err.Error())
+		if len(due) > 0 {
+			if d.verbose {
+				fmt.Printf("polling %d of %d feeds.\n", len(due), len(list.Feeds()))
 			}
-		}
+			d.run(ctx, recipients, skip, subs)
 
-		// Default time to sleep - in minutes
-		n := 15
+			polled := make(map[string]bool)
+			for _, uri := range due {
+				polled[uri] = true
+			}
+			for _, entry := range list.Feeds() {
+				if !polled[entry.URL] {
+					continue
+				}
+				if err := sched.Polled(entry, interval, now); err != nil {
+					fmt.Fprintln(os.Stderr, err.Error())
+				}
+			}
+		}
 
-		// Get the user's sleep period
-		sleep := os.Getenv("SLEEP")
-		if sleep != "" {
-			v, err := strconv.Atoi(sleep)
-			if err == nil {
-				n = v
+		if ctx.Err() != nil {
+			if d.verbose {
+				fmt.Printf("interrupted, exiting.\n")
 			}
+			return 0
 		}
 
+		next := sched.Next(list.Feeds(), interval, time.Now())
 		if d.verbose {
-			fmt.Printf("sleeping for %d minutes.\n", n)
+			fmt.Printf("sleeping until %s.\n", next.Format("15:04:05"))
+		}
+
+		// Process the feeds which are pushed to us as we're told
+		// they've been updated, while we wait.
+		wake := time.After(time.Until(next))
+	wait:
+		for {
+			select {
+			case <-wake:
+				break wait
+			case <-hup:
+				if d.verbose {
+					fmt.Printf("reloading the feed-list.\n")
+				}
+				break wait
+			case uri := <-notified:
+				if d.verbose {
+					fmt.Printf("processing %s, which was pushed to us.\n", feedlist.Redact(uri))
+				}
+				p := d.processor(ctx)
+				p.SetFeed(uri)
+				for _, err := range p.ProcessFeeds(recipients) {
+					fmt.Fprintln(os.Stderr, err.Error())
+				}
+			case <-ctx.Done():
+				if d.verbose {
+					fmt.Printf("interrupted, exiting.\n")
+				}
+				return 0
+			}
 		}
-		time.Sleep(60 * time.Duration(n) * time.Second)
 	}
 
 }
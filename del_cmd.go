@@ -5,36 +5,100 @@
 package main
 
 import (
+	"bufio"
+	"flag"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/skx/rss2email/feedlist"
-	"github.com/skx/subcommands"
 )
 
 // Structure for our options and state.
 type delCmd struct {
 
-	// We embed the NoFlags option, because we accept no command-line flags.
-	subcommands.NoFlags
+	// Don't ask before deleting several feeds.
+	yes bool
+
+	// input holds the answers to our questions, it's shared between
+	// them since it buffers more than a single answer.
+	input *bufio.Reader
 }
 
 // Info is part of the subcommand-API
 func (d *delCmd) Info() (string, string) {
 	return "delete", `Remove a feed from our feed-list.
 
-Remove one or more specified URLs from our feed-list.
+Remove one or more specified feeds from our feed-list.
+
+Each feed may be given by its URL, or by some text which appears within
+its URL, or the comments above it, ignoring case.  If several feeds match
+you'll be asked to confirm that they should all be removed, unless you
+add '-yes'.
 
 Example:
 
     $ rss2email delete https://blog.steve.fi/index.rss
+    $ rss2email delete hacker
+    $ rss2email delete -yes example.com
 `
 }
 
+// Arguments handles our flag-setup.
+func (d *delCmd) Arguments(f *flag.FlagSet) {
+	f.BoolVar(&d.yes, "yes", false, "Don't ask for confirmation before removing several feeds.")
+}
+
+// matches returns the feeds the given argument refers to, the feed with
+// that URL, or those spelled differently, if there are any, otherwise
+// those which contain it, as found by list -search.
+func (d *delCmd) matches(list *feedlist.FeedList, arg string) []string {
+
+	var spellings []string
+	for _, uri := range list.Entries() {
+		if uri == arg {
+			return []string{uri}
+		}
+		if feedlist.Canonical(uri) == feedlist.Canonical(arg) {
+			spellings = append(spellings, uri)
+		}
+	}
+	if len(spellings) > 0 {
+		return spellings
+	}
+	return list.Search(arg).Entries()
+}
+
+// confirm returns true if the given feeds, which all match the given
+// argument, should be removed.
+func (d *delCmd) confirm(arg string, feeds []string) bool {
+
+	if len(feeds) == 1 || d.yes {
+		return true
+	}
+
+	fmt.Printf("%q matches %d feeds:\n", arg, len(feeds))
+	for _, uri := range feeds {
+		fmt.Printf("  %s\n", feedlist.Redact(uri))
+	}
+	fmt.Printf("Remove them all? [y/N] ")
+
+	answer, _ := d.input.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
 //
 // Entry-point.
 //
 func (d *delCmd) Execute(args []string) int {
 
+	if readOnly("delete feeds") {
+		return 1
+	}
+
+	d.input = bufio.NewReader(os.Stdin)
+
 	// Get the feed-list, from the default location.
 	list := feedlist.New("")
 
@@ -42,14 +106,30 @@ func (d *delCmd) Execute(args []string) int {
 	// removed any entries.
 	before := len(list.Entries())
 
-	// For each argument remove it from the list, if present.
-	for _, entry := range args {
-		list.Delete(entry)
+	// For each argument remove the feeds it matches.
+	for _, arg := range args {
+		feeds := d.matches(list, arg)
+		if len(feeds) == 0 {
+			fmt.Printf("No feed matches %q.\n", arg)
+			continue
+		}
+		if !d.confirm(arg, feeds) {
+			continue
+		}
+		for _, uri := range feeds {
+			if uri != arg {
+				fmt.Printf("Removing %s\n", feedlist.Redact(uri))
+			}
+			list.Delete(uri)
+		}
 	}
 
 	// If we made a change then save it.
 	if len(list.Entries()) != before {
-		list.Save()
+		if err := list.Save(); err != nil {
+			fmt.Printf("failed to update feed list: %s\n", err.Error())
+			return 1
+		}
 	} else {
 		fmt.Printf("Feed list unchanged.\n")
 		fmt.Printf("Use 'rss2email list' to check your current feed list.\n")
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skx/rss2email/feedlist"
+)
+
+// TestMatches tests finding the feeds an argument refers to.
+func TestMatches(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "feeds.txt")
+	err := ioutil.WriteFile(path, []byte(`# Steve's blog
+https://blog.steve.fi/index.rss
+https://example.com/one.rss
+https://example.com/two.rss
+https://EXAMPLE.org/feed
+`), 0644)
+	if err != nil {
+		t.Fatalf("failed to write feeds: %s", err)
+	}
+	list := feedlist.New(path)
+
+	tests := map[string][]string{
+		"https://blog.steve.fi/index.rss": {"https://blog.steve.fi/index.rss"},
+		"https://example.org/feed":        {"https://EXAMPLE.org/feed"},
+		"example.com":                     {"https://example.com/one.rss", "https://example.com/two.rss"},
+		"steve's":                         {"https://blog.steve.fi/index.rss"},
+		"missing":                         nil,
+	}
+
+	d := &delCmd{}
+	for arg, expected := range tests {
+		got := d.matches(list, arg)
+		if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("%s: expected %v, got %v", arg, expected, got)
+		}
+	}
+}
+
+// TestConfirm tests that each confirmation reads its own answer,
+// from piped input.
+func TestConfirm(t *testing.T) {
+
+	d := &delCmd{input: bufio.NewReader(strings.NewReader("y\nno\nYes\n"))}
+	feeds := []string{"https://example.com/one.rss", "https://example.com/two.rss"}
+
+	for i, expected := range []bool{true, false, true, false} {
+		if got := d.confirm("example", feeds); got != expected {
+			t.Errorf("answer %d: expected %v, got %v", i, expected, got)
+		}
+	}
+
+	// A single feed, or -yes, needs no confirmation.
+	if !d.confirm("one", feeds[:1]) {
+		t.Errorf("a single feed should be removed")
+	}
+	d.yes = true
+	if !d.confirm("example", feeds) {
+		t.Errorf("-yes should remove every feed")
+	}
+}
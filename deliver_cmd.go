@@ -0,0 +1,206 @@
+//
+// Deliver pre-built items, read as JSON.
+//
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/processor"
+	"github.com/skx/rss2email/withstate"
+)
+
+// deliveryItem is a single item read from our input.
+//
+// The fields of the item are those of a gofeed.Item, with the addition
+// of the feed from which it came.
+type deliveryItem struct {
+	gofeed.Item
+
+	// Feed holds the details of the source feed.
+	Feed gofeed.Feed `json:"feed"`
+}
+
+// Structure for our options and state.
+type deliverCmd struct {
+
+	// Should we be verbose in operation?
+	verbose bool
+
+	// Should we show the emails we'd send, rather than sending them?
+	dryRun bool
+}
+
+// Info is part of the subcommand-API
+func (d *deliverCmd) Info() (string, string) {
+	return "deliver", `Send emails for items read as JSON.
+
+This sub-command reads feed items, encoded as JSON, and sends an email for
+each of them using the same template and delivery settings as the 'cron'
+sub-command.  No feeds are fetched, and no state is recorded, which allows
+other programs to use rss2email purely to format and deliver messages.
+
+The first argument is the file to read, or '-' to read from STDIN.  The
+remaining arguments are the recipients.
+
+Items may be supplied as a JSON array, or as a stream of JSON objects.
+Each object has the same fields as the gofeed.Item structure, along with
+a 'feed' object describing the source feed:
+
+    {
+      "title": "Hello, World",
+      "link": "https://example.com/hello",
+      "guid": "hello",
+      "content": "<p>Hello, World</p>",
+      "feed": { "title": "Example Blog", "link": "https://example.com/" }
+    }
+
+Example:
+
+    $ scraper | rss2email deliver - user1@example.com user2@example.com
+    $ rss2email deliver -dry-run items.json user@example.com
+`
+}
+
+// Arguments handles our flag-setup.
+func (d *deliverCmd) Arguments(f *flag.FlagSet) {
+	f.BoolVar(&d.verbose, "verbose", false, "Should we be extra verbose?")
+	f.BoolVar(&d.dryRun, "dry-run", false, "Show the emails which would be sent, rather than sending them.")
+}
+
+// readItems reads the items from the given reader, which may contain
+// either a JSON array or a stream of JSON objects.
+func readItems(in io.Reader) ([]deliveryItem, error) {
+
+	reader := bufio.NewReader(in)
+
+	// Skip leading whitespace, so we can see how the input begins.
+	for {
+		r, _, err := reader.ReadRune()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !strings.ContainsRune(" \t\r\n", r) {
+			reader.UnreadRune()
+			break
+		}
+	}
+
+	dec := json.NewDecoder(reader)
+
+	// An array?
+	peek, _ := reader.Peek(1)
+	if string(peek) == "[" {
+		var items []deliveryItem
+		err := dec.Decode(&items)
+		if err != nil {
+			return nil, err
+		}
+		return items, nil
+	}
+
+	// Otherwise a stream of objects
+	var items []deliveryItem
+	for {
+		var item deliveryItem
+		err := dec.Decode(&item)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+//
+// Entry-point.
+//
+func (d *deliverCmd) Execute(args []string) int {
+
+	if !d.dryRun && readOnly("deliver messages, other than via -dry-run") {
+		return 1
+	}
+
+	if len(args) == 1 {
+		args = append(args, config.List(config.Recipients)...)
+	}
+
+	if len(args) < 2 {
+		fmt.Printf("Usage: rss2email deliver [flags] -|file email1@example.com .. emailN@example.com\n")
+		return 1
+	}
+
+	// The list of addresses to which we should send our notices.
+	recipients := []string{}
+
+	// Save each argument away, checking it is fully-qualified.
+	for _, email := range args[1:] {
+		if strings.Contains(email, "@") {
+			recipients = append(recipients, email)
+		} else {
+			fmt.Printf("Usage: rss2email deliver [flags] -|file email1 .. emailN\n")
+			return 1
+		}
+	}
+
+	// Open our input
+	var in io.Reader = os.Stdin
+	if args[0] != "-" {
+		fh, err := os.Open(args[0])
+		if err != nil {
+			fmt.Printf("failed to open %s: %s\n", args[0], err.Error())
+			return 1
+		}
+		defer fh.Close()
+		in = fh
+	}
+
+	items, err := readItems(in)
+	if err != nil {
+		fmt.Printf("failed to parse items: %s\n", err.Error())
+		return 1
+	}
+
+	// Create the helper
+	p := processor.New()
+	p.SetVerbose(d.verbose)
+	p.SetDryRun(d.dryRun)
+
+	failed := false
+	for _, x := range items {
+
+		x := x
+		feed := x.Feed
+		item := withstate.FeedItem{Item: &x.Item}
+
+		if d.verbose {
+			fmt.Printf("Delivering: %s\n", item.Title)
+		}
+
+		err := p.Deliver(&feed, item, recipients)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error delivering %s - %s\n", item.Title, err)
+			failed = true
+		}
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestReadItems tests reading items, as an array or a stream of objects.
+func TestReadItems(t *testing.T) {
+
+	tests := map[string][]string{
+		``:        nil,
+		"  \n\t ": nil,
+		`{"title": "One", "feed": {"title": "Blog"}}`:                {"One"},
+		"\n {\"title\": \"One\"}\n{\"title\": \"Two\"}\n":            {"One", "Two"},
+		`[{"title": "One"}, {"title": "Two"}, {"title": "Three"}]`:   {"One", "Two", "Three"},
+		` [ {"title": "One", "link": "https://example.com/one"} ] `:  {"One"},
+		`{"title": "One", "guid": "one", "content": "<p>Hello</p>"}`: {"One"},
+	}
+	for input, expected := range tests {
+		items, err := readItems(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", input, err)
+			continue
+		}
+		var titles []string
+		for _, item := range items {
+			titles = append(titles, item.Title)
+		}
+		if strings.Join(titles, ",") != strings.Join(expected, ",") {
+			t.Errorf("%q: expected %v, got %v", input, expected, titles)
+		}
+	}
+
+	items, _ := readItems(strings.NewReader(`{"title": "One", "feed": {"title": "Blog", "link": "https://example.com/"}}`))
+	if len(items) != 1 || items[0].Feed.Title != "Blog" || items[0].Feed.Link != "https://example.com/" {
+		t.Errorf("the feed wasn't read: %v", items)
+	}
+
+	for _, input := range []string{`{"title": `, `[{"title": "One"},]`, `{"title": "One"} oops`, `{"title": 3}`} {
+		if _, err := readItems(strings.NewReader(input)); err == nil {
+			t.Errorf("%q: expected an error", input)
+		}
+	}
+}
+
+// TestDeliverDryRun tests showing the emails for items read from a file.
+func TestDeliverDryRun(t *testing.T) {
+
+	file := filepath.Join(t.TempDir(), "items.json")
+	err := ioutil.WriteFile(file, []byte(`{"title": "Hello, World", "link": "https://example.com/hello", "guid": "hello", "content": "<p>Hello, World</p>", "feed": {"title": "Example Blog", "link": "https://example.com/"}}`), 0644)
+	if err != nil {
+		t.Fatalf("failed to write items: %s", err)
+	}
+
+	// Capture what we show.
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %s", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	output := make(chan string)
+	go func() {
+		data, _ := ioutil.ReadAll(r)
+		output <- string(data)
+	}()
+
+	d := &deliverCmd{dryRun: true}
+	result := d.Execute([]string{file, "steve@example.com"})
+	invalid := d.Execute([]string{file, "steve"})
+
+	os.Stdout = stdout
+	w.Close()
+	shown := <-output
+
+	if result != 0 {
+		t.Errorf("unexpected result %d:\n%s", result, shown)
+	}
+	if invalid != 1 {
+		t.Errorf("expected an invalid recipient to fail")
+	}
+	for _, expected := range []string{"To: steve@example.com", "https://example.com/hello"} {
+		if !strings.Contains(shown, expected) {
+			t.Errorf("expected %q in the output:\n%s", expected, shown)
+		}
+	}
+}
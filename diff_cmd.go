@@ -0,0 +1,109 @@
+//
+// Show how a feed has changed since it was last processed.
+//
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/skx/rss2email/feedlist"
+	"github.com/skx/rss2email/feedstate"
+	"github.com/skx/rss2email/withstate"
+	"github.com/skx/subcommands"
+)
+
+// Structure for our options and state.
+type diffCmd struct {
+
+	// We embed the NoFlags option, because we accept no command-line flags.
+	subcommands.NoFlags
+}
+
+// Info is part of the subcommand-API
+func (d *diffCmd) Info() (string, string) {
+	return "diff", `Show how a feed has changed since it was last processed.
+
+Each time a feed is processed we save a snapshot of the items it
+contained.  This sub-command fetches the feed again, and compares it
+with that snapshot, showing the items which were added, removed, or
+changed since.
+
+Added items are shown along with whether they will be emailed, those
+which were seen before, under the same GUID or link, will not be.  This
+should help you discover why an item you expected never arrived.
+
+Nothing is sent, and no state is updated.
+
+Example:
+
+    $ rss2email diff https://blog.steve.fi/index.rss
+`
+}
+
+// describe returns a one-line description of the given item.
+func describe(item feedstate.SnapshotItem) string {
+	title := item.Title
+	if title == "" {
+		title = "(untitled)"
+	}
+	if item.Link != "" {
+		title += " <" + item.Link + ">"
+	}
+	return title
+}
+
+//
+// Entry-point.
+//
+func (d *diffCmd) Execute(args []string) int {
+
+	if len(args) != 1 {
+		fmt.Printf("Usage: rss2email diff URL\n")
+		return 1
+	}
+	url := args[0]
+
+	old, err := feedstate.LoadSnapshot(url)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return 1
+	}
+
+	feed, err := feedlist.Feed(url)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return 1
+	}
+	now := feedstate.NewSnapshot(url, feed)
+
+	if old == nil {
+		fmt.Printf("There is no snapshot of %s, as it hasn't been processed, so every item is new.\n\n", url)
+		old = &feedstate.Snapshot{URL: url}
+	} else {
+		fmt.Printf("Comparing %s with the snapshot taken %s.\n\n", url, when(old.Taken))
+	}
+
+	added, removed, changed := old.Diff(now)
+
+	for _, item := range added {
+		state := "new, will be emailed"
+		seen := withstate.FeedItem{Item: &gofeed.Item{GUID: item.ID}}
+		if !seen.IsNew() {
+			state = "seen before, will not be emailed"
+		}
+		fmt.Printf("+ %s (%s)\n", describe(item), state)
+	}
+	for _, item := range removed {
+		fmt.Printf("- %s\n", describe(item))
+	}
+	for _, c := range changed {
+		fmt.Printf("~ %s (changed %s, changes are not emailed)\n", describe(c.Item), strings.Join(c.Fields, ", "))
+	}
+
+	unchanged := len(now.Items) - len(added) - len(changed)
+	fmt.Printf("\n%d added, %d removed, %d changed, %d unchanged.\n", len(added), len(removed), len(changed), unchanged)
+	return 0
+}
@@ -0,0 +1,303 @@
+// Package discover finds the feeds published by a site, so that they may
+// be added to our feed-list without hunting for them by hand.
+//
+// We look for the feeds a page advertises via <link rel="alternate">
+// tags, probe the paths which are commonly used for feeds, and know the
+// feed locations of a few popular services.
+package discover
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmcdole/gofeed"
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/network"
+)
+
+// commonPaths are the paths, relative to the root of a site, at which
+// feeds are commonly found.
+var commonPaths = []string{
+	"/feed",
+	"/rss",
+	"/atom.xml",
+	"/index.xml",
+	"/feed.xml",
+	"/rss.xml",
+	"/index.rss",
+	"/feed.atom",
+}
+
+// feedTypes are the MIME types a <link rel="alternate"> tag uses to
+// advertise a feed.
+var feedTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/feed+json": true,
+	"text/xml":              true,
+	"application/xml":       true,
+}
+
+// maxSize is the largest response we'll read.
+const maxSize = 4 * 1024 * 1024
+
+// Candidate is a feed we found.
+type Candidate struct {
+
+	// URL is the location of the feed.
+	URL string
+
+	// Title is the title of the feed.
+	Title string
+
+	// Entries is the number of entries the feed contains.
+	Entries int
+}
+
+// fetch downloads the given URL, returning the body of the response.
+func fetch(client *http.Client, link string) ([]byte, string, error) {
+
+	req, err := http.NewRequest("GET", link, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("User-Agent", config.Get(config.UserAgent))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, "", fmt.Errorf("failed to fetch %s: %s", link, resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSize))
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Report the URL we ended up at, after any redirections.
+	return data, resp.Request.URL.String(), nil
+}
+
+// parse returns a candidate if the given data is a feed.
+func parse(link string, data []byte) (*Candidate, bool) {
+
+	feed, err := gofeed.NewParser().Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, false
+	}
+	return &Candidate{URL: link, Title: strings.TrimSpace(feed.Title), Entries: len(feed.Items)}, true
+}
+
+// advertised returns the feeds the given HTML page links to.
+func advertised(base *url.URL, data []byte) []string {
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+
+	var out []string
+	doc.Find("link[rel~=alternate]").Each(func(i int, s *goquery.Selection) {
+		kind, _ := s.Attr("type")
+		href, _ := s.Attr("href")
+		if href == "" || !feedTypes[strings.ToLower(strings.TrimSpace(kind))] {
+			return
+		}
+
+		ref, err := base.Parse(strings.TrimSpace(href))
+		if err == nil {
+			out = append(out, ref.String())
+		}
+	})
+	return out
+}
+
+// wellKnown returns the feeds which popular services publish for the
+// given page.
+func wellKnown(u *url.URL) []string {
+
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	parts := strings.FieldsFunc(u.Path, func(r rune) bool { return r == '/' })
+
+	switch {
+	case host == "github.com" && len(parts) >= 2:
+		repo := "https://github.com/" + parts[0] + "/" + parts[1]
+		return []string{repo + "/releases.atom", repo + "/tags.atom", repo + "/commits.atom"}
+
+	case host == "github.com" && len(parts) == 1:
+		return []string{"https://github.com/" + parts[0] + ".atom"}
+
+	case (host == "reddit.com" || strings.HasSuffix(host, ".reddit.com")) && len(parts) >= 2 && (parts[0] == "r" || parts[0] == "u" || parts[0] == "user"):
+		return []string{"https://www.reddit.com/" + parts[0] + "/" + parts[1] + "/.rss"}
+
+	case host == "youtube.com" && len(parts) >= 2 && parts[0] == "channel":
+		return []string{"https://www.youtube.com/feeds/videos.xml?channel_id=" + url.QueryEscape(parts[1])}
+
+	case host == "youtube.com" && u.Query().Get("list") != "":
+		return []string{"https://www.youtube.com/feeds/videos.xml?playlist_id=" + url.QueryEscape(u.Query().Get("list"))}
+
+	case host == "medium.com" && len(parts) >= 1:
+		return []string{"https://medium.com/feed/" + parts[0]}
+
+	case strings.HasSuffix(host, ".substack.com"):
+		return []string{"https://" + host + "/feed"}
+	}
+
+	return nil
+}
+
+// keyword returns the feeds popular services publish for the given
+// keyword, which is not a site.
+func keyword(word string) []string {
+	word = url.PathEscape(strings.ToLower(word))
+
+	return []string{
+		"https://www.reddit.com/r/" + word + "/.rss",
+		"https://" + word + ".substack.com/feed",
+		"https://medium.com/feed/tag/" + word,
+		"https://" + word + ".com/feed",
+	}
+}
+
+// Discover returns the feeds found for the given input, which is the URL
+// of a site or page, a hostname, or a keyword.
+//
+// Feeds the page advertises come first, then those we found by probing.
+func Discover(input string) ([]Candidate, error) {
+
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil, fmt.Errorf("nothing to discover")
+	}
+
+	client, err := network.HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	client.Timeout = 30 * time.Second
+
+	// A keyword, rather than a site?
+	if !strings.Contains(input, ".") && !strings.Contains(input, "/") {
+		return probe(client, keyword(input)), nil
+	}
+
+	if !strings.Contains(input, "://") {
+		input = "https://" + input
+	}
+	u, err := url.Parse(input)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid URL %s", input)
+	}
+
+	var links []string
+
+	// Fetch the page itself, which might be a feed, or advertise some.
+	data, final, err := fetch(client, u.String())
+	if err == nil {
+		if c, ok := parse(final, data); ok {
+			return []Candidate{*c}, nil
+		}
+
+		base, perr := url.Parse(final)
+		if perr == nil {
+			u = base
+		}
+		links = append(links, advertised(u, data)...)
+	}
+
+	links = append(links, wellKnown(u)...)
+	for _, path := range commonPaths {
+		links = append(links, u.Scheme+"://"+u.Host+path)
+	}
+
+	found := probe(client, links)
+	if len(found) == 0 && err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// Advertised returns the feeds advertised by the page at the given URL,
+// via <link rel="alternate"> tags, or the page itself if it is a feed.
+//
+// Unlike Discover we don't go looking for feeds the page doesn't
+// mention.
+func Advertised(link string) ([]Candidate, error) {
+
+	client, err := network.HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	client.Timeout = 30 * time.Second
+
+	data, final, err := fetch(client, link)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := parse(final, data); ok {
+		return []Candidate{*c}, nil
+	}
+
+	base, err := url.Parse(final)
+	if err != nil {
+		return nil, err
+	}
+	return probe(client, advertised(base, data)), nil
+}
+
+// probe fetches each of the given links, in parallel, and returns those
+// which are feeds, in the same order.
+//
+// The same feed is often available at several locations, so feeds with
+// the same title and number of entries are only returned once.
+func probe(client *http.Client, links []string) []Candidate {
+
+	results := make([]*Candidate, len(links))
+
+	var wg sync.WaitGroup
+	for i, link := range links {
+		wg.Add(1)
+		go func(i int, link string) {
+			defer wg.Done()
+
+			data, final, err := fetch(client, link)
+			if err != nil {
+				return
+			}
+			if c, ok := parse(final, data); ok {
+				results[i] = c
+			}
+		}(i, link)
+	}
+	wg.Wait()
+
+	var out []Candidate
+	seen := make(map[string]bool)
+	for _, c := range results {
+		if c == nil {
+			continue
+		}
+
+		key := fmt.Sprintf("%s\n%d", c.Title, c.Entries)
+		if seen[c.URL] || seen[key] {
+			continue
+		}
+		seen[c.URL] = true
+		seen[key] = true
+
+		out = append(out, *c)
+	}
+	return out
+}
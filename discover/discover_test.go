@@ -0,0 +1,151 @@
+package discover
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// rss returns a trivial RSS feed, with the given title.
+func rss(title string, entries int) string {
+	items := ""
+	for i := 0; i < entries; i++ {
+		items += fmt.Sprintf("<item><title>%d</title><link>https://example.com/%d</link></item>", i, i)
+	}
+	return `<?xml version="1.0"?><rss version="2.0"><channel><title>` + title + `</title>` + items + `</channel></rss>`
+}
+
+// TestDiscover ensures that we find advertised and common feeds.
+func TestDiscover(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><head>
+<link rel="alternate" type="application/rss+xml" href="/posts.rss">
+<link rel="alternate" type="text/html" href="/fr/">
+<link rel="stylesheet" type="application/rss+xml" href="/nope.rss">
+</head><body>Hello</body></html>`)
+		case "/posts.rss":
+			fmt.Fprint(w, rss("Posts", 2))
+		case "/feed", "/rss.xml":
+			// The same feed, again.
+			fmt.Fprint(w, rss("Posts", 2))
+		case "/atom.xml":
+			fmt.Fprint(w, `<?xml version="1.0"?><feed xmlns="http://www.w3.org/2005/Atom"><title>Comments</title></feed>`)
+		case "/rss":
+			fmt.Fprint(w, "<html><body>Not a feed</body></html>")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	found, err := Discover(ts.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []Candidate{
+		{URL: ts.URL + "/posts.rss", Title: "Posts", Entries: 2},
+		{URL: ts.URL + "/atom.xml", Title: "Comments", Entries: 0},
+	}
+	if !reflect.DeepEqual(found, expected) {
+		t.Fatalf("unexpected candidates %v", found)
+	}
+
+	// A feed is itself.
+	found, err = Discover(ts.URL + "/atom.xml")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(found) != 1 || found[0].Title != "Comments" {
+		t.Fatalf("unexpected candidates %v", found)
+	}
+
+	// Nothing at all.
+	_, err = Discover("")
+	if err == nil {
+		t.Fatalf("expected an error with no input")
+	}
+}
+
+// TestAdvertised ensures we find only the feeds a page advertises.
+func TestAdvertised(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><head>
+<link rel="alternate" type="application/atom+xml" href="/atom.xml">
+<link rel="alternate" type="application/rss+xml" href="posts.rss">
+<link rel="alternate" type="application/rss+xml" href="/missing.rss">
+</head><body>Hello</body></html>`)
+		case "/posts.rss", "/feed":
+			fmt.Fprint(w, rss("Posts", 2))
+		case "/atom.xml":
+			fmt.Fprint(w, `<?xml version="1.0"?><feed xmlns="http://www.w3.org/2005/Atom"><title>Comments</title></feed>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	found, err := Advertised(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []Candidate{
+		{URL: ts.URL + "/atom.xml", Title: "Comments", Entries: 0},
+		{URL: ts.URL + "/posts.rss", Title: "Posts", Entries: 2},
+	}
+	if !reflect.DeepEqual(found, expected) {
+		t.Fatalf("unexpected candidates %v", found)
+	}
+
+	// A feed is itself.
+	found, err = Advertised(ts.URL + "/posts.rss")
+	if err != nil || len(found) != 1 || found[0].Title != "Posts" {
+		t.Fatalf("unexpected candidates %v %v", found, err)
+	}
+
+	// A page which can't be fetched is an error.
+	_, err = Advertised(ts.URL + "/missing")
+	if err == nil {
+		t.Fatalf("expected an error for a missing page")
+	}
+}
+
+// TestWellKnown tests the feeds we know of for popular services.
+func TestWellKnown(t *testing.T) {
+
+	tests := map[string][]string{
+		"https://github.com/skx/rss2email/issues": {
+			"https://github.com/skx/rss2email/releases.atom",
+			"https://github.com/skx/rss2email/tags.atom",
+			"https://github.com/skx/rss2email/commits.atom",
+		},
+		"https://github.com/skx":                     {"https://github.com/skx.atom"},
+		"https://old.reddit.com/r/golang/":           {"https://www.reddit.com/r/golang/.rss"},
+		"https://www.reddit.com/r/golang/":           {"https://www.reddit.com/r/golang/.rss"},
+		"https://www.youtube.com/channel/UC123":      {"https://www.youtube.com/feeds/videos.xml?channel_id=UC123"},
+		"https://www.youtube.com/playlist?list=PL1":  {"https://www.youtube.com/feeds/videos.xml?playlist_id=PL1"},
+		"https://medium.com/@steve":                  {"https://medium.com/feed/@steve"},
+		"https://example.substack.com/p/hello-world": {"https://example.substack.com/feed"},
+		"https://blog.steve.fi/":                     nil,
+	}
+
+	for in, out := range tests {
+		u, err := url.Parse(in)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %s", in, err)
+		}
+		got := wellKnown(u)
+		if !reflect.DeepEqual(got, out) {
+			t.Errorf("%s: expected %v, got %v", in, out, got)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+//
+// Find the feeds published by a site.
+//
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/skx/rss2email/discover"
+	"github.com/skx/rss2email/feedlist"
+)
+
+// Structure for our options and state.
+type discoverCmd struct {
+
+	// Should we add the first feed found to our feed-list?
+	add bool
+}
+
+// Info is part of the subcommand-API
+func (d *discoverCmd) Info() (string, string) {
+	return "discover", `Find the feeds published by a site.
+
+This sub-command finds the feeds a site publishes, so that you don't need
+to hunt for them by hand.  Given a site, or page, we look for the feeds
+it advertises, probe the locations at which feeds are commonly found
+("/feed", "/rss", "/atom.xml", "/index.xml", etc), and know where popular
+services such as GitHub, Reddit, and YouTube publish theirs.
+
+Given a keyword, rather than a site, we look for a matching subreddit,
+Substack, or Medium tag.
+
+Each feed found is shown along with its title, and the number of entries
+it contains.  With '-add' the first, which is usually the main feed of
+the site, is added to your feed-list.
+
+Example:
+
+    $ rss2email discover blog.steve.fi
+    $ rss2email discover https://github.com/skx/rss2email
+    $ rss2email discover -add golang
+`
+}
+
+// Arguments handles our flag-setup.
+func (d *discoverCmd) Arguments(f *flag.FlagSet) {
+	f.BoolVar(&d.add, "add", false, "Add the first feed found to the feed-list.")
+}
+
+// Execute is invoked if the user specifies `discover` as the subcommand.
+func (d *discoverCmd) Execute(args []string) int {
+
+	if len(args) != 1 {
+		fmt.Printf("Usage: rss2email discover [-add] site|keyword\n")
+		return 1
+	}
+
+	found, err := discover.Discover(args[0])
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return 1
+	}
+
+	if len(found) == 0 {
+		fmt.Printf("No feeds were found for %s\n", args[0])
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "URL\tTITLE\tENTRIES\n")
+	for _, c := range found {
+		fmt.Fprintf(w, "%s\t%s\t%d\n", c.URL, c.Title, c.Entries)
+	}
+	w.Flush()
+
+	if !d.add {
+		return 0
+	}
+	if readOnly("add the feed") {
+		return 1
+	}
+
+	// Add the first feed to the list.
+	list := feedlist.New("")
+	for _, err := range list.Add(found[0].URL) {
+		fmt.Printf("%s\n", err.Error())
+	}
+
+	err = list.Save()
+	if err != nil {
+		fmt.Printf("failed to save the updated feed list: %s\n", err.Error())
+		return 1
+	}
+
+	fmt.Printf("\nAdded %s\n", found[0].URL)
+	return 0
+}
@@ -0,0 +1,64 @@
+//
+// Show the environmental variables we use for configuration.
+//
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/skx/rss2email/config"
+	"github.com/skx/subcommands"
+)
+
+// Structure for our options and state.
+type envCmd struct {
+
+	// We embed the NoFlags option, because we accept no command-line flags.
+	subcommands.NoFlags
+}
+
+// Info is part of the subcommand-API
+func (e *envCmd) Info() (string, string) {
+	return "env", `Show the environmental variables used for configuration.
+
+This sub-command lists each environmental variable which is consulted
+for configuration, along with a description, its default value, and the
+value which is currently set.  Secret values are masked.
+
+Each of these may also be set in the configuration file, which is named
+config.toml and lives alongside the feed-list.  Values in the environment
+take precedence over those in the file.
+
+Passwords may instead be read from a file, named by adding _FILE to the
+name of the variable (e.g. SMTP_PASSWORD_FILE), or from the OS keyring if
+KEYRING is set to "true".
+
+Example:
+
+    $ rss2email env
+`
+}
+
+// Execute is invoked if the user specifies `env` as the subcommand.
+func (e *envCmd) Execute(args []string) int {
+
+	fmt.Printf("Configuration file: %s\n", config.File())
+
+	for _, v := range config.Variables() {
+
+		fmt.Printf("\n")
+
+		current := config.Get(v.Name)
+		if v.Secret && config.IsSet(v.Name) {
+			current = "********"
+		}
+
+		fmt.Printf("%s\n", v.Name)
+		fmt.Printf("\t%s\n", v.Description)
+		fmt.Printf("\tDefault: %q\n", v.Default)
+		fmt.Printf("\tCurrent: %q (%s)\n", current, config.Source(v.Name))
+	}
+
+	return 0
+}
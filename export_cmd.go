@@ -7,7 +7,6 @@ package main
 import (
 	"fmt"
 	"os"
-	"text/template"
 
 	"github.com/skx/rss2email/feedlist"
 	"github.com/skx/subcommands"
@@ -35,41 +34,12 @@ Example:
 // Execute is invoked if the user specifies `add` as the subcommand.
 func (e *exportCmd) Execute(args []string) int {
 
-	// Individual feed URL
-	type Feed struct {
-		URL string
-	}
-
-	// Template Data
-	type TemplateData struct {
-		Entries []Feed
-	}
-	data := TemplateData{}
-
 	// Get the feed-list, from the default location.
 	list := feedlist.New("")
 
-	for _, entry := range list.Entries() {
-		data.Entries = append(data.Entries, Feed{URL: entry})
-	}
-
-	// Template
-	tmpl := `<?xml version="1.0" encoding="utf-8"?>
-<opml version="1.0">
-<head>
-<title>Feed Export</title>
-</head>
-<body>
-{{range .Entries}}<outline xmlUrl="{{.URL}}"/>
-{{end}}
-</body>
-</opml>
-`
-	// Compile the template and write to STDOUT
-	t := template.Must(template.New("tmpl").Parse(tmpl))
-	err := t.Execute(os.Stdout, data)
+	err := list.WriteOPML(os.Stdout)
 	if err != nil {
-		fmt.Printf("error rendering template: %s\n", err.Error())
+		fmt.Printf("%s\n", err.Error())
 		return 1
 	}
 
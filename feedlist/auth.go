@@ -0,0 +1,201 @@
+package feedlist
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Redact returns the given URL with any password it contains hidden, so
+// that it is safe to show, or to record.
+func Redact(link string) string {
+	u, err := url.Parse(link)
+	if err != nil || u.User == nil {
+		return link
+	}
+	return u.Redacted()
+}
+
+// WithCredentials returns the given URL with the given credentials, as
+// "username:password", added to it.  These are used to authenticate when
+// the feed is fetched.
+func WithCredentials(link string, credentials string) (string, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+
+	parts := strings.SplitN(credentials, ":", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", fmt.Errorf("invalid credentials, expected \"username:password\"")
+	}
+
+	u.User = url.UserPassword(parts[0], parts[1])
+	return u.String(), nil
+}
+
+// splitCredentials returns the given URL without any credentials it
+// contains, along with them.
+func splitCredentials(link string) (string, *url.Userinfo) {
+	u, err := url.Parse(link)
+	if err != nil || u.User == nil {
+		return link, nil
+	}
+
+	user := u.User
+	u.User = nil
+	return u.String(), user
+}
+
+// authorization returns the Authorization header with which we should
+// answer the challenges of the given response, using the given
+// credentials.
+//
+// Digest authentication is preferred to Basic, if the server supports
+// both, as it doesn't reveal the password.
+func authorization(resp *http.Response, user *url.Userinfo) (string, error) {
+
+	password, _ := user.Password()
+
+	basic := false
+	for _, challenge := range resp.Header.Values("WWW-Authenticate") {
+		scheme := strings.ToLower(strings.SplitN(strings.TrimSpace(challenge), " ", 2)[0])
+		switch scheme {
+		case "digest":
+			return digest(challenge, user.Username(), password, resp.Request.Method, resp.Request.URL.RequestURI())
+		case "basic":
+			basic = true
+		}
+	}
+
+	if !basic {
+		return "", fmt.Errorf("unsupported authentication scheme %q", resp.Header.Get("WWW-Authenticate"))
+	}
+
+	req := &http.Request{Header: make(http.Header)}
+	req.SetBasicAuth(user.Username(), password)
+	return req.Header.Get("Authorization"), nil
+}
+
+// challengeParams parses the parameters of a challenge, `Digest
+// realm="x", nonce="y"`, which may contain quoted commas.
+func challengeParams(challenge string) map[string]string {
+
+	params := make(map[string]string)
+
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	if len(parts) != 2 {
+		return params
+	}
+	s := parts[1]
+
+	for s != "" {
+		s = strings.TrimLeft(s, " ,")
+		eq := strings.Index(s, "=")
+		if eq < 0 {
+			break
+		}
+		name := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = s[eq+1:]
+
+		value := ""
+		if strings.HasPrefix(s, `"`) {
+			end := 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				value = strings.Replace(s[1:], `\`, "", -1)
+				s = ""
+			} else {
+				value = strings.Replace(s[1:end], `\`, "", -1)
+				s = s[end+1:]
+			}
+		} else {
+			end := strings.Index(s, ",")
+			if end < 0 {
+				end = len(s)
+			}
+			value = strings.TrimSpace(s[:end])
+			s = s[end:]
+		}
+		params[name] = value
+	}
+
+	return params
+}
+
+// digest returns the Authorization header which answers the given Digest
+// challenge, as described by RFC 7616.
+func digest(challenge, username, password, method, uri string) (string, error) {
+
+	params := challengeParams(challenge)
+
+	var h func() hash.Hash
+	algorithm := params["algorithm"]
+	switch strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS") {
+	case "", "MD5":
+		h = md5.New
+	case "SHA-256":
+		h = sha256.New
+	default:
+		return "", fmt.Errorf("unsupported digest algorithm %q", algorithm)
+	}
+	H := func(s string) string {
+		x := h()
+		x.Write([]byte(s))
+		return fmt.Sprintf("%x", x.Sum(nil))
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	cnonce := fmt.Sprintf("%x", buf)
+	nc := "00000001"
+	nonce := params["nonce"]
+
+	ha1 := H(username + ":" + params["realm"] + ":" + password)
+	if strings.HasSuffix(strings.ToUpper(algorithm), "-SESS") {
+		ha1 = H(ha1 + ":" + nonce + ":" + cnonce)
+	}
+	ha2 := H(method + ":" + uri)
+
+	qop := ""
+	for _, q := range strings.Split(params["qop"], ",") {
+		if strings.TrimSpace(q) == "auth" {
+			qop = "auth"
+		}
+	}
+	if params["qop"] != "" && qop == "" {
+		return "", fmt.Errorf("unsupported digest qop %q", params["qop"])
+	}
+
+	var response string
+	if qop != "" {
+		response = H(ha1 + ":" + nonce + ":" + nc + ":" + cnonce + ":" + qop + ":" + ha2)
+	} else {
+		response = H(ha1 + ":" + nonce + ":" + ha2)
+	}
+
+	out := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+		username, params["realm"], nonce, uri, response)
+	if algorithm != "" {
+		out += ", algorithm=" + algorithm
+	}
+	if qop != "" {
+		out += fmt.Sprintf(`, qop=%s, nc=%s, cnonce="%s"`, qop, nc, cnonce)
+	}
+	if opaque, ok := params["opaque"]; ok {
+		out += fmt.Sprintf(`, opaque="%s"`, opaque)
+	}
+	return out, nil
+}
@@ -0,0 +1,207 @@
+package feedlist
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skx/rss2email/atomicfile"
+	"github.com/skx/rss2email/config"
+)
+
+// cachedHeaders are the headers of a response we keep alongside its body,
+// those we need to decode it, to revalidate it, and to find its hub.
+var cachedHeaders = []string{"Content-Type", "Content-Encoding", "ETag", "Last-Modified", "Link"}
+
+// cacheEntry is a copy of a feed, as it was sent to us, so that it needn't
+// be downloaded again while it is fresh, or if it hasn't changed since.
+type cacheEntry struct {
+
+	// URL is where the body was finally fetched from, after any
+	// redirects.
+	URL string `json:"url"`
+
+	// MovedTo is where the feed had permanently moved to, if it had.
+	MovedTo string `json:"moved_to,omitempty"`
+
+	// Header holds the cachedHeaders of the response.
+	Header http.Header `json:"header"`
+
+	// Body is the body of the response, before it was decompressed.
+	Body []byte `json:"body"`
+
+	// Expires is the time the copy must be revalidated, zero if it
+	// must always be.
+	Expires time.Time `json:"expires"`
+}
+
+// cacheEnabled returns true unless FEED_CACHE has turned off our cache.
+func cacheEnabled() bool {
+	return config.Get(config.FeedCache) != "false"
+}
+
+// cacheKey returns the name of the cache entry of the given feed.
+//
+// Any additional headers we send, such as cookies, form part of the key,
+// since they may change the response.
+func cacheKey(url string, header http.Header) string {
+
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	key := url
+	for _, name := range names {
+		key += "\n" + name + ": " + strings.Join(header[name], ", ")
+	}
+	return fmt.Sprintf("%x", sha1.Sum([]byte(key)))
+}
+
+// cachePath returns the file which holds the given cache entry.
+func cachePath(key string) string {
+	return filepath.Join(config.StateDirectory(), "cache", key+".json")
+}
+
+// loadCache returns the cache entry with the given key, or nil if there
+// is none, or it cannot be read.
+func loadCache(key string) *cacheEntry {
+
+	data, err := ioutil.ReadFile(cachePath(key))
+	if err != nil {
+		return nil
+	}
+
+	e := &cacheEntry{}
+	if json.Unmarshal(data, e) != nil || e.URL == "" {
+		return nil
+	}
+	return e
+}
+
+// save writes the cache entry to disk, with the given key.
+//
+// It may hold private feeds, so only we may read it.
+func (e *cacheEntry) save(key string) error {
+
+	file := cachePath(key)
+
+	err := os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create cache directory: %s", err.Error())
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	err = atomicfile.WriteFile(file, data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry: %s", err.Error())
+	}
+	return nil
+}
+
+// fresh returns true if the entry may be used without asking the server
+// whether it has changed.
+func (e *cacheEntry) fresh(now time.Time) bool {
+	return now.Before(e.Expires)
+}
+
+// unchanged returns true if the state's validators, recorded when the
+// feed was last processed, match those of the entry.
+func (e *cacheEntry) unchanged(etag string, lastModified string) bool {
+	if etag != "" {
+		return etag == e.Header.Get("ETag")
+	}
+	return lastModified != "" && lastModified == e.Header.Get("Last-Modified")
+}
+
+// expiry returns the time a response with the given headers stops being
+// fresh, zero if it must always be revalidated, or false if it mustn't be
+// stored at all.
+//
+// A response is fresh for the max-age of its Cache-Control header, or
+// failing that until its Expires header.
+func expiry(header http.Header, now time.Time) (time.Time, bool) {
+
+	maxAge, noCache := -1, false
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value := strings.TrimSpace(directive), ""
+		if i := strings.Index(name, "="); i >= 0 {
+			name, value = strings.TrimSpace(name[:i]), strings.Trim(strings.TrimSpace(name[i+1:]), `"`)
+		}
+		switch strings.ToLower(name) {
+		case "no-store":
+			return time.Time{}, false
+		case "no-cache":
+			noCache = true
+		case "max-age":
+			if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+				maxAge = secs
+			}
+		}
+	}
+
+	switch {
+	case noCache:
+		return time.Time{}, true
+	case maxAge >= 0:
+		age, _ := strconv.Atoi(header.Get("Age"))
+		if age < 0 {
+			age = 0
+		}
+		return now.Add(time.Duration(maxAge-age) * time.Second), true
+	}
+
+	// An invalid date means the response has already expired.
+	t, err := http.ParseTime(header.Get("Expires"))
+	if err != nil {
+		return time.Time{}, true
+	}
+	return t, true
+}
+
+// newCacheEntry returns an entry for the given response, without its
+// body, or nil if it mustn't, or needn't, be stored.
+//
+// We only keep responses which are fresh, or which have validators we can
+// use to revalidate them.
+func newCacheEntry(resp *http.Response, now time.Time) *cacheEntry {
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Vary") == "*" {
+		return nil
+	}
+
+	expires, ok := expiry(resp.Header, now)
+	if !ok {
+		return nil
+	}
+
+	e := &cacheEntry{URL: resp.Request.URL.String(), Header: http.Header{}, Expires: expires}
+	for _, name := range cachedHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			e.Header.Set(name, value)
+		}
+	}
+	if !e.fresh(now) && !e.revalidatable() {
+		return nil
+	}
+	return e
+}
+
+// revalidatable returns true if the entry has validators which we may
+// send to the server, to ask whether it has changed.
+func (e *cacheEntry) revalidatable() bool {
+	return e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != ""
+}
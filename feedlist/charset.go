@@ -0,0 +1,118 @@
+package feedlist
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+)
+
+// utf8BOM is the byte-order mark of UTF-8, which our parser doesn't
+// expect.
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// xmlDeclaration matches the XML declaration at the start of a document,
+// capturing the encoding it declares.
+var xmlDeclaration = regexp.MustCompile(`^\s*<\?xml[^>]*?encoding\s*=\s*["']([A-Za-z0-9._:-]+)["'][^>]*\?>`)
+
+// toUTF8 returns a reader of the given body as UTF-8, transcoding it from
+// the character set it uses.
+//
+// The character set is found from a byte-order mark, or the charset of
+// the Content-Type header, or the encoding the XML declaration names.
+// As servers often claim UTF-8 regardless of what they send the latter
+// wins if the body isn't valid UTF-8.  Failing all of those we assume
+// UTF-8, or Windows-1252 if the body isn't valid UTF-8.
+//
+// If we transcode a document its XML declaration is updated to match.
+func toUTF8(body io.Reader, contentType string) (io.Reader, error) {
+
+	br := bufio.NewReaderSize(body, 4096)
+	head, err := br.Peek(1024)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	valid := validUTF8(head)
+
+	var label string
+	switch {
+	case bytes.HasPrefix(head, utf8BOM):
+		br.Discard(len(utf8BOM))
+		return br, nil
+	case bytes.HasPrefix(head, []byte("\xfe\xff")):
+		label = "utf-16be"
+	case bytes.HasPrefix(head, []byte("\xff\xfe")):
+		label = "utf-16le"
+	}
+
+	declared := ""
+	if m := xmlDeclaration.FindSubmatch(head); m != nil {
+		declared = string(m[1])
+	}
+
+	if label == "" {
+		if _, params, err := mime.ParseMediaType(contentType); err == nil {
+			label = params["charset"]
+		}
+	}
+	if label == "" || (isUTF8(label) && !valid && declared != "") {
+		label = declared
+	}
+	if label == "" && !valid {
+		label = "windows-1252"
+	}
+	if label == "" || (isUTF8(label) && valid) {
+		return br, nil
+	}
+
+	enc, _ := charset.Lookup(label)
+	if enc == nil {
+		return nil, fmt.Errorf("unsupported character set %q", label)
+	}
+	out := bufio.NewReaderSize(enc.NewDecoder().Reader(br), 4096)
+
+	// The byte-order mark is no longer needed, and the declaration
+	// must no longer name the old encoding, or the parser will try to
+	// transcode it again.
+	decoded, err := out.Peek(1024)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if bytes.HasPrefix(decoded, utf8BOM) {
+		out.Discard(len(utf8BOM))
+		decoded = decoded[len(utf8BOM):]
+	}
+	loc := xmlDeclaration.FindSubmatchIndex(decoded)
+	if loc == nil {
+		return out, nil
+	}
+	declaration := string(decoded[loc[0]:loc[2]]) + "utf-8" + string(decoded[loc[3]:loc[1]])
+	out.Discard(loc[1])
+	return io.MultiReader(strings.NewReader(declaration), out), nil
+}
+
+// isUTF8 returns true if the label names UTF-8.
+func isUTF8(label string) bool {
+	return strings.EqualFold(label, "utf-8") || strings.EqualFold(label, "utf8")
+}
+
+// validUTF8 returns true if the given prefix of a document is valid
+// UTF-8, ignoring any rune which is cut short at its end.
+func validUTF8(head []byte) bool {
+	for i := len(head) - 1; i >= 0 && i > len(head)-4; i-- {
+		if head[i] < 0x80 {
+			break
+		}
+		if utf8.RuneStart(head[i]) {
+			head = head[:i]
+			break
+		}
+	}
+	return utf8.Valid(head)
+}
@@ -0,0 +1,152 @@
+package feedlist
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/skx/rss2email/config"
+)
+
+// IsCommand returns true if the given feed is generated by running a
+// command, as in "exec:/usr/local/bin/make-feed", rather than fetched.
+func IsCommand(link string) bool {
+	return strings.HasPrefix(strings.ToLower(link), "exec:")
+}
+
+// runCommand runs the command which generates the given feed, returning
+// what it wrote to STDOUT.
+//
+// The command may be followed by arguments, separated by spaces.  If it
+// is a relative path, as in "exec:bin/make-feed", it is found in the
+// configuration directory, a bare name is searched for in $PATH, and a
+// leading "~" in it, or its arguments, is the home directory.  It must
+// finish within FETCH_TIMEOUT, and write no more than limit bytes, unless
+// that is zero.
+func runCommand(ctx context.Context, link string, limit int64) ([]byte, error) {
+
+	args := strings.Fields(link[len("exec:"):])
+	if len(args) == 0 {
+		return nil, fmt.Errorf("no command named")
+	}
+	for i, arg := range args {
+		args[i] = expandHome(arg)
+	}
+	if strings.Contains(args[0], "/") && !filepath.IsAbs(args[0]) {
+		args[0] = filepath.Join(config.ConfigDirectory(), args[0])
+	}
+
+	timeout, err := fetchTimeout()
+	if err != nil {
+		return nil, err
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+
+	// We use pipes of our own, rather than letting exec copy the output
+	// for us, so that we may stop reading if the command outlives its
+	// timeout, even if a child it started still holds them open.
+	stdout, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer stdout.Close()
+	cmd.Stdout = w
+
+	stderr, ew, err := os.Pipe()
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	defer stderr.Close()
+	cmd.Stderr = ew
+
+	// Only the command needs the ends it writes to.
+	err = cmd.Start()
+	w.Close()
+	ew.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var out io.Reader = stdout
+	var limited *limitedReader
+	if limit > 0 {
+		limited = newLimitedReader(out, limit)
+		out = limited
+	}
+	output := readAll(out, 0)
+	messages := readAll(stderr, 4096)
+
+	var res, msg readResult
+	select {
+	case res = <-output:
+	case <-ctx.Done():
+		stdout.Close()
+		res = <-output
+	}
+	select {
+	case msg = <-messages:
+	case <-ctx.Done():
+		stderr.Close()
+		msg = <-messages
+	}
+	data, err := res.data, res.err
+
+	// Don't wait for a command which is writing too much.
+	if limited != nil && limited.exceeded {
+		cancel()
+		cmd.Wait()
+		return nil, fmt.Errorf("the feed is larger than %d bytes", limit)
+	}
+
+	if werr := cmd.Wait(); werr != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("command timed out after %s", timeout)
+		}
+		if text := strings.TrimSpace(string(msg.data)); text != "" {
+			return nil, fmt.Errorf("%s: %s", werr.Error(), text)
+		}
+		return nil, werr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readResult is what readAll read, and why it stopped.
+type readResult struct {
+	data []byte
+	err  error
+}
+
+// readAll reads everything from the given reader in the background,
+// sending the result upon the channel it returns.  If keep is non-zero
+// only that many bytes are kept, and the rest discarded.
+func readAll(r io.Reader, keep int64) <-chan readResult {
+	ch := make(chan readResult, 1)
+	go func() {
+		if keep == 0 {
+			data, err := ioutil.ReadAll(r)
+			ch <- readResult{data, err}
+			return
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(r, keep))
+		if err == nil {
+			_, err = io.Copy(ioutil.Discard, r)
+		}
+		ch <- readResult{data, err}
+	}()
+	return ch
+}
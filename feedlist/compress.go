@@ -0,0 +1,43 @@
+package feedlist
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// acceptEncoding lists the content-encodings we can decompress.
+const acceptEncoding = "gzip, deflate"
+
+// decompress returns a reader of the decompressed content of a response
+// body, which was sent with the given content-encoding.
+//
+// Servers disagree on what "deflate" means, RFC 9110 says it is zlib
+// data, but some send raw deflate data, so we accept either.
+func decompress(body io.Reader, encoding string) (io.Reader, error) {
+
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		r := bufio.NewReader(body)
+		header, err := r.Peek(2)
+		if err != nil {
+			return nil, err
+		}
+
+		// A zlib header is a multiple of 31, with the deflate method.
+		if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			return zlib.NewReader(r)
+		}
+		return flate.NewReader(r), nil
+	default:
+		return nil, fmt.Errorf("unsupported content-encoding %q", encoding)
+	}
+}
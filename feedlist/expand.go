@@ -0,0 +1,80 @@
+package feedlist
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// variable matches a reference to an environment variable within a feed,
+// as in "${TOKEN}", whose braces may have been escaped when the URL was
+// parsed.  The bare "$TOKEN" isn't expanded, as "$" may appear within
+// URLs.
+var variable = regexp.MustCompile(`\$(?:\{|%7[Bb])([A-Za-z_][A-Za-z0-9_]*)(?:\}|%7[Dd])`)
+
+// hasVariables returns true if the given feed refers to environment
+// variables, and so must be expanded before it is fetched.
+func hasVariables(link string) bool {
+	return variable.MatchString(link)
+}
+
+// Expand returns the given feed with the environment variables it refers
+// to, as in "https://example.com/feed?key=${TOKEN}", replaced by their
+// values, so that secrets needn't be stored within the feed-list.  It is
+// an error if a variable isn't set.
+//
+// Feeds are only expanded as they are fetched, everywhere else they are
+// known by their unexpanded URLs.  The errors, copies, and state which
+// result from fetching them are given the unexpanded URL too, via
+// conceal, so the values are never shown, or recorded.
+func Expand(link string) (string, error) {
+	var missing []string
+
+	out := variable.ReplaceAllStringFunc(link, func(ref string) string {
+		name := variable.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("the environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+// conceal returns the given text, describing the given feed once it was
+// expanded, with the values of the variables the feed refers to replaced
+// by references to them, as they appear within the feed.  Values are
+// found escaped as they would be within a URL, as well as verbatim.
+func conceal(link string, text string) string {
+	for _, match := range variable.FindAllStringSubmatch(link, -1) {
+		value := os.Getenv(match[1])
+		if value == "" {
+			continue
+		}
+		for _, form := range []string{value, url.QueryEscape(value), url.PathEscape(value)} {
+			text = strings.ReplaceAll(text, form, "${"+match[1]+"}")
+		}
+	}
+	return text
+}
+
+// expandHome returns the given path with a leading "~" replaced by the
+// home directory of the current user.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
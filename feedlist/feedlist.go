@@ -3,96 +3,622 @@
 package feedlist
 
 import (
-	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
-	"os/user"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 
 	"github.com/mmcdole/gofeed"
+	"github.com/skx/rss2email/atomicfile"
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/feedstate"
+	"github.com/skx/rss2email/network"
+	"github.com/skx/rss2email/scrape"
 )
 
-// fetchFeed fetches a feed from the remote URL.
+// HTTPError is returned when a feed could not be fetched because the
+// remote server responded with an unsuccessful status-code.
+type HTTPError struct {
+
+	// URL is the feed which was being fetched.
+	URL string
+
+	// StatusCode is the HTTP status-code of the response.
+	StatusCode int
+
+	// Status is the HTTP status-line of the response.
+	Status string
+
+	// RetryAfter is the time the server asked us to wait before
+	// trying again, if any.
+	RetryAfter time.Duration
+}
+
+// Error is part of the error-interface.
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("error processing %s - %s", Redact(e.URL), e.Status)
+}
+
+// Permanent returns true if the error is one which is not expected to
+// go away if the request is retried, including a refusal of our
+// credentials.
+//
+// Server errors, along with "408 Request Timeout" and "429 Too Many
+// Requests", may be temporary, but other client errors are not.
+func (e *HTTPError) Permanent() bool {
+	switch e.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return e.StatusCode >= 400 && e.StatusCode < 500
+}
+
+// DuplicateError is returned by Add when a feed is already in the list,
+// under another spelling of its URL.
+type DuplicateError struct {
+
+	// URL is the feed which wasn't added.
+	URL string
+
+	// Existing is the spelling of the feed in the list.
+	Existing string
+}
+
+// Error is part of the error-interface.
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("%s: not added, it is already present as %s", Redact(e.URL), Redact(e.Existing))
+}
+
+// ParseError is returned when a feed was fetched, or read, but couldn't
+// be parsed.
+type ParseError struct {
+
+	// URL is the feed which was being parsed.
+	URL string
+
+	// Err is the reason the feed couldn't be parsed.
+	Err error
+}
+
+// Error is part of the error-interface.
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("error parsing %s contents: %s", Redact(e.URL), e.Err.Error())
+}
+
+// ErrNotModified is returned by FeedConditional if the feed hasn't
+// changed since it was last fetched.
+var ErrNotModified = errors.New("feed not modified")
+
+// fetchFeed fetches a feed from the remote URL, and parses it.
 //
 // We must use this instead of the URL handler that the feed-parser supports
 // because reddit, and some other sites, will just return a HTTP error-code
 // if we're using a standard "spider" User-Agent.
 //
-func fetchFeed(url string) (string, error) {
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
+// The response is parsed as it is streamed, rather than being read into
+// memory first.  A feed larger than the limit, or FEED_MAX_SIZE if that
+// is smaller, either as it is sent or once decompressed, is refused.
+//
+// If there is state we make a conditional request, using the validators
+// it holds, and they're updated from the response.
+//
+// If the URL contains credentials they are used to authenticate, via
+// Basic or Digest authentication, if the server asks us to.
+//
+// Any additional headers are sent with the request, replacing those we'd
+// otherwise set.
+//
+// The whole fetch, including reading the body, must complete within
+// FETCH_TIMEOUT, and is abandoned if the context is cancelled.
+//
+// If we were redirected, and every redirect was permanent, the state
+// records where the feed has moved to.  It also records the hints an RSS
+// feed gives about how often it should be fetched, and the WebSub hub a
+// feed advertises.
+//
+// Feeds named by file:// URLs, or "-" for STDIN, are read rather than
+// fetched, via readLocal.
+//
+// Unless FEED_CACHE is "false" we keep a copy of the feed, which is used
+// without contacting the server while its Cache-Control header says it is
+// fresh, and is revalidated via its ETag, or Last-Modified date, after.
+// The copy is held in memory as the feed is read, so no copy is kept, or
+// used, when the caller limits the size of the feed to save memory.
+func fetchFeed(url string, opts FetchOptions) (*gofeed.Feed, error) {
+	limit, state, header := opts.Limit, opts.State, opts.Header
+
+	if isLocal(url) {
+		return readLocal(url, opts)
+	}
+
+	client, err := network.HTTPClientWith(opts.Proxy, opts.TLS)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	req.Header.Set("User-Agent", "rss2email (https://github.com/skx/rss2email)")
-	resp, err := client.Do(req)
+	timeout, err := fetchTimeout()
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
 	}
-	defer resp.Body.Close()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
-	output, err := ioutil.ReadAll(resp.Body)
+	// The feed is fetched from its expanded URL, but otherwise known
+	// by the one within the feed-list.
+	shown := Redact(url)
+	expanded, err := Expand(url)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("error processing %s - %s", shown, err.Error())
+	}
+	target, user := splitCredentials(expanded)
+
+	// Find our copy of the feed, if we have one worth using.
+	var cached *cacheEntry
+	key := ""
+	if cacheEnabled() && limit == 0 {
+		key = cacheKey(url, header)
+		cached = loadCache(key)
+		if cached != nil && (opts.Revalidate || !cached.fresh(time.Now())) && !cached.revalidatable() {
+			cached = nil
+		}
 	}
-	return string(output), nil
-}
 
-func fetchFeedAndParse(url string) (*gofeed.Feed, error) {
+	// Note where the feed now lives, if each redirect we follow is
+	// permanent.
+	moved, permanent := "", true
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		switch req.Response.StatusCode {
+		case http.StatusMovedPermanently, http.StatusPermanentRedirect:
+			// Where a feed which refers to variables has moved
+			// to holds their values, so isn't recorded.
+			if permanent && !hasVariables(url) {
+				moved = req.URL.String()
+			}
+		default:
+			moved, permanent = "", false
+		}
+		return nil
+	}
+
+	get := func(authorization string) (*http.Response, error) {
+		moved, permanent = "", true
+
+		req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("User-Agent", config.Get(config.UserAgent))
+
+		// Setting this ourselves means Go won't decompress the response
+		// for us, but lets us accept deflate as well as gzip.
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		// Ask whether our copy has changed, if we have one, or
+		// whether the feed has changed since we last processed it.
+		etag, lastModified := "", ""
+		if cached != nil {
+			etag, lastModified = cached.Header.Get("ETag"), cached.Header.Get("Last-Modified")
+		} else if state != nil {
+			etag, lastModified = state.ETag, state.LastModified
+		}
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lastModified != "" {
+			req.Header.Set("If-Modified-Since", lastModified)
+		}
+
+		for name, values := range header {
+			req.Header[name] = values
+		}
 
-	// Fetch the URL
-	txt, err := fetchFeed(url)
+		return client.Do(req)
+	}
+
+	// The body we'll parse, the headers which describe it, and the
+	// page it came from.
+	var raw io.Reader
+	var rawHeader http.Header
+	var page string
+
+	// The copy of the feed we'll keep, once we've read it.
+	var store *cacheEntry
+	var stored bytes.Buffer
+
+	if cached != nil && cached.fresh(time.Now()) && !opts.Revalidate {
+		moved = cached.MovedTo
+	} else {
+		resp, err := get("")
+		if err != nil {
+			return nil, transientError{fmt.Errorf("error processing %s - %s", shown, conceal(url, err.Error()))}
+		}
+
+		// Answer the server's challenge, if we can.
+		if resp.StatusCode == http.StatusUnauthorized && user != nil {
+			authz, err := authorization(resp, user)
+			resp.Body.Close()
+			if err != nil {
+				return nil, fmt.Errorf("error processing %s - %s", shown, conceal(url, err.Error()))
+			}
+
+			resp, err = get(authz)
+			if err != nil {
+				return nil, transientError{fmt.Errorf("error processing %s - %s", shown, conceal(url, err.Error()))}
+			}
+		}
+		defer resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusNotModified && cached != nil:
+			// Our copy is still good, for as long as the
+			// server now says.
+			if expires, ok := expiry(resp.Header, time.Now()); ok {
+				cached.Expires, cached.MovedTo = expires, moved
+				cached.save(key)
+			}
+
+		case resp.StatusCode == http.StatusNotModified && state != nil:
+			state.MovedTo = moved
+			return nil, ErrNotModified
+
+		case resp.StatusCode < 200 || resp.StatusCode > 299:
+			return nil, &HTTPError{URL: url, StatusCode: resp.StatusCode, Status: resp.Status, RetryAfter: retryAfter(resp)}
+
+		default:
+			raw, rawHeader, page = resp.Body, resp.Header, resp.Request.URL.String()
+			if key != "" {
+				store = newCacheEntry(resp, time.Now())
+			}
+			if store != nil {
+				store.URL = conceal(url, store.URL)
+			}
+			if store != nil {
+				raw = io.TeeReader(raw, &stored)
+			}
+		}
+	}
+
+	// If we're using our copy, it may be that the feed hasn't changed
+	// since we last processed it.
+	if raw == nil {
+		if state != nil && cached.unchanged(state.ETag, state.LastModified) {
+			state.MovedTo = moved
+			return nil, ErrNotModified
+		}
+		raw, rawHeader, page = bytes.NewReader(cached.Body), cached.Header, cached.URL
+	}
+
+	// We refuse to read more than the limit, both as it is sent and
+	// once it has been decompressed.
+	max, err := maxFeedSize()
 	if err != nil {
-		return nil, fmt.Errorf("error processing %s - %s", url, err.Error())
+		return nil, err
+	}
+	if limit == 0 || (max > 0 && max < limit) {
+		limit = max
+	}
+	body := raw
+	var sent, decompressed *limitedReader
+	if limit > 0 {
+		sent = newLimitedReader(body, limit)
+		body = sent
+	}
+	tooLarge := func() error {
+		if (sent != nil && sent.exceeded) || (decompressed != nil && decompressed.exceeded) {
+			return fmt.Errorf("error processing %s - the feed is larger than %d bytes", shown, limit)
+		}
+		return nil
+	}
+
+	body, err = decompress(body, rawHeader.Get("Content-Encoding"))
+	if err != nil {
+		if err := tooLarge(); err != nil {
+			return nil, err
+		}
+		err = fmt.Errorf("error decompressing %s contents: %s", shown, err.Error())
+		if ctx.Err() != nil {
+			return nil, transientError{err}
+		}
+		return nil, err
+	}
+	if limit > 0 {
+		decompressed = newLimitedReader(body, limit)
+		body = decompressed
+	}
+
+	// Convert it to UTF-8, if it isn't already.
+	body, err = toUTF8(body, rawHeader.Get("Content-Type"))
+	if err != nil {
+		if err := tooLarge(); err != nil {
+			return nil, err
+		}
+		err = fmt.Errorf("error processing %s contents: %s", shown, err.Error())
+		if ctx.Err() != nil {
+			return nil, transientError{err}
+		}
+		return nil, err
 	}
 
-	// Parse it
-	fp := gofeed.NewParser()
-	feed, err := fp.ParseString(txt)
+	// Parse it, or scrape it if it's a page rather than a feed.
+	var feed *gofeed.Feed
+	hints := &hintTranslator{}
+	if opts.Scrape != nil {
+		feed, err = scrape.Parse(body, page, *opts.Scrape)
+	} else {
+		feed, err = hints.parser().Parse(body)
+	}
+	if err := tooLarge(); err != nil {
+		return nil, err
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error parsing %s contents: %s", url, err.Error())
+		// If we ran out of time the content was truncated,
+		// rather than being invalid.
+		err = &ParseError{URL: url, Err: err}
+		if ctx.Err() != nil {
+			return nil, transientError{err}
+		}
+		return nil, err
+	}
+
+	// Only once we have the feed are its validators worth keeping.
+	if state != nil {
+		state.ETag = rawHeader.Get("ETag")
+		state.LastModified = rawHeader.Get("Last-Modified")
+		state.MovedTo = moved
+		state.Schedule = hints.schedule
+		hints.header(rawHeader.Get("Link"))
+		state.Hub, state.Topic = hints.websub(page)
+
+		// The hub would be told the values of our variables, so
+		// such feeds are polled instead.
+		if hasVariables(url) {
+			state.Hub, state.Topic = "", ""
+		}
+	}
+
+	// Keep a copy, if we read all of it.  This is merely to save time,
+	// so a failure to do so isn't an error.
+	if store != nil {
+		rest := raw
+		if sent != nil {
+			rest = sent
+		}
+		if _, err := io.Copy(ioutil.Discard, rest); err == nil && tooLarge() == nil && ctx.Err() == nil {
+			store.Body, store.MovedTo = stored.Bytes(), moved
+			store.save(key)
+		}
 	}
 
 	return feed, nil
 }
 
-const (
-	fetchMaxTries   = 5
-	fetchRetryDelay = 200 * time.Millisecond
-)
+// fetchTimeout returns the maximum time fetching a feed may take.
+func fetchTimeout() (time.Duration, error) {
+	value := config.Get(config.FetchTimeout)
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid %s %q, expected a duration such as \"30s\"", config.FetchTimeout, value)
+	}
+	return timeout, nil
+}
 
 // Feed takes an URL as input, and returns a *gofeed.Feed.
 func Feed(url string) (*gofeed.Feed, error) {
+	return FeedLimited(url, 0)
+}
+
+// FeedLimited takes an URL as input, and returns a *gofeed.Feed, reading
+// no more than limit bytes from the remote server.  A limit of zero
+// means there is no limit.
+func FeedLimited(url string, limit int64) (*gofeed.Feed, error) {
+	return FeedConditional(url, limit, nil)
+}
+
+// FeedConditional takes an URL as input, and returns a *gofeed.Feed,
+// reading no more than limit bytes from the remote server.
+//
+// If state is non-nil the feed is only fetched if it has changed since
+// the validators within it were recorded, otherwise ErrNotModified is
+// returned.  When the feed is fetched they are updated, but it is up to
+// the caller to save the state.
+func FeedConditional(url string, limit int64, state *feedstate.State) (*gofeed.Feed, error) {
+	return FeedWith(url, FetchOptions{Limit: limit, State: state})
+}
+
+// FetchOptions control how a feed is fetched, by FeedWith.
+type FetchOptions struct {
+
+	// Limit is the most bytes to read from the remote server, zero
+	// means there is no limit.
+	Limit int64
+
+	// State holds the validators for a conditional request, as
+	// described for FeedConditional, if it is non-nil.
+	State *feedstate.State
+
+	// Header holds additional headers to send, such as API tokens or
+	// cookies.
+	Header http.Header
+
+	// Proxy is the proxy to fetch the feed via, as understood by
+	// network.HTTPClientVia, "" uses that of the environment.
+	Proxy string
+
+	// Context may be cancelled to abandon the fetch, and any retries.
+	Context context.Context
+
+	// TLS holds the settings used to verify the server, and to
+	// identify ourselves to it.
+	TLS network.TLS
+
+	// Scrape holds the rules to find the items within a page which
+	// isn't a feed, if it is non-nil.
+	Scrape *scrape.Rules
+
+	// Revalidate asks the server whether the feed has changed, even
+	// if our copy of it is fresh, as when we've been told it has.
+	Revalidate bool
+}
+
+// FeedWith takes an URL as input, and returns a *gofeed.Feed, fetched
+// according to the given options.
+func FeedWith(url string, opts FetchOptions) (*gofeed.Feed, error) {
 	var feed *gofeed.Feed
 	var err error
 
-	// Try up to fetchMaxTries times
-	for i := 0; i < fetchMaxTries; i++ {
-		// Rate limit to avoid hammering the server
-		time.Sleep(time.Duration(i) * fetchRetryDelay)
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	policy, err := loadRetryPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < policy.tries; i++ {
+
+		// Back off before retrying, to avoid hammering the server,
+		// unless we've been told to stop.
+		if i > 0 {
+			delay, ok := policy.backoff(i, err)
+			if !ok {
+				return nil, err
+			}
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return nil, fmt.Errorf("error processing %s - %s", Redact(url), ctx.Err().Error())
+			}
+		}
+
+		feed, err = fetchFeed(url, opts)
+		if err == nil || err == ErrNotModified {
+			return feed, err
+		}
 
-		feed, err = fetchFeedAndParse(url)
-		if err == nil {
-			return feed, nil
+		// There's no point retrying if the feed is gone, or
+		// broken, or we've been told to stop.
+		if !retryable(err) || ctx.Err() != nil {
+			return nil, err
 		}
 	}
 
 	return nil, err
 }
 
-// expandedEntry is a url with its comment from the feeds file.
-type expandedEntry struct {
-	// url is the feed's url
-	url string
+// Entry is a single feed from the feeds file, along with the comments
+// which precede it.
+type Entry struct {
+
+	// URL is the feed's url
+	URL string
+
+	// Comments contains the blank lines and comments preceding the url
+	Comments []string
+
+	// Inline contains the options which follow the url on the same
+	// line, as "key=value".
+	Inline []string
+
+	// file is the file the entry was read from, if it wasn't the
+	// feed-list itself.
+	file string
+}
+
+// Directives returns the values of the named directive within the
+// comments preceding the entry, followed by those of the inline option
+// of the same name.
+//
+// A directive is a comment of the form "#name value", with no space
+// between the "#" and the name, and an inline option is "name=value".
+func (e Entry) Directives(name string) []string {
+	var out []string
+
+	prefix := "#" + name
+	for _, c := range e.Comments {
+		if isDirective(c, name) {
+			out = append(out, strings.TrimSpace(c[len(prefix):]))
+		}
+	}
+	return append(out, e.inline(name)...)
+}
+
+// isDirective returns true if the given comment is the named directive.
+func isDirective(comment string, name string) bool {
+	prefix := "#" + name
+	if !strings.HasPrefix(comment, prefix) {
+		return false
+	}
+	rest := comment[len(prefix):]
+	return rest == "" || rest[0] == ' ' || rest[0] == '\t'
+}
+
+// disabledDirective is the directive which marks the following feed as
+// being disabled.  Any text following it is the reason the feed was
+// disabled.
+const disabledDirective = "disabled"
+
+// Disabled returns true if the entry has been disabled.
+func (e Entry) Disabled() bool {
+	return len(e.Directives(disabledDirective)) > 0
+}
+
+// tagDirective is the directive which tags the following feed, so that
+// it may be processed separately from the others.  Several tags may be
+// given, separated by commas or spaces.
+const tagDirective = "tag"
+
+// Tags returns the tags of the entry.
+func (e Entry) Tags() []string {
+	var out []string
+	for _, value := range e.Directives(tagDirective) {
+		out = append(out, strings.FieldsFunc(value, func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		})...)
+	}
+	return out
+}
+
+// HasTag returns true if the entry has any of the given tags, ignoring
+// case.
+func (e Entry) HasTag(tags ...string) bool {
+	for _, have := range e.Tags() {
+		for _, want := range tags {
+			if strings.EqualFold(have, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
 
-	// comments contains the blank lines and comments preceding the url
-	comments []string
+// State returns the persistent state of the feed, such as the number of
+// times it has recently been found to be missing.
+func (e Entry) State() *feedstate.State {
+	return feedstate.Load(e.URL)
 }
 
 // FeedList is the list of our feeds.
@@ -102,13 +628,49 @@ type FeedList struct {
 	filename string
 
 	// expandedEntries contains an array of feed URLS.
-	expandedEntries []expandedEntry
+	expandedEntries []Entry
+
+	// info holds a summary of each feed, once fetched by FetchInfo.
+	info map[string]Info
+
+	// infoMutex protects info.
+	infoMutex sync.Mutex
+
+	// err is the first error encountered reading the feed-list, or
+	// the files it includes, which cannot then be saved.
+	err error
+
+	// files are the files the feeds were read from, in order.
+	files []string
+
+	// trailing holds the comments which follow the last feed of
+	// each file.
+	trailing map[string][]string
+
+	// remote is the URL the feed-list was fetched from, if it was.
+	remote string
+
+	// digests holds the hash of each file's contents when we read, or
+	// wrote, it, so that we don't overwrite the changes of others.
+	digests map[string][sha256.Size]byte
 }
 
 // New returns a new instance of the feedlist.
 //
 // The existing feedlist file will be read, if present, to populate the
-// list of feeds.
+// list of feeds.  If no file is named we read "feeds.toml", a structured
+// feed-list, from our configuration directory if it exists, and "feeds"
+// otherwise, followed by the files within "feeds.d", unless FEED_LIST
+// names another.
+//
+// Files named by "#include-file" comments are read too, and the changes
+// made to their feeds are saved to them.
+//
+// A feed-list which is a URL is fetched, via https, and our copy of it is
+// read.  If it cannot be fetched we use the copy we have, if any.  Such a
+// list is maintained elsewhere, so cannot be saved, and isn't trusted: it
+// may not contain commands, local files, includes, or other directives
+// which run commands or read files, nor refer to environment variables.
 func New(filename string) *FeedList {
 
 	// Create the object
@@ -116,87 +678,237 @@ func New(filename string) *FeedList {
 
 	// If there was no path specified then create something
 	// sensible.
+	dropIn := ""
 	if filename == "" {
-
-		// Default to using $HOME for our storage
-		home := os.Getenv("HOME")
-
-		// If that fails then get the current user, and use
-		// their home if possible.
-		if home == "" {
-			usr, err := user.Current()
-			if err == nil {
-				home = usr.HomeDir
+		filename = config.Get(config.FeedList)
+		if filename == "" {
+			filename = filepath.Join(config.ConfigDirectory(), "feeds")
+			if _, err := os.Stat(filename + StructuredSuffix); err == nil {
+				filename += StructuredSuffix
 			}
 		}
+		dropIn = filepath.Join(config.ConfigDirectory(), DropInDirectory)
+	}
 
-		// Now build up our file-path
-		filename = filepath.Join(home, ".rss2email", "feeds")
+	// Fetch it, if it's remote.
+	required := false
+	if isRemote(filename) {
+		m.remote = filename
+		filename = remoteCopy(m.remote)
+		if err := fetchRemote(m.remote, filename); err != nil {
+			if _, serr := os.Stat(filename); serr != nil || !strings.HasPrefix(m.remote, "https://") {
+				m.err = err
+			}
+		}
+		required = m.err == nil
 	}
 
 	// Save our updated filename
 	m.filename = filename
 
-	// Open our input-file
-	file, err := os.Open(filename)
-	if err == nil {
-		defer file.Close()
-
-		seenFeed := make(map[string]bool)
-
-		//
-		// Process it line by line.
-		//
-		comments := make([]string, 0)
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			tmp := scanner.Text()
-			tmp = strings.TrimSpace(tmp)
-
-			//
-			// Save non-url lines as comments
-			//
-			if tmp == "" || strings.HasPrefix(tmp, "#") {
-				comments = append(comments, tmp)
-				continue
-			}
+	// Read it, along with the files it includes, and the files
+	// within the drop-in directory.
+	r := &reader{list: m, seen: make(map[string]bool), visited: make(map[string]bool)}
+	r.read(filename, required)
+	if dropIn != "" {
+		r.readDirectory(dropIn)
+	}
+
+	return m
+}
 
-			eEntry := expandedEntry{url: tmp, comments: comments}
-			comments = make([]string, 0)
+// Err returns the error encountered reading the feed-list, if it, or
+// a file it includes, is malformed or missing.
+func (f *FeedList) Err() error {
+	return f.err
+}
 
-			if !seenFeed[eEntry.url] {
-				m.expandedEntries = append(m.expandedEntries, eEntry)
-				seenFeed[eEntry.url] = true
-			}
+// Feeds returns the configured feeds, along with the comments which
+// precede each of them.
+//
+// The entries returned are copies, changing them does not change the
+// list.
+func (f *FeedList) Feeds() []Entry {
+	feeds := make([]Entry, len(f.expandedEntries))
+	for i, eEntry := range f.expandedEntries {
+		feeds[i] = Entry{URL: eEntry.URL, Comments: append([]string(nil), eEntry.Comments...), Inline: append([]string(nil), eEntry.Inline...), file: eEntry.file}
+	}
+	return feeds
+}
+
+// Tagged returns a copy of the list holding only the feeds with any of
+// the given tags, ignoring case, such as for listing them.  The copy
+// cannot be saved.
+func (f *FeedList) Tagged(tags ...string) *FeedList {
+	out := new(FeedList)
+	for _, eEntry := range f.expandedEntries {
+		if eEntry.HasTag(tags...) {
+			out.expandedEntries = append(out.expandedEntries, eEntry)
 		}
 	}
+	return out
+}
 
-	return m
+// Search returns a copy of the list holding only the feeds whose URL,
+// comments, or options contain the given text, ignoring case.  This
+// includes their titles, which are recorded in a comment when they're
+// added.  The copy cannot be saved.
+func (f *FeedList) Search(text string) *FeedList {
+	text = strings.ToLower(text)
+
+	out := new(FeedList)
+	for _, eEntry := range f.expandedEntries {
+		fields := append([]string{Redact(eEntry.URL)}, eEntry.Comments...)
+		fields = append(fields, eEntry.Inline...)
+		for _, field := range fields {
+			if strings.Contains(strings.ToLower(field), text) {
+				out.expandedEntries = append(out.expandedEntries, eEntry)
+				break
+			}
+		}
+	}
+	return out
 }
 
-// Entries returns the configured feeds.
+// Entries returns the URLs of the configured feeds.
 func (f *FeedList) Entries() []string {
 	urls := make([]string, len(f.expandedEntries))
 	for i, eEntry := range f.expandedEntries {
-		urls[i] = eEntry.url
+		urls[i] = eEntry.URL
 	}
 	return (urls)
 }
 
-// Add adds new entries to the feed-list, avoiding duplicates.
+// IsDisabled returns true if the given feed has been disabled, and should
+// not be polled.
+//
+// A feed is disabled by preceding it with a "#disabled" comment in the
+// feed-list.
+func (f *FeedList) IsDisabled(url string) bool {
+	for _, eEntry := range f.expandedEntries {
+		if eEntry.URL == url {
+			return eEntry.Disabled()
+		}
+	}
+	return false
+}
+
+// Directives returns the values of the named directive for the given
+// feed.
+//
+// Directives are comments of the form "#name value", which precede the
+// feed in the feed-list, for example:
+//
+//	#rewrite title /^\[Sponsored\] //
+//	https://example.com/index.rss
+func (f *FeedList) Directives(url string, name string) []string {
+	for _, eEntry := range f.expandedEntries {
+		if eEntry.URL == url {
+			return eEntry.Directives(name)
+		}
+	}
+	return nil
+}
+
+// Disable marks the given feed as disabled, recording the reason in
+// the feed-list.
+// You must call `Save` if you wish this change to be persisted.
+func (f *FeedList) Disable(url string, reason string) {
+	for i, eEntry := range f.expandedEntries {
+		if eEntry.URL == url && !eEntry.Disabled() {
+			comment := "#" + disabledDirective
+			if reason != "" {
+				comment += " " + reason
+			}
+			f.expandedEntries[i].Comments = append(eEntry.Comments, comment)
+		}
+	}
+}
+
+// Enable resumes polling of the given feed, if it was disabled, by
+// removing the "#disabled" comments, or option, which precede it.
+// You must call `Save` if you wish this change to be persisted.
+func (f *FeedList) Enable(url string) {
+	for i, eEntry := range f.expandedEntries {
+		if eEntry.URL != url {
+			continue
+		}
+
+		var comments []string
+		for _, c := range eEntry.Comments {
+			if !isDirective(c, disabledDirective) {
+				comments = append(comments, c)
+			}
+		}
+		f.expandedEntries[i].Comments = comments
+
+		var inline []string
+		for _, option := range eEntry.Inline {
+			if !strings.HasPrefix(option, disabledDirective+"=") {
+				inline = append(inline, option)
+			}
+		}
+		f.expandedEntries[i].Inline = inline
+	}
+}
+
+// Annotate adds the given comments, such as directives, to those above
+// the feed with the given URL, unless it has them already.
+// You must call `Save` if you wish this change to be persisted.
+func (f *FeedList) Annotate(url string, comments ...string) {
+	for i, eEntry := range f.expandedEntries {
+		if eEntry.URL != url {
+			continue
+		}
+		for _, c := range comments {
+			if !contains(f.expandedEntries[i].Comments, c) {
+				f.expandedEntries[i].Comments = append(f.expandedEntries[i].Comments, c)
+			}
+		}
+	}
+}
+
+// Rename changes the URL of the given feed, keeping the comments which
+// precede it.  If the new URL is already present the old entry is
+// removed instead.
+// You must call `Save` if you wish this change to be persisted.
+func (f *FeedList) Rename(from string, to string) {
+	for _, eEntry := range f.expandedEntries {
+		if eEntry.URL == to {
+			f.Delete(from)
+			return
+		}
+	}
+
+	for i, eEntry := range f.expandedEntries {
+		if eEntry.URL == from {
+			f.expandedEntries[i].URL = to
+		}
+	}
+}
+
+// Add adds new entries to the feed-list, avoiding duplicates.  A feed
+// which is already present under another spelling of its URL, as
+// described for Canonical, isn't added, and a DuplicateError is returned.
 // You must call `Save` if you wish this addition to be persisted.
 func (f *FeedList) Add(uris ...string) []error {
 
-	// Maintain a map of seen entries to avoid duplicates
-	seen := make(map[string]bool)
+	// Maintain a map of seen entries to avoid duplicates, including
+	// those spelled differently.
+	seen := make(map[string]string)
 
 	for _, eEntry := range f.expandedEntries {
-		seen[eEntry.url] = true
+		seen[Canonical(eEntry.URL)] = eEntry.URL
 	}
 
 	errors := make([]error, 0)
 	for _, uri := range uris {
-		if !seen[uri] {
+		existing, ok := seen[Canonical(uri)]
+		if ok && existing != uri {
+			errors = append(errors, &DuplicateError{URL: uri, Existing: existing})
+			continue
+		}
+		if !ok {
 			feed, err := Feed(uri)
 			comments := []string{""}
 
@@ -212,24 +924,31 @@ func (f *FeedList) Add(uris ...string) []error {
 				comments = append(comments, "# "+title)
 			}
 
-			eEntry := expandedEntry{url: uri, comments: comments}
+			eEntry := Entry{URL: uri, Comments: comments}
 			f.expandedEntries = append(f.expandedEntries, eEntry)
 		}
 
-		seen[uri] = true
+		seen[Canonical(uri)] = uri
 	}
 
 	return errors
 }
 
-// Delete removes an entry from our list of feeds.
+// Delete removes an entry from our list of feeds.  If the feed isn't
+// present as given, it is removed under any other spelling of its URL.
 // You must call `Save` if you wish this removal to be persisted.
 func (f *FeedList) Delete(url string) {
 
-	var tmp []expandedEntry
+	// A feed which isn't listed may be listed under another spelling.
+	match := func(e Entry) bool { return e.URL == url }
+	if !f.has(url) {
+		match = func(e Entry) bool { return Canonical(e.URL) == Canonical(url) }
+	}
+
+	var tmp []Entry
 
 	for _, eEntry := range f.expandedEntries {
-		if eEntry.url != url {
+		if !match(eEntry) {
 			tmp = append(tmp, eEntry)
 		}
 	}
@@ -237,83 +956,266 @@ func (f *FeedList) Delete(url string) {
 	f.expandedEntries = tmp
 }
 
+// has returns true if the given feed is in the list, exactly as given.
+func (f *FeedList) has(url string) bool {
+	for _, eEntry := range f.expandedEntries {
+		if eEntry.URL == url {
+			return true
+		}
+	}
+	return false
+}
+
 // Save syncs our entries to disc.
 func (f *FeedList) Save() error {
 
-	// Of course we need to make sure the directory exists before
-	// we can write beneath it.
-	dir, _ := filepath.Split(f.filename)
-	os.MkdirAll(dir, os.ModePerm)
+	// A partial list, from Tagged, would lose the other feeds, as
+	// would one we couldn't read.
+	if f.filename == "" {
+		return fmt.Errorf("cannot save part of the feed-list")
+	}
+	if f.err != nil {
+		return f.err
+	}
+	if f.remote != "" {
+		return fmt.Errorf("the feed-list is fetched from %s, change it there instead", Redact(f.remote))
+	}
 
-	// Open the file
-	fh, err := os.Create(f.filename)
+	// The feed-list may be changed by another process, a manual
+	// addition while we're run by cron for example, so we hold the
+	// lock the feed-state uses while we write it.
+	unlock, err := feedstate.Lock()
 	if err != nil {
-		return fmt.Errorf("error writing to %s - %s", f.filename, err.Error())
+		return err
+	}
+	defer unlock()
+
+	// Each file is written in turn, though those we included are
+	// left alone if they haven't changed.
+	files := []string{f.filename}
+	for _, file := range f.files {
+		if file != f.filename {
+			files = append(files, file)
+		}
 	}
 
-	verbose := false
-	f.WriteAllEntriesIncludingComments(fh, verbose)
+	for i, file := range files {
+		var entries []Entry
+		for _, eEntry := range f.expandedEntries {
+			if eEntry.file == file || (eEntry.file == "" && file == f.filename) {
+				entries = append(entries, eEntry)
+			}
+		}
 
-	fh.Close()
+		// Saving never fetches the feeds, or records their summaries.
+		var out bytes.Buffer
+		if isStructured(file) {
+			writeStructured(&out, entries, f.trailing[file])
+		} else {
+			writePlain(&out, entries, f.trailing[file], nil)
+		}
+
+		if i > 0 {
+			current, err := ioutil.ReadFile(file)
+			if err == nil && bytes.Equal(current, out.Bytes()) {
+				continue
+			}
+		}
+
+		// If the file changed since we read it then writing it
+		// would lose those changes.
+		// Its contents are compared, since two changes may be
+		// made within the resolution of its modification time.
+		perm := os.FileMode(0644)
+		if fi, err := os.Stat(file); err == nil {
+			current, err := ioutil.ReadFile(file)
+			if read, ok := f.digests[file]; ok && err == nil && sha256.Sum256(current) != read {
+				return fmt.Errorf("error writing to %s - it was changed by another process, please try again", file)
+			}
+			perm = fi.Mode().Perm()
+		}
+
+		// Of course we need to make sure the directory exists
+		// before we can write beneath it.
+		dir, _ := filepath.Split(file)
+		os.MkdirAll(dir, os.ModePerm)
+
+		// The file is replaced in one step, so that a crash never
+		// leaves it partially written.  A symlink is kept, and its
+		// target replaced.
+		target := file
+		if resolved, err := filepath.EvalSymlinks(file); err == nil {
+			target = resolved
+		}
+		err = atomicfile.WriteFile(target, out.Bytes(), perm)
+		if err != nil {
+			return fmt.Errorf("error writing to %s - %s", file, err.Error())
+		}
+		if f.digests != nil {
+			f.digests[file] = sha256.Sum256(out.Bytes())
+		}
+	}
 
 	return nil
 }
 
-const maxInt = int(^uint(0) >> 1)
+// Info summarises the entries of a feed, once it has been fetched.
+type Info struct {
 
-// feedInfo returns a string containing information about a feed
-func feedInfo(url string) string {
-	feed, err := Feed(url)
-	if err != nil {
+	// Title is the title of the feed.
+	Title string `json:"title,omitempty"`
+
+	// Items is the number of entries within the feed.
+	Items int `json:"items"`
+
+	// Newest is the publication date of the newest entry, if every
+	// entry has one.
+	Newest *time.Time `json:"newest,omitempty"`
+
+	// Oldest is the publication date of the oldest entry, if every
+	// entry has one.
+	Oldest *time.Time `json:"oldest,omitempty"`
+
+	// Error is the reason the feed couldn't be fetched, if it couldn't.
+	Error string `json:"error,omitempty"`
+}
+
+// String returns the summary of the feed which is shown by the list
+// sub-command, or the empty string if it couldn't be fetched.
+func (i Info) String() string {
+	if i.Error != "" {
 		return ""
 	}
 
 	entriesString := "entries"
-	if len(feed.Items) == 1 {
+	if i.Items == 1 {
 		entriesString = "entry"
 	}
-	info := fmt.Sprintf("%d %s", len(feed.Items), entriesString)
+	info := fmt.Sprintf("%d %s", i.Items, entriesString)
+
+	if i.Newest == nil || i.Oldest == nil {
+		return info
+	}
+
+	newest := int(time.Since(*i.Newest) / (24 * time.Hour))
+	oldest := int(time.Since(*i.Oldest) / (24 * time.Hour))
+	return fmt.Sprintf("%s, aged %d-%d days", info, newest, oldest)
+}
+
+// feedInfo fetches a feed, and returns a summary of its entries.
+func feedInfo(url string) Info {
+	feed, err := Feed(url)
+	if err != nil {
+		return Info{Error: err.Error()}
+	}
 
-	oldest := -1
-	newest := maxInt
+	info := Info{Title: feed.Title, Items: len(feed.Items)}
 	for _, item := range feed.Items {
 		if item.PublishedParsed == nil {
-			return info
+			return Info{Title: info.Title, Items: info.Items}
 		}
 
-		age := int(time.Since(*item.PublishedParsed) / (24 * time.Hour))
-		if age > oldest {
-			oldest = age
+		published := *item.PublishedParsed
+		if info.Newest == nil || published.After(*info.Newest) {
+			info.Newest = &published
 		}
+		if info.Oldest == nil || published.Before(*info.Oldest) {
+			info.Oldest = &published
+		}
+	}
+
+	return info
+}
+
+// infoFetcher returns the summary of a single feed, it is a variable so
+// that it may be replaced in our test-cases.
+var infoFetcher = feedInfo
+
+// FetchInfo fetches each feed, to build a summary of its entries which
+// will be included when the list is written verbosely.
+//
+// Up to concurrency feeds are fetched at once.  Feeds which have already
+// been fetched are not fetched again.
+func (f *FeedList) FetchInfo(concurrency int) {
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
 
-		if age < newest {
-			newest = age
+	f.infoMutex.Lock()
+	if f.info == nil {
+		f.info = make(map[string]Info)
+	}
+	var pending []string
+	for _, eEntry := range f.expandedEntries {
+		if _, ok := f.info[eEntry.URL]; !ok {
+			pending = append(pending, eEntry.URL)
 		}
 	}
+	f.infoMutex.Unlock()
 
-	info = fmt.Sprintf("%s, aged %d-%d days", info, newest, oldest)
+	urls := make(chan string)
+	var wg sync.WaitGroup
 
-	return info
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for url := range urls {
+				info := infoFetcher(url)
+
+				f.infoMutex.Lock()
+				f.info[url] = info
+				f.infoMutex.Unlock()
+			}
+		}()
+	}
+
+	for _, url := range pending {
+		urls <- url
+	}
+	close(urls)
+	wg.Wait()
 }
 
 // WriteAllEntriesIncludingComments Writes the feed list, including comments.
+//
+// If verbose is true the summary of each feed, as fetched by FetchInfo,
+// is included too.  No feeds are fetched here.
 func (f *FeedList) WriteAllEntriesIncludingComments(writer io.Writer, verbose bool) {
+
+	f.infoMutex.Lock()
+	defer f.infoMutex.Unlock()
+
+	var info map[string]Info
+	if verbose {
+		info = f.info
+	}
+	writePlain(writer, f.expandedEntries, nil, info)
+}
+
+// writePlain writes the given entries, including comments, followed by
+// any trailing comments.  The summary of each feed is included if one
+// is given.
+func writePlain(writer io.Writer, entries []Entry, trailing []string, info map[string]Info) {
+
 	// For each entry in the list ..
-	for _, eEntry := range f.expandedEntries {
+	for _, eEntry := range entries {
 
 		// Print the uri comments
-		for _, s := range eEntry.comments {
+		for _, s := range eEntry.Comments {
 			fmt.Fprintf(writer, "%s\n", s)
 		}
 
-		if verbose {
-			info := feedInfo(eEntry.url)
-			if info != "" {
-				fmt.Fprintf(writer, "# %s\n", info)
-			}
+		if summary, ok := info[eEntry.URL]; ok && summary.String() != "" {
+			fmt.Fprintf(writer, "# %s\n", summary)
 		}
 
-		// Print the uri
-		fmt.Fprintf(writer, "%s\n", eEntry.url)
+		// Print the uri, and its options
+		fmt.Fprintf(writer, "%s\n", joinOptions(eEntry.URL, eEntry.Inline))
+	}
+
+	for _, s := range trailing {
+		fmt.Fprintf(writer, "%s\n", s)
 	}
 }
@@ -0,0 +1,168 @@
+package feedlist
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/mmcdole/gofeed/atom"
+	"github.com/mmcdole/gofeed/rss"
+	"github.com/skx/rss2email/feedstate"
+)
+
+// hintTranslator converts feeds as usual, but also records the hints they
+// give which the universal feed discards: how often an RSS feed should be
+// fetched, and the WebSub hub which pushes updates of the feed.
+type hintTranslator struct {
+	rss  gofeed.DefaultRSSTranslator
+	atom gofeed.DefaultAtomTranslator
+
+	// schedule holds the hints of the last feed translated.
+	schedule feedstate.Schedule
+
+	// hub is the WebSub hub the feed advertised, and self the URL it
+	// gave for itself, if any.
+	hub  string
+	self string
+}
+
+// parser returns a feed parser which records its hints with us.
+func (t *hintTranslator) parser() *gofeed.Parser {
+	p := gofeed.NewParser()
+	p.RSSTranslator = t
+	p.AtomTranslator = t
+	return p
+}
+
+// Translate converts the given feed, recording its hints.
+func (t *hintTranslator) Translate(feed interface{}) (*gofeed.Feed, error) {
+	switch f := feed.(type) {
+	case *rss.Feed:
+		t.schedule = schedule(f)
+		for _, link := range f.Extensions["atom"]["link"] {
+			t.link(link.Attrs["rel"], link.Attrs["href"])
+		}
+		return t.rss.Translate(f)
+	case *atom.Feed:
+		for _, link := range f.Links {
+			t.link(link.Rel, link.Href)
+		}
+		return t.atom.Translate(f)
+	}
+	return nil, fmt.Errorf("unknown feed type %T", feed)
+}
+
+// link records the given link of the feed, if it names the feed's hub,
+// or the feed itself.  The first of each is used.
+func (t *hintTranslator) link(rel string, href string) {
+	href = strings.TrimSpace(href)
+	for _, r := range strings.Fields(strings.ToLower(rel)) {
+		switch {
+		case r == "hub" && t.hub == "":
+			t.hub = href
+		case r == "self" && t.self == "":
+			t.self = href
+		}
+	}
+}
+
+// header records the hub and self links of the given Link header, which
+// take precedence over those within the feed.
+func (t *hintTranslator) header(value string) {
+	var hub, self string
+	for _, link := range strings.Split(value, ",") {
+		parts := strings.Split(link, ";")
+		target := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		target = target[1 : len(target)-1]
+
+		for _, param := range parts[1:] {
+			name, value := param, ""
+			if i := strings.Index(param, "="); i >= 0 {
+				name, value = param[:i], strings.Trim(strings.TrimSpace(param[i+1:]), `"`)
+			}
+			if !strings.EqualFold(strings.TrimSpace(name), "rel") {
+				continue
+			}
+			for _, r := range strings.Fields(strings.ToLower(value)) {
+				if r == "hub" && hub == "" {
+					hub = target
+				}
+				if r == "self" && self == "" {
+					self = target
+				}
+			}
+		}
+	}
+	if hub != "" {
+		t.hub = hub
+	}
+	if self != "" {
+		t.self = self
+	}
+}
+
+// websub returns the hub of the feed fetched from the given page, and the
+// topic the hub knows it by, with relative URLs resolved.  If there is no
+// hub both are empty.
+func (t *hintTranslator) websub(page string) (string, string) {
+
+	if t.hub == "" {
+		return "", ""
+	}
+
+	base, err := url.Parse(page)
+	if err != nil {
+		return "", ""
+	}
+	resolve := func(link string) string {
+		u, err := base.Parse(link)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return ""
+		}
+		return u.String()
+	}
+
+	hub := resolve(t.hub)
+	topic := page
+	if t.self != "" {
+		topic = resolve(t.self)
+	}
+	if hub == "" || topic == "" {
+		return "", ""
+	}
+	return hub, topic
+}
+
+// schedule returns the hints of the given feed, ignoring those which
+// are invalid.
+func schedule(r *rss.Feed) feedstate.Schedule {
+
+	var s feedstate.Schedule
+
+	if mins, err := strconv.Atoi(strings.TrimSpace(r.TTL)); err == nil && mins > 0 {
+		s.TTL = time.Duration(mins) * time.Minute
+	}
+
+	for _, value := range r.SkipHours {
+		// Some publishers use 24 for midnight.
+		if hour, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && hour >= 0 && hour <= 24 {
+			s.SkipHours = append(s.SkipHours, hour%24)
+		}
+	}
+
+	for _, value := range r.SkipDays {
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if strings.EqualFold(strings.TrimSpace(value), d.String()) {
+				s.SkipDays = append(s.SkipDays, d)
+			}
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,195 @@
+package feedlist
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DropInDirectory is the directory, within our configuration directory,
+// whose files are read after the feed-list, as though it included them.
+const DropInDirectory = "feeds.d"
+
+// includeDirective is the directive which names another file of feeds
+// to read, relative to the file it appears in.  It may be a pattern,
+// such as "#include-file work/*.feeds".
+const includeDirective = "include-file"
+
+// reader reads a feed-list, along with the files it includes.
+type reader struct {
+
+	// list is the list we're populating.
+	list *FeedList
+
+	// seen holds the feeds we've read, only the first of which is
+	// kept if a feed is listed twice.
+	seen map[string]bool
+
+	// visited holds the files we've read, so that a file which
+	// includes itself isn't read forever.
+	visited map[string]bool
+}
+
+// fail records the first error we encounter.
+func (r *reader) fail(err error) {
+	if r.list.err == nil {
+		r.list.err = err
+	}
+}
+
+// read reads the given file, followed by the files it includes.  It is
+// an error if a file which is required cannot be read.
+func (r *reader) read(path string, required bool) {
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	if r.visited[abs] {
+		return
+	}
+	r.visited[abs] = true
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if required {
+			r.fail(fmt.Errorf("error reading %s: %s", path, err.Error()))
+		}
+		return
+	}
+
+	var entries []Entry
+	var trailing []string
+	if isStructured(path) {
+		entries, trailing, err = readStructured(bytes.NewReader(data))
+	} else {
+		entries, trailing, err = readPlain(bytes.NewReader(data))
+	}
+	if err != nil {
+		r.fail(fmt.Errorf("error reading %s: %s", path, err.Error()))
+		return
+	}
+
+	if r.list.trailing == nil {
+		r.list.trailing = make(map[string][]string)
+		r.list.digests = make(map[string][sha256.Size]byte)
+	}
+	r.list.files = append(r.list.files, path)
+	r.list.trailing[path] = trailing
+	r.list.digests[path] = sha256.Sum256(data)
+
+	// The entries of a shared feed-list aren't trusted.
+	untrusted := r.list.remote != "" && path == r.list.filename
+	if untrusted {
+		for _, eEntry := range append(entries, Entry{Comments: trailing}) {
+			if err := checkUntrusted(eEntry); err != nil {
+				r.fail(fmt.Errorf("error reading %s: %s", Redact(r.list.remote), err.Error()))
+				return
+			}
+		}
+	}
+
+	var includes []string
+	for _, eEntry := range entries {
+		eEntry.file = path
+		includes = append(includes, eEntry.Directives(includeDirective)...)
+
+		if !r.seen[eEntry.URL] {
+			r.list.expandedEntries = append(r.list.expandedEntries, eEntry)
+			r.seen[eEntry.URL] = true
+		}
+	}
+	includes = append(includes, Entry{Comments: trailing}.Directives(includeDirective)...)
+
+	for _, pattern := range includes {
+		r.include(path, pattern)
+	}
+}
+
+// include reads the files named by the given pattern, which appeared
+// within the given file.
+func (r *reader) include(from string, pattern string) {
+
+	if pattern == "" {
+		r.fail(fmt.Errorf("error reading %s: #%s names no file", from, includeDirective))
+		return
+	}
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(filepath.Dir(from), pattern)
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		r.fail(fmt.Errorf("error reading %s: invalid #%s %q", from, includeDirective, pattern))
+		return
+	}
+
+	// A file which doesn't exist is an error, but a pattern which
+	// matches nothing isn't.
+	if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+		matches = []string{pattern}
+	}
+	for _, match := range matches {
+		r.read(match, true)
+	}
+}
+
+// readDirectory reads each file within the given directory, in order of
+// their names, if it exists.  Hidden files, and backups ending in "~",
+// are ignored.
+func (r *reader) readDirectory(dir string) {
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			r.fail(fmt.Errorf("error reading %s: %s", dir, err.Error()))
+		}
+		return
+	}
+
+	for _, fi := range files {
+		name := fi.Name()
+		if fi.IsDir() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") {
+			continue
+		}
+		r.read(filepath.Join(dir, name), true)
+	}
+}
+
+// readPlain reads the entries of a plain feed-list, which has a feed on
+// each line, preceded by its comments, along with the comments which
+// follow the last feed.
+func readPlain(in io.Reader) ([]Entry, []string, error) {
+
+	var entries []Entry
+
+	//
+	// Process it line by line.
+	//
+	comments := make([]string, 0)
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		tmp := scanner.Text()
+		tmp = strings.TrimSpace(tmp)
+
+		//
+		// Save non-url lines as comments
+		//
+		if tmp == "" || strings.HasPrefix(tmp, "#") {
+			comments = append(comments, tmp)
+			continue
+		}
+
+		url, inline := splitOptions(tmp)
+		entries = append(entries, Entry{URL: url, Comments: comments, Inline: inline})
+		comments = make([]string, 0)
+	}
+
+	return entries, comments, scanner.Err()
+}
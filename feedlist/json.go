@@ -0,0 +1,48 @@
+package feedlist
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// jsonFeed is a feed as it is written by WriteJSON.
+type jsonFeed struct {
+	URL      string   `json:"url"`
+	Comments []string `json:"comments"`
+	Options  []string `json:"options,omitempty"`
+
+	// The summary of the feed, once it has been fetched.
+	*Info
+}
+
+// WriteJSON writes our feeds, along with their comments, as a JSON array.
+//
+// The summary of each feed, as fetched by FetchInfo, is included too, for
+// the feeds which have been fetched.  No feeds are fetched here.
+func (f *FeedList) WriteJSON(w io.Writer) error {
+
+	f.infoMutex.Lock()
+	defer f.infoMutex.Unlock()
+
+	out := []jsonFeed{}
+	for _, eEntry := range f.expandedEntries {
+		feed := jsonFeed{URL: eEntry.URL, Comments: eEntry.Comments, Options: eEntry.Inline}
+		if feed.Comments == nil {
+			feed.Comments = []string{}
+		}
+		if info, ok := f.info[eEntry.URL]; ok {
+			feed.Info = &info
+		}
+		out = append(out, feed)
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error writing JSON: %s", err.Error())
+	}
+	if _, err := fmt.Fprintf(w, "%s\n", data); err != nil {
+		return fmt.Errorf("error writing JSON: %s", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package feedlist
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/skx/rss2email/config"
+)
+
+// maxFeedSize returns the largest feed we'll download, in bytes, zero if
+// there is no limit.
+func maxFeedSize() (int64, error) {
+	value := config.Get(config.FeedMaxSize)
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid %s %q, expected a number of bytes", config.FeedMaxSize, value)
+	}
+	return size, nil
+}
+
+// limitedReader reads from another reader until more than the limit has
+// been read, after which it fails.
+//
+// Unlike io.LimitReader this lets us tell a feed which is too large
+// apart from one which ended at the limit.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	exceeded  bool
+}
+
+// newLimitedReader returns a reader which fails after reading limit bytes.
+func newLimitedReader(r io.Reader, limit int64) *limitedReader {
+	return &limitedReader{r: r, remaining: limit}
+}
+
+// Read is part of the io.Reader interface.
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.exceeded {
+		return 0, errTooLarge
+	}
+
+	// Read one byte beyond the limit, to find out if there is more.
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+
+	n, err := l.r.Read(p)
+	if int64(n) > l.remaining {
+		n = int(l.remaining)
+		l.remaining = 0
+		l.exceeded = true
+		return n, errTooLarge
+	}
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// errTooLarge is returned by a limitedReader once the limit is exceeded.
+var errTooLarge = fmt.Errorf("too large")
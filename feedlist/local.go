@@ -0,0 +1,160 @@
+package feedlist
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/scrape"
+)
+
+// Stdin is the name of the feed which is read from STDIN.
+const Stdin = "-"
+
+// stdin is where that feed is read from, it is a variable so that it may
+// be replaced in our test-cases.
+var stdin io.Reader = os.Stdin
+
+// isLocal returns true if the given feed is read from a file, STDIN, or
+// a command, rather than being fetched.
+func isLocal(link string) bool {
+	return link == Stdin || strings.HasPrefix(strings.ToLower(link), "file:") || IsCommand(link)
+}
+
+// localPath returns the file named by the given file:// URL.  Relative
+// paths, as in "file:feeds/local.xml", are found in the configuration
+// directory, and "file:~/feeds/local.xml" within the home directory.
+func localPath(link string) (string, error) {
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		return "", fmt.Errorf("cannot read files from %s", u.Host)
+	}
+
+	path := u.Path
+	if u.Opaque != "" {
+		path, err = url.PathUnescape(u.Opaque)
+		if err != nil {
+			return "", err
+		}
+	}
+	if path == "" {
+		return "", fmt.Errorf("no file named")
+	}
+
+	path = expandHome(filepath.FromSlash(path))
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(config.ConfigDirectory(), path)
+	}
+	return path, nil
+}
+
+// readLocal reads a feed from a file, STDIN, or the output of a command,
+// and parses it.
+//
+// The modification time of a file stands in for the validators of a
+// remote feed, so that if there is state, and the file hasn't changed
+// since it was recorded, ErrNotModified is returned.
+func readLocal(link string, opts FetchOptions) (*gofeed.Feed, error) {
+	limit, state := opts.Limit, opts.State
+
+	expanded, err := Expand(link)
+	if err != nil {
+		return nil, fmt.Errorf("error processing %s - %s", link, err.Error())
+	}
+
+	max, err := maxFeedSize()
+	if err != nil {
+		return nil, err
+	}
+	if limit == 0 || (max > 0 && max < limit) {
+		limit = max
+	}
+
+	var in io.Reader = stdin
+	modified := ""
+	switch {
+	case IsCommand(link):
+		out, err := runCommand(opts.Context, expanded, limit)
+		if err != nil {
+			return nil, fmt.Errorf("error processing %s - %s", link, err.Error())
+		}
+		in = bytes.NewReader(out)
+
+	case link != Stdin:
+		path, err := localPath(expanded)
+		if err != nil {
+			return nil, fmt.Errorf("error processing %s - %s", link, err.Error())
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("error processing %s - %s", link, err.Error())
+		}
+		defer file.Close()
+
+		fi, err := file.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("error processing %s - %s", link, err.Error())
+		}
+		modified = fi.ModTime().UTC().Format(time.RFC3339Nano)
+		if state != nil && state.LastModified == modified {
+			return nil, ErrNotModified
+		}
+		in = file
+	}
+
+	var limited *limitedReader
+	if limit > 0 {
+		limited = newLimitedReader(in, limit)
+		in = limited
+	}
+
+	tooLarge := func() error {
+		if limited != nil && limited.exceeded {
+			return fmt.Errorf("error processing %s - the feed is larger than %d bytes", link, limit)
+		}
+		return nil
+	}
+
+	body, err := toUTF8(in, "")
+	if err != nil {
+		if err := tooLarge(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error processing %s contents: %s", link, err.Error())
+	}
+
+	var feed *gofeed.Feed
+	hints := &hintTranslator{}
+	if opts.Scrape != nil {
+		feed, err = scrape.Parse(body, link, *opts.Scrape)
+	} else {
+		feed, err = hints.parser().Parse(body)
+	}
+	if err := tooLarge(); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, &ParseError{URL: link, Err: err}
+	}
+
+	if state != nil {
+		state.ETag = ""
+		state.LastModified = modified
+		state.MovedTo = ""
+		state.Schedule = hints.schedule
+		state.Hub, state.Topic = "", ""
+	}
+	return feed, nil
+}
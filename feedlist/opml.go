@@ -0,0 +1,36 @@
+package feedlist
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteOPML writes the URLs of our feeds as an OPML document.
+func (f *FeedList) WriteOPML(w io.Writer) error {
+
+	var out strings.Builder
+	out.WriteString(`<?xml version="1.0" encoding="utf-8"?>
+<opml version="1.0">
+<head>
+<title>Feed Export</title>
+</head>
+<body>
+`)
+	for _, eEntry := range f.expandedEntries {
+		out.WriteString(`<outline xmlUrl="`)
+		xml.EscapeText(&out, []byte(eEntry.URL))
+		out.WriteString("\"/>\n")
+	}
+	out.WriteString(`
+</body>
+</opml>
+`)
+
+	_, err := io.WriteString(w, out.String())
+	if err != nil {
+		return fmt.Errorf("error writing OPML: %s", err.Error())
+	}
+	return nil
+}
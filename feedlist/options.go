@@ -0,0 +1,207 @@
+package feedlist
+
+import (
+	"fmt"
+	"net/mail"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/skx/rss2email/config"
+)
+
+// optionPattern matches an inline option, "key=value", which may follow
+// the URL of a feed on the same line.
+var optionPattern = regexp.MustCompile(`^[a-z][a-z0-9-]*=`)
+
+// optionSeparator separates a command, and its arguments, from the inline
+// options which follow it.
+const optionSeparator = "--"
+
+// splitOptions splits a line of the feed-list into the feed, and the
+// inline options which follow it.
+//
+// The options are taken from the end of the line, stopping at the first
+// word which isn't "key=value".  A URL cannot contain a space, but a
+// command can, and its arguments might look like options, so a command's
+// options must follow a separator: "exec:make-feed a=b -- tag=work".
+func splitOptions(line string) (string, []string) {
+
+	fields := strings.Fields(line)
+	n := len(fields)
+	for n > 1 && optionPattern.MatchString(fields[n-1]) {
+		n--
+	}
+
+	command := IsCommand(line)
+	if command && (n < 2 || fields[n-1] != optionSeparator) {
+		return line, nil
+	}
+	if n == len(fields) && !command {
+		return line, nil
+	}
+
+	// Keep the spacing of a command's arguments.
+	url := line
+	for i := len(fields) - 1; i >= n; i-- {
+		url = strings.TrimSuffix(strings.TrimSpace(url), fields[i])
+	}
+	if command {
+		url = strings.TrimSuffix(strings.TrimSpace(url), optionSeparator)
+	}
+	return strings.TrimSpace(url), fields[n:]
+}
+
+// joinOptions returns the line of the feed-list holding the given feed, and
+// its inline options, which splitOptions reverses.
+func joinOptions(url string, inline []string) string {
+
+	// A command needs the separator if it has options, or if its own
+	// arguments would otherwise be taken for them.
+	if IsCommand(url) {
+		if plain, _ := splitOptions(url); len(inline) > 0 || plain != url {
+			url += " " + optionSeparator
+		}
+	}
+	return strings.Join(append([]string{url}, inline...), " ")
+}
+
+// inline returns the values of the named inline option.
+func (e Entry) inline(name string) []string {
+	var out []string
+	for _, option := range e.Inline {
+		parts := strings.SplitN(option, "=", 2)
+		if len(parts) == 2 && parts[0] == name {
+			out = append(out, parts[1])
+		}
+	}
+	return out
+}
+
+// Options holds the settings which control the delivery of a feed's items,
+// given either as inline options, "to=bob@example.com", or as directives,
+// "#to bob@example.com".
+type Options struct {
+
+	// To are the recipients of the feed's items, in place of those
+	// we were given.
+	To []string
+
+	// Template is the template the feed's emails are rendered with, in
+	// place of the default.
+	Template string
+
+	// Include are the patterns which an item's title or content must
+	// match one of, if there are any, for it to be sent.
+	Include []*regexp.Regexp
+
+	// Exclude are the patterns which an item's title or content must
+	// not match, for it to be sent.
+	Exclude []*regexp.Regexp
+}
+
+// Options returns the delivery settings of the entry, along with the
+// first error found in them.  Invalid settings are ignored.
+//
+// Recipients are comma-separated, patterns are regular expressions which
+// ignore case, and the template is found in the configuration directory
+// unless its path is absolute.  A feed without recipients, or a template,
+// of its own uses those of its tags, via TAG_WORK_RECIPIENTS and
+// TAG_WORK_TEMPLATE for the tag "work".
+func (e Entry) Options() (Options, error) {
+	var opts Options
+	var err error
+
+	for _, value := range e.Directives("to") {
+		for _, addr := range strings.Split(value, ",") {
+			addr = strings.TrimSpace(addr)
+			if addr == "" {
+				continue
+			}
+			// Invalid recipients are reported, and dropped.
+			if _, perr := mail.ParseAddress(addr); perr != nil || strings.HasPrefix(addr, "-") {
+				if err == nil {
+					err = fmt.Errorf("invalid recipient %q, expected an email address", addr)
+				}
+				continue
+			}
+			opts.To = append(opts.To, addr)
+		}
+	}
+
+	if values := e.Directives("template"); len(values) > 0 && values[len(values)-1] != "" {
+		opts.Template = values[len(values)-1]
+		if !filepath.IsAbs(opts.Template) {
+			opts.Template = filepath.Join(config.ConfigDirectory(), opts.Template)
+		}
+	}
+
+	// Fall back to the settings of our tags.
+	own := len(opts.To) > 0
+	for _, tag := range e.Tags() {
+		if config.Tagged(config.Recipients, tag) == "" {
+			continue
+		}
+		if !own {
+			for _, addr := range config.List(config.Tagged(config.Recipients, tag)) {
+				if !contains(opts.To, addr) {
+					opts.To = append(opts.To, addr)
+				}
+			}
+		}
+		if opts.Template == "" {
+			opts.Template = config.Get(config.Tagged(config.Template, tag))
+		}
+	}
+
+	patterns := func(name string) []*regexp.Regexp {
+		var out []*regexp.Regexp
+		for _, value := range e.Directives(name) {
+			re, rerr := regexp.Compile("(?i)" + value)
+			if rerr != nil {
+				if err == nil {
+					err = fmt.Errorf("invalid %s pattern %q: %s", name, value, rerr.Error())
+				}
+				continue
+			}
+			out = append(out, re)
+		}
+		return out
+	}
+	opts.Include = patterns("include")
+	opts.Exclude = patterns("exclude")
+
+	if err != nil {
+		return opts, fmt.Errorf("error processing %s - %s", Redact(e.URL), err.Error())
+	}
+	return opts, nil
+}
+
+// Wanted returns true if an item with the given title and content should
+// be sent, according to our patterns.
+func (o Options) Wanted(title string, content string) bool {
+
+	match := func(patterns []*regexp.Regexp) bool {
+		for _, re := range patterns {
+			if re.MatchString(title) || re.MatchString(content) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(o.Include) > 0 && !match(o.Include) {
+		return false
+	}
+	return !match(o.Exclude)
+}
+
+// contains returns true if the list contains the given string.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
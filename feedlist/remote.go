@@ -0,0 +1,173 @@
+package feedlist
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/skx/rss2email/atomicfile"
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/network"
+)
+
+// remoteClient returns the client the feed-list is fetched with, it is a
+// variable so that it may be replaced in our test-cases.
+var remoteClient = network.HTTPClient
+
+// untrustedDirectives are the directives which run commands, or read
+// local files, so are refused within a feed-list fetched from elsewhere.
+var untrustedDirectives = []string{includeDirective, "transcode", "template", "tls-ca", "tls-cert", "tls-key"}
+
+// isRemote returns true if the feed-list is fetched from a URL, rather
+// than read from a file.
+func isRemote(location string) bool {
+	return strings.HasPrefix(location, "https://") || strings.HasPrefix(location, "http://")
+}
+
+// IsUntrusted returns true if the given feed would run a command, read a
+// local file, or reveal our environment, so must only be accepted from a
+// feed-list the user wrote, never one somebody else supplied.
+func IsUntrusted(link string) bool {
+	return isLocal(link) || hasVariables(link)
+}
+
+// checkUntrusted returns an error if the given entry, from a feed-list
+// fetched from elsewhere, would run a command, read a local file, or
+// reveal our environment.  Whoever serves the list, or tampers with it,
+// mustn't be able to do what only our own feed-list may.
+func checkUntrusted(e Entry) error {
+	if e.URL != "" && IsUntrusted(e.URL) {
+		return fmt.Errorf("%s is refused within a shared feed-list", Redact(e.URL))
+	}
+	for _, name := range untrustedDirectives {
+		if len(e.Directives(name)) > 0 {
+			return fmt.Errorf("#%s is refused within a shared feed-list", name)
+		}
+	}
+	return nil
+}
+
+// remoteCopy returns the file in which we keep our copy of the feed-list
+// fetched from the given URL.  It is structured if the URL names a
+// structured feed-list.
+func remoteCopy(location string) string {
+	name := "feeds.remote"
+	if u, err := url.Parse(location); err == nil && isStructured(u.Path) {
+		name += StructuredSuffix
+	}
+	return filepath.Join(config.StateDirectory(), name)
+}
+
+// fetchRemote fetches the feed-list from the given URL, and saves it to
+// the given file, unless it hasn't changed since the file was written.
+//
+// Credentials within the URL, or FEED_LIST_USERNAME and FEED_LIST_PASSWORD,
+// are used to authenticate, if the server asks us to.  The list must be
+// fetched via https, so that it can't be tampered with.
+func fetchRemote(location string, path string) error {
+
+	shown := Redact(location)
+	target, user := splitCredentials(location)
+	if name := config.Get(config.FeedListUsername); name != "" {
+		user = url.UserPassword(name, config.Get(config.FeedListPassword))
+	}
+
+	if !strings.HasPrefix(location, "https://") {
+		return fmt.Errorf("error fetching %s - the feed-list must be fetched via https", shown)
+	}
+
+	client, err := remoteClient()
+	if err != nil {
+		return err
+	}
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return fmt.Errorf("stopped after 10 redirects")
+		}
+		if req.URL.Scheme != "https" {
+			return fmt.Errorf("refusing to follow a redirect to %s", req.URL.Scheme)
+		}
+		return nil
+	}
+	timeout, err := fetchTimeout()
+	if err != nil {
+		return err
+	}
+	max, err := maxFeedSize()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	get := func(authorization string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", config.Get(config.UserAgent))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		// Our copy is dated as the server dated the feed-list.
+		if fi, err := os.Stat(path); err == nil {
+			req.Header.Set("If-Modified-Since", fi.ModTime().UTC().Format(http.TimeFormat))
+		}
+		return client.Do(req)
+	}
+
+	resp, err := get("")
+	if err != nil {
+		return fmt.Errorf("error fetching %s - %s", shown, err.Error())
+	}
+	if resp.StatusCode == http.StatusUnauthorized && user != nil {
+		authz, err := authorization(resp, user)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("error fetching %s - %s", shown, err.Error())
+		}
+		resp, err = get(authz)
+		if err != nil {
+			return fmt.Errorf("error fetching %s - %s", shown, err.Error())
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("error fetching %s - %s", shown, resp.Status)
+	}
+
+	// The feed-list is limited to the size of a feed.
+	var body io.Reader = resp.Body
+	if max > 0 {
+		body = newLimitedReader(body, max)
+	}
+	content, err := ioutil.ReadAll(body)
+	if err == errTooLarge {
+		return fmt.Errorf("error fetching %s - the feed-list is larger than %d bytes", shown, max)
+	}
+	if err != nil {
+		return fmt.Errorf("error fetching %s - %s", shown, err.Error())
+	}
+
+	// Replace our copy in one step, so that it is never partial.
+	os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err := atomicfile.WriteFile(path, content, 0600); err != nil {
+		return fmt.Errorf("error writing to %s - %s", path, err.Error())
+	}
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		os.Chtimes(path, time.Now(), modified)
+	}
+	return nil
+}
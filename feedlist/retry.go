@@ -0,0 +1,125 @@
+package feedlist
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/skx/rss2email/config"
+)
+
+// transientError is an error which may go away if the fetch is retried,
+// such as a timeout or a refused connection.
+type transientError struct {
+	error
+}
+
+// retryable returns true if fetching the feed again might succeed, where
+// it just failed with the given error.
+func retryable(err error) bool {
+	switch e := err.(type) {
+	case *HTTPError:
+		return !e.Permanent()
+	case transientError:
+		return true
+	}
+	return false
+}
+
+// retryPolicy describes how often, and how quickly, we retry fetches.
+type retryPolicy struct {
+
+	// tries is the maximum number of attempts we make.
+	tries int
+
+	// delay is the time we wait before the first retry, which doubles
+	// for each retry thereafter.
+	delay time.Duration
+
+	// maxDelay is the longest we'll wait before any retry.
+	maxDelay time.Duration
+}
+
+// loadRetryPolicy returns our retry policy, as configured.
+func loadRetryPolicy() (retryPolicy, error) {
+
+	var p retryPolicy
+	var err error
+
+	p.tries, err = strconv.Atoi(config.Get(config.FetchTries))
+	if err != nil || p.tries < 1 {
+		return p, fmt.Errorf("invalid %s %q, expected a positive number", config.FetchTries, config.Get(config.FetchTries))
+	}
+
+	p.delay, err = time.ParseDuration(config.Get(config.FetchRetryDelay))
+	if err != nil || p.delay < 0 {
+		return p, fmt.Errorf("invalid %s %q, expected a duration such as \"200ms\"", config.FetchRetryDelay, config.Get(config.FetchRetryDelay))
+	}
+
+	p.maxDelay, err = time.ParseDuration(config.Get(config.FetchRetryMax))
+	if err != nil || p.maxDelay < 0 {
+		return p, fmt.Errorf("invalid %s %q, expected a duration such as \"30s\"", config.FetchRetryMax, config.Get(config.FetchRetryMax))
+	}
+
+	return p, nil
+}
+
+// jitterRand supplies the randomness for our jitter, so that several
+// hosts retrying the same server don't do so in lock-step.
+var (
+	jitterRand  = rand.New(rand.NewSource(time.Now().UnixNano()))
+	jitterMutex sync.Mutex
+)
+
+// backoff returns the time to wait before the given retry, the first
+// being 1, or false if we should give up.
+//
+// The delay doubles for each retry, up to the maximum, and a random
+// amount of up to half of it is subtracted.  If the server asked us to
+// wait, via Retry-After, we wait at least that long, unless it is longer
+// than the maximum.
+func (p retryPolicy) backoff(retry int, err error) (time.Duration, bool) {
+
+	delay := p.delay
+	for i := 1; i < retry && delay < p.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.maxDelay {
+		delay = p.maxDelay
+	}
+
+	if half := int64(delay / 2); half > 0 {
+		jitterMutex.Lock()
+		delay -= time.Duration(jitterRand.Int63n(half + 1))
+		jitterMutex.Unlock()
+	}
+
+	if herr, ok := err.(*HTTPError); ok && herr.RetryAfter > delay {
+		if herr.RetryAfter > p.maxDelay {
+			return 0, false
+		}
+		delay = herr.RetryAfter
+	}
+	return delay, true
+}
+
+// retryAfter returns the time the server asked us to wait before trying
+// again, via the Retry-After header, or zero if it didn't.
+func retryAfter(resp *http.Response) time.Duration {
+
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && time.Until(t) > 0 {
+		return time.Until(t)
+	}
+	return 0
+}
@@ -0,0 +1,226 @@
+package feedlist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skx/rss2email/internal/toml"
+)
+
+// StructuredSuffix is the suffix of a structured feed-list, which holds
+// each feed as a table in a simple subset of TOML, rather than a line:
+//
+//	[[feed]]
+//	url = "https://example.com/index.rss"
+//	name = "Example"
+//	tags = ["news", "daily"]
+//	recipients = ["bob@example.com"]
+//	include = ["golang"]
+//	schedule = "0 8 * * MON-FRI"
+//
+// Every key other than the url is equivalent to the directive of the
+// same name, such as "proxy" to "#proxy", along with a few more natural
+// names: tags for "#tag", recipients for "#to", and schedule for either
+// "#interval" or "#cron", as its value requires.
+const StructuredSuffix = ".toml"
+
+// aliases maps the keys of a structured feed-list to the directives
+// they stand for, where those differ.
+var aliases = map[string]string{
+	"tags":       tagDirective,
+	"recipients": "to",
+}
+
+// lists are the directives which are written as arrays, even when they
+// have a single value.
+var lists = map[string]bool{tagDirective: true, "to": true, "include": true, "exclude": true}
+
+// isStructured returns true if the given feed-list is structured.
+func isStructured(filename string) bool {
+	return strings.HasSuffix(filename, StructuredSuffix)
+}
+
+// readStructured reads the entries of a structured feed-list.
+//
+// Comments preceding a feed's table are kept as its comments, and its
+// keys become its directives.  The comments which follow the last table
+// are returned too.
+func readStructured(in io.Reader) ([]Entry, []string, error) {
+
+	var entries []Entry
+	var entry *Entry
+	var comments []string
+
+	scanner := bufio.NewScanner(in)
+	line := 0
+	for scanner.Scan() {
+		line++
+		txt := strings.TrimSpace(scanner.Text())
+
+		if txt == "" || strings.HasPrefix(txt, "#") {
+			comments = append(comments, txt)
+			continue
+		}
+		txt = strings.TrimSpace(toml.StripComment(txt))
+
+		if txt == "[[feed]]" {
+			if entry != nil {
+				entries = append(entries, *entry)
+			}
+			entry = &Entry{Comments: comments}
+			comments = nil
+			continue
+		}
+		if strings.HasPrefix(txt, "[") {
+			return nil, nil, fmt.Errorf("line %d: unexpected table %q, expected [[feed]]", line, txt)
+		}
+		if entry == nil {
+			return nil, nil, fmt.Errorf("line %d: expected [[feed]] before %q", line, txt)
+		}
+
+		parts := strings.SplitN(txt, "=", 2)
+		if len(parts) != 2 {
+			return nil, nil, fmt.Errorf("line %d: expected key = value, got %q", line, txt)
+		}
+		key := strings.ReplaceAll(strings.TrimSpace(parts[0]), "_", "-")
+		raw := strings.TrimSpace(parts[1])
+		values, err := toml.ParseValue(raw)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+
+		switch key {
+		case "url":
+			if len(values) != 1 || values[0] == "" {
+				return nil, nil, fmt.Errorf("line %d: expected a single url", line)
+			}
+			entry.URL = values[0]
+			continue
+		case "schedule":
+			key = "cron"
+			for _, v := range values {
+				if _, err := time.ParseDuration(v); err == nil {
+					key = "interval"
+				}
+			}
+		}
+		if name, ok := aliases[key]; ok {
+			key = name
+		}
+
+		switch raw {
+		case "false":
+			// As though the directive were absent.
+		case "true":
+			entry.Comments = append(entry.Comments, "#"+key)
+		default:
+			for _, v := range values {
+				entry.Comments = append(entry.Comments, "#"+key+" "+v)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if entry != nil {
+		entries = append(entries, *entry)
+	}
+
+	for _, e := range entries {
+		if e.URL == "" {
+			return nil, nil, fmt.Errorf("a [[feed]] has no url")
+		}
+	}
+	return entries, comments, nil
+}
+
+// writeStructured writes the given entries as a structured feed-list.
+//
+// Their directives become keys, and their other comments are written
+// above their tables, followed by the trailing comments.
+func writeStructured(writer io.Writer, entries []Entry, trailing []string) {
+
+	for i, eEntry := range entries {
+
+		values := make(map[string][]string)
+		var keys []string
+		for _, c := range eEntry.Comments {
+			name, value, ok := directive(c)
+			if !ok {
+				fmt.Fprintf(writer, "%s\n", c)
+				continue
+			}
+			if _, seen := values[name]; !seen {
+				keys = append(keys, name)
+			}
+			values[name] = append(values[name], value)
+		}
+		for _, option := range eEntry.Inline {
+			parts := strings.SplitN(option, "=", 2)
+			if _, seen := values[parts[0]]; !seen {
+				keys = append(keys, parts[0])
+			}
+			values[parts[0]] = append(values[parts[0]], parts[1])
+		}
+
+		fmt.Fprintf(writer, "[[feed]]\n")
+		fmt.Fprintf(writer, "url = %s\n", strconv.Quote(eEntry.URL))
+		for _, name := range keys {
+			key := name
+			for alias, d := range aliases {
+				if d == name {
+					key = alias
+				}
+			}
+
+			vals := values[name]
+			for j, v := range vals {
+				if v == "" {
+					vals[j] = "true"
+				} else {
+					vals[j] = strconv.Quote(v)
+				}
+			}
+			if len(vals) == 1 && !lists[name] {
+				fmt.Fprintf(writer, "%s = %s\n", key, vals[0])
+			} else {
+				fmt.Fprintf(writer, "%s = [%s]\n", key, strings.Join(vals, ", "))
+			}
+		}
+
+		// Separate the tables, unless the next begins with a blank
+		// line of its own.
+		if i < len(entries)-1 {
+			next := entries[i+1].Comments
+			if len(next) == 0 || next[0] != "" {
+				fmt.Fprintf(writer, "\n")
+			}
+		}
+	}
+
+	for _, c := range trailing {
+		fmt.Fprintf(writer, "%s\n", c)
+	}
+}
+
+// directive splits a comment which is a directive into its name and
+// value, "#tag news" being the tag directive with the value "news".
+func directive(comment string) (string, string, bool) {
+	if len(comment) < 2 || comment[0] != '#' {
+		return "", "", false
+	}
+	fields := strings.SplitN(comment[1:], " ", 2)
+	name := strings.TrimRight(fields[0], "\t")
+	if name == "" || !optionPattern.MatchString(name+"=") {
+		return "", "", false
+	}
+	value := ""
+	if len(fields) == 2 {
+		value = strings.TrimSpace(fields[1])
+	}
+	return name, value, true
+}
@@ -0,0 +1,151 @@
+package feedlist
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Normalise returns the given URL in its usual form: its scheme and host
+// are lower-case, the default port is dropped, an empty path becomes "/",
+// and repeated trailing slashes become one.  Other feeds, such as local
+// files and commands, and those which refer to environment variables, are
+// returned unchanged.
+func Normalise(link string) string {
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" || hasVariables(link) {
+		return link
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return link
+	}
+	u.Scheme = scheme
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	if trimmed := strings.TrimRight(u.Path, "/"); trimmed != u.Path {
+		u.Path = trimmed + "/"
+		if u.RawPath != "" {
+			u.RawPath = strings.TrimRight(u.RawPath, "/") + "/"
+		}
+	}
+	return u.String()
+}
+
+// Canonical returns the form of the given URL which is shared by its other
+// spellings, those which differ only in their scheme, http or https, a
+// "www." prefix upon their host, their credentials, or a trailing slash,
+// along with the differences Normalise removes.  It is used to compare
+// feeds, rather than to fetch them.
+func Canonical(link string) string {
+	u, err := url.Parse(Normalise(link))
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return link
+	}
+
+	u.Scheme = "https"
+	u.User = nil
+	u.Host = strings.TrimPrefix(u.Host, "www.")
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = strings.TrimSuffix(u.RawPath, "/")
+	return u.String()
+}
+
+// similar returns a key which is shared by URLs which probably name the
+// same feed, as they differ only in the case of their paths, or in the
+// ways Canonical ignores.
+func similar(link string) string {
+	return strings.ToLower(Canonical(link))
+}
+
+// group returns the groups of several feeds which share the same key.
+func (f *FeedList) group(key func(string) string) [][]string {
+	groups := make(map[string][]string)
+	var keys []string
+	for _, eEntry := range f.expandedEntries {
+		k := key(eEntry.URL)
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], eEntry.URL)
+	}
+
+	var out [][]string
+	for _, k := range keys {
+		if len(groups[k]) > 1 {
+			out = append(out, groups[k])
+		}
+	}
+	return out
+}
+
+// Duplicates returns the groups of feeds which are the same feed, listed
+// under different spellings of its URL, as described for Canonical.
+func (f *FeedList) Duplicates() [][]string {
+	return f.group(Canonical)
+}
+
+// sortKey returns the key by which a feed is sorted, its URL without
+// the scheme, so that feeds from the same site are listed together.
+func sortKey(link string) string {
+	link = strings.ToLower(link)
+	if i := strings.Index(link, "://"); i >= 0 {
+		link = link[i+3:]
+	}
+	return link
+}
+
+// Tidied describes the changes made to the feed-list by Tidy.
+type Tidied struct {
+
+	// Renamed maps the URLs which were normalised to their new forms.
+	Renamed map[string]string
+
+	// Similar holds the groups of feeds which are probably the same
+	// feed, spelled differently, including the Duplicates.  They're
+	// left for the user to choose between.
+	Similar [][]string
+}
+
+// Tidy sorts the feeds by their URLs, or by their first tag, and then their
+// URLs, if byTag is set.  Each feed keeps its comments, and options, and
+// feeds without tags are listed last.  The URLs of the feeds are normalised
+// too, and a feed which is then listed twice is only kept once.
+//
+// You must call `Save` if you wish the changes to be persisted.
+func (f *FeedList) Tidy(byTag bool) Tidied {
+
+	tidied := Tidied{Renamed: make(map[string]string)}
+
+	for _, eEntry := range f.Feeds() {
+		if normal := Normalise(eEntry.URL); normal != eEntry.URL {
+			f.Rename(eEntry.URL, normal)
+			tidied.Renamed[eEntry.URL] = normal
+		}
+	}
+
+	tag := func(e Entry) string {
+		tags := e.Tags()
+		if len(tags) == 0 {
+			return ""
+		}
+		return strings.ToLower(tags[0])
+	}
+	sort.SliceStable(f.expandedEntries, func(i, j int) bool {
+		a, b := f.expandedEntries[i], f.expandedEntries[j]
+		if byTag && tag(a) != tag(b) {
+			return tag(b) == "" || (tag(a) != "" && tag(a) < tag(b))
+		}
+		return sortKey(a.URL) < sortKey(b.URL)
+	})
+
+	tidied.Similar = f.group(similar)
+	return tidied
+}
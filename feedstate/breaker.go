@@ -0,0 +1,35 @@
+package feedstate
+
+import "time"
+
+// Failed records that fetching the feed failed, with the given error.
+//
+// Once the feed has failed threshold runs in a row it is left alone for
+// the cooldown period, and true is returned the first time that happens.
+// A threshold of zero disables this.
+func (s *State) Failed(err error, threshold int, cooldown time.Duration, now time.Time) bool {
+
+	s.Failures++
+	s.LastError = err.Error()
+
+	if threshold <= 0 || s.Failures < threshold {
+		return false
+	}
+
+	tripped := s.CoolUntil.IsZero()
+	s.CoolUntil = now.Add(cooldown)
+	return tripped
+}
+
+// Succeeded records that the feed was fetched, clearing any failures.
+func (s *State) Succeeded() {
+	s.Failures = 0
+	s.LastError = ""
+	s.CoolUntil = time.Time{}
+}
+
+// Cooling returns true if the feed has failed repeatedly, and shouldn't
+// be fetched again until its cooldown period has passed.
+func (s *State) Cooling(now time.Time) bool {
+	return !s.CoolUntil.IsZero() && now.Before(s.CoolUntil)
+}
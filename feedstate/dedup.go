@@ -0,0 +1,138 @@
+package feedstate
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Dedup holds statistics about the items of a feed which we suppressed,
+// because they'd been seen before, both for the last run and in total.
+//
+// Items which are new, but share the link of an item which was present
+// the last time the feed was fetched, are "churned": the feed changed
+// their GUIDs, so they'll be sent again.
+type Dedup struct {
+
+	// Runs is the number of times the feed has been processed.
+	Runs int `json:"runs"`
+
+	// Items is the total number of items we've processed.
+	Items int `json:"items"`
+
+	// Suppressed is the total number of items which were skipped,
+	// because they'd been seen before.
+	Suppressed int `json:"suppressed"`
+
+	// Churned is the total number of new items which had the link of
+	// an item seen previously.
+	Churned int `json:"churned"`
+
+	// LastItems, LastSuppressed, and LastChurned are the counts for
+	// the most recent run.
+	LastItems      int `json:"last_items"`
+	LastSuppressed int `json:"last_suppressed"`
+	LastChurned    int `json:"last_churned"`
+
+	// Storms is the number of runs in which many items churned.
+	Storms int `json:"storms"`
+
+	// LastStorm is the time of the most recent of those runs.
+	LastStorm time.Time `json:"last_storm"`
+}
+
+// Record adds the counts from a single run to the statistics.
+func (d *Dedup) Record(items, suppressed, churned int, storm bool) {
+	d.Runs++
+	d.Items += items
+	d.Suppressed += suppressed
+	d.Churned += churned
+
+	d.LastItems = items
+	d.LastSuppressed = suppressed
+	d.LastChurned = churned
+
+	if storm {
+		d.Storms++
+		d.LastStorm = time.Now()
+	}
+}
+
+// Rate returns the percentage of all the items we've processed which
+// were suppressed.
+func (d *Dedup) Rate() float64 {
+	if d.Items == 0 {
+		return 0
+	}
+	return float64(d.Suppressed) * 100 / float64(d.Items)
+}
+
+// linkHash returns the value we store to remember the given link.
+func linkHash(link string) string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(link)))
+}
+
+// HadLink returns true if an item with the given link was present the
+// last time the feed was fetched.
+func (s *State) HadLink(link string) bool {
+	if link == "" {
+		return false
+	}
+
+	hash := linkHash(link)
+	for _, l := range s.Links {
+		if l == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// SetLinks records the links of the items present in the feed, replacing
+// those recorded previously.
+func (s *State) SetLinks(links []string) {
+	s.Links = nil
+	for _, link := range links {
+		if link != "" {
+			s.Links = append(s.Links, linkHash(link))
+		}
+	}
+}
+
+// All returns the saved state of every feed, sorted by URL.
+func All() ([]*State, error) {
+
+	entries, err := ioutil.ReadDir(stateDirectory())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feed-state directory: %s", err.Error())
+	}
+
+	var out []*State
+	for _, fi := range entries {
+		if !fi.Mode().IsRegular() || filepath.Ext(fi.Name()) != ".json" || isSnapshot(fi.Name()) {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(stateDirectory(), fi.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read feed-state: %s", err.Error())
+		}
+
+		s := &State{}
+		if json.Unmarshal(data, s) != nil || s.URL == "" {
+			continue
+		}
+		out = append(out, s)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].URL < out[j].URL })
+	return out, nil
+}
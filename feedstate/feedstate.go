@@ -0,0 +1,207 @@
+// Package feedstate records state about each feed we poll, as opposed
+// to the items within the feeds, which is handled by withstate.
+//
+// The state for each feed is stored as a small JSON file beneath
+// ~/.rss2email/feed-state/, named after the hash of the feed URL, along
+// with a snapshot of the items it contained when last processed.
+package feedstate
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/skx/rss2email/atomicfile"
+	"github.com/skx/rss2email/config"
+)
+
+// statePrefix holds the prefix directory, and is used to
+// allow changes during testing
+var statePrefix string
+
+// State is the persistent state of a single feed.
+type State struct {
+
+	// URL is the feed this state relates to.
+	URL string `json:"url"`
+
+	// NotFound is the number of consecutive runs in which the feed
+	// returned a 404 response.
+	NotFound int `json:"not_found,omitempty"`
+
+	// Failures is the number of consecutive runs in which the feed
+	// could not be fetched, and LastError the reason for the last.
+	Failures  int    `json:"failures,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+
+	// CoolUntil is the time before which we won't try to fetch the
+	// feed again, because it has failed repeatedly.
+	CoolUntil time.Time `json:"cool_until"`
+
+	// Schedule holds the publisher's hints about how often the feed
+	// should be fetched, and NextFetch the time before which we won't
+	// fetch it again, because of them or because the server asked us
+	// to wait.
+	Schedule  Schedule  `json:"schedule"`
+	NextFetch time.Time `json:"next_fetch"`
+
+	// Hub is the WebSub hub which pushes updates of the feed, and Topic
+	// the URL it knows the feed by, as the feed advertised them when it
+	// was last fetched.
+	Hub   string `json:"hub,omitempty"`
+	Topic string `json:"topic,omitempty"`
+
+	// MovedTo is the URL the feed was permanently redirected to,
+	// when it was last fetched, and MoveReported the one we last told
+	// the user about.
+	MovedTo      string `json:"moved_to,omitempty"`
+	MoveReported string `json:"move_reported,omitempty"`
+
+	// LastFetched is the time at which the feed was last fetched
+	// successfully.
+	LastFetched time.Time `json:"last_fetched"`
+
+	// Dedup holds statistics about the items we suppressed.
+	Dedup Dedup `json:"dedup"`
+
+	// Links holds the hashes of the links of the items which were
+	// present when the feed was last fetched.
+	Links []string `json:"links,omitempty"`
+
+	// Seen holds the keys of the items which were present when the
+	// feed was last fetched, so that their state may be kept alive
+	// while the feed is unmodified.
+	Seen []string `json:"seen,omitempty"`
+
+	// Identity is how the items were identified, via #id, when the
+	// feed was last fetched, so that we can tell when it changes.
+	Identity string `json:"identity,omitempty"`
+
+	// ETag and LastModified are the validators returned with the feed
+	// when it was last fetched, which are used to ask the server to
+	// send it only if it has changed.
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// stateDirectory returns the directory beneath which we store state
+func stateDirectory() string {
+
+	// If we've found it already, or we've mocked it, then
+	// return the appropriate value
+	if statePrefix != "" {
+		return statePrefix
+	}
+
+	// Store the path for the future, and return it.
+	statePrefix = filepath.Join(config.StateDirectory(), "feed-state")
+	return statePrefix
+}
+
+// path returns the file which holds the state of the given URL.
+func path(url string) string {
+	return filepath.Join(stateDirectory(), fmt.Sprintf("%x.json", sha1.Sum([]byte(url))))
+}
+
+// Lock takes the lock shared by the feed-state, and the feed-list, which
+// is held while either is written, waiting until it is free.  The function
+// returned releases it.
+func Lock() (func(), error) {
+	unlock, err := atomicfile.Lock(filepath.Join(stateDirectory(), ".lock"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock feed-state: %s", err.Error())
+	}
+	return unlock, nil
+}
+
+// Load returns the state of the given feed.
+//
+// If there is no saved state, or it cannot be read, an empty state is
+// returned.
+func Load(url string) *State {
+	s := &State{URL: url}
+
+	data, err := ioutil.ReadFile(path(url))
+	if err != nil {
+		return s
+	}
+
+	err = json.Unmarshal(data, s)
+	if err != nil {
+		return &State{URL: url}
+	}
+
+	// The state belongs to this URL, regardless of what was stored.
+	s.URL = url
+	return s
+}
+
+// Save persists the state to disk.
+func (s *State) Save() error {
+
+	file := path(s.URL)
+
+	err := os.MkdirAll(filepath.Dir(file), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed to create feed-state directory: %s", err.Error())
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = atomicfile.WriteFile(file, data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write feed-state: %s", err.Error())
+	}
+	return nil
+}
+
+// Record describes a single file within our state directory.
+type Record struct {
+
+	// Path is the location of the file.
+	Path string
+
+	// Size is the size of the file, in bytes.
+	Size int64
+}
+
+// Orphans returns the records which hold the state of feeds other than
+// those given, which are no longer needed.
+func Orphans(urls []string) ([]Record, error) {
+
+	keep := make(map[string]bool)
+	for _, url := range urls {
+		keep[filepath.Base(path(url))] = true
+		keep[filepath.Base(snapshotPath(url))] = true
+	}
+
+	entries, err := ioutil.ReadDir(stateDirectory())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feed-state directory: %s", err.Error())
+	}
+
+	var out []Record
+	for _, fi := range entries {
+		if !fi.Mode().IsRegular() || filepath.Ext(fi.Name()) != ".json" || keep[fi.Name()] {
+			continue
+		}
+		out = append(out, Record{Path: filepath.Join(stateDirectory(), fi.Name()), Size: fi.Size()})
+	}
+	return out, nil
+}
@@ -0,0 +1,277 @@
+package feedstate
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// TestLoadSave ensures state round-trips.
+func TestLoadSave(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "feedstate")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	old := statePrefix
+	statePrefix = dir
+	defer func() { statePrefix = old }()
+
+	// Missing state is empty
+	s := Load("https://example.com/")
+	if s.NotFound != 0 || s.URL != "https://example.com/" {
+		t.Fatalf("unexpected initial state: %v", s)
+	}
+
+	s.NotFound = 3
+	err = s.Save()
+	if err != nil {
+		t.Fatalf("failed to save state: %s", err)
+	}
+
+	s = Load("https://example.com/")
+	if s.NotFound != 3 {
+		t.Fatalf("state wasn't persisted: %v", s)
+	}
+
+	// Other feeds are unaffected
+	s = Load("https://example.org/")
+	if s.NotFound != 0 {
+		t.Fatalf("unexpected state for a different feed: %v", s)
+	}
+}
+
+// TestOrphans ensures we find the state of feeds which were removed.
+func TestOrphans(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "feedstate")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	old := statePrefix
+	statePrefix = dir
+	defer func() { statePrefix = old }()
+
+	// No state is fine.
+	orphans, err := Orphans(nil)
+	if err != nil || len(orphans) != 0 {
+		t.Fatalf("unexpected result: %v %v", orphans, err)
+	}
+
+	for _, url := range []string{"https://example.com/", "https://example.org/"} {
+		s := Load(url)
+		s.NotFound = 1
+		if err = s.Save(); err != nil {
+			t.Fatalf("failed to save state: %s", err)
+		}
+	}
+
+	orphans, err = Orphans([]string{"https://example.com/"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(orphans) != 1 || orphans[0].Path != path("https://example.org/") || orphans[0].Size == 0 {
+		t.Fatalf("unexpected orphans: %v", orphans)
+	}
+}
+
+// TestDedup ensures our statistics, and links, are recorded.
+func TestDedup(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "feedstate")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	old := statePrefix
+	statePrefix = dir
+	defer func() { statePrefix = old }()
+
+	s := Load("https://example.com/")
+	if s.HadLink("https://example.com/one") || s.HadLink("") {
+		t.Fatalf("unexpected link in empty state")
+	}
+
+	s.SetLinks([]string{"https://example.com/one", ""})
+	s.Dedup.Record(4, 3, 0, false)
+	s.Dedup.Record(4, 1, 2, true)
+	if err = s.Save(); err != nil {
+		t.Fatalf("failed to save state: %s", err)
+	}
+
+	all, err := All()
+	if err != nil || len(all) != 1 {
+		t.Fatalf("unexpected states: %v %v", all, err)
+	}
+
+	s = all[0]
+	if s.URL != "https://example.com/" || !s.HadLink("https://example.com/one") || s.HadLink("https://example.com/two") {
+		t.Fatalf("links weren't persisted: %v", s)
+	}
+
+	d := s.Dedup
+	if d.Runs != 2 || d.Items != 8 || d.Suppressed != 4 || d.Churned != 2 || d.Rate() != 50 {
+		t.Fatalf("unexpected totals: %v", d)
+	}
+	if d.LastItems != 4 || d.LastSuppressed != 1 || d.LastChurned != 2 {
+		t.Fatalf("unexpected last run: %v", d)
+	}
+	if d.Storms != 1 || d.LastStorm.IsZero() {
+		t.Fatalf("storm wasn't recorded: %v", d)
+	}
+}
+
+// TestBreaker ensures failing feeds are left alone for a while.
+func TestBreaker(t *testing.T) {
+
+	now := time.Date(2021, time.March, 7, 12, 0, 0, 0, time.UTC)
+	s := &State{URL: "https://example.com/"}
+
+	for i := 1; i <= 3; i++ {
+		tripped := s.Failed(errors.New("timeout"), 3, time.Hour, now)
+		if tripped != (i == 3) {
+			t.Fatalf("failure %d: unexpected result %v", i, tripped)
+		}
+	}
+	if !s.Cooling(now) || !s.Cooling(now.Add(59*time.Minute)) || s.Cooling(now.Add(time.Hour)) {
+		t.Fatalf("unexpected cooldown: %v", s.CoolUntil)
+	}
+	if s.Failures != 3 || s.LastError != "timeout" {
+		t.Fatalf("failures weren't recorded: %v", s)
+	}
+
+	// A further failure cools again, but isn't reported.
+	later := now.Add(2 * time.Hour)
+	if s.Failed(errors.New("refused"), 3, time.Hour, later) || !s.Cooling(later) {
+		t.Fatalf("a further failure didn't cool the feed: %v", s)
+	}
+
+	s.Succeeded()
+	if s.Cooling(later) || s.Failures != 0 || s.LastError != "" {
+		t.Fatalf("success didn't reset the state: %v", s)
+	}
+
+	// A zero threshold never cools.
+	for i := 0; i < 10; i++ {
+		s.Failed(errors.New("timeout"), 0, time.Hour, now)
+	}
+	if s.Cooling(now) {
+		t.Fatalf("a zero threshold cooled the feed")
+	}
+}
+
+// TestSnapshot ensures snapshots are saved, and compared.
+func TestSnapshot(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "feedstate")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	old := statePrefix
+	statePrefix = dir
+	defer func() { statePrefix = old }()
+
+	url := "https://example.com/"
+
+	s, err := LoadSnapshot(url)
+	if s != nil || err != nil {
+		t.Fatalf("unexpected snapshot: %v %v", s, err)
+	}
+
+	feed := &gofeed.Feed{Items: []*gofeed.Item{
+		{GUID: "1", Title: "One", Link: "https://example.com/1", Content: "one"},
+		{Title: "Two", Link: "https://example.com/2", Description: "two"},
+		{GUID: "3", Title: "Three", Content: "three"},
+	}}
+	err = NewSnapshot(url, feed).Save()
+	if err != nil {
+		t.Fatalf("failed to save snapshot: %s", err)
+	}
+
+	s, err = LoadSnapshot(url)
+	if err != nil || len(s.Items) != 3 || s.Items[1].ID != "https://example.com/2" {
+		t.Fatalf("snapshot wasn't persisted: %v %v", s, err)
+	}
+
+	// The snapshot is neither state, nor an orphan.
+	all, err := All()
+	if err != nil || len(all) != 0 {
+		t.Fatalf("snapshot treated as state: %v %v", all, err)
+	}
+	orphans, err := Orphans([]string{url})
+	if err != nil || len(orphans) != 0 {
+		t.Fatalf("snapshot treated as an orphan: %v %v", orphans, err)
+	}
+
+	feed.Items[0].Content = "uno"
+	feed.Items[0].Title = "Uno"
+	feed.Items = append(feed.Items[:2], &gofeed.Item{GUID: "4", Title: "Four"})
+
+	added, removed, changed := s.Diff(NewSnapshot(url, feed))
+	if len(added) != 1 || added[0].ID != "4" {
+		t.Errorf("unexpected additions: %v", added)
+	}
+	if len(removed) != 1 || removed[0].ID != "3" {
+		t.Errorf("unexpected removals: %v", removed)
+	}
+	if len(changed) != 1 || changed[0].Item.ID != "1" || strings.Join(changed[0].Fields, ",") != "title,content" {
+		t.Errorf("unexpected changes: %v", changed)
+	}
+}
+
+// TestSchedule tests the time we may next fetch a feed.
+func TestSchedule(t *testing.T) {
+
+	// A Monday morning.
+	from := time.Date(2021, 3, 1, 9, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		schedule Schedule
+		next     time.Time
+	}{
+		{Schedule{}, from},
+		{Schedule{TTL: time.Hour}, from.Add(time.Hour)},
+		{Schedule{TTL: 30 * 24 * time.Hour}, from.Add(MaxWait)},
+		{Schedule{SkipHours: []int{9, 10, 11}}, time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)},
+		{Schedule{TTL: time.Hour, SkipHours: []int{9}}, from.Add(time.Hour)},
+		{Schedule{SkipDays: []time.Weekday{time.Monday, time.Tuesday}}, time.Date(2021, 3, 3, 0, 0, 0, 0, time.UTC)},
+		{Schedule{SkipDays: []time.Weekday{0, 1, 2, 3, 4, 5, 6}}, from},
+	}
+
+	for _, tst := range tests {
+		if next := tst.schedule.Next(from); !next.Equal(tst.next) {
+			t.Errorf("%v: expected %s, got %s", tst.schedule, tst.next, next)
+		}
+	}
+
+	s := &State{}
+	if s.Waiting(from) {
+		t.Fatalf("a new feed shouldn't be waiting")
+	}
+	s.Defer(time.Hour, from)
+	if !s.Waiting(from.Add(59*time.Minute)) || s.Waiting(from.Add(time.Hour)) {
+		t.Errorf("unexpected wait, until %s", s.NextFetch)
+	}
+
+	// We never wait less than we've been asked to, or too long.
+	s.Defer(time.Minute, from)
+	if !s.NextFetch.Equal(from.Add(time.Hour)) {
+		t.Errorf("wait was shortened, until %s", s.NextFetch)
+	}
+	s.Defer(365*24*time.Hour, from)
+	if !s.NextFetch.Equal(from.Add(MaxWait)) {
+		t.Errorf("wait wasn't limited, until %s", s.NextFetch)
+	}
+}
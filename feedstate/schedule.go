@@ -0,0 +1,79 @@
+package feedstate
+
+import "time"
+
+// MaxWait is the longest a publisher may ask us to wait before fetching
+// their feed again; longer requests are cut short.
+const MaxWait = 7 * 24 * time.Hour
+
+// Schedule holds the hints a publisher gave about how often their feed
+// should be fetched, via the <ttl>, <skipHours>, and <skipDays> elements
+// of an RSS feed.
+type Schedule struct {
+
+	// TTL is the time for which the feed may be cached.
+	TTL time.Duration `json:"ttl,omitempty"`
+
+	// SkipHours are the hours, in UTC, during which the feed shouldn't
+	// be fetched.
+	SkipHours []int `json:"skip_hours,omitempty"`
+
+	// SkipDays are the days, in UTC, on which the feed shouldn't be
+	// fetched.
+	SkipDays []time.Weekday `json:"skip_days,omitempty"`
+}
+
+// skipped returns true if the feed shouldn't be fetched at the given time.
+func (s Schedule) skipped(t time.Time) bool {
+	t = t.UTC()
+	for _, h := range s.SkipHours {
+		if t.Hour() == h {
+			return true
+		}
+	}
+	for _, d := range s.SkipDays {
+		if t.Weekday() == d {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the earliest time the feed should be fetched, following
+// a fetch at the given time.
+//
+// If the hours and days to skip leave no time at all, within MaxWait,
+// they're ignored.
+func (s Schedule) Next(from time.Time) time.Time {
+
+	ttl := s.TTL
+	if ttl > MaxWait {
+		ttl = MaxWait
+	}
+	next := from.Add(ttl)
+
+	limit := from.Add(MaxWait)
+	for t := next; t.Before(limit); t = t.UTC().Truncate(time.Hour).Add(time.Hour) {
+		if !s.skipped(t) {
+			return t
+		}
+	}
+	return next
+}
+
+// Defer records that the feed shouldn't be fetched again for the given
+// time, because its server asked us to wait, via Retry-After.
+func (s *State) Defer(wait time.Duration, now time.Time) {
+	if wait > MaxWait {
+		wait = MaxWait
+	}
+	if until := now.Add(wait); until.After(s.NextFetch) {
+		s.NextFetch = until
+	}
+}
+
+// Waiting returns true if the feed shouldn't be fetched yet, because its
+// publisher asked us not to.
+func (s *State) Waiting(now time.Time) bool {
+	return now.Before(s.NextFetch)
+}
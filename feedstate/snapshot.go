@@ -0,0 +1,201 @@
+package feedstate
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// snapshotSuffix is the suffix of the files which hold our snapshots,
+// which live alongside the state of their feeds.
+const snapshotSuffix = ".snapshot.json"
+
+// Snapshot is a summary of the items in a feed, as it was when it was
+// last processed, so that we may see how it has changed since.
+type Snapshot struct {
+
+	// URL is the feed this snapshot relates to.
+	URL string `json:"url"`
+
+	// Taken is the time at which the snapshot was taken.
+	Taken time.Time `json:"taken"`
+
+	// Items holds the summary of each item in the feed.
+	Items []SnapshotItem `json:"items"`
+}
+
+// SnapshotItem is the summary of a single item, within a snapshot.
+type SnapshotItem struct {
+
+	// ID identifies the item, it is the GUID, or the link of an item
+	// without one, as used to record whether it has been seen.
+	ID string `json:"id"`
+
+	// Title is the title of the item.
+	Title string `json:"title"`
+
+	// Link is the link to the item.
+	Link string `json:"link,omitempty"`
+
+	// Date is the time the item was last updated, or published, as
+	// given by the feed.
+	Date string `json:"date,omitempty"`
+
+	// Content is a hash of the content of the item.
+	Content string `json:"content"`
+}
+
+// snapshotPath returns the file which holds the snapshot of the given
+// URL.
+func snapshotPath(url string) string {
+	return filepath.Join(stateDirectory(), fmt.Sprintf("%x%s", sha1.Sum([]byte(url)), snapshotSuffix))
+}
+
+// NewSnapshot returns a snapshot of the given feed, fetched from the
+// given URL.
+func NewSnapshot(url string, feed *gofeed.Feed) *Snapshot {
+
+	s := &Snapshot{URL: url, Taken: time.Now()}
+
+	for _, item := range feed.Items {
+		id := item.GUID
+		if id == "" {
+			id = item.Link
+		}
+
+		date := item.Updated
+		if date == "" {
+			date = item.Published
+		}
+
+		content := item.Content
+		if content == "" {
+			content = item.Description
+		}
+
+		s.Items = append(s.Items, SnapshotItem{
+			ID:      id,
+			Title:   item.Title,
+			Link:    item.Link,
+			Date:    date,
+			Content: fmt.Sprintf("%x", sha1.Sum([]byte(content))),
+		})
+	}
+
+	return s
+}
+
+// LoadSnapshot returns the snapshot of the given feed, or nil if there
+// is none.
+func LoadSnapshot(url string) (*Snapshot, error) {
+
+	data, err := ioutil.ReadFile(snapshotPath(url))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %s", err.Error())
+	}
+
+	s := &Snapshot{}
+	err = json.Unmarshal(data, s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot: %s", err.Error())
+	}
+	s.URL = url
+	return s, nil
+}
+
+// Save persists the snapshot to disk, replacing any previous snapshot.
+func (s *Snapshot) Save() error {
+
+	file := snapshotPath(s.URL)
+
+	err := os.MkdirAll(filepath.Dir(file), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed to create feed-state directory: %s", err.Error())
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(file, data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write snapshot: %s", err.Error())
+	}
+	return nil
+}
+
+// Change describes an item which differs between two snapshots.
+type Change struct {
+
+	// Item is the item, as it is now.
+	Item SnapshotItem
+
+	// Fields holds the names of the fields which changed.
+	Fields []string
+}
+
+// Diff compares the snapshot with a later one, returning the items
+// which were added, those which were removed, and those which changed.
+func (s *Snapshot) Diff(later *Snapshot) ([]SnapshotItem, []SnapshotItem, []Change) {
+
+	before := make(map[string]SnapshotItem)
+	for _, item := range s.Items {
+		before[item.ID] = item
+	}
+	after := make(map[string]bool)
+
+	var added, removed []SnapshotItem
+	var changed []Change
+
+	for _, item := range later.Items {
+		after[item.ID] = true
+
+		old, ok := before[item.ID]
+		if !ok {
+			added = append(added, item)
+			continue
+		}
+
+		var fields []string
+		if old.Title != item.Title {
+			fields = append(fields, "title")
+		}
+		if old.Link != item.Link {
+			fields = append(fields, "link")
+		}
+		if old.Date != item.Date {
+			fields = append(fields, "date")
+		}
+		if old.Content != item.Content {
+			fields = append(fields, "content")
+		}
+		if len(fields) > 0 {
+			changed = append(changed, Change{Item: item, Fields: fields})
+		}
+	}
+
+	for _, item := range s.Items {
+		if !after[item.ID] {
+			removed = append(removed, item)
+		}
+	}
+
+	return added, removed, changed
+}
+
+// isSnapshot returns true if the named file holds a snapshot, rather
+// than the state of a feed.
+func isSnapshot(name string) bool {
+	return strings.HasSuffix(name, snapshotSuffix)
+}
@@ -3,14 +3,14 @@ module github.com/skx/rss2email
 go 1.16
 
 require (
-	github.com/PuerkitoBio/goquery v1.5.1 // indirect
-	github.com/andybalholm/cascadia v1.2.0 // indirect
-	github.com/k3a/html2text v0.0.0-20191003111652-62431c4a3ba5
+	github.com/PuerkitoBio/goquery v1.5.1
+	github.com/andybalholm/cascadia v1.2.0
 	github.com/mmcdole/gofeed v1.0.0
 	github.com/skx/subcommands v0.8.0
 	github.com/smartystreets/goconvey v0.0.0-20190306220146-200a235640ff // indirect
 	github.com/stretchr/testify v1.3.0 // indirect
 	golang.org/x/mod v0.4.1 // indirect
+	golang.org/x/net v0.0.0-20201021035429-f5854403a974
 	golang.org/x/sys v0.0.0-20210217105451-b926d437f341 // indirect
 	golang.org/x/text v0.3.3 // indirect
 	honnef.co/go/tools v0.1.1 // indirect
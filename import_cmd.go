@@ -1,54 +1,71 @@
 //
-// Import an OPML feedlist.
+// Import the feed-lists of other feed-readers.
 //
 
 package main
 
 import (
-	"encoding/xml"
+	"flag"
 	"fmt"
 	"io/ioutil"
+	"strings"
 
 	"github.com/skx/rss2email/feedlist"
-	"github.com/skx/subcommands"
+	"github.com/skx/rss2email/importer"
 )
 
-type opml struct {
-	XMLName   xml.Name  `xml:"opml"`
-	Version   string    `xml:"version,attr"`
-	OpmlTitle string    `xml:"head>title"`
-	Outlines  []outline `xml:"body>outline"`
-}
-
-type outline struct {
-	Text    string `xml:"text,attr"`
-	Title   string `xml:"title,attr"`
-	Type    string `xml:"type,attr"`
-	XMLURL  string `xml:"xmlUrl,attr"`
-	HTMLURL string `xml:"htmlUrl,attr"`
-	Favicon string `xml:"rssfr-favicon,attr"`
-}
-
 // Structure for our options and state.
 type importCmd struct {
 
-	// We embed the NoFlags option, because we accept no command-line flags.
-	subcommands.NoFlags
+	// The format of the files we're importing, or "" to detect it.
+	format string
 }
 
 // Info is part of the subcommand-API
 func (i *importCmd) Info() (string, string) {
-	return "import", `Import a list of feeds via an OPML file.
+	return "import", `Import a list of feeds, from OPML or another feed-reader.
+
+The feeds within each of the given files are added to our feed-list.  The
+following formats are understood, and detected automatically, or may be
+given via '-format':
+
+    opml      An OPML document, as exported by most feed-readers,
+              including Liferea.  Feeds may be nested within folders,
+              which become their tags.
+
+    newsboat  The 'urls' file of newsboat, or newsbeuter.  The tags
+              following each URL are kept, and a "~title" becomes a
+              comment above the feed.
+
+    r2e       The configuration file of the classic rss2email, usually
+              ~/.config/rss2email.cfg.  The name of each feed becomes
+              a comment above it, recipients specific to a feed are
+              kept, and inactive feeds are disabled.
+
+Tags containing spaces have them replaced by hyphens, and titles are
+written on a single line.  Commands, local files, and URLs containing
+variables are never imported, they must be added to the feed-list by hand.
 
 Example:
 
     $ rss2email import file1.opml file2.opml .. fileN.opml
+    $ rss2email import ~/.newsboat/urls
+    $ rss2email import -format r2e ~/.config/rss2email.cfg
 `
 }
 
+// Arguments handles our flag-setup.
+func (i *importCmd) Arguments(f *flag.FlagSet) {
+	f.StringVar(&i.format, "format", "", "The format of the files, \"opml\", \"newsboat\", or \"r2e\", detected if unset.")
+}
+
 // Execute is invoked if the user specifies `import` as the subcommand.
 func (i *importCmd) Execute(args []string) int {
 
+	if readOnly("import feeds") {
+		return 1
+	}
+
 	// Get the feed-list, from the default location.
 	list := feedlist.New("")
 
@@ -65,24 +82,56 @@ func (i *importCmd) Execute(args []string) int {
 		}
 
 		// Parse
-		o := opml{}
-		err = xml.Unmarshal(data, &o)
+		format := i.format
+		if format == "" {
+			format = importer.Detect(file, data)
+		}
+		feeds, err := importer.Parse(format, data)
 		if err != nil {
 			fmt.Printf("failed to parse %s: %s\n", file, err.Error())
 			continue
 		}
-		entries := make([]string, len(o.Outlines))
-		for i, outline := range o.Outlines {
 
-			if outline.XMLURL != "" {
-				fmt.Printf("Adding %s\n", outline.XMLURL)
-				entries[i] = outline.XMLURL
-				added++
-			}
+		present := make(map[string]bool)
+		for _, uri := range list.Entries() {
+			present[uri] = true
 		}
-		errors := list.Add(entries...)
-		for _, err := range errors {
-			fmt.Printf("%s\n", (err.Error()))
+
+		for _, feed := range feeds {
+
+			// Commands, local files, and variables are only
+			// used if they were added by hand, never because
+			// somebody sent us a file.
+			if feedlist.IsUntrusted(feed.URL) {
+				fmt.Printf("Skipping %s, commands, local files, and variables must be added to the feed-list by hand\n", feedlist.Redact(feed.URL))
+				continue
+			}
+
+			fmt.Printf("Adding %s\n", feedlist.Redact(feed.URL))
+			errors := list.Add(feed.URL)
+			for _, err := range errors {
+				fmt.Printf("%s\n", (err.Error()))
+			}
+			if len(errors) > 0 || present[feed.URL] {
+				continue
+			}
+			added++
+
+			// Keep what we know of the feed.
+			var comments []string
+			if feed.Title != "" {
+				comments = append(comments, "# "+feed.Title)
+			}
+			if len(feed.Tags) > 0 {
+				comments = append(comments, "#tag "+strings.Join(feed.Tags, ","))
+			}
+			if len(feed.To) > 0 {
+				comments = append(comments, "#to "+strings.Join(feed.To, ","))
+			}
+			list.Annotate(feed.URL, comments...)
+			if feed.Disabled {
+				list.Disable(feed.URL, "")
+			}
 		}
 	}
 
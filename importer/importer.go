@@ -0,0 +1,311 @@
+// Package importer reads the feed-lists of other feed-readers, so that
+// switching to us is a single command.
+//
+// We understand OPML, as exported by most readers including Liferea, the
+// "urls" file of newsboat, and the configuration file of the classic,
+// Python, rss2email.
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// OPML is an OPML document, whose folders become tags.
+	OPML = "opml"
+
+	// Newsboat is the "urls" file of newsboat, or newsbeuter, which
+	// has a feed on each line followed by its tags.
+	Newsboat = "newsboat"
+
+	// R2E is the configuration file of the classic rss2email, usually
+	// ~/.config/rss2email.cfg.
+	R2E = "r2e"
+)
+
+// Feed is a single feed found in another feed-list.
+type Feed struct {
+
+	// URL is the location of the feed.
+	URL string
+
+	// Title is the title the feed was given, if any.
+	Title string
+
+	// Tags are the tags, or folders, of the feed.  Spaces are replaced
+	// by hyphens, as our tags cannot contain them.
+	Tags []string
+
+	// To are the recipients of the feed, if they're specific to it.
+	To []string
+
+	// Disabled is true if the feed wasn't being polled.
+	Disabled bool
+}
+
+// Detect returns the format of the given feed-list, from its name and
+// its contents.  A file which is neither OPML, nor the configuration of
+// rss2email, is taken to be the urls file of newsboat.
+func Detect(name string, data []byte) string {
+	switch {
+	case bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")):
+		return OPML
+	case filepath.Ext(name) == ".cfg" || bytes.Contains(data, []byte("[feed.")):
+		return R2E
+	}
+	return Newsboat
+}
+
+// Parse returns the feeds within the given feed-list, which is in the
+// given format.
+//
+// The whitespace within titles, including any newlines, is collapsed to
+// single spaces, since they become comments within our feed-list and must
+// not add lines of their own.
+func Parse(format string, data []byte) ([]Feed, error) {
+
+	var feeds []Feed
+	var err error
+
+	switch format {
+	case OPML:
+		feeds, err = parseOPML(data)
+	case Newsboat:
+		feeds, err = parseNewsboat(data)
+	case R2E:
+		feeds, err = parseR2E(data)
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected %q, %q, or %q", format, OPML, Newsboat, R2E)
+	}
+
+	for i := range feeds {
+		feeds[i].Title = strings.Join(strings.Fields(feeds[i].Title), " ")
+	}
+	return feeds, err
+}
+
+// tag returns the given name as a tag.
+func tag(name string) string {
+	return strings.Join(strings.Fields(name), "-")
+}
+
+// outline is an entry within an OPML document, which is either a feed or
+// a folder of them.
+type outline struct {
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Outlines []outline  `xml:"outline"`
+}
+
+// attr returns the value of the named attribute, ignoring case, as not
+// every reader uses the same.
+func (o outline) attr(names ...string) string {
+	for _, name := range names {
+		for _, a := range o.Attrs {
+			if strings.EqualFold(a.Name.Local, name) && a.Value != "" {
+				return a.Value
+			}
+		}
+	}
+	return ""
+}
+
+// parseOPML returns the feeds within an OPML document.  Outlines may be
+// nested within folders, as Liferea and others export them, and each
+// folder becomes a tag of the feeds within it.  Liferea's search folders,
+// and other outlines without a feed, are ignored.
+func parseOPML(data []byte) ([]Feed, error) {
+	var doc struct {
+		Outlines []outline `xml:"body>outline"`
+	}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	var feeds []Feed
+	var walk func(outlines []outline, tags []string)
+	walk = func(outlines []outline, tags []string) {
+		for _, o := range outlines {
+			title := o.attr("title", "text")
+			link := o.attr("xmlUrl")
+			if link == "" && strings.EqualFold(o.attr("type"), "rss") {
+				link = o.attr("url")
+			}
+
+			if link != "" {
+				feeds = append(feeds, Feed{URL: link, Title: title, Tags: tags})
+			}
+			if len(o.Outlines) > 0 {
+				inner := tags
+				if title != "" {
+					inner = append(append([]string(nil), tags...), tag(title))
+				}
+				walk(o.Outlines, inner)
+			}
+		}
+	}
+	walk(doc.Outlines, nil)
+
+	return feeds, nil
+}
+
+// parseNewsboat returns the feeds within a newsboat "urls" file.
+//
+// Each line holds a URL followed by its tags, which may be quoted, a tag
+// beginning with "~" giving the feed's title.  Query feeds, and those
+// which run a command or filter, are ignored, as are comments.
+func parseNewsboat(data []byte) ([]Feed, error) {
+	var feeds []Feed
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := splitQuoted(strings.TrimSpace(scanner.Text()))
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		link := fields[0]
+		lower := strings.ToLower(link)
+		if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") && !strings.HasPrefix(lower, "file://") {
+			continue
+		}
+
+		feed := Feed{URL: link}
+		for _, field := range fields[1:] {
+			switch {
+			case strings.HasPrefix(field, "~"):
+				feed.Title = field[1:]
+			case field == "!":
+				feed.Disabled = true
+			case field != "":
+				feed.Tags = append(feed.Tags, tag(field))
+			}
+		}
+		feeds = append(feeds, feed)
+	}
+
+	return feeds, scanner.Err()
+}
+
+// splitQuoted splits a line into its words, which may be quoted.
+func splitQuoted(line string) []string {
+	var out []string
+	var word strings.Builder
+	quoted, started := false, false
+
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			started = true
+		case !quoted && (r == ' ' || r == '\t'):
+			if started {
+				out = append(out, word.String())
+				word.Reset()
+				started = false
+			}
+		default:
+			word.WriteRune(r)
+			started = true
+		}
+	}
+	if started {
+		out = append(out, word.String())
+	}
+	return out
+}
+
+// parseR2E returns the feeds within the configuration file of the classic
+// rss2email.
+//
+// Each feed is a section named "feed.name", whose name becomes its title.
+// The recipients given by its "to" setting are kept, if they differ from
+// those of the "DEFAULT" section, and a feed with "active = False" is
+// disabled.
+func parseR2E(data []byte) ([]Feed, error) {
+	var feeds []Feed
+	var feed *Feed
+	to := ""
+
+	recipients := func(value string) []string {
+		var out []string
+		for _, addr := range strings.Split(value, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				out = append(out, addr)
+			}
+		}
+		return out
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	section := ""
+	for scanner.Scan() {
+		line++
+		raw := scanner.Text()
+		txt := strings.TrimSpace(raw)
+		if txt == "" || strings.HasPrefix(txt, "#") || strings.HasPrefix(txt, ";") {
+			continue
+		}
+
+		// Values may continue upon indented lines, none of which
+		// we need.
+		if strings.HasPrefix(raw, " ") || strings.HasPrefix(raw, "\t") {
+			continue
+		}
+
+		if strings.HasPrefix(txt, "[") && strings.HasSuffix(txt, "]") {
+			section = txt[1 : len(txt)-1]
+			if strings.HasPrefix(section, "feed.") {
+				feeds = append(feeds, Feed{Title: strings.TrimPrefix(section, "feed.")})
+				feed = &feeds[len(feeds)-1]
+			} else {
+				feed = nil
+			}
+			continue
+		}
+
+		parts := strings.SplitN(txt, "=", 2)
+		if len(parts) != 2 {
+			parts = strings.SplitN(txt, ":", 2)
+		}
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: expected name = value, got %q", line, txt)
+		}
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+
+		switch {
+		case section == "DEFAULT" && name == "to":
+			to = value
+		case feed == nil:
+		case name == "url":
+			feed.URL = value
+		case name == "to":
+			feed.To = recipients(value)
+		case name == "active":
+			feed.Disabled = strings.EqualFold(value, "false") || value == "0" || strings.EqualFold(value, "no")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// Only the feeds which have a URL are useful, and only those
+	// recipients which differ from everybody else's are kept.
+	var out []Feed
+	for _, f := range feeds {
+		if f.URL == "" {
+			continue
+		}
+		if strings.Join(f.To, ",") == strings.Join(recipients(to), ",") {
+			f.To = nil
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
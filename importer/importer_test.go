@@ -0,0 +1,145 @@
+package importer
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestDetect tests guessing the format of a feed-list.
+func TestDetect(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		data     string
+		expected string
+	}{
+		{"feeds.opml", "\n<?xml version=\"1.0\"?><opml/>", OPML},
+		{"rss2email.cfg", "[DEFAULT]\nto = bob@example.com\n", R2E},
+		{"config", "[feed.blog]\nurl = https://example.com/\n", R2E},
+		{"urls", "https://example.com/ news\n", Newsboat},
+	}
+	for _, test := range tests {
+		if out := Detect(test.name, []byte(test.data)); out != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, out)
+		}
+	}
+
+	if _, err := Parse("yaml", nil); err == nil {
+		t.Errorf("expected an error with an unknown format")
+	}
+}
+
+// TestOPML tests reading nested outlines, as Liferea writes them.
+func TestOPML(t *testing.T) {
+
+	data := `<?xml version="1.0"?>
+<opml version="1.0">
+<head><title>Liferea Feeds Export</title></head>
+<body>
+<outline title="Top" text="Top" xmlUrl="https://example.com/top.rss"/>
+<outline title="Tech News" text="Tech News">
+  <outline text="Go" type="rss" xmlurl="https://go.dev/blog/feed.atom"/>
+  <outline title="Linux">
+    <outline title="LWN" type="rss" url="https://lwn.net/headlines/rss"/>
+  </outline>
+  <outline title="Unread" type="vfolder"/>
+</outline>
+</body>
+</opml>`
+
+	feeds, err := Parse(OPML, []byte(data))
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+
+	expected := []Feed{
+		{URL: "https://example.com/top.rss", Title: "Top"},
+		{URL: "https://go.dev/blog/feed.atom", Title: "Go", Tags: []string{"Tech-News"}},
+		{URL: "https://lwn.net/headlines/rss", Title: "LWN", Tags: []string{"Tech-News", "Linux"}},
+	}
+	if !reflect.DeepEqual(feeds, expected) {
+		t.Errorf("unexpected feeds: %#v", feeds)
+	}
+
+	// Titles never span lines, lest they add directives.
+	feeds, err = Parse(OPML, []byte(`<opml><body><outline title="Blog&#10;#transcode touch /tmp/pwned&#13;&#9;x" xmlUrl="https://example.com/"/></body></opml>`))
+	if err != nil || len(feeds) != 1 || feeds[0].Title != "Blog #transcode touch /tmp/pwned x" {
+		t.Errorf("unexpected feeds: %#v %v", feeds, err)
+	}
+
+	if _, err := Parse(OPML, []byte("<opml><body>")); err == nil {
+		t.Errorf("expected an error with malformed OPML")
+	}
+}
+
+// TestNewsboat tests reading the urls file of newsboat.
+func TestNewsboat(t *testing.T) {
+
+	data := `# My feeds
+https://example.com/one.rss
+https://example.com/two.rss news "Tech News" "~Example Two"
+https://example.com/three.rss ! old
+
+"query:Unread:unread = \"yes\""
+exec:~/bin/make-feed
+filter:~/bin/filter:https://example.com/four.rss
+`
+
+	feeds, err := Parse(Newsboat, []byte(data))
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+
+	expected := []Feed{
+		{URL: "https://example.com/one.rss"},
+		{URL: "https://example.com/two.rss", Title: "Example Two", Tags: []string{"news", "Tech-News"}},
+		{URL: "https://example.com/three.rss", Tags: []string{"old"}, Disabled: true},
+	}
+	if !reflect.DeepEqual(feeds, expected) {
+		t.Errorf("unexpected feeds: %#v", feeds)
+	}
+}
+
+// TestR2E tests reading the configuration of the classic rss2email.
+func TestR2E(t *testing.T) {
+
+	data := `[DEFAULT]
+to = bob@example.com
+html-mail = True
+trust-guid = True
+	continued
+
+[feed.blog]
+url = https://example.com/blog.rss
+to = bob@example.com
+
+[feed.work]
+url = https://example.com/work.rss
+to = alice@example.com, carol@example.com
+
+[feed.old]
+url = https://example.com/old.rss
+active = False
+
+[feed.broken]
+to = alice@example.com
+`
+
+	feeds, err := Parse(R2E, []byte(data))
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+
+	expected := []Feed{
+		{URL: "https://example.com/blog.rss", Title: "blog"},
+		{URL: "https://example.com/work.rss", Title: "work", To: []string{"alice@example.com", "carol@example.com"}},
+		{URL: "https://example.com/old.rss", Title: "old", Disabled: true},
+	}
+	if !reflect.DeepEqual(feeds, expected) {
+		t.Errorf("unexpected feeds: %#v", feeds)
+	}
+
+	if _, err := Parse(R2E, []byte("[feed.x]\nnonsense\n")); err == nil {
+		t.Errorf("expected an error with a malformed file")
+	}
+}
@@ -0,0 +1,113 @@
+// Package toml parses the small subset of TOML which we accept in our
+// configuration file and the structured feed-list.
+//
+// Each line holds a single key and value, or a table header.  Values are
+// strings, either basic or literal, integers, booleans, or arrays of them
+// given upon a single line.  Nothing else is supported.
+package toml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StripComment removes any comment from the given line, taking care
+// not to treat a '#' within a string as a comment.
+func StripComment(line string) string {
+	quote := rune(0)
+	escaped := false
+
+	for i, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quote == '"':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// ParseValue parses a value, which may be a string, an array of them,
+// an integer, or a boolean.  The elements of an array are returned in
+// turn, anything else as a single element.
+func ParseValue(val string) ([]string, error) {
+
+	switch {
+	case strings.HasPrefix(val, "\""):
+		s, err := strconv.Unquote(val)
+		if err != nil {
+			return nil, fmt.Errorf("malformed string %s", val)
+		}
+		return []string{s}, nil
+
+	case strings.HasPrefix(val, "'"):
+		if len(val) < 2 || !strings.HasSuffix(val, "'") {
+			return nil, fmt.Errorf("malformed string %s", val)
+		}
+		return []string{val[1 : len(val)-1]}, nil
+
+	case strings.HasPrefix(val, "["):
+		if !strings.HasSuffix(val, "]") {
+			return nil, fmt.Errorf("malformed array %s, arrays must be given on a single line", val)
+		}
+		items := []string{}
+		for _, item := range splitArray(val[1 : len(val)-1]) {
+			s, err := ParseValue(item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, s...)
+		}
+		return items, nil
+
+	case val == "true" || val == "false":
+		return []string{val}, nil
+	}
+
+	if _, err := strconv.ParseInt(val, 10, 64); err != nil {
+		return nil, fmt.Errorf("unsupported value %s", val)
+	}
+	return []string{val}, nil
+}
+
+// splitArray splits the contents of an array into its elements.
+func splitArray(s string) []string {
+	var out []string
+	quote := rune(0)
+	escaped := false
+	start := 0
+
+	for i, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quote == '"':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			out = append(out, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+
+	last := strings.TrimSpace(s[start:])
+	if last != "" {
+		out = append(out, last)
+	}
+	return out
+}
@@ -0,0 +1,56 @@
+package toml
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestStripComment tests removing comments, but not from within strings.
+func TestStripComment(t *testing.T) {
+
+	tests := map[string]string{
+		`key = 3 # three`:            `key = 3 `,
+		`key = "#hash" # comment`:    `key = "#hash" `,
+		`key = '#hash' # comment`:    `key = '#hash' `,
+		`key = "a \" # b" # comment`: `key = "a \" # b" `,
+		`# just a comment`:           ``,
+	}
+
+	for in, out := range tests {
+		if got := StripComment(in); got != out {
+			t.Errorf("StripComment(%q) = %q, expected %q", in, got, out)
+		}
+	}
+}
+
+// TestParseValue tests parsing each kind of value.
+func TestParseValue(t *testing.T) {
+
+	tests := map[string]string{
+		`"basic"`:                  `basic`,
+		`"tab\there"`:              "tab\there",
+		`'C:\literal'`:             `C:\literal`,
+		`42`:                       `42`,
+		`true`:                     `true`,
+		`[]`:                       ``,
+		`["a", 'b', 3]`:            `a|b|3`,
+		`["quote \", comma", "c"]`: `quote ", comma|c`,
+	}
+
+	for in, out := range tests {
+		got, err := ParseValue(in)
+		if err != nil {
+			t.Errorf("unexpected error parsing %s: %s", in, err)
+			continue
+		}
+		if strings.Join(got, "|") != out {
+			t.Errorf("ParseValue(%s) = %q, expected %q", in, got, out)
+		}
+	}
+
+	for _, in := range []string{`"open`, `'open`, `["a"`, `bare`, `1.5`} {
+		if _, err := ParseValue(in); err == nil {
+			t.Errorf("expected an error parsing %s", in)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/skx/rss2email/feedlist"
 )
@@ -20,6 +21,18 @@ type listCmd struct {
 
 	// Should we show extra information about a feed?
 	verbose bool
+
+	// How many feeds should we fetch at once, when verbose?
+	concurrency int
+
+	// Only list the feeds with these tags, comma-separated.
+	tag string
+
+	// The format to list the feeds in, "text" or "json".
+	format string
+
+	// Only list the feeds which contain this text.
+	search string
 }
 
 // Info is part of the subcommand-API
@@ -28,10 +41,29 @@ func (l *listCmd) Info() (string, string) {
 
 This subcommand lists the configured feeds which will be polled.
 
+With '-verbose' each feed is fetched, so that the number and age of its
+entries can be shown.  Several feeds are fetched at once, the number may
+be changed with '-concurrency'.
+
+With '-tag' only the feeds with that tag, given by a '#tag' comment, are
+listed.  Several tags may be separated by commas.
+
+With '-search' only the feeds whose URL, title, or other comments contain
+the given text, ignoring case, are listed.  This helps to find the feed
+you'd like to edit, or delete, within a long list.
+
+With '-format json' the feeds are written as a JSON array, for scripts and
+dashboards.  Each feed is fetched, as with '-verbose', so that its title,
+the number of its entries, and the dates of its newest and oldest entries
+can be included along with its URL and comments.
+
 Example:
 
     $ rss2email list
     $ rss2email list -verbose
+    $ rss2email list -tag news
+    $ rss2email list -search golang
+    $ rss2email list -format json
 `
 }
 
@@ -39,6 +71,10 @@ Example:
 func (l *listCmd) Arguments(f *flag.FlagSet) {
 	f.BoolVar(&l.template, "template", false, "Show the contents of the default template?")
 	f.BoolVar(&l.verbose, "verbose", false, "Show extra information about each feed?")
+	f.IntVar(&l.concurrency, "concurrency", 4, "The number of feeds to fetch at once, with -verbose.")
+	f.StringVar(&l.tag, "tag", "", "Only list the feeds with this tag, several may be comma-separated.")
+	f.StringVar(&l.search, "search", "", "Only list the feeds whose URL, or comments, contain this text.")
+	f.StringVar(&l.format, "format", "text", "The format to list the feeds in, \"text\" or \"json\".")
 }
 
 //
@@ -52,8 +88,49 @@ func (l *listCmd) Execute(args []string) int {
 		return 1
 	}
 
+	if l.format != "text" && l.format != "json" {
+		fmt.Fprintf(os.Stderr, "unknown format %q, expected \"text\" or \"json\"\n", l.format)
+		return 1
+	}
+
 	// Get the feed-list, from the default location.
 	list := feedlist.New("")
+	if err := list.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+
+	// Warn about feeds which are listed twice, spelled differently.
+	for _, group := range list.Duplicates() {
+		var shown []string
+		for _, uri := range group {
+			shown = append(shown, feedlist.Redact(uri))
+		}
+		fmt.Fprintf(os.Stderr, "warning: these feeds are the same: %s\n", strings.Join(shown, ", "))
+	}
+
+	// Only the feeds with the given tags?
+	if l.tag != "" {
+		list = list.Tagged(strings.FieldsFunc(l.tag, func(r rune) bool { return r == ',' })...)
+	}
+
+	// Only the feeds which match our search?
+	if l.search != "" {
+		list = list.Search(l.search)
+	}
+
+	// Fetch the feeds, if we're to describe them.
+	if l.verbose || l.format == "json" {
+		list.FetchInfo(l.concurrency)
+	}
+
+	if l.format == "json" {
+		if err := list.WriteJSON(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		return 0
+	}
 
 	list.WriteAllEntriesIncludingComments(os.Stdout, l.verbose)
 
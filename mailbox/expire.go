@@ -0,0 +1,66 @@
+package mailbox
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SourceHeader is the header which records the feed a message was
+// generated from, allowing us to find the messages of a given feed.
+const SourceHeader = "X-RSS-Source"
+
+// ParseTTL parses the time-to-live of a feed's messages.
+//
+// This is a duration such as "36h", or a number of days, or weeks, such
+// as "7d" or "2w".
+func ParseTTL(s string) (time.Duration, error) {
+
+	s = strings.TrimSpace(s)
+
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(s, suffix) {
+			n, err := strconv.Atoi(strings.TrimSuffix(s, suffix))
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid TTL %q", s)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid TTL %q", s)
+	}
+	return d, nil
+}
+
+// Expired returns the UIDs of the messages in the selected folder which
+// were generated from the given feed, and delivered before the given time.
+func (c *Client) Expired(source string, before time.Time) ([]string, error) {
+	return c.Search(fmt.Sprintf("BEFORE %s HEADER %s %s", before.Format("2-Jan-2006"), SourceHeader, Quote(source)))
+}
+
+// Remove deletes the given messages from the selected folder, if archive
+// is not empty they're copied to that folder first.
+func (c *Client) Remove(uids []string, archive string) error {
+
+	if len(uids) == 0 {
+		return nil
+	}
+
+	// Check before copying, lest the copies accumulate.
+	err := c.canExpunge()
+	if err != nil {
+		return err
+	}
+
+	if archive != "" {
+		err = c.Copy(uids, archive)
+		if err != nil {
+			return err
+		}
+	}
+	return c.Delete(uids)
+}
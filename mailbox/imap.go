@@ -0,0 +1,325 @@
+// Package mailbox contains a minimal IMAP client, which is used to tidy
+// up the messages we've previously delivered.
+//
+// Only the handful of commands we need are implemented, as described in
+// RFC 3501.
+package mailbox
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Client is a connection to an IMAP server.
+type Client struct {
+
+	// conn is the underlying connection.
+	conn net.Conn
+
+	// r reads responses from the server.
+	r *bufio.Reader
+
+	// tag is the number of the last command we sent.
+	tag int
+
+	// capabilities are those the server advertised.
+	capabilities map[string]bool
+}
+
+// Dial connects to the IMAP server at the given address, which is a
+// "host:port" pair.
+//
+// Port 993 uses TLS from the start, otherwise the connection is upgraded
+// via STARTTLS.  If the server doesn't support STARTTLS the connection is
+// refused, so that credentials aren't sent in the clear, unless insecure
+// is set.
+func Dial(dialer *net.Dialer, addr string, insecure bool) (*Client, error) {
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IMAP server %s: %s", addr, err.Error())
+	}
+
+	var conn net.Conn
+	if port == "993" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := NewClient(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	if port != "993" && !c.capabilities["STARTTLS"] && !insecure {
+		c.Close()
+		return nil, fmt.Errorf("%s doesn't support STARTTLS, refusing to use an unencrypted connection", addr)
+	}
+
+	if port != "993" && c.capabilities["STARTTLS"] {
+		_, err = c.Cmd("STARTTLS")
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+
+		conn = tls.Client(c.conn, &tls.Config{ServerName: host})
+		c.conn = conn
+		c.r = bufio.NewReader(conn)
+
+		err = c.capability()
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// NewClient creates a client using the given connection, reading the
+// greeting and capabilities of the server.
+func NewClient(conn net.Conn) (*Client, error) {
+
+	c := &Client{conn: conn, r: bufio.NewReader(conn)}
+
+	greeting, err := c.readLine()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting, "* OK") && !strings.HasPrefix(greeting, "* PREAUTH") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected greeting: %s", greeting)
+	}
+
+	err = c.capability()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// capability updates our record of the server's capabilities.
+func (c *Client) capability() error {
+
+	lines, err := c.Cmd("CAPABILITY")
+	if err != nil {
+		return err
+	}
+
+	c.capabilities = make(map[string]bool)
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && strings.EqualFold(fields[0], "CAPABILITY") {
+			for _, f := range fields[1:] {
+				c.capabilities[strings.ToUpper(f)] = true
+			}
+		}
+	}
+	return nil
+}
+
+// readLine reads a single line from the server, without its terminator.
+//
+// If the line ends with a literal, "{123}", the literal is read and
+// appended, along with the rest of the line.
+func (c *Client) readLine() (string, error) {
+
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+
+	if strings.HasSuffix(line, "}") {
+		start := strings.LastIndex(line, "{")
+		if start >= 0 {
+			n, err := strconv.Atoi(line[start+1 : len(line)-1])
+			if err == nil {
+				literal := make([]byte, n)
+				_, err = io.ReadFull(c.r, literal)
+				if err != nil {
+					return "", err
+				}
+				rest, err := c.readLine()
+				if err != nil {
+					return "", err
+				}
+				line = line[:start] + strconv.Quote(string(literal)) + rest
+			}
+		}
+	}
+
+	return line, nil
+}
+
+// Cmd sends a command to the server, and waits for its completion.
+//
+// The untagged responses received, without their leading "* ", are
+// returned.  A response other than "OK" is an error.
+func (c *Client) Cmd(format string, args ...interface{}) ([]string, error) {
+
+	c.tag++
+	tag := fmt.Sprintf("A%03d", c.tag)
+
+	_, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, fmt.Sprintf(format, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	var untagged []string
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.HasPrefix(line, "* ") {
+			untagged = append(untagged, line[2:])
+			continue
+		}
+		if !strings.HasPrefix(line, tag+" ") {
+			continue
+		}
+
+		status := strings.TrimPrefix(line, tag+" ")
+		if !strings.HasPrefix(strings.ToUpper(status), "OK") {
+			name := strings.Fields(format)[0]
+			return untagged, fmt.Errorf("%s failed: %s", name, status)
+		}
+		return untagged, nil
+	}
+}
+
+// Quote returns the given string as an IMAP quoted-string.
+func Quote(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "\"", "\\\"")
+	return "\"" + s + "\""
+}
+
+// mutf7 is the base64 alphabet of modified UTF-7, which uses "," in place
+// of "/", and no padding.
+var mutf7 = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+,").WithPadding(base64.NoPadding)
+
+// EncodeFolder returns the given folder name in the modified UTF-7 encoding
+// of RFC 3501, section 5.1.3, so that names containing non-ASCII
+// characters may be used with any server.
+func EncodeFolder(name string) string {
+
+	var out strings.Builder
+	var pending []rune
+
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		units := utf16.Encode(pending)
+		buf := make([]byte, 0, len(units)*2)
+		for _, u := range units {
+			buf = append(buf, byte(u>>8), byte(u))
+		}
+		out.WriteString("&" + mutf7.EncodeToString(buf) + "-")
+		pending = nil
+	}
+
+	for _, r := range name {
+		if r >= 0x20 && r <= 0x7e {
+			flush()
+			if r == '&' {
+				out.WriteString("&-")
+			} else {
+				out.WriteRune(r)
+			}
+			continue
+		}
+		pending = append(pending, r)
+	}
+	flush()
+	return out.String()
+}
+
+// Login authenticates to the server.
+func (c *Client) Login(username string, password string) error {
+	_, err := c.Cmd("LOGIN %s %s", Quote(username), Quote(password))
+	return err
+}
+
+// Select opens the given folder for reading and writing.
+func (c *Client) Select(folder string) error {
+	_, err := c.Cmd("SELECT %s", Quote(EncodeFolder(folder)))
+	return err
+}
+
+// Search returns the UIDs of the messages in the selected folder which
+// match the given search criteria.
+func (c *Client) Search(criteria string) ([]string, error) {
+
+	lines, err := c.Cmd("UID SEARCH %s", criteria)
+	if err != nil {
+		return nil, err
+	}
+
+	var uids []string
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && strings.EqualFold(fields[0], "SEARCH") {
+			uids = append(uids, fields[1:]...)
+		}
+	}
+	return uids, nil
+}
+
+// Copy copies the given messages to another folder.
+func (c *Client) Copy(uids []string, folder string) error {
+	_, err := c.Cmd("UID COPY %s %s", strings.Join(uids, ","), Quote(EncodeFolder(folder)))
+	return err
+}
+
+// Delete marks the given messages as deleted, and expunges them.
+//
+// A plain EXPUNGE would also remove any other messages the user had marked
+// as deleted, so we require the UID EXPUNGE command of UIDPLUS (RFC 4315)
+// and refuse to touch the messages if the server doesn't support it.
+func (c *Client) Delete(uids []string) error {
+
+	err := c.canExpunge()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Cmd("UID STORE %s +FLAGS.SILENT (\\Deleted)", strings.Join(uids, ","))
+	if err != nil {
+		return err
+	}
+	_, err = c.Cmd("UID EXPUNGE %s", strings.Join(uids, ","))
+	return err
+}
+
+// canExpunge returns an error if the server can't expunge only the
+// messages we choose.
+func (c *Client) canExpunge() error {
+	if !c.capabilities["UIDPLUS"] {
+		return fmt.Errorf("the IMAP server doesn't support UIDPLUS, refusing to expunge other messages marked as deleted")
+	}
+	return nil
+}
+
+// Close logs out, and closes the connection.
+func (c *Client) Close() error {
+	c.Cmd("LOGOUT")
+	return c.conn.Close()
+}
@@ -0,0 +1,217 @@
+package mailbox
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServer answers IMAP commands over the given connection, advertising
+// the given capabilities, and recording each command it receives.
+func fakeServer(t *testing.T, conn net.Conn, capabilities string, commands *[]string) {
+
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	conn.Write([]byte("* OK IMAP4rev1 ready\r\n"))
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		fields := strings.SplitN(line, " ", 2)
+		tag, cmd := fields[0], fields[1]
+		*commands = append(*commands, cmd)
+
+		switch {
+		case cmd == "CAPABILITY":
+			conn.Write([]byte("* CAPABILITY " + capabilities + "\r\n"))
+		case strings.HasPrefix(cmd, "LOGIN") && !strings.Contains(cmd, "\"secret\""):
+			conn.Write([]byte(tag + " NO bad password\r\n"))
+			continue
+		case strings.HasPrefix(cmd, "UID SEARCH"):
+			conn.Write([]byte("* SEARCH 4 8 15\r\n"))
+		case cmd == "LOGOUT":
+			conn.Write([]byte("* BYE\r\n" + tag + " OK done\r\n"))
+			return
+		}
+		conn.Write([]byte(tag + " OK done\r\n"))
+	}
+}
+
+// TestClient tests talking to a fake server.
+func TestClient(t *testing.T) {
+
+	client, server := net.Pipe()
+
+	var commands []string
+	done := make(chan bool)
+	go func() {
+		fakeServer(t, server, "IMAP4rev1 UIDPLUS", &commands)
+		done <- true
+	}()
+
+	c, err := NewClient(client)
+	if err != nil {
+		t.Fatalf("failed to create client: %s", err)
+	}
+	if !c.capabilities["UIDPLUS"] {
+		t.Errorf("capabilities were not read: %v", c.capabilities)
+	}
+
+	if err = c.Login("steve", "wrong"); err == nil {
+		t.Errorf("expected login failure")
+	}
+	if err = c.Login("steve", "secret"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err = c.Select("INBOX"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	before := time.Date(2021, time.March, 7, 0, 0, 0, 0, time.UTC)
+	uids, err := c.Expired("https://blog.steve.fi/index.rss", before)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.Join(uids, ",") != "4,8,15" {
+		t.Errorf("unexpected uids: %v", uids)
+	}
+
+	if err = c.Remove(uids, "Archive"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	c.Close()
+	<-done
+
+	expected := []string{
+		"CAPABILITY",
+		`LOGIN "steve" "wrong"`,
+		`LOGIN "steve" "secret"`,
+		`SELECT "INBOX"`,
+		`UID SEARCH BEFORE 7-Mar-2021 HEADER X-RSS-Source "https://blog.steve.fi/index.rss"`,
+		`UID COPY 4,8,15 "Archive"`,
+		`UID STORE 4,8,15 +FLAGS.SILENT (\Deleted)`,
+		"UID EXPUNGE 4,8,15",
+		"LOGOUT",
+	}
+	if strings.Join(commands, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected commands:\n%s", strings.Join(commands, "\n"))
+	}
+}
+
+// TestNoUIDPlus tests that nothing is removed if the server can't expunge
+// only our messages.
+func TestNoUIDPlus(t *testing.T) {
+
+	client, server := net.Pipe()
+
+	var commands []string
+	done := make(chan bool)
+	go func() {
+		fakeServer(t, server, "IMAP4rev1", &commands)
+		done <- true
+	}()
+
+	c, err := NewClient(client)
+	if err != nil {
+		t.Fatalf("failed to create client: %s", err)
+	}
+	if err = c.Remove([]string{"4", "8"}, "Archive"); err == nil {
+		t.Errorf("expected an error without UIDPLUS")
+	}
+	c.Close()
+	<-done
+
+	for _, cmd := range commands {
+		if cmd != "CAPABILITY" && cmd != "LOGOUT" {
+			t.Errorf("unexpected command %q", cmd)
+		}
+	}
+}
+
+// TestDialInsecure tests that we refuse to connect without TLS, unless
+// told otherwise.
+func TestDialInsecure(t *testing.T) {
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer l.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var commands []string
+			go fakeServer(t, conn, "IMAP4rev1 UIDPLUS", &commands)
+		}
+	}()
+
+	_, err = Dial(&net.Dialer{}, l.Addr().String(), false)
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("expected a STARTTLS error, got %v", err)
+	}
+
+	c, err := Dial(&net.Dialer{}, l.Addr().String(), true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	c.Close()
+}
+
+// TestParseTTL tests parsing time-to-live values.
+func TestParseTTL(t *testing.T) {
+
+	valid := map[string]time.Duration{
+		"7d":  7 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+		"36h": 36 * time.Hour,
+	}
+	for in, out := range valid {
+		d, err := ParseTTL(in)
+		if err != nil || d != out {
+			t.Errorf("unexpected result for %s: %s %v", in, d, err)
+		}
+	}
+
+	for _, in := range []string{"", "d", "-1d", "steve", "0h"} {
+		_, err := ParseTTL(in)
+		if err == nil {
+			t.Errorf("expected error parsing %q", in)
+		}
+	}
+}
+
+// TestEncodeFolder tests the modified UTF-7 encoding of folder names.
+func TestEncodeFolder(t *testing.T) {
+
+	tests := map[string]string{
+		"INBOX":              "INBOX",
+		"Tom & Jerry":        "Tom &- Jerry",
+		"Entwürfe":           "Entw&APw-rfe",
+		"Новости":            "&BB0EPgQyBD4EQQRCBDg-",
+		"~peter/mail/台北/日本語": "~peter/mail/&U,BTFw-/&ZeVnLIqe-",
+	}
+
+	for in, expected := range tests {
+		if EncodeFolder(in) != expected {
+			t.Errorf("%s: expected %s, got %s", in, expected, EncodeFolder(in))
+		}
+	}
+}
+
+// TestQuote tests quoting strings.
+func TestQuote(t *testing.T) {
+	if Quote(`a "b" \c`) != `"a \"b\" \\c"` {
+		t.Errorf("unexpected quoting: %s", Quote(`a "b" \c`))
+	}
+}
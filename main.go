@@ -5,9 +5,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
+	"github.com/skx/rss2email/config"
 	"github.com/skx/subcommands"
 )
 
@@ -20,6 +25,80 @@ func recoverPanic() {
 	}
 }
 
+//
+// globalFlags processes any flags which appear before the name of the
+// sub-command, and which apply to all sub-commands, removing them from
+// our arguments.
+//
+func globalFlags() {
+
+	args := []string{os.Args[0]}
+
+	i := 1
+	for ; i < len(os.Args); i++ {
+		arg := os.Args[i]
+
+		// Stop at the first non-flag, that's the sub-command.
+		if !strings.HasPrefix(arg, "-") {
+			break
+		}
+
+		name := strings.TrimLeft(arg, "-")
+
+		// Boolean flags don't take a value.
+		if name == "read-only" {
+			config.SetReadOnly()
+			continue
+		}
+
+		value := ""
+		if strings.Contains(name, "=") {
+			parts := strings.SplitN(name, "=", 2)
+			name, value = parts[0], parts[1]
+		} else if i+1 < len(os.Args) {
+			i++
+			value = os.Args[i]
+		}
+
+		switch name {
+		case "config-dir":
+			config.SetDirectory(value)
+		default:
+			fmt.Fprintf(os.Stderr, "unknown flag %s\n", arg)
+			os.Exit(1)
+		}
+	}
+
+	os.Args = append(args, os.Args[i:]...)
+}
+
+//
+// readOnly returns true, having explained why, if we're in read-only mode
+// and so must refuse to carry out the given action.
+//
+func readOnly(action string) bool {
+	if !config.IsReadOnly() {
+		return false
+	}
+
+	fmt.Fprintf(os.Stderr, "refusing to %s, as we're in read-only mode\n", action)
+	return true
+}
+
+//
+// interruptible returns a context which is cancelled when we receive
+// SIGINT or SIGTERM, so that we may stop cleanly.  A second signal
+// kills us, as usual.
+//
+func interruptible() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
+
 //
 // Register the subcommands, and run the one the user chose.
 //
@@ -30,17 +109,44 @@ func main() {
 	//
 	defer recoverPanic()
 
+	//
+	// Handle any global flags.
+	//
+	globalFlags()
+
+	//
+	// Load our configuration file, if present.
+	//
+	err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		os.Exit(1)
+	}
+
 	//
 	// Register each of our subcommands.
 	//
 	subcommands.Register(&addCmd{})
+	subcommands.Register(&cleanupCmd{})
 	subcommands.Register(&cronCmd{})
 	subcommands.Register(&daemonCmd{})
 	subcommands.Register(&delCmd{})
+	subcommands.Register(&deliverCmd{})
+	subcommands.Register(&diffCmd{})
+	subcommands.Register(&discoverCmd{})
+	subcommands.Register(&envCmd{})
 	subcommands.Register(&exportCmd{})
 	subcommands.Register(&importCmd{})
 	subcommands.Register(&listCmd{})
 	subcommands.Register(&listDefaultTemplateCmd{})
+	subcommands.Register(&pauseCmd{})
+	subcommands.Register(&resumeCmd{})
+	subcommands.Register(&selfUpdateCmd{})
+	subcommands.Register(&stateCmd{})
+	subcommands.Register(&statsCmd{})
+	subcommands.Register(&templatePreviewCmd{})
+	subcommands.Register(&tidyCmd{})
+	subcommands.Register(&validateCmd{})
 	subcommands.Register(&versionCmd{})
 
 	//
@@ -0,0 +1,157 @@
+// Package network provides the dialer and HTTP client which are used
+// for all outgoing connections.
+//
+// On hosts with multiple addresses the user may specify the source
+// address, or interface, from which connections should be made.
+package network
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/skx/rss2email/config"
+)
+
+// sourceAddress returns the local address connections should be made
+// from, or nil if the system should choose.
+//
+// The configured value may be an IP address, or the name of a network
+// interface in which case the first IPv4 address of that interface is
+// used, falling back to the first address of any kind.
+func sourceAddress() (net.IP, error) {
+
+	bind := config.Get(config.BindAddress)
+	if bind == "" {
+		return nil, nil
+	}
+
+	ip := net.ParseIP(bind)
+	if ip != nil {
+		return ip, nil
+	}
+
+	iface, err := net.InterfaceByName(bind)
+	if err != nil {
+		return nil, fmt.Errorf("%s is neither an IP address nor an interface: %s", bind, err.Error())
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the addresses of %s: %s", bind, err.Error())
+	}
+
+	var found net.IP
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ipnet.IP.To4() != nil {
+			return ipnet.IP, nil
+		}
+		if found == nil {
+			found = ipnet.IP
+		}
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("interface %s has no addresses", bind)
+	}
+	return found, nil
+}
+
+// Dialer returns a dialer which makes connections from the configured
+// source address.
+func Dialer() (*net.Dialer, error) {
+
+	d := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	ip, err := sourceAddress()
+	if err != nil {
+		return nil, err
+	}
+	if ip != nil {
+		d.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+
+	return d, nil
+}
+
+// HTTPClient returns a HTTP client which makes connections from the
+// configured source address.
+//
+// Requests are sent via the proxy named by the HTTP_PROXY, HTTPS_PROXY,
+// and NO_PROXY variables of the environment, if any.
+func HTTPClient() (*http.Client, error) {
+	return HTTPClientVia("")
+}
+
+// HTTPClientVia returns a HTTP client which makes connections from the
+// configured source address, via the given proxy.
+//
+// The proxy may be a "http://", "https://", or "socks5://" URL, "direct"
+// to connect without a proxy, or "" to use that of the environment.
+// SOCKS proxies resolve hostnames themselves, as Tor requires.
+func HTTPClientVia(proxy string) (*http.Client, error) {
+	return HTTPClientWith(proxy, TLS{})
+}
+
+// HTTPClientWith returns a HTTP client which makes connections from the
+// configured source address, via the given proxy, as HTTPClientVia, and
+// with the given TLS settings.
+func HTTPClientWith(proxy string, t TLS) (*http.Client, error) {
+
+	d, err := Dialer()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = d.DialContext
+	transport.Proxy = http.ProxyFromEnvironment
+
+	transport.TLSClientConfig, err = t.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	switch proxy {
+	case "":
+	case "direct":
+		transport.Proxy = nil
+	default:
+		u, err := ParseProxy(proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// ParseProxy parses the URL of a proxy, ensuring it is one we support.
+func ParseProxy(proxy string) (*url.URL, error) {
+
+	u, err := url.Parse(proxy)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q, expected a URL such as \"socks5://127.0.0.1:9050\"", proxy)
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	case "socks5h":
+		// We always leave resolution to the proxy, which is
+		// what this scheme requests.
+		u.Scheme = "socks5"
+	default:
+		return nil, fmt.Errorf("invalid proxy %q, the scheme must be http, https, or socks5", u.Redacted())
+	}
+	return u, nil
+}
@@ -0,0 +1,188 @@
+package network
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/skx/rss2email/config"
+)
+
+// TestSourceAddress tests the handling of our bind-address setting.
+func TestSourceAddress(t *testing.T) {
+
+	cur := os.Getenv(config.BindAddress)
+	defer os.Setenv(config.BindAddress, cur)
+
+	// Unset is fine, and means we don't bind.
+	os.Setenv(config.BindAddress, "")
+	d, err := Dialer()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if d.LocalAddr != nil {
+		t.Fatalf("unexpected local address: %s", d.LocalAddr)
+	}
+
+	// An IP is used as-is.
+	os.Setenv(config.BindAddress, "127.0.0.1")
+	d, err = Dialer()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if d.LocalAddr == nil || d.LocalAddr.String() != "127.0.0.1:0" {
+		t.Fatalf("unexpected local address: %v", d.LocalAddr)
+	}
+
+	// A bogus interface is an error.
+	os.Setenv(config.BindAddress, "steve-kemp0")
+	_, err = HTTPClient()
+	if err == nil {
+		t.Fatalf("expected an error with a bogus interface")
+	}
+}
+
+// TestProxy tests the selection of proxies.
+func TestProxy(t *testing.T) {
+
+	req, _ := http.NewRequest("GET", "https://example.com/feed.rss", nil)
+
+	proxyFor := func(proxy string) string {
+		client, err := HTTPClientVia(proxy)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		transport := client.Transport.(*http.Transport)
+		if transport.Proxy == nil {
+			return "none"
+		}
+		u, err := transport.Proxy(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if u == nil {
+			return "none"
+		}
+		return u.String()
+	}
+
+	if proxyFor("direct") != "none" {
+		t.Errorf("direct connections used a proxy")
+	}
+	if proxyFor("socks5h://127.0.0.1:9050") != "socks5://127.0.0.1:9050" {
+		t.Errorf("unexpected proxy: %s", proxyFor("socks5h://127.0.0.1:9050"))
+	}
+	if proxyFor("http://proxy.example.com:3128") != "http://proxy.example.com:3128" {
+		t.Errorf("unexpected proxy: %s", proxyFor("http://proxy.example.com:3128"))
+	}
+
+	for _, bogus := range []string{"ftp://example.com", "127.0.0.1:9050", "%%"} {
+		if _, err := HTTPClientVia(bogus); err == nil {
+			t.Errorf("expected an error with proxy %q", bogus)
+		}
+	}
+}
+
+// TestTLS tests our handling of private certificate authorities, and
+// client certificates.
+func TestTLS(t *testing.T) {
+
+	dir := t.TempDir()
+
+	// Create a client certificate, signed by itself.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "rss2email"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %s", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %s", err)
+	}
+	client, _ := x509.ParseCertificate(der)
+
+	write := func(name string, kind string, data []byte) string {
+		path := filepath.Join(dir, name)
+		err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: data}), 0600)
+		if err != nil {
+			t.Fatalf("failed to write %s: %s", name, err)
+		}
+		return path
+	}
+	certFile := write("client.pem", "CERTIFICATE", der)
+	keyFile := write("client.key", "EC PRIVATE KEY", keyDER)
+
+	// A server with its own certificate authority, which requires our
+	// client certificate.
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: x509.NewCertPool()}
+	ts.TLS.ClientCAs.AddCert(client)
+	ts.StartTLS()
+	defer ts.Close()
+
+	caFile := write("ca.pem", "CERTIFICATE", ts.Certificate().Raw)
+
+	get := func(settings TLS) error {
+		c, err := HTTPClientWith("direct", settings)
+		if err != nil {
+			return err
+		}
+		resp, err := c.Get(ts.URL)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	tests := []struct {
+		settings TLS
+		ok       bool
+	}{
+		{TLS{}, false},
+		{TLS{CA: caFile}, false},
+		{TLS{CA: caFile, Cert: certFile, Key: keyFile}, true},
+		{TLS{Insecure: true, Cert: certFile, Key: keyFile}, true},
+	}
+	for _, test := range tests {
+		if err := get(test.settings); (err == nil) != test.ok {
+			t.Errorf("%v: expected success %v, got %v", test.settings, test.ok, err)
+		}
+	}
+
+	// Bad settings are reported.
+	for _, bogus := range []TLS{
+		{CA: filepath.Join(dir, "missing.pem")},
+		{CA: keyFile},
+		{Cert: certFile},
+		{Cert: certFile, Key: caFile},
+	} {
+		if _, err := bogus.Config(); err == nil {
+			t.Errorf("%v: expected an error", bogus)
+		}
+	}
+}
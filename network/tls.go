@@ -0,0 +1,66 @@
+package network
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// TLS describes how we verify the certificate of a server, and how we
+// identify ourselves to it, for servers which don't use a public
+// certificate authority, or which require a client certificate.
+type TLS struct {
+
+	// CA is a file holding the PEM certificates of the authorities
+	// we trust, in addition to those of the system.
+	CA string
+
+	// Cert and Key are the files holding our client certificate, and
+	// its private key, in PEM.
+	Cert string
+	Key  string
+
+	// Insecure disables verification of the server's certificate.
+	Insecure bool
+}
+
+// Config returns the TLS configuration these settings describe, or nil
+// if they're all unset.
+func (t TLS) Config() (*tls.Config, error) {
+
+	if t == (TLS{}) {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{InsecureSkipVerify: t.Insecure}
+
+	if t.CA != "" {
+		pem, err := ioutil.ReadFile(t.CA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read certificate authorities: %s", err.Error())
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", t.CA)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if t.Cert != "" || t.Key != "" {
+		if t.Cert == "" || t.Key == "" {
+			return nil, fmt.Errorf("a client certificate requires both a certificate and a key")
+		}
+		cert, err := tls.LoadX509KeyPair(t.Cert, t.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %s", err.Error())
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,86 @@
+//
+// Pause feeds, without removing them from our feed-list.
+//
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/skx/rss2email/feedlist"
+)
+
+// Structure for our options and state.
+type pauseCmd struct {
+
+	// The reason the feeds were paused, recorded in the feed-list.
+	reason string
+}
+
+// Info is part of the subcommand-API
+func (p *pauseCmd) Info() (string, string) {
+	return "pause", `Stop polling feeds, without removing them.
+
+Mark one or more URLs in our feed-list as disabled, by adding a
+'#disabled' comment above each of them.  They keep their comments, and
+the items we've already seen, so that nothing is sent twice when they're
+resumed via 'rss2email resume'.
+
+Example:
+
+    $ rss2email pause https://blog.steve.fi/index.rss
+    $ rss2email pause -reason "on holiday" https://example.com/news.rss
+`
+}
+
+// Arguments handles our flag-setup.
+func (p *pauseCmd) Arguments(f *flag.FlagSet) {
+	f.StringVar(&p.reason, "reason", "paused", "The reason for pausing the feeds, recorded in the feed-list.")
+}
+
+//
+// Entry-point.
+//
+func (p *pauseCmd) Execute(args []string) int {
+
+	if readOnly("pause feeds") {
+		return 1
+	}
+
+	// Get the feed-list, from the default location.
+	list := feedlist.New("")
+
+	// Disable each feed which is present, and isn't already.
+	changed := false
+	for _, uri := range args {
+		present := false
+		for _, entry := range list.Entries() {
+			if entry == uri {
+				present = true
+			}
+		}
+		if !present {
+			fmt.Printf("%s is not in the feed list.\n", uri)
+			continue
+		}
+		if !list.IsDisabled(uri) {
+			list.Disable(uri, p.reason)
+			changed = true
+		}
+	}
+
+	// If we made a change then save it.
+	if changed {
+		if err := list.Save(); err != nil {
+			fmt.Printf("%s\n", err.Error())
+			return 1
+		}
+	} else {
+		fmt.Printf("Feed list unchanged.\n")
+		fmt.Printf("Use 'rss2email list' to check your current feed list.\n")
+	}
+
+	// All done.
+	return 0
+}
@@ -0,0 +1,26 @@
+package processor
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/skx/rss2email/config"
+)
+
+// breakerSettings returns the number of runs in a row a feed may fail
+// before we leave it alone, and how long we do so for.
+func breakerSettings() (int, time.Duration, error) {
+
+	limit, err := strconv.Atoi(config.Get(config.FailureLimit))
+	if err != nil || limit < 0 {
+		return 0, 0, fmt.Errorf("invalid %s %q, expected a number of runs", config.FailureLimit, config.Get(config.FailureLimit))
+	}
+
+	cooldown, err := time.ParseDuration(config.Get(config.FailureCooldown))
+	if err != nil || cooldown < 0 {
+		return 0, 0, fmt.Errorf("invalid %s %q, expected a duration such as \"24h\"", config.FailureCooldown, config.Get(config.FailureCooldown))
+	}
+
+	return limit, cooldown, nil
+}
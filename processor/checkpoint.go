@@ -0,0 +1,93 @@
+package processor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/feedlist"
+)
+
+// runBudget returns the maximum time a run may take, zero if there is no
+// limit.
+func runBudget() (time.Duration, error) {
+
+	value := config.Get(config.RunBudget)
+	if value == "" {
+		return 0, nil
+	}
+
+	budget, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %s", config.RunBudget, value, err.Error())
+	}
+	return budget, nil
+}
+
+// checkpointName returns the name of the checkpoint for our runs.  Runs
+// restricted to different tags process different feeds, so each has its
+// own.
+func (p *Processor) checkpointName() string {
+	if len(p.tags) == 0 {
+		return "checkpoint"
+	}
+	return "checkpoint-" + strings.ToLower(strings.Join(p.tags, ","))
+}
+
+// checkpointPath returns the file which holds the named checkpoint.
+func checkpointPath(name string) string {
+	return filepath.Join(config.StateDirectory(), "checkpoints", name)
+}
+
+// loadCheckpoint returns the URL of the feed from which the next run
+// should start, or "" to start from the top.
+func loadCheckpoint(name string) string {
+	data, err := ioutil.ReadFile(checkpointPath(name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// saveCheckpoint records the URL of the feed from which the next run
+// should start, "" removes the checkpoint.
+func saveCheckpoint(name string, url string) error {
+
+	file := checkpointPath(name)
+
+	if url == "" {
+		err := os.Remove(file)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove checkpoint: %s", err.Error())
+		}
+		return nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(file), os.ModePerm)
+	if err == nil {
+		err = ioutil.WriteFile(file, []byte(url+"\n"), 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint: %s", err.Error())
+	}
+	return nil
+}
+
+// resume returns the feeds in the order they should be processed, starting
+// with the given one, then wrapping around to those which precede it.
+//
+// If the feed isn't present, perhaps because it was removed, we start from
+// the top.
+func resume(feeds []feedlist.Entry, from string) []feedlist.Entry {
+
+	for i, entry := range feeds {
+		if entry.URL == from {
+			return append(append([]feedlist.Entry{}, feeds[i:]...), feeds[:i]...)
+		}
+	}
+	return feeds
+}
@@ -0,0 +1,152 @@
+package processor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/feedlist"
+)
+
+// TestResume tests the order in which feeds are processed, after a run
+// which stopped part-way through.
+func TestResume(t *testing.T) {
+
+	var feeds []feedlist.Entry
+	for _, name := range []string{"a", "b", "c", "d"} {
+		feeds = append(feeds, feedlist.Entry{URL: "https://example.com/" + name})
+	}
+
+	order := func(entries []feedlist.Entry) string {
+		var names []string
+		for _, e := range entries {
+			names = append(names, strings.TrimPrefix(e.URL, "https://example.com/"))
+		}
+		return strings.Join(names, "")
+	}
+
+	tests := map[string]string{
+		"":                          "abcd",
+		"https://example.com/a":     "abcd",
+		"https://example.com/c":     "cdab",
+		"https://example.com/d":     "dabc",
+		"https://example.com/gone":  "abcd",
+		"https://example.com/c?x=1": "abcd",
+	}
+	for from, expected := range tests {
+		if got := order(resume(feeds, from)); got != expected {
+			t.Errorf("%q: expected %s, got %s", from, expected, got)
+		}
+	}
+}
+
+// TestCheckpoint tests saving, loading, and removing checkpoints.
+func TestCheckpoint(t *testing.T) {
+
+	p := New()
+	if p.checkpointName() != "checkpoint" {
+		t.Errorf("unexpected name %s", p.checkpointName())
+	}
+	p.tags = []string{"News", "daily"}
+	name := p.checkpointName()
+	if name != "checkpoint-news,daily" {
+		t.Errorf("unexpected name %s", name)
+	}
+
+	if got := loadCheckpoint(name); got != "" {
+		t.Errorf("expected no checkpoint, got %q", got)
+	}
+	if err := saveCheckpoint(name, "https://example.com/feed"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := loadCheckpoint(name); got != "https://example.com/feed" {
+		t.Errorf("unexpected checkpoint %q", got)
+	}
+	if got := loadCheckpoint("checkpoint"); got != "" {
+		t.Errorf("checkpoints weren't distinct, got %q", got)
+	}
+
+	// Removing it twice is fine.
+	for i := 0; i < 2; i++ {
+		if err := saveCheckpoint(name, ""); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if got := loadCheckpoint(name); got != "" {
+		t.Errorf("expected no checkpoint, got %q", got)
+	}
+}
+
+// TestRunBudget tests that a run stops once its budget is spent, and that
+// the next resumes where it stopped, then clears the checkpoint.
+func TestRunBudget(t *testing.T) {
+
+	for _, name := range []string{config.FeedList, config.RunBudget} {
+		cur := os.Getenv(name)
+		defer os.Setenv(name, cur)
+	}
+
+	var mutex sync.Mutex
+	var fetched []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		fetched = append(fetched, strings.TrimPrefix(r.URL.Path, "/budget-"))
+		mutex.Unlock()
+
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprintf(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>Test</title><link>https://example.com/</link><item><title>Item</title><guid>%s</guid><link>https://example.com%s</link></item></channel></rss>`, r.URL.Path, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	file := filepath.Join(t.TempDir(), "feeds")
+	var list strings.Builder
+	for _, name := range []string{"a", "b", "c"} {
+		list.WriteString(srv.URL + "/budget-" + name + "\n")
+	}
+	if err := ioutil.WriteFile(file, []byte(list.String()), 0644); err != nil {
+		t.Fatalf("failed to write feeds: %s", err)
+	}
+	os.Setenv(config.FeedList, file)
+
+	run := func() string {
+		mutex.Lock()
+		fetched = nil
+		mutex.Unlock()
+
+		p := New()
+		p.send = false
+		if errs := p.ProcessFeeds([]string{"steve@example.com"}); len(errs) > 0 {
+			t.Fatalf("unexpected errors: %v", errs)
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		return strings.Join(fetched, "")
+	}
+
+	// The budget is spent by the first feed.
+	os.Setenv(config.RunBudget, "10ms")
+	if got := run(); got != "a" {
+		t.Errorf("expected a single feed to be processed, got %s", got)
+	}
+	if got := loadCheckpoint("checkpoint"); got != srv.URL+"/budget-b" {
+		t.Errorf("unexpected checkpoint %q", got)
+	}
+
+	// The next run resumes from there, wrapping around.
+	os.Setenv(config.RunBudget, "")
+	if got := run(); got != "bca" {
+		t.Errorf("unexpected order %s", got)
+	}
+	if got := loadCheckpoint("checkpoint"); got != "" {
+		t.Errorf("expected the checkpoint to be removed, got %q", got)
+	}
+}
@@ -0,0 +1,103 @@
+package processor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/skx/rss2email/config"
+)
+
+// dripInterval returns the minimum time between deliveries, zero if they
+// aren't paced.
+func dripInterval() (time.Duration, error) {
+
+	value := config.Get(config.DripInterval)
+	if value == "" {
+		return 0, nil
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval < 0 {
+		return 0, fmt.Errorf("invalid %s %q, expected a duration such as \"5m\"", config.DripInterval, value)
+	}
+	return interval, nil
+}
+
+// dripPath returns the file which records the time of our last delivery.
+func dripPath() string {
+	return filepath.Join(config.StateDirectory(), "drip")
+}
+
+// loadLastDelivery returns the time of our last delivery, or the zero
+// time if there hasn't been one.
+func loadLastDelivery() time.Time {
+	data, err := ioutil.ReadFile(dripPath())
+	if err != nil {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// saveLastDelivery records the time of our last delivery.
+func saveLastDelivery(t time.Time) error {
+
+	file := dripPath()
+
+	err := os.MkdirAll(filepath.Dir(file), os.ModePerm)
+	if err == nil {
+		err = ioutil.WriteFile(file, []byte(t.Format(time.RFC3339)+"\n"), 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record delivery time: %s", err.Error())
+	}
+	return nil
+}
+
+// deferDelivery waits until the drip interval has passed since our last
+// delivery.  It returns true if a new item should be left for a later run
+// instead, because waiting would overrun the run's deadline, or the run
+// was interrupted while we waited.
+func (p *Processor) deferDelivery() bool {
+	if p.drip == 0 || p.dryRun || !p.send {
+		return false
+	}
+
+	wait := p.drip - time.Since(p.lastDelivery)
+	if wait <= 0 {
+		return false
+	}
+	if !p.deadline.IsZero() && time.Now().Add(wait).After(p.deadline) {
+		return true
+	}
+
+	if p.verbose {
+		fmt.Printf("\t\tWaiting %s before the next delivery\n", wait.Round(time.Second))
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return false
+	case <-p.ctx.Done():
+		return true
+	}
+}
+
+// delivered records that an item was just delivered, so that the next
+// waits for the drip interval to pass.
+func (p *Processor) delivered() error {
+	if p.drip == 0 || p.dryRun || !p.send {
+		return nil
+	}
+	p.lastDelivery = time.Now()
+	return saveLastDelivery(p.lastDelivery)
+}
@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/skx/rss2email/config"
+)
+
+// TestDripInterval tests parsing the drip interval.
+func TestDripInterval(t *testing.T) {
+
+	defer os.Setenv(config.DripInterval, os.Getenv(config.DripInterval))
+
+	tests := map[string]time.Duration{
+		"":    0,
+		"5m":  5 * time.Minute,
+		"90s": 90 * time.Second,
+	}
+	for value, expected := range tests {
+		os.Setenv(config.DripInterval, value)
+		got, err := dripInterval()
+		if err != nil || got != expected {
+			t.Errorf("%q: expected %s, got %s %v", value, expected, got, err)
+		}
+	}
+
+	for _, value := range []string{"soon", "-5m"} {
+		os.Setenv(config.DripInterval, value)
+		if _, err := dripInterval(); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
+
+// TestLastDelivery tests recording the time of our last delivery.
+func TestLastDelivery(t *testing.T) {
+
+	now := time.Now().Truncate(time.Second)
+	if err := saveLastDelivery(now); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := loadLastDelivery(); !got.Equal(now) {
+		t.Errorf("expected %s, got %s", now, got)
+	}
+}
+
+// TestDeferDelivery tests that deliveries wait for the drip interval,
+// unless the deadline or an interruption stops them.
+func TestDeferDelivery(t *testing.T) {
+
+	drip := 100 * time.Millisecond
+
+	// Unpaced, or long since the last delivery, there's no wait.
+	p := New()
+	if p.deferDelivery() {
+		t.Errorf("unpaced deliveries shouldn't be deferred")
+	}
+	p.drip = drip
+	p.lastDelivery = time.Now().Add(-time.Hour)
+	if p.deferDelivery() {
+		t.Errorf("a delivery after the interval shouldn't be deferred")
+	}
+
+	// Otherwise we wait for our turn.
+	p.lastDelivery = time.Now()
+	started := time.Now()
+	if p.deferDelivery() {
+		t.Errorf("a delivery within the run shouldn't be deferred")
+	}
+	if waited := time.Since(started); waited < drip/2 {
+		t.Errorf("expected to wait for the interval, waited %s", waited)
+	}
+
+	// Unless that would overrun the deadline.
+	p.lastDelivery = time.Now()
+	p.deadline = time.Now().Add(drip / 2)
+	started = time.Now()
+	if !p.deferDelivery() {
+		t.Errorf("a delivery beyond the deadline should be deferred")
+	}
+	if waited := time.Since(started); waited >= drip/2 {
+		t.Errorf("expected not to wait, waited %s", waited)
+	}
+
+	// Or the run is interrupted.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.ctx = ctx
+	p.deadline = time.Time{}
+	p.lastDelivery = time.Now()
+	if !p.deferDelivery() {
+		t.Errorf("an interrupted delivery should be deferred")
+	}
+}
@@ -0,0 +1,127 @@
+package emailer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/network"
+)
+
+// The Wayback Machine endpoints we use, which are variables so that they
+// may be replaced in our test-cases.
+var (
+	// waybackAvailable returns the latest snapshot of a URL.
+	waybackAvailable = "https://archive.org/wayback/available"
+
+	// waybackSave creates a snapshot of the URL appended to it.
+	waybackSave = "https://web.archive.org/save/"
+)
+
+// archiveURL returns the URL of a snapshot of our item, within the
+// Wayback Machine, if ARCHIVE_LINKS is set.
+//
+// With "lookup" the latest existing snapshot is used, with "save" a new
+// snapshot is requested, falling back to the latest.  Failures are not
+// fatal, we just return "" and the email has no archive link.
+func (e *Emailer) archiveURL() string {
+
+	if e.archiveCache != nil {
+		return *e.archiveCache
+	}
+
+	link := ""
+	if e.item.Link != "" {
+		switch config.Get(config.ArchiveLinks) {
+		case "save":
+			link = waybackSnapshot(e.item.Link)
+			if link == "" {
+				link = waybackLatest(e.item.Link)
+			}
+		case "lookup":
+			link = waybackLatest(e.item.Link)
+		}
+	}
+
+	e.archiveCache = &link
+	return link
+}
+
+// waybackGet fetches the given URL, from the Wayback Machine.
+func waybackGet(link string) (*http.Response, error) {
+
+	client, err := network.HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	client.Timeout = 60 * time.Second
+
+	req, err := http.NewRequest("GET", link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", config.Get(config.UserAgent))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch %s: %s", link, resp.Status)
+	}
+	return resp, nil
+}
+
+// waybackLatest returns the URL of the latest snapshot of the given link,
+// or "" if there is none.
+func waybackLatest(link string) string {
+
+	resp, err := waybackGet(waybackAvailable + "?url=" + url.QueryEscape(link))
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		ArchivedSnapshots struct {
+			Closest struct {
+				Available bool   `json:"available"`
+				URL       string `json:"url"`
+			} `json:"closest"`
+		} `json:"archived_snapshots"`
+	}
+
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1024*1024)).Decode(&result)
+	if err != nil || !result.ArchivedSnapshots.Closest.Available {
+		return ""
+	}
+	return result.ArchivedSnapshots.Closest.URL
+}
+
+// waybackSnapshot asks the Wayback Machine to snapshot the given link,
+// returning the URL of the snapshot, or "" on failure.
+func waybackSnapshot(link string) string {
+
+	resp, err := waybackGet(waybackSave + link)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1024*1024))
+
+	// We're either told where the snapshot lives, or redirected to it.
+	if loc := resp.Header.Get("Content-Location"); strings.HasPrefix(loc, "/web/") {
+		return resp.Request.URL.Scheme + "://" + resp.Request.URL.Host + loc
+	}
+	if strings.Contains(resp.Request.URL.Path, "/web/") {
+		return resp.Request.URL.String()
+	}
+	return ""
+}
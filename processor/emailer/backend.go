@@ -0,0 +1,105 @@
+package emailer
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/skx/rss2email/config"
+)
+
+// backend is a mechanism by which rendered messages may be delivered.
+//
+// Backends register themselves via registerBackend, typically from an
+// init function in a file which is guarded by a build tag, so that
+// optional backends can be omitted from minimal builds.
+type backend struct {
+
+	// name is the human-readable name of this backend.
+	name string
+
+	// priority is used to order the backends; when sending we use the
+	// enabled backend with the highest priority.
+	priority int
+
+	// enabled returns true if this backend has been configured, and
+	// should be used.
+	enabled func() bool
+
+	// send delivers the message to the given recipients, the first of
+	// which is also used as the sender.
+	send func(e *Emailer, to []string, content []byte) error
+
+	// once is true if the backend publishes each message once, rather
+	// than delivering it to each recipient in turn.
+	once bool
+}
+
+// backends holds the registered backends, in priority order.
+var backends []backend
+
+// registerBackend makes the given backend available.
+func registerBackend(b backend) {
+	backends = append(backends, b)
+
+	sort.SliceStable(backends, func(i, j int) bool {
+		return backends[i].priority > backends[j].priority
+	})
+}
+
+// selectBackend returns the backend which should be used to deliver
+// messages, or nil if none are available.
+func selectBackend() *backend {
+	for i := range backends {
+		if backends[i].enabled() {
+			return &backends[i]
+		}
+	}
+	return nil
+}
+
+// selectBackends returns the backends which should be used to deliver
+// messages.
+//
+// If the user has listed backends explicitly each of those is used, in
+// the order given.  Otherwise if an SMTP profile was chosen we use SMTP,
+// and failing that the single backend selectBackend returns.
+func (e *Emailer) selectBackends() ([]*backend, error) {
+
+	names := config.List(config.Backends)
+	if len(names) == 0 && e.smtpProfile != "" {
+		names = []string{"smtp"}
+	}
+	if len(names) == 0 {
+		b := selectBackend()
+		if b == nil {
+			return nil, fmt.Errorf("no delivery backend is available")
+		}
+		return []*backend{b}, nil
+	}
+
+	var out []*backend
+	for _, name := range names {
+		found := false
+		for i := range backends {
+			if backends[i].name == name {
+				out = append(out, &backends[i])
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown backend %q, available backends are %v", name, Backends())
+		}
+	}
+	return out, nil
+}
+
+// Backends returns the names of the delivery mechanisms which are
+// compiled into this binary.
+func Backends() []string {
+	names := []string{}
+	for _, b := range backends {
+		names = append(names, b.name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -9,24 +9,30 @@
 //
 // The choice is made based upon the presence of environmental
 // variables.
+//
+// Each delivery mechanism is a backend which registers itself at
+// startup, optional backends may be excluded from the binary via
+// build tags (for example `go build -tags nosmtp`).
 package emailer
 
 import (
 	"bytes"
+	"crypto/sha1"
 	"errors"
 	"fmt"
 	"html"
 	"io/ioutil"
+	"mime"
 	"mime/quotedprintable"
-	"net/smtp"
+	"net/mail"
 	"os"
-	"os/exec"
-	"os/user"
 	"path/filepath"
-	"strconv"
+	"strings"
 	"text/template"
 
 	"github.com/mmcdole/gofeed"
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/receipts"
 	emailtemplate "github.com/skx/rss2email/template"
 	"github.com/skx/rss2email/withstate"
 )
@@ -38,6 +44,57 @@ type Emailer struct {
 	feed *gofeed.Feed
 	// Item is the feed item itself
 	item withstate.FeedItem
+
+	// enclosureCache holds the enclosures of the item, once fetched.
+	enclosureCache []Enclosure
+
+	// lowMemory is true if we should avoid large allocations.
+	lowMemory bool
+
+	// deduplicate is true if we should record each delivery made, and
+	// skip those which have been made previously.
+	deduplicate bool
+
+	// headers holds additional headers, "Name: value", to add to
+	// the message.
+	headers []string
+
+	// source is the URL of the feed, as it appears in the feed-list.
+	source string
+
+	// replyTo is the address replies should be sent to, overriding
+	// the global setting.
+	replyTo string
+
+	// smtpProfile is the name of the SMTP profile to deliver via, if
+	// empty the global SMTP settings are used.
+	smtpProfile string
+
+	// preview is the size of the preview to send, rather than the
+	// whole item, if empty the global setting is used.
+	preview string
+
+	// transcode is the command used to transcode enclosures before
+	// they're attached, if any.
+	transcode string
+
+	// folderTemplate names the folder the item should be filed in,
+	// overriding the global setting.
+	folderTemplate string
+
+	// tags are the tags of the feed.
+	tags []string
+
+	// template is the file holding the template of the message,
+	// overriding the global setting.
+	template string
+
+	// version is the version of rss2email sending the message.
+	version string
+
+	// archiveCache holds the URL of the archived copy of the item,
+	// once we've looked for it.
+	archiveCache *string
 }
 
 // New creates a new Emailer object.
@@ -48,6 +105,69 @@ func New(feed *gofeed.Feed, item withstate.FeedItem) *Emailer {
 	return &Emailer{feed: feed, item: item}
 }
 
+// SetLowMemory updates the state of this object, when the low-memory
+// flag is true enclosures are never downloaded, and nothing is cached.
+func (e *Emailer) SetLowMemory(state bool) {
+	e.lowMemory = state
+}
+
+// SetDeduplicate updates the state of this object, when the deduplicate
+// flag is true each successful delivery is recorded against the item, and
+// deliveries which have already been made are skipped.
+//
+// This allows a failure in one backend, or to one recipient, to be retried
+// without repeating the deliveries which succeeded.
+func (e *Emailer) SetDeduplicate(state bool) {
+	e.deduplicate = state
+}
+
+// SetHeaders sets additional headers, of the form "Name: value", which
+// are added to the message along with those configured globally.
+func (e *Emailer) SetHeaders(headers []string) {
+	e.headers = headers
+}
+
+// SetVersion records the version of rss2email which is sending the
+// message, which may be added to its headers.
+func (e *Emailer) SetVersion(version string) {
+	e.version = version
+}
+
+// SetTemplate chooses the file holding the template of the message,
+// overriding the TEMPLATE setting.  Unlike that the file must exist.
+func (e *Emailer) SetTemplate(path string) {
+	e.template = path
+}
+
+// SetSource records the URL of the feed, as it appears in the feed-list,
+// which is added to the message so that it may be found later.
+func (e *Emailer) SetSource(url string) {
+	e.source = url
+}
+
+// SetReplyTo sets the address to which replies should be sent, overriding
+// the REPLY_TO setting.
+func (e *Emailer) SetReplyTo(addr string) {
+	e.replyTo = addr
+}
+
+// SetSMTPProfile chooses the named SMTP profile to deliver via, whose
+// settings are given by variables such as SMTP_GMAIL_HOST.
+//
+// When a profile is chosen we always deliver via SMTP, unless the user
+// has listed the backends to use explicitly.
+func (e *Emailer) SetSMTPProfile(profile string) {
+	e.smtpProfile = profile
+}
+
+// replyAddress returns the address replies should be sent to, if any.
+func (e *Emailer) replyAddress() string {
+	if e.replyTo != "" {
+		return e.replyTo
+	}
+	return config.Get(config.ReplyTo)
+}
+
 // loadTemplate loads the template used for sending the email notification.
 func (e *Emailer) loadTemplate() (*template.Template, error) {
 
@@ -60,23 +180,17 @@ func (e *Emailer) loadTemplate() (*template.Template, error) {
 	//
 	// Is there an on-disk template instead?  If so use it.
 	//
-	home := os.Getenv("HOME")
-
-	// If that fails then get the current user, and use
-	// their home if possible.
-	if home == "" {
-		usr, errr := user.Current()
-		if errr == nil {
-			home = usr.HomeDir
-		}
+	override := filepath.Join(config.ConfigDirectory(), "email.tmpl")
+	if config.IsSet(config.Template) {
+		override = config.Get(config.Template)
+	}
+	if e.template != "" {
+		override = e.template
 	}
 
-	// The path to the overridden template
-	override := filepath.Join(home, ".rss2email", "email.tmpl")
-
-	// If the file exists, use it.
+	// If the file exists, use it.  A feed's own template must exist.
 	_, err = os.Stat(override)
-	if !os.IsNotExist(err) {
+	if !os.IsNotExist(err) || e.template != "" {
 		content, err = ioutil.ReadFile(override)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read %s: %s", override, err.Error())
@@ -86,11 +200,15 @@ func (e *Emailer) loadTemplate() (*template.Template, error) {
 	//
 	// Function map allows exporting functions to the template
 	//
-	funcMap := template.FuncMap{
-		"quoteprintable": e.toQuotedPrintable,
-	}
+	funcMap := templateFuncs()
+	funcMap["quoteprintable"] = e.toQuotedPrintable
+	funcMap["encodebody"] = e.encodeBody
+	funcMap["encodeheader"] = encodeHeader
 
-	tmpl := template.Must(template.New("email.tmpl").Funcs(funcMap).Parse(string(content)))
+	tmpl, err := template.New("email.tmpl").Funcs(funcMap).Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %s", err.Error())
+	}
 
 	return tmpl, nil
 }
@@ -115,12 +233,243 @@ func (e *Emailer) toQuotedPrintable(s string) (string, error) {
 	return ac.String(), nil
 }
 
+// encodeHeader encodes the given value for use in a header, as per
+// RFC 2047.  ASCII values are returned unchanged.
+func encodeHeader(s string) string {
+	return mime.QEncoding.Encode("utf-8", s)
+}
+
+// headerAddress returns the given address formatted for use in a From:
+// or To: header.  Addresses may include a name, "Steve <steve@example.com>",
+// which will be encoded as per RFC 2047 if it contains non-ASCII text.
+func headerAddress(addr string) string {
+	a, err := mail.ParseAddress(addr)
+	if err != nil {
+		return addr
+	}
+	if a.Name == "" {
+		return a.Address
+	}
+	return a.String()
+}
+
+// headerAddresses returns the given addresses formatted for use in a
+// To: header.
+func headerAddresses(addrs []string) string {
+	out := make([]string, len(addrs))
+	for i, addr := range addrs {
+		out[i] = headerAddress(addr)
+	}
+	return strings.Join(out, ", ")
+}
+
+// envelopeAddress returns the bare email address from the given address,
+// which might include a name, for use in the SMTP envelope.
+func envelopeAddress(addr string) string {
+	a, err := mail.ParseAddress(addr)
+	if err != nil {
+		return addr
+	}
+	return a.Address
+}
+
+// envelopeAddresses returns the bare email addresses from the given list.
+func envelopeAddresses(addrs []string) []string {
+	out := make([]string, len(addrs))
+	for i, addr := range addrs {
+		out[i] = envelopeAddress(addr)
+	}
+	return out
+}
+
+// subject renders the subject template, using the given template
+// parameters, and encodes the result for use in a header.
+func (e *Emailer) subject(params interface{}) (string, error) {
+
+	src := config.Get(config.SubjectTemplate)
+	tmpl, err := template.New("subject").Parse(src)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse subject template %q: %s", src, err.Error())
+	}
+
+	out, err := execute(tmpl, params)
+	if err != nil {
+		return "", fmt.Errorf("subject template %q: %s", src, err.Error())
+	}
+
+	// Headers must be a single line.
+	subject := strings.Join(strings.Fields(string(out)), " ")
+
+	return encodeHeader(subject), nil
+}
+
+// Render generates the complete email which would be sent to the given
+// address, by populating our template.
+func (e *Emailer) Render(addr string, textstr string, htmlstr string) ([]byte, error) {
+	return e.render([]string{addr}, textstr, htmlstr)
+}
+
+// renderOptions control how a message is rendered.
+type renderOptions struct {
+
+	// attach is true if enclosures may be attached.
+	attach bool
+
+	// truncated is true if the content has already been shortened,
+	// so no preview should be made of it.
+	truncated bool
+}
+
+// renderMessage generates the complete email which would be sent to the
+// given addresses, the first of which is used as the sender.
+func (e *Emailer) renderMessage(to []string, textstr string, htmlstr string, opts renderOptions) ([]byte, error) {
+	var err error
+
+	//
+	// Here is a temporary structure we'll use to popular our email
+	// template.
+	//
+	type TemplateParms struct {
+		Feed      string
+		FeedTitle string
+		To        string
+		From      string
+		Text      string
+		HTML      string
+		Subject   string
+		Link      string
+
+		// RawText and RawHTML are the content of the item,
+		// without any transfer encoding.
+		RawText string
+		RawHTML string
+
+		// TextBody and HTMLBody are the output of the "text"
+		// and "html" templates, encoded with TextEncoding and
+		// HTMLEncoding respectively.
+		TextBody     string
+		TextEncoding string
+		HTMLBody     string
+		HTMLEncoding string
+
+		// SubjectHeader is the subject generated from our
+		// subject template, encoded for use in a header.
+		SubjectHeader string
+
+		// ReplyTo is the address replies should be sent to, if
+		// any.  The Reply-To header is added for you.
+		ReplyTo string
+
+		// ArchiveURL is the URL of a snapshot of the item within
+		// the Wayback Machine, if ARCHIVE_LINKS is set.
+		ArchiveURL string
+
+		// Truncated is true if Text and HTML contain a preview of
+		// the item, rather than all of it.
+		Truncated bool
+
+		// Enclosures contains any enclosures the item has,
+		// which might be attached to the message.
+		Enclosures []Enclosure
+
+		// In case people need access to fields
+		// we've not wrapped/exported explicitly
+		RSSFeed *gofeed.Feed
+		RSSItem withstate.FeedItem
+	}
+
+	//
+	// Populate it appropriately.
+	//
+	var x TemplateParms
+	x.Feed = e.feed.Link
+	x.FeedTitle = e.feed.Title
+	x.From = headerAddress(to[0])
+	x.Link = e.item.Link
+	x.Subject = e.item.Title
+	x.To = headerAddresses(to)
+	x.ReplyTo = e.replyAddress()
+	x.ArchiveURL = e.archiveURL()
+	x.RSSFeed = e.feed
+	x.RSSItem = e.item
+	x.Enclosures = e.enclosures()
+	if !opts.attach {
+		x.Enclosures = linked(x.Enclosures)
+	}
+
+	// Generate the subject from the template the user configured.
+	x.SubjectHeader, err = e.subject(x)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send a preview of the content, if we should.
+	x.Truncated = opts.truncated
+	if !opts.truncated {
+		textstr, htmlstr, x.Truncated, err = e.previewContent(textstr, htmlstr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The real meat of the mail is the text & HTML
+	// parts.  They need to be encoded, unconditionally.
+	x.RawText = textstr
+	x.RawHTML = html.UnescapeString(htmlstr)
+	x.Text, err = e.toQuotedPrintable(x.RawText)
+	if err != nil {
+		return nil, err
+	}
+	x.HTML, err = e.toQuotedPrintable(x.RawHTML)
+	if err != nil {
+		return nil, err
+	}
+
+	//
+	// Load the template we're going to render.
+	//
+	var t *template.Template
+	t, err = e.loadTemplate()
+	if err != nil {
+		return nil, err
+	}
+
+	//
+	// Render, and encode, the bodies of the text & HTML parts.
+	//
+	x.TextBody, x.TextEncoding, err = e.renderPart(t, "text", x)
+	if err != nil {
+		return nil, err
+	}
+	x.HTMLBody, x.HTMLEncoding, err = e.renderPart(t, "html", x)
+	if err != nil {
+		return nil, err
+	}
+
+	//
+	// Any additional headers come before those of the template.
+	//
+	extra, err := e.extraHeaders()
+	if err != nil {
+		return nil, err
+	}
+
+	//
+	// Render the template.
+	//
+	body, err := execute(t, x)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(extra), body...), nil
+}
+
 // Sendmail is a simple function that emails the given address.
 //
 // We send a MIME message with both a plain-text and a HTML-version of the
 // message.  This should be nicer for users.
 func (e *Emailer) Sendmail(addresses []string, textstr string, htmlstr string) error {
-	var err error
 
 	//
 	// Ensure we have a recipient.
@@ -131,192 +480,183 @@ func (e *Emailer) Sendmail(addresses []string, textstr string, htmlstr string) e
 	}
 
 	//
-	// Process each address
+	// Find the backends to deliver via.
 	//
-	for _, addr := range addresses {
-
-		//
-		// Here is a temporary structure we'll use to popular our email
-		// template.
-		//
-		type TemplateParms struct {
-			Feed      string
-			FeedTitle string
-			To        string
-			From      string
-			Text      string
-			HTML      string
-			Subject   string
-			Link      string
-
-			// In case people need access to fields
-			// we've not wrapped/exported explicitly
-			RSSFeed *gofeed.Feed
-			RSSItem withstate.FeedItem
-		}
+	list, err := e.selectBackends()
+	if err != nil {
+		return err
+	}
 
-		//
-		// Populate it appropriately.
-		//
-		var x TemplateParms
-		x.Feed = e.feed.Link
-		x.FeedTitle = e.feed.Title
-		x.From = addr
-		x.Link = e.item.Link
-		x.Subject = e.item.Title
-		x.To = addr
-		x.RSSFeed = e.feed
-		x.RSSItem = e.item
-
-		// The real meat of the mail is the text & HTML
-		// parts.  They need to be encoded, unconditionally.
-		x.Text, err = e.toQuotedPrintable(textstr)
-		if err != nil {
-			return err
-		}
-		x.HTML, err = e.toQuotedPrintable(html.UnescapeString(htmlstr))
+	//
+	// Deliver via each backend, a failure in one doesn't prevent
+	// delivery via the others.
+	//
+	var failures []string
+	for _, b := range list {
+		err := e.sendVia(b, addresses, textstr, htmlstr)
 		if err != nil {
-			return err
+			failures = append(failures, fmt.Sprintf("%s: %s", b.name, err.Error()))
 		}
+	}
 
-		//
-		// Load the template we're going to render.
-		//
-		var t *template.Template
-		t, err = e.loadTemplate()
-		if err != nil {
-			return err
-		}
+	if len(failures) > 0 {
+		return fmt.Errorf("delivery failed via %s", strings.Join(failures, ", "))
+	}
+	return nil
+}
 
-		//
-		// Render the template into the buffer.
-		//
-		buf := &bytes.Buffer{}
-		err = t.Execute(buf, x)
-		if err != nil {
-			return err
-		}
+// delivery is a single message which we send.
+type delivery struct {
 
-		//
-		// Are we sending via SMTP?
-		//
-		if e.isSMTP() {
+	// to holds the recipients shown in the message.
+	to []string
 
-			err := e.sendSMTP(addr, buf.Bytes())
-			if err != nil {
-				return err
-			}
-		} else {
+	// rcpt holds the recipients the message is delivered to, which
+	// includes any blind-copies.
+	rcpt []string
 
-			err := e.sendSendmail(addr, buf.Bytes())
-			if err != nil {
-				return err
-			}
-		}
-	}
-	return nil
+	// bcc holds the blind-copies, which are also within rcpt.
+	bcc []string
 }
 
-// isSMTP determines whether we should use SMTP to send the email.
+// deliveries returns the messages we should send to the given addresses,
+// via the given backend.
 //
-// We just check to see that the obvious mandatory parameters are set in the
-// environment.  If they're wrong we'll get an error at delivery time, as
-// expected.
-func (e *Emailer) isSMTP() bool {
-
-	// Mandatory environmental variables
-	vars := []string{"SMTP_HOST", "SMTP_USERNAME", "SMTP_PASSWORD"}
-
-	for _, name := range vars {
-		if os.Getenv(name) == "" {
-			return false
+// Normally a message is sent to each address in turn, but the user may
+// choose to send a single message to them all.  Any blind-copies are
+// added to the first message.
+func deliveries(b *backend, addresses []string) []delivery {
+
+	var out []delivery
+
+	switch {
+	case b.once:
+		out = append(out, delivery{to: addresses[:1], rcpt: addresses[:1]})
+		return out
+	case config.Get(config.GroupRecipients) == "true":
+		out = append(out, delivery{to: addresses, rcpt: addresses})
+	default:
+		for _, addr := range addresses {
+			out = append(out, delivery{to: []string{addr}, rcpt: []string{addr}})
 		}
 	}
 
-	return true
+	out[0].bcc = config.List(config.Bcc)
+	out[0].rcpt = append(append([]string{}, out[0].rcpt...), out[0].bcc...)
+	return out
 }
 
-// sendSMTP sends the content of the email to the destination address
-// via SMTP.
-func (e *Emailer) sendSMTP(to string, content []byte) error {
+// sendVia delivers the message to each address, via the given backend.
+func (e *Emailer) sendVia(b *backend, addresses []string, textstr string, htmlstr string) error {
 
-	// basics
-	host := os.Getenv("SMTP_HOST")
-	port := os.Getenv("SMTP_PORT")
+	for _, d := range deliveries(b, addresses) {
 
-	p := 587
-	if port != "" {
-		n, err := strconv.Atoi(port)
+		// The key identifies this particular delivery.  It's
+		// derived from the visible recipients alone, so that
+		// changing the blind-copies doesn't make it look new.
+		key := b.name + ":" + strings.Join(d.to, ",")
+		if b.once {
+			key = b.name
+		}
+
+		if e.deduplicate && e.item.Delivered(key) {
+			continue
+		}
+
+		content, err := e.render(d.to, textstr, htmlstr)
 		if err != nil {
 			return err
 		}
-		p = n
-	}
 
-	// auth
-	user := os.Getenv("SMTP_USERNAME")
-	pass := os.Getenv("SMTP_PASSWORD")
+		// Mail is encrypted to its recipients, if we should.
+		if encrypting() && !b.once {
+			content, err = e.encrypt(content, d.to, d.bcc)
+			if err != nil {
+				return err
+			}
+		}
 
-	// Authenticate
-	auth := smtp.PlainAuth("", user, pass, host)
+		err = b.send(e, d.rcpt, content)
 
-	// Get the mailserver
-	addr := fmt.Sprintf("%s:%d", host, p)
+		// Record the outcome for each recipient, for those
+		// backends which deliver to them.  This is informational,
+		// so failing to record it isn't fatal.
+		if !b.once {
+			receipts.Record(envelopeAddresses(d.rcpt), err)
+		}
 
-	// Send the mail
-	err := smtp.SendMail(addr, auth, to, []string{to}, content)
+		if err != nil {
+			return err
+		}
 
-	return err
+		if e.deduplicate {
+			err = e.item.RecordDelivered(key)
+			if err != nil {
+				return fmt.Errorf("failed to record delivery: %s", err.Error())
+			}
+		}
+	}
+	return nil
 }
 
-// sendSendmail sends the content of the email to the destination address
-// via /usr/sbin/sendmail
-func (e *Emailer) sendSendmail(addr string, content []byte) error {
-
-	// Get the command to run.
-	sendmail := exec.Command("/usr/sbin/sendmail", "-i", "-f", addr, addr)
-	stdin, err := sendmail.StdinPipe()
-	if err != nil {
-		fmt.Printf("Error sending email: %s\n", err.Error())
-		return err
-	}
+// DryRun renders the emails which Sendmail would send to the given
+// addresses, but rather than sending them it writes them out for
+// inspection.
+//
+// If dir is empty the messages are written to STDOUT, otherwise each
+// message is written to a distinct `.eml` file beneath that directory.
+func (e *Emailer) DryRun(addresses []string, textstr string, htmlstr string, dir string) error {
 
 	//
-	// Get the output pipe.
+	// Ensure we have a recipient.
 	//
-	stdout, err := sendmail.StdoutPipe()
-	if err != nil {
-		fmt.Printf("Error sending email: %s\n", err.Error())
-		return err
+	if len(addresses) < 1 {
+		e := errors.New("empty recipient address, did you not setup a recipient?")
+		return e
 	}
 
-	//
-	// Run the command, and pipe in the rendered template-result
-	//
-	sendmail.Start()
-	_, err = stdin.Write(content)
-	if err != nil {
-		fmt.Printf("Failed to write to sendmail pipe: %s\n", err.Error())
-		return err
-	}
-	stdin.Close()
+	// The messages are those we'd send to the recipients, rather than
+	// one for each of the backends.
+	for _, d := range deliveries(&backend{}, addresses) {
 
-	//
-	// Read the output of Sendmail.
-	//
-	_, err = ioutil.ReadAll(stdout)
-	if err != nil {
-		fmt.Printf("Error reading mail output: %s\n", err.Error())
-		return nil
-	}
+		content, err := e.render(d.to, textstr, htmlstr)
+		if err != nil {
+			return err
+		}
 
-	//
-	// Wait for the command to complete.
-	//
-	err = sendmail.Wait()
-	if err != nil {
-		fmt.Printf("Waiting for process to terminate failed: %s\n", err.Error())
+		if encrypting() {
+			content, err = e.encrypt(content, d.to, d.bcc)
+			if err != nil {
+				return err
+			}
+		}
+
+		// No directory?  Then dump to the console.
+		if dir == "" {
+			fmt.Printf("%s\n", content)
+			continue
+		}
+
+		// Ensure the directory exists
+		err = os.MkdirAll(dir, os.ModePerm)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %s", dir, err.Error())
+		}
+
+		// The filename is based upon the item and the recipient,
+		// so that repeated runs overwrite rather than accumulate.
+		guid := e.item.GUID
+		if guid == "" {
+			guid = e.item.Link
+		}
+		name := fmt.Sprintf("%x.eml", sha1.Sum([]byte(guid+strings.Join(d.to, ","))))
+
+		path := filepath.Join(dir, name)
+		err = ioutil.WriteFile(path, content, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %s", path, err.Error())
+		}
 	}
 
-	return err
+	return nil
 }
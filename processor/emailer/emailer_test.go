@@ -0,0 +1,1203 @@
+package emailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/withstate"
+)
+
+// newTestEmailer returns an emailer with a simple feed and item.
+func newTestEmailer(t *testing.T) *Emailer {
+
+	// Ensure we don't pick up a local template override
+	dir, err := ioutil.TempDir("", "emailer")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	cur := os.Getenv("HOME")
+	os.Setenv("HOME", dir)
+	t.Cleanup(func() { os.Setenv("HOME", cur) })
+
+	feed := &gofeed.Feed{Title: "Steve's Blog", Link: "https://blog.steve.fi/"}
+	item := withstate.FeedItem{Item: &gofeed.Item{
+		Title: "Hello World",
+		Link:  "https://blog.steve.fi/hello.html",
+		GUID:  "hello",
+	}}
+
+	return New(feed, item)
+}
+
+// TestRender ensures our template is populated.
+func TestRender(t *testing.T) {
+
+	e := newTestEmailer(t)
+
+	out, err := e.Render("steve@example.com", "text", "<p>html</p>")
+	if err != nil {
+		t.Fatalf("unexpected error rendering: %s", err)
+	}
+
+	expected := []string{
+		"To: steve@example.com",
+		"Subject: [rss2email] Hello World",
+		"X-RSS-Link: https://blog.steve.fi/hello.html",
+	}
+	for _, str := range expected {
+		if !strings.Contains(string(out), str) {
+			t.Errorf("rendered email didn't contain %q", str)
+		}
+	}
+}
+
+// TestDryRun ensures that dry-run emails are written to a directory.
+func TestDryRun(t *testing.T) {
+
+	e := newTestEmailer(t)
+
+	dir, err := ioutil.TempDir("", "dryrun")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = e.DryRun([]string{"a@example.com", "b@example.com"}, "text", "html", dir)
+	if err != nil {
+		t.Fatalf("unexpected error in dry-run: %s", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 2 {
+		t.Fatalf("expected two files, found %d", len(files))
+	}
+
+	// The messages are grouped, as they would be when sent.
+	cur := os.Getenv(config.GroupRecipients)
+	defer os.Setenv(config.GroupRecipients, cur)
+	os.Setenv(config.GroupRecipients, "true")
+
+	os.RemoveAll(dir)
+	err = e.DryRun([]string{"a@example.com", "b@example.com"}, "text", "html", dir)
+	if err != nil {
+		t.Fatalf("unexpected error in dry-run: %s", err)
+	}
+
+	files, _ = filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("expected one file, found %d", len(files))
+	}
+	out, _ := ioutil.ReadFile(files[0])
+	if !strings.Contains(string(out), "To: a@example.com, b@example.com\n") {
+		t.Errorf("recipients not found in message:\n%s", out)
+	}
+
+	// No recipients is an error
+	err = e.DryRun([]string{}, "text", "html", dir)
+	if err == nil {
+		t.Fatalf("expected an error with no recipients")
+	}
+}
+
+// TestEnclosures ensures that small enclosures are attached, and large
+// ones are linked.
+func TestEnclosures(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/large.mp3" {
+			fmt.Fprint(w, strings.Repeat("x", 2048))
+			return
+		}
+		fmt.Fprint(w, "small")
+	}))
+	defer ts.Close()
+
+	for _, name := range []string{config.AttachEnclosures, config.EnclosureMaxSize} {
+		cur := os.Getenv(name)
+		defer os.Setenv(name, cur)
+	}
+	os.Setenv(config.AttachEnclosures, "true")
+	os.Setenv(config.EnclosureMaxSize, "1024")
+
+	e := newTestEmailer(t)
+	e.item.Enclosures = []*gofeed.Enclosure{
+		{URL: ts.URL + "/small.jpg", Type: "image/jpeg"},
+		{URL: ts.URL + "/large.mp3", Type: "audio/mpeg"},
+		{URL: ts.URL + "/evil.jpg", Type: "image/jpeg\r\nX-Injected: yes"},
+	}
+
+	out, err := e.Render("steve@example.com", "text", "html")
+	if err != nil {
+		t.Fatalf("unexpected error rendering: %s", err)
+	}
+
+	expected := []string{
+		`Content-Disposition: attachment; filename="small.jpg"`,
+		"c21hbGw=",
+		"Enclosure: " + ts.URL + "/large.mp3",
+	}
+	for _, str := range expected {
+		if !strings.Contains(string(out), str) {
+			t.Errorf("rendered email didn't contain %q", str)
+		}
+	}
+	if strings.Contains(string(out), `filename="large.mp3"`) {
+		t.Errorf("large enclosure was attached")
+	}
+	if strings.Contains(string(out), "X-Injected") || !strings.Contains(string(out), `Content-Type: application/octet-stream; name="evil.jpg"`) {
+		t.Errorf("invalid enclosure type was used:\n%s", out)
+	}
+
+	if enclosureType("Audio/MPEG; rate=44100") != "audio/mpeg" || enclosureType("") != "application/octet-stream" {
+		t.Errorf("unexpected enclosure types")
+	}
+}
+
+// TestTranscode ensures that large enclosures are attached once they've
+// been transcoded, and that the results are cached.
+func TestTranscode(t *testing.T) {
+
+	fetches := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		fmt.Fprint(w, strings.Repeat("x", 2048))
+	}))
+	defer ts.Close()
+
+	for _, name := range []string{config.AttachEnclosures, config.EnclosureMaxSize} {
+		cur := os.Getenv(name)
+		defer os.Setenv(name, cur)
+	}
+	os.Setenv(config.AttachEnclosures, "true")
+	os.Setenv(config.EnclosureMaxSize, "1024")
+
+	dir, err := ioutil.TempDir("", "transcode")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	transcodeDirectory = dir
+	defer func() { transcodeDirectory = "" }()
+
+	render := func(command string) string {
+		e := newTestEmailer(t)
+		e.SetTranscode(command)
+		e.item.Enclosures = []*gofeed.Enclosure{
+			{URL: ts.URL + "/large.mp3", Type: "audio/mpeg", Length: "2048"},
+		}
+
+		out, err := e.Render("steve@example.com", "text", "html")
+		if err != nil {
+			t.Fatalf("unexpected error rendering: %s", err)
+		}
+		return string(out)
+	}
+
+	// Too large, even once transcoded.
+	out := render("head -c 1500")
+	if strings.Contains(out, `filename="large.mp3"`) {
+		t.Errorf("large enclosure was attached")
+	}
+
+	// A failing command means no attachment.
+	out = render("false")
+	if strings.Contains(out, `filename="large.mp3"`) {
+		t.Errorf("enclosure attached after transcoding failed")
+	}
+
+	// Small enough.
+	out = render("head -c 10")
+	if !strings.Contains(out, `filename="large.mp3"`) || !strings.Contains(out, "eHh4eHh4eHh4eA==") {
+		t.Errorf("transcoded enclosure wasn't attached:\n%s", out)
+	}
+
+	// The second time around we use the cache.
+	count := fetches
+	out = render("head -c 10")
+	if !strings.Contains(out, "eHh4eHh4eHh4eA==") {
+		t.Errorf("transcoded enclosure wasn't attached:\n%s", out)
+	}
+	if fetches != count {
+		t.Errorf("enclosure was fetched again, rather than cached")
+	}
+}
+
+// TestBackends ensures sendmail is always available, as the fallback.
+func TestBackends(t *testing.T) {
+
+	found := false
+	for _, name := range Backends() {
+		if name == "sendmail" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("sendmail backend not registered: %v", Backends())
+	}
+
+	if selectBackend() == nil {
+		t.Fatalf("failed to select a backend")
+	}
+}
+
+// TestDeduplicate ensures that when several backends are in use a
+// failure in one is retried without repeating the others.
+func TestDeduplicate(t *testing.T) {
+
+	old := backends
+	defer func() { backends = old }()
+
+	for _, name := range []string{config.Backends, config.Bcc} {
+		cur := os.Getenv(name)
+		defer os.Setenv(name, cur)
+	}
+
+	sent := map[string]int{}
+	fail := true
+
+	registerBackend(backend{
+		name:    "test-ok",
+		enabled: func() bool { return false },
+		send: func(e *Emailer, to []string, content []byte) error {
+			sent["ok:"+strings.Join(to, ",")]++
+			return nil
+		},
+	})
+	registerBackend(backend{
+		name:    "test-flaky",
+		enabled: func() bool { return false },
+		send: func(e *Emailer, to []string, content []byte) error {
+			if fail {
+				return fmt.Errorf("transient failure")
+			}
+			sent["flaky:"+strings.Join(to, ",")]++
+			return nil
+		},
+	})
+
+	os.Setenv(config.Backends, "test-ok,test-flaky")
+
+	e := newTestEmailer(t)
+	e.item.GUID = fmt.Sprintf("dedup-%d", time.Now().UnixNano())
+	e.SetDeduplicate(true)
+
+	to := []string{"steve@example.com", "bob@example.com"}
+
+	err := e.Sendmail(to, "text", "html")
+	if err == nil || !strings.Contains(err.Error(), "test-flaky") {
+		t.Fatalf("expected failure from the flaky backend, got %v", err)
+	}
+	if sent["ok:steve@example.com"] != 1 || sent["ok:bob@example.com"] != 1 {
+		t.Fatalf("working backend wasn't used: %v", sent)
+	}
+
+	// Retrying only delivers via the backend which failed.
+	fail = false
+	err = e.Sendmail(to, "text", "html")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if sent["ok:steve@example.com"] != 1 || sent["flaky:bob@example.com"] != 1 {
+		t.Fatalf("unexpected deliveries: %v", sent)
+	}
+
+	// Adding a blind-copy doesn't make the deliveries look new.
+	os.Setenv(config.Bcc, "archive@example.com")
+	err = e.Sendmail(to, "text", "html")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if sent["ok:steve@example.com"] != 1 || sent["ok:steve@example.com,archive@example.com"] != 0 {
+		t.Fatalf("unexpected deliveries: %v", sent)
+	}
+
+	// Unknown backends are reported.
+	os.Setenv(config.Backends, "carrier-pigeon")
+	err = e.Sendmail(to, "text", "html")
+	if err == nil || !strings.Contains(err.Error(), "unknown backend") {
+		t.Fatalf("expected error for unknown backend, got %v", err)
+	}
+}
+
+// TestGroupRecipients ensures a single message may be sent to all the
+// recipients, and that blind-copies are delivered.
+func TestGroupRecipients(t *testing.T) {
+
+	old := backends
+	defer func() { backends = old }()
+
+	for _, name := range []string{config.Backends, config.GroupRecipients, config.Bcc} {
+		cur := os.Getenv(name)
+		defer os.Setenv(name, cur)
+	}
+
+	var rcpts []string
+	var messages []string
+	registerBackend(backend{
+		name:    "test-record",
+		enabled: func() bool { return false },
+		send: func(e *Emailer, to []string, content []byte) error {
+			rcpts = append(rcpts, strings.Join(to, ","))
+			messages = append(messages, string(content))
+			return nil
+		},
+	})
+	os.Setenv(config.Backends, "test-record")
+	os.Setenv(config.Bcc, "archive@example.com")
+
+	e := newTestEmailer(t)
+	to := []string{"steve@example.com", "Bob <bob@example.com>"}
+
+	// By default each recipient gets their own message, and the
+	// blind-copy accompanies the first.
+	os.Setenv(config.GroupRecipients, "")
+	err := e.Sendmail(to, "text", "html")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.Join(rcpts, " ") != "steve@example.com,archive@example.com Bob <bob@example.com>" {
+		t.Fatalf("unexpected recipients: %v", rcpts)
+	}
+
+	// Or a single message is sent to them all.
+	rcpts = nil
+	messages = nil
+	os.Setenv(config.GroupRecipients, "true")
+	err = e.Sendmail(to, "text", "html")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(rcpts) != 1 || rcpts[0] != "steve@example.com,Bob <bob@example.com>,archive@example.com" {
+		t.Fatalf("unexpected recipients: %v", rcpts)
+	}
+	if !strings.Contains(messages[0], "To: steve@example.com, \"Bob\" <bob@example.com>\n") {
+		t.Errorf("recipients not found in message:\n%s", messages[0])
+	}
+	if strings.Contains(messages[0], "archive@example.com") {
+		t.Errorf("blind-copy shown in message:\n%s", messages[0])
+	}
+}
+
+// TestHeaders ensures additional headers are added to messages.
+func TestHeaders(t *testing.T) {
+
+	cur := os.Getenv(config.Headers)
+	defer os.Setenv(config.Headers, cur)
+	os.Setenv(config.Headers, "X-Label: news, tech, X-Source: rss2email")
+
+	e := newTestEmailer(t)
+	e.SetHeaders([]string{"x-label: blogs", "X-Feed: Grüße"})
+
+	out, err := e.Render("steve@example.com", "text", "html")
+	if err != nil {
+		t.Fatalf("unexpected error rendering: %s", err)
+	}
+
+	prefix := "Auto-Submitted: auto-generated\nX-Label: blogs\nX-Source: rss2email\nX-Feed: =?utf-8?q?Gr=C3=BC=C3=9Fe?=\nContent-Type:"
+	if !strings.HasPrefix(string(out), prefix) {
+		t.Errorf("headers not found:\n%s", out)
+	}
+
+	// Values may contain commas.
+	got := splitHeaders("X-Label: news, tech, X-Source: rss2email")
+	if len(got) != 2 || got[0] != "X-Label: news, tech" {
+		t.Errorf("unexpected headers: %q", got)
+	}
+
+	// Invalid headers are errors.
+	for _, h := range []string{"X-Label", "X Label: news", "X-Label: a\r\nBcc: evil@example.com"} {
+		e.SetHeaders([]string{h})
+		_, err = e.Render("steve@example.com", "text", "html")
+		if err == nil {
+			t.Errorf("expected error for header %q", h)
+		}
+	}
+}
+
+// TestAutoSubmitted ensures that messages are marked as being
+// automatically generated.
+func TestAutoSubmitted(t *testing.T) {
+
+	for _, name := range []string{config.AutoSubmitted, config.Precedence} {
+		cur := os.Getenv(name)
+		defer os.Setenv(name, cur)
+		os.Setenv(name, "")
+	}
+
+	e := newTestEmailer(t)
+
+	out, err := e.Render("steve@example.com", "text", "html")
+	if err != nil {
+		t.Fatalf("unexpected error rendering: %s", err)
+	}
+	if !strings.HasPrefix(string(out), "Auto-Submitted: auto-generated\nContent-Type:") {
+		t.Errorf("Auto-Submitted header not found:\n%s", out)
+	}
+
+	os.Setenv(config.AutoSubmitted, "no")
+	os.Setenv(config.Precedence, "bulk")
+	out, err = e.Render("steve@example.com", "text", "html")
+	if err != nil {
+		t.Fatalf("unexpected error rendering: %s", err)
+	}
+	if !strings.HasPrefix(string(out), "Precedence: bulk\nContent-Type:") {
+		t.Errorf("unexpected headers:\n%s", out)
+	}
+}
+
+// TestInstanceHeaders ensures the host and version are only added to
+// our headers when requested.
+func TestInstanceHeaders(t *testing.T) {
+
+	cur := os.Getenv(config.InstanceHeaders)
+	defer os.Setenv(config.InstanceHeaders, cur)
+	os.Setenv(config.InstanceHeaders, "")
+
+	e := newTestEmailer(t)
+	e.SetVersion("v1.2.3")
+
+	out, err := e.Render("steve@example.com", "text", "html")
+	if err != nil {
+		t.Fatalf("unexpected error rendering: %s", err)
+	}
+	if strings.Contains(string(out), VersionHeader) {
+		t.Errorf("unexpected instance headers:\n%s", out)
+	}
+
+	os.Setenv(config.InstanceHeaders, "true")
+	out, err = e.Render("steve@example.com", "text", "html")
+	if err != nil {
+		t.Fatalf("unexpected error rendering: %s", err)
+	}
+	host, _ := os.Hostname()
+	for _, h := range []string{HostHeader + ": " + host + "\n", VersionHeader + ": v1.2.3\n"} {
+		if !strings.Contains(string(out), h) {
+			t.Errorf("header %q not found:\n%s", h, out)
+		}
+	}
+}
+
+// TestReplyTo ensures the Reply-To header is set.
+func TestReplyTo(t *testing.T) {
+
+	cur := os.Getenv(config.ReplyTo)
+	defer os.Setenv(config.ReplyTo, cur)
+	os.Setenv(config.ReplyTo, "")
+
+	e := newTestEmailer(t)
+
+	out, err := e.Render("steve@example.com", "text", "html")
+	if err != nil {
+		t.Fatalf("unexpected error rendering: %s", err)
+	}
+	if strings.Contains(string(out), "Reply-To:") {
+		t.Fatalf("Reply-To present when unset:\n%s", out)
+	}
+
+	os.Setenv(config.ReplyTo, "Steve <steve@example.com>")
+	out, err = e.Render("bob@example.com", "text", "html")
+	if err != nil {
+		t.Fatalf("unexpected error rendering: %s", err)
+	}
+	if !strings.HasPrefix(string(out), "Reply-To: \"Steve\" <steve@example.com>\n") {
+		t.Fatalf("Reply-To not found:\n%s", out)
+	}
+
+	// The feed's setting wins.
+	e.SetReplyTo("editor@example.org")
+	out, err = e.Render("bob@example.com", "text", "html")
+	if err != nil {
+		t.Fatalf("unexpected error rendering: %s", err)
+	}
+	if !strings.HasPrefix(string(out), "Reply-To: editor@example.org\n") {
+		t.Fatalf("Reply-To not found:\n%s", out)
+	}
+}
+
+// TestThreading ensures that threading headers are stable, and shared
+// by the items of a feed.
+func TestThreading(t *testing.T) {
+
+	cur := os.Getenv(config.Threading)
+	defer os.Setenv(config.Threading, cur)
+	os.Setenv(config.Threading, "")
+
+	e := newTestEmailer(t)
+
+	out, err := e.Render("steve@example.com", "text", "html")
+	if err != nil {
+		t.Fatalf("unexpected error rendering: %s", err)
+	}
+	if strings.Contains(string(out), "Message-ID:") {
+		t.Fatalf("threading headers present when disabled")
+	}
+
+	os.Setenv(config.Threading, "true")
+
+	headers := func(e *Emailer) map[string]string {
+		out, err := e.Render("steve@example.com", "text", "html")
+		if err != nil {
+			t.Fatalf("unexpected error rendering: %s", err)
+		}
+		found := make(map[string]string)
+		for _, line := range strings.Split(string(out), "\n") {
+			for _, name := range []string{"Message-ID", "In-Reply-To", "References"} {
+				if strings.HasPrefix(line, name+": ") {
+					found[name] = strings.TrimPrefix(line, name+": ")
+				}
+			}
+		}
+		return found
+	}
+
+	a := headers(e)
+	if len(a) != 3 || !strings.HasSuffix(a["Message-ID"], "@blog.steve.fi>") {
+		t.Fatalf("unexpected headers: %v", a)
+	}
+	if a["In-Reply-To"] != a["References"] || a["Message-ID"] == a["References"] {
+		t.Fatalf("unexpected headers: %v", a)
+	}
+
+	// The same item has the same ID.
+	if b := headers(newTestEmailer(t)); b["Message-ID"] != a["Message-ID"] {
+		t.Errorf("message-ID isn't stable: %v %v", a, b)
+	}
+
+	// A different item has a different ID, but the same root.
+	other := newTestEmailer(t)
+	other.item.GUID = "goodbye"
+	b := headers(other)
+	if b["Message-ID"] == a["Message-ID"] || b["References"] != a["References"] {
+		t.Errorf("unexpected headers: %v %v", a, b)
+	}
+}
+
+// TestSandbox ensures pathological templates fail cleanly.
+func TestSandbox(t *testing.T) {
+
+	for _, name := range []string{config.TemplateMaxSize, config.TemplateTimeout} {
+		cur := os.Getenv(name)
+		defer os.Setenv(name, cur)
+	}
+	os.Setenv(config.TemplateMaxSize, "1024")
+	os.Setenv(config.TemplateTimeout, "")
+
+	// Too much output.
+	huge := template.Must(template.New("huge").Parse(`{{range .}}{{.}}{{end}}`))
+	_, err := execute(huge, strings.Split(strings.Repeat("x", 2048), ""))
+	if err == nil || !strings.Contains(err.Error(), "limit of 1024 bytes") {
+		t.Fatalf("expected output limit error, got %v", err)
+	}
+
+	// Too slow.
+	os.Setenv(config.TemplateTimeout, "50ms")
+	slow := template.Must(template.New("slow").Funcs(template.FuncMap{
+		"sleep": func() string { time.Sleep(time.Second); return "" },
+	}).Parse(`{{sleep}}`))
+	_, err = execute(slow, nil)
+	if err == nil || !strings.Contains(err.Error(), "took longer than 50ms") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+
+	// Fine.
+	out, err := execute(huge, []string{"a", "b"})
+	if err != nil || string(out) != "ab" {
+		t.Fatalf("unexpected result %q %v", out, err)
+	}
+
+	// A broken template is reported, rather than panicking.
+	e := newTestEmailer(t)
+	path := filepath.Join(os.Getenv("HOME"), "broken.tmpl")
+	ioutil.WriteFile(path, []byte("{{.Subject"), 0644)
+
+	cur := os.Getenv(config.Template)
+	defer os.Setenv(config.Template, cur)
+	os.Setenv(config.Template, path)
+
+	_, err = e.Render("steve@example.com", "text", "html")
+	if err == nil || !strings.Contains(err.Error(), "failed to parse template") {
+		t.Fatalf("expected parse error, got %v", err)
+	}
+}
+
+// TestSendmailArgs tests the arguments passed to sendmail.
+func TestSendmailArgs(t *testing.T) {
+
+	cur := os.Getenv(config.SendmailArgs)
+	defer os.Setenv(config.SendmailArgs, cur)
+
+	tests := map[string]string{
+		"":                   "-i -f steve@example.com -- steve@example.com bob@example.com",
+		"-t":                 "-t -- steve@example.com bob@example.com",
+		"-f {from} -- {to}":  "-f steve@example.com -- steve@example.com bob@example.com",
+		"--from={from} -oi ": "--from=steve@example.com -oi -- steve@example.com bob@example.com",
+	}
+	for in, out := range tests {
+		os.Setenv(config.SendmailArgs, in)
+		got := strings.Join(sendmailArgs("steve@example.com", []string{"steve@example.com", "bob@example.com"}), " ")
+		if got != out {
+			t.Errorf("unexpected arguments for %q: %s", in, got)
+		}
+	}
+}
+
+// TestSendmailFailure ensures that sendmail's errors are reported, and
+// that it can't hang forever.
+func TestSendmailFailure(t *testing.T) {
+
+	for _, name := range []string{config.SendmailPath, config.SendmailArgs, config.SendmailTimeout} {
+		cur := os.Getenv(name)
+		defer os.Setenv(name, cur)
+	}
+
+	dir, err := ioutil.TempDir("", "sendmail")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	script := filepath.Join(dir, "sendmail")
+	os.Setenv(config.SendmailPath, script)
+	os.Setenv(config.SendmailArgs, "")
+	os.Setenv(config.SendmailTimeout, "500ms")
+
+	e := newTestEmailer(t)
+
+	type TestCase struct {
+		script string
+		err    string
+	}
+
+	tests := []TestCase{
+		{"cat >/dev/null", ""},
+		{"cat >/dev/null; echo 'unknown user' >&2; exit 67", "exit status 67: unknown user"},
+		{"exec sleep 10", "timed out after 500ms"},
+	}
+
+	for _, tst := range tests {
+		err = ioutil.WriteFile(script, []byte("#!/bin/sh\n"+tst.script+"\n"), 0755)
+		if err != nil {
+			t.Fatalf("failed to write script: %s", err)
+		}
+
+		err = e.sendSendmail([]string{"steve@example.com"}, []byte("Subject: test\n\ntest\n"))
+		if tst.err == "" {
+			if err != nil {
+				t.Errorf("unexpected error for %q: %s", tst.script, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tst.err) {
+			t.Errorf("expected error %q for %q, got %v", tst.err, tst.script, err)
+		}
+	}
+}
+
+// TestSubjectTemplate ensures the subject may be customized, and that
+// non-ASCII subjects are encoded.
+func TestSubjectTemplate(t *testing.T) {
+
+	cur := os.Getenv(config.SubjectTemplate)
+	defer os.Setenv(config.SubjectTemplate, cur)
+	os.Setenv(config.SubjectTemplate, "[{{.FeedTitle}}] {{.Subject}}")
+
+	e := newTestEmailer(t)
+
+	out, err := e.Render("steve@example.com", "text", "html")
+	if err != nil {
+		t.Fatalf("unexpected error rendering: %s", err)
+	}
+	if !strings.Contains(string(out), "Subject: [Steve's Blog] Hello World\n") {
+		t.Errorf("custom subject not found:\n%s", out)
+	}
+
+	e.item.Title = "Grüße"
+	out, err = e.Render("steve@example.com", "text", "html")
+	if err != nil {
+		t.Fatalf("unexpected error rendering: %s", err)
+	}
+	if !strings.Contains(string(out), "Subject: =?utf-8?q?[Steve's_Blog]_Gr=C3=BC=C3=9Fe?=\n") {
+		t.Errorf("encoded subject not found:\n%s", out)
+	}
+
+	// A broken template is an error
+	os.Setenv(config.SubjectTemplate, "{{.Subject")
+	_, err = e.Render("steve@example.com", "text", "html")
+	if err == nil {
+		t.Errorf("expected error with a broken subject template")
+	}
+}
+
+// TestAddresses ensures names within addresses are encoded.
+func TestAddresses(t *testing.T) {
+
+	e := newTestEmailer(t)
+
+	out, err := e.Render("Jörg Schmidt <joerg@example.com>", "text", "html")
+	if err != nil {
+		t.Fatalf("unexpected error rendering: %s", err)
+	}
+	if !strings.Contains(string(out), "To: =?utf-8?q?J=C3=B6rg_Schmidt?= <joerg@example.com>\n") {
+		t.Errorf("encoded address not found:\n%s", out)
+	}
+
+	if envelopeAddress("Jörg Schmidt <joerg@example.com>") != "joerg@example.com" {
+		t.Errorf("failed to find envelope address")
+	}
+	if envelopeAddress("steve@example.com") != "steve@example.com" {
+		t.Errorf("failed to find envelope address")
+	}
+}
+
+// TestTemplateFuncs tests some of our template helpers.
+func TestTemplateFuncs(t *testing.T) {
+
+	if truncate(5, "Hello, World") != "Hello…" {
+		t.Errorf("truncate failed: %s", truncate(5, "Hello, World"))
+	}
+	if truncate(50, "Grüße") != "Grüße" {
+		t.Errorf("truncate failed: %s", truncate(50, "Grüße"))
+	}
+	if defaultValue("x", "") != "x" || defaultValue("x", "y") != "y" {
+		t.Errorf("default failed")
+	}
+
+	when := time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)
+	if formatDate("2006-01-02", &when) != "2021-03-04" {
+		t.Errorf("date failed: %s", formatDate("2006-01-02", &when))
+	}
+	var missing *time.Time
+	if formatDate("2006-01-02", missing) != "" {
+		t.Errorf("date failed with a nil time")
+	}
+
+	// Only our own environmental variables may be read.
+	for _, name := range []string{"R2E_TEST_NAME", "SMTP_PASSWORD"} {
+		cur := os.Getenv(name)
+		defer os.Setenv(name, cur)
+		os.Setenv(name, "secret")
+	}
+	if templateEnv("R2E_TEST_NAME") != "secret" || templateEnv("SMTP_PASSWORD") != "" {
+		t.Errorf("env failed")
+	}
+
+	// Ensure they're usable from a template
+	tmpl := template.Must(template.New("x").Funcs(templateFuncs()).Parse(`{{upper .}} {{. | truncate 3 | lower}}`))
+	buf := &bytes.Buffer{}
+	err := tmpl.Execute(buf, "Steve")
+	if err != nil {
+		t.Fatalf("failed to execute template: %s", err)
+	}
+	if buf.String() != "STEVE ste…" {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
+
+// TestPreview ensures that long items are shortened, when a preview has
+// been configured.
+func TestPreview(t *testing.T) {
+
+	cur := os.Getenv(config.Preview)
+	defer os.Setenv(config.Preview, cur)
+	os.Setenv(config.Preview, "")
+
+	content := "<p>One two three four</p><p>Five six</p><p>Seven</p>"
+
+	e := newTestEmailer(t)
+
+	text, html, truncated, err := e.previewContent("text", content)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if truncated || text != "text" || html != content {
+		t.Fatalf("content changed without a preview")
+	}
+
+	type TestCase struct {
+		size      string
+		text      string
+		truncated bool
+	}
+
+	tests := []TestCase{
+		{"2p", "One two three four\n\nFive six\n\nRead more: ", true},
+		{"3p", "text", false},
+		{"3w", "One two three …\n\nRead more: ", true},
+		{"5w", "One two three four\n\nFive …\n\nRead more: ", true},
+		{"7", "text", false},
+	}
+
+	for _, tst := range tests {
+		os.Setenv(config.Preview, tst.size)
+
+		text, html, truncated, err = e.previewContent("text", content)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %s", tst.size, err)
+		}
+		if truncated != tst.truncated {
+			t.Fatalf("%s: expected truncated=%v", tst.size, tst.truncated)
+		}
+		if !strings.HasPrefix(text, tst.text) {
+			t.Fatalf("%s: unexpected text %q", tst.size, text)
+		}
+		if truncated && !strings.Contains(html, ">Read more…</a>") {
+			t.Fatalf("%s: missing link in %q", tst.size, html)
+		}
+	}
+
+	// The feed's setting wins.
+	e.SetPreview("1p")
+	text, _, _, err = e.previewContent("text", content)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.HasPrefix(text, "One two three four\n\nRead more: ") {
+		t.Fatalf("unexpected text %q", text)
+	}
+
+	// Bogus sizes are errors.
+	for _, size := range []string{"0", "p", "ten words", "-2w"} {
+		e.SetPreview(size)
+		_, _, _, err = e.previewContent("text", content)
+		if err == nil {
+			t.Fatalf("expected error for %q", size)
+		}
+	}
+}
+
+// TestBodyEncoding ensures that a sane transfer encoding is chosen for
+// each part of the message, and that it may be overridden.
+func TestBodyEncoding(t *testing.T) {
+
+	cur := os.Getenv(config.BodyEncoding)
+	defer os.Setenv(config.BodyEncoding, cur)
+
+	text := "Привет, мир!  Это сообщение написано по-русски."
+
+	e := newTestEmailer(t)
+
+	type TestCase struct {
+		setting string
+		text    string
+		html    string
+	}
+
+	tests := []TestCase{
+		{"", "base64", "quoted-printable"},
+		{"auto", "base64", "quoted-printable"},
+		{"base64", "base64", "base64"},
+		{"quoted-printable", "quoted-printable", "quoted-printable"},
+	}
+
+	for _, tst := range tests {
+		os.Setenv(config.BodyEncoding, tst.setting)
+
+		out, err := e.Render("steve@example.com", text, "<p>Hello, world!</p>")
+		if err != nil {
+			t.Fatalf("unexpected error rendering: %s", err)
+		}
+
+		msg := string(out)
+		textPart := msg[strings.Index(msg, "Content-Type: text/plain"):strings.Index(msg, "Content-Type: text/html")]
+		htmlPart := msg[strings.Index(msg, "Content-Type: text/html"):]
+
+		if !strings.Contains(textPart, "Content-Transfer-Encoding: "+tst.text+"\n") {
+			t.Errorf("%q: expected text to be %s:\n%s", tst.setting, tst.text, textPart)
+		}
+		if !strings.Contains(htmlPart, "Content-Transfer-Encoding: "+tst.html+"\n") {
+			t.Errorf("%q: expected HTML to be %s:\n%s", tst.setting, tst.html, htmlPart)
+		}
+
+		// The text must survive the round-trip.
+		if tst.text == "base64" {
+			body := strings.SplitN(textPart, "\n\n", 2)[1]
+			body = body[:strings.Index(body, "\n--")]
+			data, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(body, "\r\n", ""))
+			if err != nil {
+				t.Fatalf("%q: failed to decode text: %s", tst.setting, err)
+			}
+			if !strings.Contains(string(data), text) {
+				t.Errorf("%q: text not found in %q", tst.setting, data)
+			}
+		}
+	}
+
+	os.Setenv(config.BodyEncoding, "uuencode")
+	_, err := e.Render("steve@example.com", text, "<p>Hello, world!</p>")
+	if err == nil {
+		t.Fatalf("expected error with a bogus encoding")
+	}
+}
+
+// TestMessageSize ensures that large messages are shortened to fit.
+func TestMessageSize(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, strings.Repeat("x", 4096))
+	}))
+	defer ts.Close()
+
+	for _, name := range []string{config.MaxMessageSize, config.MessageSizePolicy, config.AttachEnclosures} {
+		cur := os.Getenv(name)
+		defer os.Setenv(name, cur)
+	}
+	os.Setenv(config.AttachEnclosures, "true")
+	os.Setenv(config.MessageSizePolicy, "")
+
+	e := newTestEmailer(t)
+	e.item.Enclosures = []*gofeed.Enclosure{
+		{URL: ts.URL + "/photo.jpg", Type: "image/jpeg"},
+	}
+
+	image := `<img src="data:image/png;base64,` + strings.Repeat("A", 20000) + `">`
+	content := "<p>" + strings.Repeat("word ", 400) + "</p>" + image
+
+	// No limit.
+	os.Setenv(config.MaxMessageSize, "")
+	out, err := e.Render("steve@example.com", "text", content)
+	if err != nil {
+		t.Fatalf("unexpected error rendering: %s", err)
+	}
+	full := len(out)
+
+	// Big enough without the attachment.
+	os.Setenv(config.MaxMessageSize, strconv.Itoa(full-4096))
+	out, err = e.Render("steve@example.com", "text", content)
+	if err != nil {
+		t.Fatalf("unexpected error rendering: %s", err)
+	}
+	if strings.Contains(string(out), `filename="photo.jpg"`) || strings.Contains(string(out), "Read more") {
+		t.Fatalf("expected only the attachment to be removed:\n%s", out)
+	}
+
+	// Truncated.
+	os.Setenv(config.MaxMessageSize, "6000")
+	out, err = e.Render("steve@example.com", "text", content)
+	if err != nil {
+		t.Fatalf("unexpected error rendering: %s", err)
+	}
+	if len(out) > 6000 || strings.Contains(string(out), strings.Repeat("A", 60)) || !strings.Contains(string(out), "word word") {
+		t.Fatalf("message wasn't truncated:\n%s", out)
+	}
+
+	// Link only.
+	os.Setenv(config.MessageSizePolicy, "link")
+	out, err = e.Render("steve@example.com", "text", content)
+	if err != nil {
+		t.Fatalf("unexpected error rendering: %s", err)
+	}
+	if len(out) > 6000 || strings.Contains(string(out), "word") || !strings.Contains(string(out), "Read more") {
+		t.Fatalf("message wasn't replaced by a link:\n%s", out)
+	}
+
+	// Too small for anything.
+	os.Setenv(config.MaxMessageSize, "100")
+	_, err = e.Render("steve@example.com", "text", content)
+	if err == nil {
+		t.Fatalf("expected an error with a tiny limit")
+	}
+
+	os.Setenv(config.MessageSizePolicy, "drop")
+	_, err = e.Render("steve@example.com", "text", content)
+	if err == nil {
+		t.Fatalf("expected an error with a bogus policy")
+	}
+}
+
+// TestEncrypt ensures messages are encrypted via PGP/MIME, and may be
+// decrypted by the recipient.
+func TestEncrypt(t *testing.T) {
+
+	gpg, err := exec.LookPath("gpg")
+	if err != nil {
+		t.Skip("gpg is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "gpg")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	defer exec.Command("gpgconf", "--homedir", dir, "--kill", "all").Run()
+
+	out, err := exec.Command(gpg, "--homedir", dir, "--batch", "--passphrase", "", "--quick-gen-key", "steve@example.com", "default", "default", "never").CombinedOutput()
+	if err != nil {
+		t.Skipf("failed to generate a key: %s %s", err, out)
+	}
+
+	for _, name := range []string{config.GPGHome, config.GPGKeyFile} {
+		cur := os.Getenv(name)
+		defer os.Setenv(name, cur)
+	}
+	os.Setenv(config.GPGHome, dir)
+	os.Setenv(config.GPGKeyFile, "")
+
+	e := newTestEmailer(t)
+	msg, err := e.Render("steve@example.com", "secret text", "<p>secret html</p>")
+	if err != nil {
+		t.Fatalf("unexpected error rendering: %s", err)
+	}
+
+	enc, err := e.encrypt(msg, []string{"steve@example.com"}, nil)
+	if err != nil {
+		t.Fatalf("failed to encrypt: %s", err)
+	}
+
+	fields, body := splitMessage(enc)
+	headers := strings.Join(fields, "\n")
+	for _, str := range []string{"To: steve@example.com", "Subject: ", "Content-Type: multipart/encrypted; protocol=\"application/pgp-encrypted\""} {
+		if !strings.Contains(headers, str) {
+			t.Errorf("header %q not found in:\n%s", str, headers)
+		}
+	}
+	if strings.Contains(string(enc), "secret") || strings.Contains(headers, "multipart/mixed") {
+		t.Fatalf("message wasn't encrypted:\n%s", enc)
+	}
+
+	// The recipient can read it.
+	start := strings.Index(string(body), "-----BEGIN PGP MESSAGE-----")
+	if start < 0 {
+		t.Fatalf("no PGP message found:\n%s", body)
+	}
+	decrypt := exec.Command(gpg, "--homedir", dir, "--batch", "--quiet", "--decrypt")
+	decrypt.Stdin = bytes.NewReader(body[start:])
+	plain, err := decrypt.Output()
+	if err != nil {
+		t.Fatalf("failed to decrypt: %s", err)
+	}
+	if !strings.HasPrefix(string(plain), "Content-Type: multipart/mixed") || !strings.Contains(string(plain), "secret text") {
+		t.Fatalf("unexpected decrypted content:\n%s", plain)
+	}
+
+	// A blind-copy can read it too, but its key isn't revealed.
+	out, err = exec.Command(gpg, "--homedir", dir, "--batch", "--passphrase", "", "--quick-gen-key", "archive@example.com", "default", "default", "never").CombinedOutput()
+	if err != nil {
+		t.Fatalf("failed to generate a key: %s %s", err, out)
+	}
+	keyID := func(addr string) string {
+		out, err := exec.Command(gpg, "--homedir", dir, "--batch", "--with-colons", "--list-keys", addr).Output()
+		if err != nil {
+			t.Fatalf("failed to list keys: %s", err)
+		}
+		for _, line := range strings.Split(string(out), "\n") {
+			if fields := strings.Split(line, ":"); fields[0] == "sub" && len(fields) > 4 {
+				return fields[4]
+			}
+		}
+		t.Fatalf("no encryption key found for %s:\n%s", addr, out)
+		return ""
+	}
+	enc, err = e.encrypt(msg, []string{"steve@example.com"}, []string{"archive@example.com"})
+	if err != nil {
+		t.Fatalf("failed to encrypt: %s", err)
+	}
+	_, body = splitMessage(enc)
+	list := exec.Command(gpg, "--homedir", dir, "--batch", "--list-only", "--list-packets")
+	list.Stdin = bytes.NewReader(body[strings.Index(string(body), "-----BEGIN PGP MESSAGE-----"):])
+	packets, _ := list.CombinedOutput()
+	if !strings.Contains(string(packets), keyID("steve@example.com")) {
+		t.Errorf("the recipient's key wasn't found:\n%s", packets)
+	}
+	if strings.Contains(string(packets), keyID("archive@example.com")) {
+		t.Errorf("the blind-copy's key was revealed:\n%s", packets)
+	}
+
+	// There's no key for bob.
+	_, err = e.encrypt(msg, []string{"bob@example.com"}, nil)
+	if err == nil {
+		t.Fatalf("expected error encrypting without a key")
+	}
+
+	// Unless we use a key file.
+	key := filepath.Join(dir, "steve.asc")
+	out, err = exec.Command(gpg, "--homedir", dir, "--batch", "--armor", "--output", key, "--export", "steve@example.com").CombinedOutput()
+	if err != nil {
+		t.Fatalf("failed to export key: %s %s", err, out)
+	}
+	os.Setenv(config.GPGKeyFile, key)
+	_, err = e.encrypt(msg, []string{"bob@example.com"}, nil)
+	if err != nil {
+		t.Fatalf("failed to encrypt with a key file: %s", err)
+	}
+}
+
+// TestArchiveLinks ensures that we link to snapshots of items.
+func TestArchiveLinks(t *testing.T) {
+
+	saves := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/available":
+			if r.URL.Query().Get("url") != "https://example.com/item" {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprint(w, `{"archived_snapshots":{"closest":{"available":true,"status":"200","url":"http://archive.invalid/web/2020/https://example.com/item"}}}`)
+		case strings.HasPrefix(r.URL.Path, "/save/"):
+			saves++
+			w.Header().Set("Content-Location", "/web/2021/"+strings.TrimPrefix(r.URL.Path, "/save/"))
+			fmt.Fprint(w, "saved")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	curAvailable, curSave := waybackAvailable, waybackSave
+	defer func() { waybackAvailable, waybackSave = curAvailable, curSave }()
+	waybackAvailable = ts.URL + "/available"
+	waybackSave = ts.URL + "/save/"
+
+	cur := os.Getenv(config.ArchiveLinks)
+	defer os.Setenv(config.ArchiveLinks, cur)
+
+	render := func(setting string) string {
+		os.Setenv(config.ArchiveLinks, setting)
+
+		e := newTestEmailer(t)
+		e.item.Link = "https://example.com/item"
+
+		// Render twice, to ensure we only ask once.
+		e.Render("steve@example.com", "text", "html")
+		out, err := e.Render("steve@example.com", "text", "html")
+		if err != nil {
+			t.Fatalf("unexpected error rendering: %s", err)
+		}
+		return string(out)
+	}
+
+	out := render("")
+	if strings.Contains(out, "Archived:") {
+		t.Errorf("archive link present when disabled:\n%s", out)
+	}
+
+	out = render("lookup")
+	if !strings.Contains(out, "Archived: http://archive.invalid/web/2020/https://example.com/item") {
+		t.Errorf("archive link not found:\n%s", out)
+	}
+
+	out = render("save")
+	if !strings.Contains(out, "Archived: "+ts.URL+"/web/2021/https://example.com/item") {
+		t.Errorf("snapshot link not found:\n%s", out)
+	}
+	if saves != 1 {
+		t.Errorf("expected one snapshot, made %d", saves)
+	}
+}
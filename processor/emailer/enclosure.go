@@ -0,0 +1,174 @@
+package emailer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/network"
+)
+
+// Enclosure holds the details of a single feed-item enclosure, and is
+// exported to our template.
+type Enclosure struct {
+
+	// URL is the location of the enclosure.
+	URL string
+
+	// Type is the MIME type of the enclosure.
+	Type string
+
+	// Filename is the name we give to the attachment.
+	Filename string
+
+	// Content is the base64-encoded body of the enclosure, split into
+	// lines.  It is empty if the enclosure was not attached, for
+	// example because it was too large.
+	Content string
+}
+
+// Attached returns true if the enclosure content was downloaded, and
+// will be attached to the message.
+func (e Enclosure) Attached() bool {
+	return e.Content != ""
+}
+
+// enclosures returns the enclosures associated with our item.
+//
+// If attachments are enabled each enclosure is downloaded, providing
+// it is not larger than our size cap, otherwise only the link is
+// returned.  The results are cached, as we render the same message
+// once for each recipient, unless we're running in low-memory mode.
+func (e *Emailer) enclosures() []Enclosure {
+
+	if e.enclosureCache != nil {
+		return e.enclosureCache
+	}
+
+	attach := config.Get(config.AttachEnclosures) == "true" && !e.lowMemory
+	max, err := strconv.ParseInt(config.Get(config.EnclosureMaxSize), 10, 64)
+	if err != nil {
+		max = 0
+	}
+
+	out := []Enclosure{}
+	for _, enc := range e.item.Enclosures {
+		if enc == nil || enc.URL == "" {
+			continue
+		}
+
+		x := Enclosure{
+			URL:      enc.URL,
+			Type:     enclosureType(enc.Type),
+			Filename: enclosureFilename(enc.URL),
+		}
+
+		// If the feed tells us the size, and it is too large, then
+		// we can avoid the download entirely - unless we're going
+		// to shrink it.
+		size, err := strconv.ParseInt(enc.Length, 10, 64)
+		if attach && (err != nil || size <= max || e.transcode != "") {
+			data, err := e.fetchAttachment(&x, max)
+			if err == nil {
+				x.Content = encodeBase64(data)
+			}
+		}
+
+		out = append(out, x)
+	}
+
+	if !e.lowMemory {
+		e.enclosureCache = out
+	}
+	return out
+}
+
+// enclosureType returns the MIME type of the attachment, falling back to
+// "application/octet-stream" if the feed gave us nothing sensible.  The
+// type goes into our MIME headers, so anything else would let a feed add
+// headers of its own.
+func enclosureType(t string) string {
+	mediaType, _, err := mime.ParseMediaType(t)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return mediaType
+}
+
+// enclosureFilename returns a sensible filename for the attachment.
+func enclosureFilename(link string) string {
+	name := "attachment"
+
+	u, err := url.Parse(link)
+	if err == nil {
+		base := path.Base(u.Path)
+		if base != "" && base != "." && base != "/" {
+			name = base
+		}
+	}
+
+	// Avoid breaking our MIME headers.
+	return strings.NewReplacer("\"", "", "\r", "", "\n", "").Replace(name)
+}
+
+// fetchEnclosure downloads the given URL, returning an error if the
+// content is larger than max bytes.
+func fetchEnclosure(link string, max int64) ([]byte, error) {
+
+	client, err := network.HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", link, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", config.Get(config.UserAgent))
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: %s", link, resp.Status)
+	}
+	if resp.ContentLength > max {
+		return nil, fmt.Errorf("enclosure %s is too large", link)
+	}
+
+	// Read one byte more than we permit, so we can spot oversized
+	// responses which didn't declare their length.
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, fmt.Errorf("enclosure %s is too large", link)
+	}
+	return data, nil
+}
+
+// encodeBase64 encodes the data as base64, wrapped at 76 characters
+// as required by RFC 2045.
+func encodeBase64(data []byte) string {
+	enc := base64.StdEncoding.EncodeToString(data)
+
+	var sb strings.Builder
+	for len(enc) > 76 {
+		sb.WriteString(enc[:76])
+		sb.WriteString("\r\n")
+		enc = enc[76:]
+	}
+	sb.WriteString(enc)
+	return sb.String()
+}
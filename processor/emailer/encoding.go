@@ -0,0 +1,91 @@
+package emailer
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/skx/rss2email/config"
+)
+
+// The transfer encodings we support for the bodies of our messages.
+const (
+	quotedPrintable = "quoted-printable"
+	base64Encoding  = "base64"
+)
+
+// bodyEncoding returns the transfer encoding to use for the given body,
+// which is that set via BODY_ENCODING, or the more compact of
+// quoted-printable and base64 if that is "auto".
+func bodyEncoding(body string) (string, error) {
+
+	switch enc := strings.ToLower(config.Get(config.BodyEncoding)); enc {
+	case quotedPrintable, base64Encoding:
+		return enc, nil
+	case "auto":
+	default:
+		return "", fmt.Errorf("invalid %s %q, expected \"auto\", \"%s\", or \"%s\"", config.BodyEncoding, enc, quotedPrintable, base64Encoding)
+	}
+
+	// Quoted-printable turns each byte which isn't printable ASCII
+	// into three, whereas base64 turns every three bytes into four.
+	// So base64 wins once more than a sixth of the bytes need to be
+	// escaped, as is the case for most non-Latin scripts.
+	escaped := 0
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c >= 0x80 || (c < 0x20 && c != '\t' && c != '\r' && c != '\n') {
+			escaped++
+		}
+	}
+
+	if escaped*6 > len(body) || !utf8.ValidString(body) {
+		return base64Encoding, nil
+	}
+	return quotedPrintable, nil
+}
+
+// encodeBody encodes the given body with the given transfer encoding.
+//
+// NOTE: We use this function both directly, and from within our
+// template.
+func (e *Emailer) encodeBody(encoding string, body string) (string, error) {
+
+	switch strings.ToLower(encoding) {
+	case quotedPrintable:
+		return e.toQuotedPrintable(body)
+	case base64Encoding:
+		return encodeBase64([]byte(body)), nil
+	}
+	return "", fmt.Errorf("unknown transfer encoding %q", encoding)
+}
+
+// renderPart renders the named template, which produces one part of
+// our message, and encodes it appropriately.
+//
+// It returns the encoded body, and the encoding used, which are empty
+// if there is no such template.
+func (e *Emailer) renderPart(t *template.Template, name string, data interface{}) (string, string, error) {
+
+	part := t.Lookup(name)
+	if part == nil {
+		return "", "", nil
+	}
+
+	body, err := execute(part, data)
+	if err != nil {
+		return "", "", err
+	}
+
+	encoding, err := bodyEncoding(string(body))
+	if err != nil {
+		return "", "", err
+	}
+
+	out, err := e.encodeBody(encoding, string(body))
+	if err != nil {
+		return "", "", err
+	}
+	return out, encoding, nil
+}
@@ -0,0 +1,103 @@
+package emailer
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/slug"
+)
+
+// FolderHeader is the header which names the folder an item should be
+// filed in, so that filters such as Sieve scripts may use it.
+const FolderHeader = "X-RSS-Folder"
+
+// SetFolder sets the template which names the folder the item should be
+// filed in, overriding the FOLDER setting.
+func (e *Emailer) SetFolder(tmpl string) {
+	e.folderTemplate = tmpl
+}
+
+// SetTags records the tags of the feed, which may be used to name the
+// folder the item is filed in.
+func (e *Emailer) SetTags(tags []string) {
+	e.tags = tags
+}
+
+// folder returns the name of the folder the item should be filed in, or
+// "" if it shouldn't be filed anywhere in particular.
+//
+// The name comes from a template, which may use the title of the feed
+// (Title), a version of that which is safe to use in folder names (Slug),
+// the host the feed lives upon (Host), and its first tag (Tag).
+func (e *Emailer) folder() (string, error) {
+
+	src := e.folderTemplate
+	if src == "" {
+		src = config.Get(config.Folder)
+	}
+	if src == "" {
+		return "", nil
+	}
+
+	type FolderParams struct {
+		Title string
+		Slug  string
+		Host  string
+		Tag   string
+	}
+
+	var x FolderParams
+	x.Title = e.feed.Title
+	if u, err := url.Parse(e.feed.Link); err == nil {
+		x.Host = u.Host
+	}
+	if len(e.tags) > 0 {
+		x.Tag = e.tags[0]
+	}
+	x.Slug = slug.Make(x.Title, "-", config.Get(config.SlugStyle))
+	if x.Slug == "" {
+		x.Slug = slug.Make(x.Host, "-", slug.ASCII)
+	}
+	if x.Slug == "" {
+		x.Slug = "misc"
+	}
+
+	tmpl, err := template.New("folder").Parse(src)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse folder template %q: %s", src, err.Error())
+	}
+	out, err := execute(tmpl, x)
+	if err != nil {
+		return "", fmt.Errorf("folder template %q: %s", src, err.Error())
+	}
+
+	// Names must be a single line.
+	return strings.Join(strings.Fields(string(out)), " "), nil
+}
+
+// detailAddress returns the given address with the folder added as the
+// detail of its local-part, "steve+Feeds.News@example.com", which servers
+// such as Dovecot use to deliver into that folder.
+//
+// The local-part is quoted if the folder contains characters which are
+// not permitted in it otherwise.
+func detailAddress(addr string, folder string) string {
+
+	at := strings.LastIndex(addr, "@")
+	if at < 0 || folder == "" {
+		return addr
+	}
+
+	local := addr[:at] + "+" + folder
+	for _, r := range local {
+		if r > ' ' && r < 0x7f && !strings.ContainsRune(`"(),:;<>@[\]`, r) {
+			continue
+		}
+		local = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(local) + `"`
+		break
+	}
+	return local + addr[at:]
+}
@@ -0,0 +1,97 @@
+package emailer
+
+import (
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/skx/rss2email/processor/plaintext"
+)
+
+// templateFuncs returns the helper functions which are available to
+// our templates, in addition to quoteprintable and encodeheader.
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+
+		// Dates
+		"date": formatDate,
+		"now":  time.Now,
+
+		// Strings
+		"contains":  func(substr, s string) bool { return strings.Contains(s, substr) },
+		"default":   defaultValue,
+		"hasPrefix": func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix": func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"join":      func(sep string, s []string) string { return strings.Join(s, sep) },
+		"lower":     strings.ToLower,
+		"replace":   func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"split":     func(sep, s string) []string { return strings.Split(s, sep) },
+		"trim":      strings.TrimSpace,
+		"truncate":  truncate,
+		"upper":     strings.ToUpper,
+
+		// HTML & URLs
+		"striphtml":  plaintext.Strip,
+		"urlquery":   url.QueryEscape,
+		"pathescape": url.PathEscape,
+
+		// Environment
+		"env": templateEnv,
+	}
+}
+
+// envPrefix is the prefix of the environmental variables which templates
+// may read, so that they can't read our secrets, such as SMTP_PASSWORD,
+// and mail them out.
+const envPrefix = "R2E_"
+
+// templateEnv returns the value of the named environmental variable, if
+// it is one which templates may read, otherwise the empty string.
+func templateEnv(name string) string {
+	if !strings.HasPrefix(name, envPrefix) {
+		return ""
+	}
+	return os.Getenv(name)
+}
+
+// formatDate formats the given time with the given layout, using the
+// Go reference-time ("2006-01-02 15:04:05").
+//
+// The time may be a time.Time, a *time.Time (such as the PublishedParsed
+// field of a feed item), or nil in which case the empty string is
+// returned.
+func formatDate(layout string, t interface{}) string {
+	switch v := t.(type) {
+	case time.Time:
+		return v.Format(layout)
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		return v.Format(layout)
+	}
+	return ""
+}
+
+// defaultValue returns the given value, unless it is empty in which
+// case the default is returned.
+func defaultValue(def string, value string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// truncate limits the given string to n characters, adding an ellipsis
+// if it was shortened.
+func truncate(n int, s string) string {
+	if n < 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	runes := []rune(s)
+	return string(runes[:n]) + "…"
+}
@@ -0,0 +1,197 @@
+package emailer
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/mailbox"
+)
+
+// The headers which identify the instance of rss2email which sent a
+// message, when INSTANCE_HEADERS is set.
+const (
+	HostHeader    = "X-RSS2Email-Host"
+	VersionHeader = "X-RSS2Email-Version"
+)
+
+// headerName matches the characters permitted in the name of a header.
+var headerName = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+
+// splitHeaders splits a list of headers, "Name: value" separated by
+// commas, into its elements.  A comma only separates two headers if it
+// is followed by the name of the next, so values may contain commas.
+func splitHeaders(s string) []string {
+	var out []string
+
+	parts := strings.Split(s, ",")
+	for i, part := range parts {
+		name := strings.TrimSpace(strings.SplitN(part, ":", 2)[0])
+		startsHeader := strings.Contains(part, ":") && headerName.MatchString(name)
+
+		if i > 0 && !startsHeader && len(out) > 0 {
+			out[len(out)-1] += "," + part
+			continue
+		}
+		out = append(out, part)
+	}
+
+	var headers []string
+	for _, h := range out {
+		h = strings.TrimSpace(h)
+		if h != "" {
+			headers = append(headers, h)
+		}
+	}
+	return headers
+}
+
+// parseHeader validates a header, "Name: value", returning the name and
+// the value encoded for use in a message.
+func parseHeader(h string) (string, string, error) {
+
+	parts := strings.SplitN(h, ":", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("malformed header %q, expected \"Name: value\"", h)
+	}
+
+	name := strings.TrimSpace(parts[0])
+	value := strings.TrimSpace(parts[1])
+
+	if !headerName.MatchString(name) {
+		return "", "", fmt.Errorf("invalid header name %q", name)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return "", "", fmt.Errorf("header %s contains a newline", name)
+	}
+
+	return name, encodeHeader(value), nil
+}
+
+// extraHeaders returns the additional headers which should be added to
+// the message, those configured globally followed by those set for this
+// feed.  A header set for the feed replaces a global one of the same name.
+//
+// If we know the URL of the feed it is recorded first of all.
+func (e *Emailer) extraHeaders() (string, error) {
+
+	var all []string
+	if e.source != "" {
+		all = append(all, mailbox.SourceHeader+": "+e.source)
+	}
+	if addr := e.replyAddress(); addr != "" {
+		all = append(all, "Reply-To: "+headerAddress(addr))
+	}
+	folder, err := e.folder()
+	if err != nil {
+		return "", err
+	}
+	if folder != "" {
+		all = append(all, FolderHeader+": "+folder)
+	}
+	if config.Get(config.Threading) == "true" {
+		all = append(all, e.threadHeaders()...)
+	}
+	if config.Get(config.InstanceHeaders) == "true" {
+		all = append(all, e.instanceHeaders()...)
+	}
+
+	// Ask vacation responders, and the like, not to reply.
+	if value := config.Get(config.AutoSubmitted); value != "no" {
+		all = append(all, "Auto-Submitted: "+value)
+	}
+	if value := config.Get(config.Precedence); value != "" {
+		all = append(all, "Precedence: "+value)
+	}
+	all = append(all, splitHeaders(config.Get(config.Headers))...)
+	all = append(all, e.headers...)
+
+	var names []string
+	values := make(map[string]string)
+
+	for _, h := range all {
+		name, value, err := parseHeader(h)
+		if err != nil {
+			return "", err
+		}
+
+		key := strings.ToLower(name)
+		if _, ok := values[key]; !ok {
+			names = append(names, name)
+		}
+		values[key] = value
+	}
+
+	var out strings.Builder
+	for _, name := range names {
+		out.WriteString(name + ": " + values[strings.ToLower(name)] + "\n")
+	}
+	return out.String(), nil
+}
+
+// instanceHeaders returns the headers which name the host, and version
+// of rss2email, which sent the message, so that the sender of duplicates
+// may be found when several hosts share feeds.
+func (e *Emailer) instanceHeaders() []string {
+
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+	version := e.version
+	if version == "" {
+		version = "unknown"
+	}
+
+	return []string{
+		HostHeader + ": " + host,
+		VersionHeader + ": " + version,
+	}
+}
+
+// messageID returns a message-ID which is derived from the given values,
+// so that it is stable across runs.
+func (e *Emailer) messageID(parts ...string) string {
+
+	host := "rss2email.invalid"
+	u, err := url.Parse(e.feed.Link)
+	if err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+
+	return fmt.Sprintf("<%x@%s>", sha1.Sum([]byte(strings.Join(parts, "\n"))), host)
+}
+
+// threadHeaders returns the headers which place the message in a thread
+// with the other items from the same feed.
+//
+// Each item has a Message-ID derived from the feed and its GUID, and
+// refers to a pseudo-message, derived from the feed alone, which is the
+// root of the thread.  The root is never sent.
+func (e *Emailer) threadHeaders() []string {
+
+	feed := e.source
+	if feed == "" {
+		feed = e.feed.FeedLink
+	}
+	if feed == "" {
+		feed = e.feed.Link
+	}
+
+	guid := e.item.GUID
+	if guid == "" {
+		guid = e.item.Link
+	}
+
+	root := e.messageID(feed)
+
+	return []string{
+		"Message-ID: " + e.messageID(feed, guid),
+		"In-Reply-To: " + root,
+		"References: " + root,
+	}
+}
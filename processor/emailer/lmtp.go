@@ -0,0 +1,165 @@
+//go:build !nolmtp
+// +build !nolmtp
+
+package emailer
+
+import (
+	"fmt"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/network"
+)
+
+func init() {
+	registerBackend(backend{
+		name:     "lmtp",
+		priority: 30,
+		enabled:  isLMTP,
+		send:     (*Emailer).sendLMTP,
+	})
+}
+
+// isLMTP determines whether we should deliver via LMTP.
+func isLMTP() bool {
+	return config.IsSet(config.LMTPAddress)
+}
+
+// lmtpConn connects to the configured LMTP server.
+//
+// The address may be the path to a Unix socket, optionally prefixed
+// with "unix:", or a "host:port" pair optionally prefixed with "tcp:".
+func lmtpConn() (net.Conn, error) {
+
+	addr := config.Get(config.LMTPAddress)
+
+	switch {
+	case strings.HasPrefix(addr, "unix:"):
+		return net.Dial("unix", strings.TrimPrefix(addr, "unix:"))
+	case strings.HasPrefix(addr, "/"):
+		return net.Dial("unix", addr)
+	}
+
+	dialer, err := network.Dialer()
+	if err != nil {
+		return nil, err
+	}
+	return dialer.Dial("tcp", strings.TrimPrefix(addr, "tcp:"))
+}
+
+// sendLMTP delivers the message via LMTP, as described in RFC 2033.
+//
+// LMTP delivers directly to the recipient's mailbox, and reports the
+// status of each recipient individually once the message has been sent.
+//
+// If the item should be filed in a folder that is added to the address
+// of each recipient, as its detail.
+func (e *Emailer) sendLMTP(to []string, content []byte) error {
+
+	folder, err := e.folder()
+	if err != nil {
+		return err
+	}
+
+	conn, err := lmtpConn()
+	if err != nil {
+		return err
+	}
+
+	to = envelopeAddresses(to)
+	from := to[0]
+	if folder != "" {
+		var rcpts []string
+		for _, addr := range to {
+			rcpts = append(rcpts, detailAddress(addr, folder))
+		}
+		to = rcpts
+	}
+	return lmtpConversation(conn, from, to, content)
+}
+
+// lmtpConversation sends a message over the given connection, which must
+// be to a server speaking LMTP.  The connection is closed when we return.
+func lmtpConversation(conn net.Conn, from string, to []string, msg []byte) error {
+
+	c := textproto.NewConn(conn)
+	defer c.Close()
+
+	cmd := func(expect int, format string, args ...interface{}) error {
+		id, err := c.Cmd(format, args...)
+		if err != nil {
+			return err
+		}
+		c.StartResponse(id)
+		defer c.EndResponse(id)
+		_, _, err = c.ReadResponse(expect)
+		return err
+	}
+
+	// Greeting
+	_, _, err := c.ReadResponse(220)
+	if err != nil {
+		return err
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	err = cmd(250, "LHLO %s", host)
+	if err != nil {
+		return err
+	}
+
+	err = cmd(250, "MAIL FROM:<%s>", from)
+	if err != nil {
+		return err
+	}
+
+	// We only expect a reply after DATA for accepted recipients.
+	var accepted []string
+	var failed []string
+	for _, rcpt := range to {
+		err = cmd(25, "RCPT TO:<%s>", rcpt)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", rcpt, err.Error()))
+			continue
+		}
+		accepted = append(accepted, rcpt)
+	}
+
+	if len(accepted) > 0 {
+		err = cmd(354, "DATA")
+		if err != nil {
+			return err
+		}
+
+		w := c.DotWriter()
+		_, err = w.Write(msg)
+		if err != nil {
+			return err
+		}
+		err = w.Close()
+		if err != nil {
+			return err
+		}
+
+		// One response per accepted recipient.
+		for _, rcpt := range accepted {
+			_, _, err = c.ReadResponse(250)
+			if err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %s", rcpt, err.Error()))
+			}
+		}
+	}
+
+	cmd(221, "QUIT")
+
+	if len(failed) > 0 {
+		return fmt.Errorf("LMTP delivery failed for %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+//go:build !nolmtp
+// +build !nolmtp
+
+package emailer
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/skx/rss2email/config"
+)
+
+// TestLMTP ensures we can deliver via LMTP.
+func TestLMTP(t *testing.T) {
+
+	s, err := newFakeServer("tcp", "127.0.0.1:0", true)
+	if err != nil {
+		t.Fatalf("failed to start server: %s", err)
+	}
+	defer s.Close()
+
+	cur := os.Getenv(config.LMTPAddress)
+	defer os.Setenv(config.LMTPAddress, cur)
+	os.Setenv(config.LMTPAddress, "tcp:"+s.listener.Addr().String())
+
+	b := selectBackend()
+	if b == nil || b.name != "lmtp" {
+		t.Fatalf("lmtp backend not selected")
+	}
+
+	e := newTestEmailer(t)
+	err = e.Sendmail([]string{"steve@example.com"}, "text", "html")
+	if err != nil {
+		t.Fatalf("failed to send: %s", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.messages) != 1 || len(s.to) != 1 || s.to[0] != "steve@example.com" {
+		t.Fatalf("unexpected delivery: %v %v", s.to, len(s.messages))
+	}
+}
+
+// TestFolder tests filing items in folders, via LMTP.
+func TestFolder(t *testing.T) {
+
+	s, err := newFakeServer("tcp", "127.0.0.1:0", true)
+	if err != nil {
+		t.Fatalf("failed to start server: %s", err)
+	}
+	defer s.Close()
+
+	for _, name := range []string{config.LMTPAddress, config.Folder} {
+		cur := os.Getenv(name)
+		defer os.Setenv(name, cur)
+	}
+	os.Setenv(config.LMTPAddress, "tcp:"+s.listener.Addr().String())
+	os.Setenv(config.Folder, "Feeds.{{.Slug}}")
+
+	e := newTestEmailer(t)
+	err = e.Sendmail([]string{"steve@example.com"}, "text", "html")
+	if err != nil {
+		t.Fatalf("failed to send: %s", err)
+	}
+
+	s.mu.Lock()
+	if len(s.to) != 1 || s.to[0] != "steve+Feeds.steve-s-blog@example.com" {
+		t.Errorf("unexpected recipients: %v", s.to)
+	}
+	if len(s.messages) != 1 || !strings.Contains(s.messages[0], "X-RSS-Folder: Feeds.steve-s-blog\r\n") {
+		t.Errorf("folder header missing: %v", s.messages)
+	}
+	s.mu.Unlock()
+
+	// The feed may choose its own folder.
+	e.SetFolder("{{.Tag}}/{{.Title}}")
+	e.SetTags([]string{"work"})
+	folder, err := e.folder()
+	if err != nil || folder != "work/Steve's Blog" {
+		t.Errorf("unexpected folder: %s %v", folder, err)
+	}
+	if detailAddress("steve@example.com", folder) != `"steve+work/Steve's Blog"@example.com` {
+		t.Errorf("unexpected address: %s", detailAddress("steve@example.com", folder))
+	}
+
+	e.SetFolder("{{.Bogus}}")
+	if _, err = e.folder(); err == nil {
+		t.Errorf("expected an error with a bogus template")
+	}
+}
@@ -0,0 +1,139 @@
+//go:build !nonntp
+// +build !nonntp
+
+package emailer
+
+import (
+	"bytes"
+	"fmt"
+	"net/textproto"
+	"net/url"
+	"strings"
+
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/network"
+	"github.com/skx/rss2email/slug"
+)
+
+func init() {
+	registerBackend(backend{
+		name:     "nntp",
+		priority: 40,
+		enabled:  isNNTP,
+		send:     (*Emailer).sendNNTP,
+		once:     true,
+	})
+}
+
+// isNNTP determines whether we should post to a news server.
+func isNNTP() bool {
+	return config.IsSet(config.NNTPServer)
+}
+
+// newsgroup returns the name of the group to which items from our feed
+// should be posted, which is based upon the title of the feed.
+//
+// Titles in other scripts are handled according to SLUG_STYLE, news
+// servers accept UTF-8 group names so "unicode" is usable here too.
+func (e *Emailer) newsgroup() string {
+
+	name := slug.Make(e.feed.Title, ".", config.Get(config.SlugStyle))
+
+	// No title?  Use the host the feed lives upon.
+	if name == "" {
+		u, err := url.Parse(e.feed.Link)
+		if err == nil {
+			name = slug.Make(u.Host, ".", slug.ASCII)
+		}
+	}
+	if name == "" {
+		name = "misc"
+	}
+
+	return config.Get(config.NNTPGroupPrefix) + name
+}
+
+// sendNNTP posts the message to a news server, in a group named after the
+// feed.  The group must already exist upon the server.
+//
+// The message is posted once, regardless of the number of recipients.
+func (e *Emailer) sendNNTP(to []string, content []byte) error {
+
+	addr := config.Get(config.NNTPServer)
+	if !strings.Contains(addr, ":") {
+		addr += ":119"
+	}
+
+	dialer, err := network.Dialer()
+	if err != nil {
+		return err
+	}
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	c := textproto.NewConn(conn)
+	defer c.Close()
+
+	cmd := func(expect int, format string, args ...interface{}) (int, error) {
+		id, err := c.Cmd(format, args...)
+		if err != nil {
+			return 0, err
+		}
+		c.StartResponse(id)
+		defer c.EndResponse(id)
+		code, _, err := c.ReadResponse(expect)
+		return code, err
+	}
+
+	// Greeting, 200 if posting is allowed.
+	_, _, err = c.ReadResponse(200)
+	if err != nil {
+		return fmt.Errorf("news server %s doesn't permit posting: %s", addr, err.Error())
+	}
+
+	// Authenticate, if we should.  The server may accept the username
+	// alone, with 281, rather than asking for the password with 381.
+	user := config.Get(config.NNTPUsername)
+	if user != "" {
+		code, err := cmd(3, "AUTHINFO USER %s", user)
+		if err != nil && code != 281 {
+			return err
+		}
+		if code == 381 {
+			_, err = cmd(281, "AUTHINFO PASS %s", config.Get(config.NNTPPassword))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = cmd(340, "POST")
+	if err != nil {
+		return err
+	}
+
+	// Add the Newsgroups header, which is required.
+	var article bytes.Buffer
+	fmt.Fprintf(&article, "Newsgroups: %s\r\n", e.newsgroup())
+	article.Write(content)
+
+	w := c.DotWriter()
+	_, err = w.Write(article.Bytes())
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	_, _, err = c.ReadResponse(240)
+	if err != nil {
+		return fmt.Errorf("failed to post to %s: %s", e.newsgroup(), err.Error())
+	}
+
+	cmd(205, "QUIT")
+	return nil
+}
@@ -0,0 +1,124 @@
+//go:build !nonntp
+// +build !nonntp
+
+package emailer
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/skx/rss2email/config"
+)
+
+// TestNewsgroup tests the naming of newsgroups.
+func TestNewsgroup(t *testing.T) {
+
+	e := newTestEmailer(t)
+
+	if e.newsgroup() != "rss2email.steve.s.blog" {
+		t.Errorf("unexpected group: %s", e.newsgroup())
+	}
+
+	e.feed.Title = ""
+	if e.newsgroup() != "rss2email.blog.steve.fi" {
+		t.Errorf("unexpected group: %s", e.newsgroup())
+	}
+
+	cur := os.Getenv(config.SlugStyle)
+	defer os.Setenv(config.SlugStyle, cur)
+
+	tests := map[string]string{
+		"ascii":         "rss2email.blog.steve.fi",
+		"transliterate": "rss2email.novosti.dnya",
+		"unicode":       "rss2email.новости.дня",
+	}
+	e.feed.Title = "Новости дня"
+	for style, expected := range tests {
+		os.Setenv(config.SlugStyle, style)
+		if e.newsgroup() != expected {
+			t.Errorf("unexpected group for %s: %s", style, e.newsgroup())
+		}
+	}
+}
+
+// TestNNTPAuth tests authenticating to a news server, which may or may
+// not want a password.
+func TestNNTPAuth(t *testing.T) {
+
+	for _, name := range []string{config.NNTPServer, config.NNTPUsername, config.NNTPPassword} {
+		cur := os.Getenv(name)
+		defer os.Setenv(name, cur)
+	}
+	os.Setenv(config.NNTPUsername, "steve")
+	os.Setenv(config.NNTPPassword, "secret")
+
+	for reply, expected := range map[string]string{
+		"281 Authentication accepted": "AUTHINFO USER steve,POST,QUIT",
+		"381 Password required":       "AUTHINFO USER steve,AUTHINFO PASS secret,POST,QUIT",
+	} {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %s", err)
+		}
+		os.Setenv(config.NNTPServer, l.Addr().String())
+
+		commands := make(chan []string)
+		go func() {
+			var seen []string
+			defer func() { commands <- seen }()
+
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			r := bufio.NewReader(conn)
+			conn.Write([]byte("200 Posting allowed\r\n"))
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				line = strings.TrimRight(line, "\r\n")
+				seen = append(seen, line)
+
+				switch {
+				case strings.HasPrefix(line, "AUTHINFO USER"):
+					conn.Write([]byte(reply + "\r\n"))
+				case strings.HasPrefix(line, "AUTHINFO PASS"):
+					conn.Write([]byte("281 Authentication accepted\r\n"))
+				case line == "POST":
+					conn.Write([]byte("340 Send article\r\n"))
+					for {
+						body, err := r.ReadString('\n')
+						if err != nil || body == ".\r\n" {
+							break
+						}
+					}
+					conn.Write([]byte("240 Article received\r\n"))
+				case line == "QUIT":
+					conn.Write([]byte("205 Bye\r\n"))
+					return
+				default:
+					conn.Write([]byte("500 Unknown command\r\n"))
+				}
+			}
+		}()
+
+		e := newTestEmailer(t)
+		err = e.sendNNTP(nil, []byte("Subject: Test\r\n\r\nHello\r\n"))
+		seen := <-commands
+		l.Close()
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", reply, err)
+		}
+		if strings.Join(seen, ",") != expected {
+			t.Errorf("%s: unexpected commands %v", reply, seen)
+		}
+	}
+}
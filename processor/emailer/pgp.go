@@ -0,0 +1,139 @@
+package emailer
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/skx/rss2email/config"
+)
+
+// encrypting returns true if we should encrypt the messages we send.
+func encrypting() bool {
+	return config.Get(config.Encrypt) == "true"
+}
+
+// splitMessage splits the given message into its header fields, including
+// any continuation lines, and its body.
+func splitMessage(content []byte) ([]string, []byte) {
+
+	sep := []byte("\n\n")
+	end := bytes.Index(content, sep)
+	if crlf := bytes.Index(content, []byte("\r\n\r\n")); crlf >= 0 && (end < 0 || crlf < end) {
+		sep = []byte("\r\n\r\n")
+		end = crlf
+	}
+	if end < 0 {
+		return nil, content
+	}
+
+	var fields []string
+	for _, line := range strings.Split(string(content[:end]), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if len(fields) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			fields[len(fields)-1] += "\n" + line
+			continue
+		}
+		fields = append(fields, line)
+	}
+
+	return fields, content[end+len(sep):]
+}
+
+// gpgArgs returns the arguments to pass to gpg, to encrypt a message to
+// the given recipients, and blind-copies.
+//
+// If GPG_KEY_FILE is set the message is encrypted to the keys in those
+// files, otherwise the key of each recipient is found in the keyring.
+// The keys of blind-copies are hidden, so that the other recipients can't
+// tell who they are from the encrypted message.
+func gpgArgs(to []string, bcc []string) []string {
+
+	args := []string{"--batch", "--no-tty", "--quiet", "--armor", "--trust-model", "always"}
+
+	if home := config.Get(config.GPGHome); home != "" {
+		args = append(args, "--homedir", home)
+	}
+
+	files := config.List(config.GPGKeyFile)
+	for _, file := range files {
+		args = append(args, "--recipient-file", file)
+	}
+	if len(files) == 0 {
+		for _, addr := range to {
+			args = append(args, "--recipient", addr)
+		}
+		for _, addr := range bcc {
+			args = append(args, "--hidden-recipient", addr)
+		}
+	}
+
+	return append(args, "--encrypt")
+}
+
+// encrypt returns the given message encrypted to the given recipients, and
+// blind-copies, as a PGP/MIME message described by RFC 3156.
+//
+// The headers of the message remain visible, as they're needed to deliver
+// it, but the content - including the headers which describe it - is
+// encrypted.
+func (e *Emailer) encrypt(content []byte, to []string, bcc []string) ([]byte, error) {
+
+	fields, body := splitMessage(content)
+
+	// The content headers move inside the encrypted part, along with
+	// the body they describe.
+	var outer []string
+	var inner bytes.Buffer
+	for _, f := range fields {
+		name := strings.ToLower(strings.TrimSpace(strings.SplitN(f, ":", 2)[0]))
+		switch {
+		case name == "mime-version":
+		case strings.HasPrefix(name, "content-"):
+			inner.WriteString(f + "\n")
+		default:
+			outer = append(outer, f)
+		}
+	}
+	inner.WriteString("\n")
+	inner.Write(body)
+
+	var stdout, stderr bytes.Buffer
+
+	path := config.Get(config.GPGPath)
+	gpg := exec.Command(path, gpgArgs(envelopeAddresses(to), envelopeAddresses(bcc))...)
+	gpg.Stdin = &inner
+	gpg.Stdout = &stdout
+	gpg.Stderr = &stderr
+
+	err := gpg.Run()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt message with %s: %s %s", path, err.Error(), strings.TrimSpace(stderr.String()))
+	}
+
+	boundary := fmt.Sprintf("%x", sha1.Sum(stdout.Bytes()))
+
+	var out bytes.Buffer
+	for _, f := range outer {
+		out.WriteString(f + "\n")
+	}
+	fmt.Fprintf(&out, "Content-Type: multipart/encrypted; protocol=\"application/pgp-encrypted\"; boundary=\"%s\"\n", boundary)
+	out.WriteString("Mime-Version: 1.0\n\n")
+
+	fmt.Fprintf(&out, "--%s\n", boundary)
+	out.WriteString("Content-Type: application/pgp-encrypted\n")
+	out.WriteString("Content-Description: PGP/MIME version identification\n\n")
+	out.WriteString("Version: 1\n\n")
+
+	fmt.Fprintf(&out, "--%s\n", boundary)
+	out.WriteString("Content-Type: application/octet-stream; name=\"encrypted.asc\"\n")
+	out.WriteString("Content-Description: OpenPGP encrypted message\n")
+	out.WriteString("Content-Disposition: inline; filename=\"encrypted.asc\"\n\n")
+	out.Write(stdout.Bytes())
+
+	fmt.Fprintf(&out, "\n--%s--\n", boundary)
+
+	return out.Bytes(), nil
+}
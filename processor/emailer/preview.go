@@ -0,0 +1,132 @@
+package emailer
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/processor/plaintext"
+)
+
+// previewLimit describes how much of an item to show in a preview.
+type previewLimit struct {
+
+	// words is the maximum number of words, if non-zero.
+	words int
+
+	// paragraphs is the maximum number of paragraphs, if non-zero.
+	paragraphs int
+}
+
+// parsePreview parses the size of a preview, which is a number of words
+// such as "100" or "100w", or a number of paragraphs such as "2p".  An
+// empty value means there is no limit.
+func parsePreview(s string) (previewLimit, error) {
+
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return previewLimit{}, nil
+	}
+
+	unit := "w"
+	if strings.HasSuffix(s, "w") || strings.HasSuffix(s, "p") {
+		unit = s[len(s)-1:]
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return previewLimit{}, fmt.Errorf("invalid preview size %q, expected a number of words (\"100w\") or paragraphs (\"2p\")", s+unit)
+	}
+
+	if unit == "p" {
+		return previewLimit{paragraphs: n}, nil
+	}
+	return previewLimit{words: n}, nil
+}
+
+// preview returns the leading paragraphs of the given text, within the
+// limit, and whether anything was removed.
+func (l previewLimit) preview(text string) ([]string, bool) {
+
+	var out []string
+	words := 0
+
+	for _, p := range strings.Split(text, "\n\n") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		if l.paragraphs > 0 && len(out) == l.paragraphs {
+			return out, true
+		}
+
+		if l.words > 0 {
+			fields := strings.Fields(p)
+			if words+len(fields) > l.words {
+				out = append(out, strings.Join(fields[:l.words-words], " ")+" …")
+				return out, true
+			}
+			words += len(fields)
+		}
+
+		out = append(out, p)
+	}
+	return out, false
+}
+
+// SetPreview sets the size of the preview of the item to send, overriding
+// the PREVIEW setting.  See parsePreview for the format.
+func (e *Emailer) SetPreview(size string) {
+	e.preview = size
+}
+
+// previewContent returns the text and HTML we should send, which will be
+// a preview of the item if a limit has been configured and the item
+// exceeds it.  The bool returned is true if the content was truncated.
+func (e *Emailer) previewContent(textstr string, htmlstr string) (string, string, bool, error) {
+
+	size := e.preview
+	if size == "" {
+		size = config.Get(config.Preview)
+	}
+
+	limit, err := parsePreview(size)
+	if err != nil {
+		return "", "", false, err
+	}
+	if limit.words == 0 && limit.paragraphs == 0 {
+		return textstr, htmlstr, false, nil
+	}
+
+	paragraphs, truncated := limit.preview(plaintext.Strip(htmlstr))
+	if !truncated {
+		return textstr, htmlstr, false, nil
+	}
+
+	text, html := e.previewBody(paragraphs)
+	return text, html, true, nil
+}
+
+// previewBody returns the text and HTML of a preview containing the given
+// paragraphs, followed by a link to the whole item.
+func (e *Emailer) previewBody(paragraphs []string) (string, string) {
+
+	text := strings.Join(paragraphs, "\n\n") + "\n"
+
+	var out strings.Builder
+	for _, p := range paragraphs {
+		out.WriteString("<p>" + html.EscapeString(p) + "</p>\n")
+	}
+
+	// Link to the rest of the item, if we can.
+	if e.item.Link != "" {
+		text += "\nRead more: " + e.item.Link + "\n"
+		out.WriteString("<p><a href=\"" + html.EscapeString(e.item.Link) + "\">Read more…</a></p>\n")
+	}
+
+	return text, out.String()
+}
@@ -0,0 +1,89 @@
+package emailer
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/skx/rss2email/config"
+)
+
+// errOutputLimit is returned when a template produces too much output.
+type errOutputLimit struct {
+	limit int64
+}
+
+// Error is part of the error interface.
+func (e *errOutputLimit) Error() string {
+	return fmt.Sprintf("output exceeded the limit of %d bytes", e.limit)
+}
+
+// limitedBuffer is a buffer which refuses to grow beyond a limit, or to
+// be written once it has been abandoned.
+type limitedBuffer struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	limit     int64
+	abandoned bool
+}
+
+// Write is part of the io.Writer interface.
+func (l *limitedBuffer) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.abandoned {
+		return 0, fmt.Errorf("template execution abandoned")
+	}
+	if int64(l.buf.Len()+len(p)) > l.limit {
+		return 0, &errOutputLimit{limit: l.limit}
+	}
+	return l.buf.Write(p)
+}
+
+// abandon causes future writes to fail, which stops the execution of a
+// template which is still running.
+func (l *limitedBuffer) abandon() {
+	l.mu.Lock()
+	l.abandoned = true
+	l.mu.Unlock()
+}
+
+// execute renders the given template, guarding against templates which
+// produce too much output, or take too long.
+//
+// A template which loops without producing output can't be stopped once
+// it has timed out, but we stop waiting for it.
+func execute(t *template.Template, data interface{}) ([]byte, error) {
+
+	limit, err := strconv.ParseInt(config.Get(config.TemplateMaxSize), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", config.TemplateMaxSize, err.Error())
+	}
+	timeout, err := time.ParseDuration(config.Get(config.TemplateTimeout))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", config.TemplateTimeout, err.Error())
+	}
+
+	buf := &limitedBuffer{limit: limit}
+	done := make(chan error, 1)
+
+	go func() {
+		done <- t.Execute(buf, data)
+	}()
+
+	select {
+	case err = <-done:
+	case <-time.After(timeout):
+		buf.abandon()
+		return nil, fmt.Errorf("template %s took longer than %s to render", t.Name(), timeout)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to render template %s: %s", t.Name(), err.Error())
+	}
+	return buf.buf.Bytes(), nil
+}
@@ -0,0 +1,107 @@
+package emailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/mail"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/skx/rss2email/config"
+)
+
+func init() {
+	registerBackend(backend{
+		name:     "sendmail",
+		priority: 0,
+		enabled:  func() bool { return true },
+		send:     (*Emailer).sendSendmail,
+	})
+}
+
+// sendmailArgs returns the arguments to pass to sendmail, to send a message
+// from the given sender to the given recipients.
+//
+// The placeholder "{from}" is replaced by the sender, and "{to}" by the
+// recipients.  If there's no "{to}" the recipients are appended.  They're
+// always preceded by "--", so that none can be taken for an option.
+func sendmailArgs(from string, to []string) []string {
+
+	var args []string
+	found := false
+
+	recipients := func() {
+		if len(args) == 0 || args[len(args)-1] != "--" {
+			args = append(args, "--")
+		}
+		args = append(args, to...)
+	}
+
+	for _, arg := range strings.Fields(config.Get(config.SendmailArgs)) {
+		switch arg {
+		case "{to}":
+			recipients()
+			found = true
+		default:
+			args = append(args, strings.ReplaceAll(arg, "{from}", from))
+		}
+	}
+
+	if !found {
+		recipients()
+	}
+	return args
+}
+
+// sendSendmail sends the content of the email to the destination addresses
+// via sendmail, /usr/sbin/sendmail by default.
+//
+// Sendmail is killed if it runs for longer than SENDMAIL_TIMEOUT, so that a
+// hung MTA can't stall us forever, and anything it writes to STDERR is
+// included in the error we return.
+func (e *Emailer) sendSendmail(to []string, content []byte) error {
+
+	timeout, err := time.ParseDuration(config.Get(config.SendmailTimeout))
+	if err != nil {
+		return fmt.Errorf("invalid %s: %s", config.SendmailTimeout, err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Get the command to run.
+	to = envelopeAddresses(to)
+	for _, addr := range to {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return fmt.Errorf("invalid recipient %q: %s", addr, err.Error())
+		}
+	}
+	path := config.Get(config.SendmailPath)
+
+	var stderr bytes.Buffer
+
+	sendmail := exec.CommandContext(ctx, path, sendmailArgs(to[0], to)...)
+	sendmail.Stdin = bytes.NewReader(content)
+	sendmail.Stdout = ioutil.Discard
+	sendmail.Stderr = &stderr
+
+	//
+	// Run the command, piping in the rendered template-result
+	//
+	err = sendmail.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%s timed out after %s", path, timeout)
+	}
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			return fmt.Errorf("%s failed: %s: %s", path, err.Error(), msg)
+		}
+		return fmt.Errorf("%s failed: %s", path, err.Error())
+	}
+
+	return nil
+}
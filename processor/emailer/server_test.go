@@ -0,0 +1,162 @@
+package emailer
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// fakeServer is a trivial SMTP/LMTP server, used for testing.
+type fakeServer struct {
+
+	// listener is the socket we accept connections upon.
+	listener net.Listener
+
+	// lmtp is true if we should speak LMTP, rather than SMTP.
+	lmtp bool
+
+	// mu protects the fields which follow.
+	mu sync.Mutex
+
+	// helo holds the names clients introduced themselves as.
+	helo []string
+
+	// from holds the envelope senders we've seen.
+	from []string
+
+	// to holds the envelope recipients we've seen.
+	to []string
+
+	// messages holds the messages we've received.
+	messages []string
+}
+
+// newFakeServer starts a server listening upon the given network and
+// address.
+func newFakeServer(network, address string, lmtp bool) (*fakeServer, error) {
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &fakeServer{listener: l, lmtp: lmtp}
+	go s.serve()
+	return s, nil
+}
+
+// newFakeTLSServer starts an SMTP server which speaks TLS, with the given
+// configuration, upon a local TCP port.
+func newFakeTLSServer(cfg *tls.Config) (*fakeServer, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &fakeServer{listener: tls.NewListener(l, cfg)}
+	go s.serve()
+	return s, nil
+}
+
+// Close stops the server.
+func (s *fakeServer) Close() {
+	s.listener.Close()
+}
+
+// serve accepts connections.
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle processes a single connection.
+func (s *fakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(format string, args ...interface{}) {
+		fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+
+	reply("220 localhost ESMTP fake")
+
+	var rcpts int
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch {
+		case cmd == "EHLO" && !s.lmtp, cmd == "LHLO" && s.lmtp:
+			s.mu.Lock()
+			s.helo = append(s.helo, strings.TrimSpace(line[4:]))
+			s.mu.Unlock()
+			reply("250-localhost")
+			reply("250 8BITMIME")
+		case cmd == "MAIL":
+			s.mu.Lock()
+			s.from = append(s.from, addrArg(line))
+			s.mu.Unlock()
+			rcpts = 0
+			reply("250 OK")
+		case cmd == "RCPT":
+			s.mu.Lock()
+			s.to = append(s.to, addrArg(line))
+			s.mu.Unlock()
+			rcpts++
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 Go ahead")
+			var msg strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				msg.WriteString(l)
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, msg.String())
+			s.mu.Unlock()
+
+			// LMTP replies once per recipient.
+			n := 1
+			if s.lmtp {
+				n = rcpts
+			}
+			for i := 0; i < n; i++ {
+				reply("250 Delivered")
+			}
+		case cmd == "RSET", cmd == "NOOP":
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("500 Unknown command")
+		}
+	}
+}
+
+// addrArg returns the address from a MAIL or RCPT command.
+func addrArg(line string) string {
+	start := strings.Index(line, "<")
+	end := strings.Index(line, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return line[start+1 : end]
+}
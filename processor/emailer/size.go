@@ -0,0 +1,76 @@
+package emailer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/processor/plaintext"
+)
+
+// linked returns a copy of the given enclosures, none of which are
+// attached.
+func linked(enclosures []Enclosure) []Enclosure {
+	out := make([]Enclosure, len(enclosures))
+	for i, enc := range enclosures {
+		enc.Content = ""
+		out[i] = enc
+	}
+	return out
+}
+
+// render generates the complete email which would be sent to the given
+// addresses, the first of which is used as the sender.
+//
+// If the message is larger than MAX_MESSAGE_SIZE it is rendered again, in
+// the hope of making it fit: first without attachments, then, depending on
+// MESSAGE_SIZE_POLICY, with the content shortened to fewer and fewer words,
+// and finally with no content at all - just a link to the item.
+func (e *Emailer) render(to []string, textstr string, htmlstr string) ([]byte, error) {
+
+	max, err := strconv.Atoi(config.Get(config.MaxMessageSize))
+	if err != nil || max < 0 {
+		return nil, fmt.Errorf("invalid %s %q, expected a number of bytes", config.MaxMessageSize, config.Get(config.MaxMessageSize))
+	}
+
+	policy := config.Get(config.MessageSizePolicy)
+	if policy != "truncate" && policy != "link" {
+		return nil, fmt.Errorf("invalid %s %q, expected \"truncate\" or \"link\"", config.MessageSizePolicy, policy)
+	}
+
+	out, err := e.renderMessage(to, textstr, htmlstr, renderOptions{attach: true})
+	if err != nil || max == 0 || len(out) <= max {
+		return out, err
+	}
+
+	// Drop the attachments.
+	out, err = e.renderMessage(to, textstr, htmlstr, renderOptions{})
+	if err != nil || len(out) <= max {
+		return out, err
+	}
+
+	// Shorten the content, which also removes any inline images.
+	if policy == "truncate" {
+		text := plaintext.Strip(htmlstr)
+
+		for words := len(strings.Fields(text)); words > 0; words /= 2 {
+			paragraphs, _ := previewLimit{words: words}.preview(text)
+			t, h := e.previewBody(paragraphs)
+
+			out, err = e.renderMessage(to, t, h, renderOptions{truncated: true})
+			if err != nil || len(out) <= max {
+				return out, err
+			}
+		}
+	}
+
+	// Just the link.
+	t, h := e.previewBody(nil)
+	out, err = e.renderMessage(to, t, h, renderOptions{truncated: true})
+	if err != nil || len(out) <= max {
+		return out, err
+	}
+
+	return nil, fmt.Errorf("message is %d bytes, even without content, which exceeds %s of %d", len(out), config.MaxMessageSize, max)
+}
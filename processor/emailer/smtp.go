@@ -0,0 +1,116 @@
+//go:build !nosmtp
+// +build !nosmtp
+
+package emailer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/smtp"
+	"strconv"
+
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/network"
+)
+
+func init() {
+	registerBackend(backend{
+		name:     "smtp",
+		priority: 10,
+		enabled:  isSMTP,
+		send:     (*Emailer).sendSMTP,
+	})
+}
+
+// isSMTP determines whether we should use SMTP to send the email.
+//
+// We just check to see that the host is set in the environment, as the
+// username and password are only required by servers which demand that we
+// authenticate.  If they're wrong we'll get an error at delivery time, as
+// expected.
+func isSMTP() bool {
+	return config.IsSet(config.SMTPHost)
+}
+
+// sendSMTP sends the content of the email to the destination address
+// via SMTP.
+func (e *Emailer) sendSMTP(to []string, content []byte) error {
+
+	// The settings of the profile we're using.
+	name := func(n string) string {
+		return config.Profile(n, e.smtpProfile)
+	}
+
+	// basics
+	host := config.Get(name(config.SMTPHost))
+	if host == "" {
+		return fmt.Errorf("SMTP profile %q has no host, set %s", e.smtpProfile, name(config.SMTPHost))
+	}
+	p, err := strconv.Atoi(config.Get(name(config.SMTPPort)))
+	if err != nil {
+		return err
+	}
+
+	// auth
+	user := config.Get(name(config.SMTPUsername))
+	pass := config.Get(name(config.SMTPPassword))
+
+	// Authenticate, unless we've no credentials to do so, as is the
+	// case for relays which accept mail from their local network.
+	var auth smtp.Auth
+	if user != "" || pass != "" {
+		auth = smtp.PlainAuth("", user, pass, host)
+	}
+
+	// TLS
+	implicit, err := smtpImplicitTLS(name, p)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := smtpTLSConfig(name, host)
+	if err != nil {
+		return err
+	}
+
+	// Get the mailserver
+	addr := fmt.Sprintf("%s:%d", host, p)
+
+	// Send the mail
+	to = envelopeAddresses(to)
+	return sendMail(addr, host, config.Get(name(config.SMTPHelo)), tlsConfig, implicit, auth, to[0], to, content)
+}
+
+// sendMail is a version of smtp.SendMail which makes the connection to
+// the mailserver via our dialer, so that the configured source address
+// is honoured.
+//
+// If implicit is true we speak TLS from the start, as is usual on port
+// 465, otherwise the connection is upgraded via STARTTLS if the server
+// supports it.
+func sendMail(addr string, host string, helo string, tlsConfig *tls.Config, implicit bool, auth smtp.Auth, from string, to []string, msg []byte) error {
+
+	dialer, err := network.Dialer()
+	if err != nil {
+		return err
+	}
+
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	if !implicit {
+		return smtpConversation(conn, host, helo, tlsConfig, auth, from, to, msg)
+	}
+
+	// Complete the handshake now, so that failures are reported
+	// clearly rather than by our first command.
+	tlsConn := tls.Client(conn, tlsConfig)
+	err = tlsConn.Handshake()
+	if err != nil {
+		conn.Close()
+		return tlsError(addr, tlsConfig, err)
+	}
+
+	return smtpConversation(tlsConn, host, helo, nil, auth, from, to, msg)
+}
@@ -0,0 +1,196 @@
+//go:build !nosmtp
+// +build !nosmtp
+
+package emailer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/skx/rss2email/config"
+)
+
+// TestSMTPWithoutAuth ensures SMTP may be used without credentials.
+func TestSMTPWithoutAuth(t *testing.T) {
+
+	s, err := newFakeServer("tcp", "127.0.0.1:0", false)
+	if err != nil {
+		t.Fatalf("failed to start server: %s", err)
+	}
+	defer s.Close()
+
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+
+	vars := map[string]string{
+		config.SMTPHost:     host,
+		config.SMTPPort:     port,
+		config.SMTPUsername: "",
+		config.SMTPPassword: "",
+		config.Backends:     "",
+	}
+	for name, val := range vars {
+		cur := os.Getenv(name)
+		defer os.Setenv(name, cur)
+		os.Setenv(name, val)
+	}
+
+	if !isSMTP() {
+		t.Fatalf("expected SMTP to be enabled by the host alone")
+	}
+
+	e := newTestEmailer(t)
+	err = e.Sendmail([]string{"steve@example.com"}, "text", "html")
+	if err != nil {
+		t.Fatalf("failed to send: %s", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.messages) != 1 || len(s.to) != 1 || s.to[0] != "steve@example.com" {
+		t.Fatalf("unexpected delivery: %v %v", s.to, len(s.messages))
+	}
+}
+
+// TestSMTPProfile ensures a feed may deliver via a named SMTP profile.
+func TestSMTPProfile(t *testing.T) {
+
+	s, err := newFakeServer("tcp", "127.0.0.1:0", false)
+	if err != nil {
+		t.Fatalf("failed to start server: %s", err)
+	}
+	defer s.Close()
+
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+
+	vars := map[string]string{
+		"SMTP_SELFHOSTED_HOST":     host,
+		"SMTP_SELFHOSTED_PORT":     port,
+		"SMTP_SELFHOSTED_USERNAME": "steve",
+		"SMTP_SELFHOSTED_PASSWORD": "secret",
+		config.Backends:            "",
+	}
+	for name, val := range vars {
+		cur := os.Getenv(name)
+		defer os.Setenv(name, cur)
+		os.Setenv(name, val)
+	}
+
+	e := newTestEmailer(t)
+	e.SetSMTPProfile("selfhosted")
+	err = e.Sendmail([]string{"steve@example.com"}, "text", "html")
+	if err != nil {
+		t.Fatalf("failed to send: %s", err)
+	}
+
+	s.mu.Lock()
+	if len(s.messages) != 1 || len(s.to) != 1 || s.to[0] != "steve@example.com" {
+		t.Fatalf("unexpected delivery: %v %v", s.to, len(s.messages))
+	}
+	if len(s.helo) != 1 || s.helo[0] != "localhost" {
+		t.Fatalf("unexpected EHLO: %v", s.helo)
+	}
+	s.mu.Unlock()
+
+	// The name we introduce ourselves as may be changed.
+	cur := os.Getenv("SMTP_SELFHOSTED_HELO")
+	defer os.Setenv("SMTP_SELFHOSTED_HELO", cur)
+	os.Setenv("SMTP_SELFHOSTED_HELO", "mail.example.com")
+
+	err = e.Sendmail([]string{"steve@example.com"}, "text", "html")
+	if err != nil {
+		t.Fatalf("failed to send: %s", err)
+	}
+	s.mu.Lock()
+	if len(s.helo) != 2 || s.helo[1] != "mail.example.com" {
+		t.Fatalf("unexpected EHLO: %v", s.helo)
+	}
+	s.mu.Unlock()
+
+	// A missing profile is an error.
+	e.SetSMTPProfile("missing")
+	err = e.Sendmail([]string{"steve@example.com"}, "text", "html")
+	if err == nil || !strings.Contains(err.Error(), "SMTP_MISSING_HOST") {
+		t.Fatalf("expected error for missing profile, got %v", err)
+	}
+}
+
+// TestSMTPImplicitTLS ensures we may speak TLS from the start, and
+// that handshake failures are clearly reported.
+func TestSMTPImplicitTLS(t *testing.T) {
+
+	// Borrow a certificate from the HTTP test-server.
+	ts := httptest.NewUnstartedServer(nil)
+	ts.StartTLS()
+	defer ts.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	smtpRootCAs = pool
+	defer func() { smtpRootCAs = nil }()
+
+	s, err := newFakeTLSServer(&tls.Config{Certificates: ts.TLS.Certificates, MaxVersion: tls.VersionTLS12})
+	if err != nil {
+		t.Fatalf("failed to start server: %s", err)
+	}
+	defer s.Close()
+
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+
+	vars := map[string]string{
+		config.SMTPHost:          host,
+		config.SMTPPort:          port,
+		config.SMTPUsername:      "",
+		config.SMTPPassword:      "",
+		config.SMTPTLS:           "implicit",
+		config.SMTPTLSMinVersion: "",
+		config.SMTPTLSServerName: "",
+		config.Backends:          "",
+	}
+	for name, val := range vars {
+		cur := os.Getenv(name)
+		defer os.Setenv(name, cur)
+		os.Setenv(name, val)
+	}
+
+	e := newTestEmailer(t)
+	err = e.Sendmail([]string{"steve@example.com"}, "text", "html")
+	if err != nil {
+		t.Fatalf("failed to send: %s", err)
+	}
+	s.mu.Lock()
+	if len(s.messages) != 1 {
+		t.Fatalf("unexpected delivery: %v", len(s.messages))
+	}
+	s.mu.Unlock()
+
+	type TestCase struct {
+		Name  string
+		Value string
+		Error string
+	}
+
+	tests := []TestCase{
+		{Name: config.SMTPTLSMinVersion, Value: "1.3", Error: "minimum version TLS 1.3"},
+		{Name: config.SMTPTLSMinVersion, Value: "2.0", Error: "invalid SMTP_TLS_MIN_VERSION"},
+		{Name: config.SMTPTLSServerName, Value: "smtp.example.net", Error: "server name smtp.example.net"},
+		{Name: config.SMTPTLSCiphers, Value: "TLS_BOGUS", Error: "unknown cipher suite"},
+		{Name: config.SMTPTLS, Value: "sometimes", Error: "invalid SMTP_TLS"},
+	}
+
+	for _, test := range tests {
+		cur := os.Getenv(test.Name)
+		os.Setenv(test.Name, test.Value)
+
+		err = e.Sendmail([]string{"steve@example.com"}, "text", "html")
+		if err == nil || !strings.Contains(err.Error(), test.Error) {
+			t.Errorf("%s=%s: expected error %q, got %v", test.Name, test.Value, test.Error, err)
+		}
+
+		os.Setenv(test.Name, cur)
+	}
+}
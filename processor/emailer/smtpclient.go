@@ -0,0 +1,102 @@
+package emailer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+// smtpConversation sends a message over the given connection, which
+// must be to a server speaking SMTP.  The connection is closed when we
+// return.
+//
+// We introduce ourselves with the given helo name, if it is non-empty,
+// otherwise as "localhost".
+//
+// If starttls is non-nil STARTTLS is used, with that configuration, when
+// the server supports it, and auth is used if it is non-nil.  If the server advertises SMTPUTF8 support it will be
+// requested, which allows non-ASCII addresses to be used as per RFC 6532.
+func smtpConversation(conn net.Conn, host string, helo string, starttls *tls.Config, auth smtp.Auth, from string, to []string, msg []byte) error {
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if helo != "" {
+		err = c.Hello(helo)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Upgrade to TLS if we can.
+	if ok, _ := c.Extension("STARTTLS"); ok && starttls != nil {
+		err = c.StartTLS(starttls)
+		if err != nil {
+			return tlsError(conn.RemoteAddr().String(), starttls, err)
+		}
+	}
+
+	if ok, _ := c.Extension("AUTH"); ok && auth != nil {
+		err = c.Auth(auth)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.Mail(from)
+	if err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		err = c.Rcpt(rcpt)
+		if err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(msg)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// tlsVersions maps the names of the TLS versions to their values.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsError describes a failure to negotiate TLS with the given server,
+// along with the settings which might be responsible.
+func tlsError(addr string, cfg *tls.Config, err error) error {
+
+	settings := []string{"server name " + cfg.ServerName}
+	for name, version := range tlsVersions {
+		if cfg.MinVersion != 0 && version == cfg.MinVersion {
+			settings = append(settings, "minimum version TLS "+name)
+		}
+	}
+	if len(cfg.CipherSuites) > 0 {
+		settings = append(settings, fmt.Sprintf("%d permitted cipher suites", len(cfg.CipherSuites)))
+	}
+
+	return fmt.Errorf("TLS handshake with %s failed (%s): %s", addr, strings.Join(settings, ", "), err.Error())
+}
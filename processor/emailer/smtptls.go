@@ -0,0 +1,69 @@
+//go:build !nosmtp
+// +build !nosmtp
+
+package emailer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/skx/rss2email/config"
+)
+
+// smtpRootCAs holds the certificate authorities we trust when talking
+// to an SMTP server, nil for the system's, and is used to allow changes
+// during testing.
+var smtpRootCAs *x509.CertPool
+
+// smtpImplicitTLS returns true if we should speak TLS as soon as we've
+// connected to the SMTP server on the given port, rather than upgrading
+// the connection via STARTTLS.
+func smtpImplicitTLS(name func(string) string, port int) (bool, error) {
+
+	switch mode := config.Get(name(config.SMTPTLS)); mode {
+	case "auto":
+		return port == 465, nil
+	case "implicit":
+		return true, nil
+	case "starttls":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid %s %q, expected \"auto\", \"implicit\", or \"starttls\"", name(config.SMTPTLS), mode)
+	}
+}
+
+// smtpTLSConfig returns the TLS configuration used to talk to the given
+// SMTP server, using the named settings.
+func smtpTLSConfig(name func(string) string, host string) (*tls.Config, error) {
+
+	cfg := &tls.Config{ServerName: host, RootCAs: smtpRootCAs}
+
+	if sni := config.Get(name(config.SMTPTLSServerName)); sni != "" {
+		cfg.ServerName = sni
+	}
+
+	if min := config.Get(name(config.SMTPTLSMinVersion)); min != "" {
+		version, ok := tlsVersions[min]
+		if !ok {
+			return nil, fmt.Errorf("invalid %s %q, expected \"1.0\", \"1.1\", \"1.2\", or \"1.3\"", name(config.SMTPTLSMinVersion), min)
+		}
+		cfg.MinVersion = version
+	}
+
+	// Cipher suites are named as in the Go standard library.
+	ciphers := make(map[string]uint16)
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		ciphers[suite.Name] = suite.ID
+	}
+	for _, cipher := range config.List(name(config.SMTPTLSCiphers)) {
+		id, ok := ciphers[strings.TrimSpace(cipher)]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q in %s", cipher, name(config.SMTPTLSCiphers))
+		}
+		cfg.CipherSuites = append(cfg.CipherSuites, id)
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,107 @@
+//go:build !nosubmission
+// +build !nosubmission
+
+package emailer
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/skx/rss2email/config"
+)
+
+func init() {
+	registerBackend(backend{
+		name:     "submission",
+		priority: 20,
+		enabled:  isSubmission,
+		send:     (*Emailer).sendSubmission,
+	})
+}
+
+// isSubmission determines whether we should deliver via a local mail
+// submission agent, which happens if either a socket or a command has
+// been configured.
+func isSubmission() bool {
+	return config.IsSet(config.SubmissionSocket) || config.IsSet(config.SubmissionCommand)
+}
+
+// sendSubmission delivers the message via a local mail submission agent,
+// which is expected to have already authenticated us.
+//
+// The agent may be reached via a Unix socket, such as OpenSMTPD's
+// /var/run/smtpd.sock, or by running a command which speaks SMTP upon
+// its STDIN and STDOUT, such as "/usr/sbin/sendmail -bs".
+func (e *Emailer) sendSubmission(to []string, content []byte) error {
+
+	conn, err := submissionConn()
+	if err != nil {
+		return err
+	}
+
+	to = envelopeAddresses(to)
+	return smtpConversation(conn, "localhost", config.Get(config.SMTPHelo), nil, nil, to[0], to, content)
+}
+
+// submissionConn connects to the configured submission agent.
+func submissionConn() (net.Conn, error) {
+
+	socket := config.Get(config.SubmissionSocket)
+	if socket != "" {
+		return net.Dial("unix", socket)
+	}
+
+	args := strings.Fields(config.Get(config.SubmissionCommand))
+	if len(args) == 0 {
+		return nil, errors.New("no submission socket or command configured")
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	return &pipeConn{Reader: stdout, WriteCloser: stdin, cmd: cmd}, nil
+}
+
+// pipeConn allows a command's STDIN and STDOUT to be used as a net.Conn.
+type pipeConn struct {
+	io.Reader
+	io.WriteCloser
+
+	// cmd is the command we're talking to.
+	cmd *exec.Cmd
+}
+
+// Close closes the command's input, and waits for it to terminate.
+func (p *pipeConn) Close() error {
+	p.WriteCloser.Close()
+	return p.cmd.Wait()
+}
+
+// pipeAddr is the address of either end of a pipeConn.
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+// The remaining methods are required by net.Conn, but are not
+// meaningful for pipes.
+func (p *pipeConn) LocalAddr() net.Addr                { return pipeAddr{} }
+func (p *pipeConn) RemoteAddr() net.Addr               { return pipeAddr{} }
+func (p *pipeConn) SetDeadline(t time.Time) error      { return nil }
+func (p *pipeConn) SetReadDeadline(t time.Time) error  { return nil }
+func (p *pipeConn) SetWriteDeadline(t time.Time) error { return nil }
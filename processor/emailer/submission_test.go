@@ -0,0 +1,55 @@
+//go:build !nosubmission
+// +build !nosubmission
+
+package emailer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skx/rss2email/config"
+)
+
+// TestSubmission ensures we can deliver via a submission socket.
+func TestSubmission(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "submission")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "smtpd.sock")
+	s, err := newFakeServer("unix", socket, false)
+	if err != nil {
+		t.Fatalf("failed to start server: %s", err)
+	}
+	defer s.Close()
+
+	cur := os.Getenv(config.SubmissionSocket)
+	defer os.Setenv(config.SubmissionSocket, cur)
+	os.Setenv(config.SubmissionSocket, socket)
+
+	b := selectBackend()
+	if b == nil || b.name != "submission" {
+		t.Fatalf("submission backend not selected")
+	}
+
+	e := newTestEmailer(t)
+	err = e.Sendmail([]string{"Steve <steve@example.com>"}, "text", "html")
+	if err != nil {
+		t.Fatalf("failed to send: %s", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.messages) != 1 || len(s.to) != 1 || s.to[0] != "steve@example.com" {
+		t.Fatalf("unexpected delivery: %v %v", s.to, len(s.messages))
+	}
+	if !strings.Contains(s.messages[0], "Subject: [rss2email] Hello World") {
+		t.Fatalf("unexpected message: %s", s.messages[0])
+	}
+}
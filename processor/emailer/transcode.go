@@ -0,0 +1,142 @@
+package emailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skx/rss2email/config"
+)
+
+// transcodeDirectory holds the location of our cache of transcoded
+// enclosures, and is used to allow changes during testing.
+var transcodeDirectory string
+
+// SetTranscode sets the command used to transcode the enclosures of the
+// item before they're attached, for example to shrink images.
+//
+// The command reads the enclosure upon STDIN, and writes the result to
+// STDOUT.
+func (e *Emailer) SetTranscode(command string) {
+	e.transcode = command
+}
+
+// transcodeCache returns the file which caches the result of running the
+// given command upon the given enclosure.
+func transcodeCache(command string, link string) string {
+	dir := transcodeDirectory
+	if dir == "" {
+		dir = filepath.Join(config.StateDirectory(), "transcoded")
+	}
+
+	hash := fmt.Sprintf("%x", sha1.Sum([]byte(command+"\n"+link)))
+	return filepath.Join(dir, hash)
+}
+
+// fetchAttachment returns the content of the given enclosure, which must
+// be no larger than max bytes.
+//
+// If a transcoding command has been set then a larger enclosure is
+// downloaded and passed through it, and the result is cached so that we
+// don't repeat the work.  The type of the enclosure is updated, if the
+// command changed it.
+func (e *Emailer) fetchAttachment(x *Enclosure, max int64) ([]byte, error) {
+
+	if e.transcode == "" {
+		return fetchEnclosure(x.URL, max)
+	}
+
+	cache := transcodeCache(e.transcode, x.URL)
+
+	data, err := ioutil.ReadFile(cache)
+	if err != nil {
+		limit, perr := strconv.ParseInt(config.Get(config.TranscodeMaxSize), 10, 64)
+		if perr != nil {
+			return nil, fmt.Errorf("invalid %s: %s", config.TranscodeMaxSize, perr.Error())
+		}
+
+		data, err = fetchEnclosure(x.URL, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err = runTranscode(e.transcode, x, data)
+		if err != nil {
+			return nil, err
+		}
+
+		err = os.MkdirAll(filepath.Dir(cache), os.ModePerm)
+		if err == nil {
+			err = ioutil.WriteFile(cache, data, 0644)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to cache transcoded enclosure: %s", err.Error())
+		}
+	}
+
+	if int64(len(data)) > max {
+		return nil, fmt.Errorf("transcoded enclosure %s is too large", x.URL)
+	}
+
+	// The command might have changed the type, "image/png" to
+	// "image/jpeg" for example.
+	if t := http.DetectContentType(data); t != "application/octet-stream" && !strings.HasPrefix(t, "text/plain") {
+		x.Type = t
+	}
+
+	return data, nil
+}
+
+// runTranscode runs the given command, passing it the content of the
+// enclosure and returning what it writes to STDOUT.
+//
+// The details of the enclosure are available to the command via the
+// environment, as $RSS2EMAIL_URL, $RSS2EMAIL_TYPE, and $RSS2EMAIL_FILENAME.
+func runTranscode(command string, x *Enclosure, data []byte) ([]byte, error) {
+
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty transcode command")
+	}
+
+	timeout, err := time.ParseDuration(config.Get(config.TranscodeTimeout))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", config.TranscodeTimeout, err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, fields[0], fields[1:]...)
+	cmd.Env = append(os.Environ(),
+		"RSS2EMAIL_URL="+x.URL,
+		"RSS2EMAIL_TYPE="+x.Type,
+		"RSS2EMAIL_FILENAME="+x.Filename)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("transcoding %s timed out after %s", x.URL, timeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to transcode %s: %s %s", x.URL, err.Error(), strings.TrimSpace(stderr.String()))
+	}
+	if stdout.Len() == 0 {
+		return nil, fmt.Errorf("failed to transcode %s: no output", x.URL)
+	}
+
+	return stdout.Bytes(), nil
+}
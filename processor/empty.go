@@ -0,0 +1,163 @@
+package processor
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmcdole/gofeed"
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/network"
+	"github.com/skx/rss2email/withstate"
+)
+
+// The ways in which we may handle items without any content.
+const (
+	// emptySend sends the item as it is.
+	emptySend = "send"
+
+	// emptySynthesize builds a little content from the title, link,
+	// and summary of the item.
+	emptySynthesize = "synthesize"
+
+	// emptyFetch fetches the content from the item's link.
+	emptyFetch = "fetch"
+
+	// emptySkip doesn't send the item at all.
+	emptySkip = "skip"
+)
+
+// emptyPageLimit is the maximum size of a page we'll fetch to replace
+// the missing content of an item.
+const emptyPageLimit = 2 * 1024 * 1024
+
+// validEmptyPolicy returns an error if the given policy is unknown.
+func validEmptyPolicy(policy string) error {
+	switch policy {
+	case emptySend, emptySynthesize, emptyFetch, emptySkip:
+		return nil
+	}
+	return fmt.Errorf("invalid empty-content policy %q, expected %q, %q, %q, or %q", policy, emptySend, emptySynthesize, emptyFetch, emptySkip)
+}
+
+// isEmpty returns true if the given HTML has no text, and nothing such as
+// an image which would be shown in place of text.
+func isEmpty(content string) bool {
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+	if err != nil {
+		return strings.TrimSpace(content) == ""
+	}
+	if doc.Find("img, picture, video, audio, iframe, object, embed, svg").Length() > 0 {
+		return false
+	}
+	return strings.TrimSpace(doc.Text()) == ""
+}
+
+// fillEmpty applies the given policy to the item, if it has no content,
+// returning false if it shouldn't be sent.
+func (p *Processor) fillEmpty(item *gofeed.Item, policy string) (bool, error) {
+
+	if policy == "" {
+		policy = config.Get(config.EmptyContent)
+	}
+	if err := validEmptyPolicy(policy); err != nil {
+		return false, err
+	}
+
+	wrapped := withstate.FeedItem{Item: item}
+	if policy == emptySend || !isEmpty(wrapped.RawContent()) {
+		return true, nil
+	}
+
+	switch policy {
+	case emptySkip:
+		if p.verbose {
+			fmt.Printf("\t\tSkipping empty entry: %s\n", item.Title)
+		}
+		return false, nil
+	case emptyFetch:
+		content, err := fetchPage(item.Link)
+		if err == nil && !isEmpty(content) {
+			item.Content = content
+			return true, nil
+		}
+		if p.verbose && err != nil {
+			fmt.Printf("\t\tFailed to fetch the content of %s: %s\n", item.Title, err.Error())
+		}
+	}
+
+	item.Content = synthesize(item)
+	return true, nil
+}
+
+// synthesize returns a little HTML describing the item, from its title,
+// link, and summary.
+func synthesize(item *gofeed.Item) string {
+
+	title := item.Title
+	if title == "" {
+		title = item.Link
+	}
+
+	var out strings.Builder
+	if item.Link != "" {
+		fmt.Fprintf(&out, "<p><a href=\"%s\">%s</a></p>\n", html.EscapeString(item.Link), html.EscapeString(title))
+	} else {
+		fmt.Fprintf(&out, "<p>%s</p>\n", html.EscapeString(title))
+	}
+
+	if item.ITunesExt != nil && item.ITunesExt.Summary != "" {
+		fmt.Fprintf(&out, "<p>%s</p>\n", html.EscapeString(item.ITunesExt.Summary))
+	}
+	return out.String()
+}
+
+// fetchPage returns the main content of the page at the given link, the
+// first <article> or <main> element, or failing that the <body>.  Scripts
+// and styles are removed.
+func fetchPage(link string) (string, error) {
+
+	if !strings.HasPrefix(link, "http://") && !strings.HasPrefix(link, "https://") {
+		return "", fmt.Errorf("cannot fetch %q", link)
+	}
+
+	client, err := network.HTTPClient()
+	if err != nil {
+		return "", err
+	}
+	client.Timeout = 60 * time.Second
+
+	req, err := http.NewRequest("GET", link, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", config.Get(config.UserAgent))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch %s: %s", link, resp.Status)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(io.LimitReader(resp.Body, emptyPageLimit))
+	if err != nil {
+		return "", err
+	}
+	doc.Find("script, style, noscript, nav, header, footer").Remove()
+
+	for _, selector := range []string{"article", "main", "body"} {
+		if s := doc.Find(selector).First(); s.Length() > 0 {
+			return s.Html()
+		}
+	}
+	return "", fmt.Errorf("no content found at %s", link)
+}
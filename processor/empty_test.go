@@ -0,0 +1,136 @@
+package processor
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+	"github.com/skx/rss2email/feedlist"
+)
+
+// TestIsEmpty tests recognising content which has nothing to show.
+func TestIsEmpty(t *testing.T) {
+
+	tests := map[string]bool{
+		"":                              true,
+		"   \n\t":                       true,
+		"<p> </p><div><br/></div>":      true,
+		"<!-- nothing -->":              true,
+		"Hello":                         false,
+		"<p>Hello</p>":                  false,
+		`<p><img src="cat.png"/></p>`:   false,
+		`<video src="cat.mp4"></video>`: false,
+		`<svg><circle r="4"/></svg>`:    false,
+	}
+	for content, expected := range tests {
+		if got := isEmpty(content); got != expected {
+			t.Errorf("%q: expected %v, got %v", content, expected, got)
+		}
+	}
+}
+
+// TestSynthesize tests building content for an item, which must escape
+// what it's built from.
+func TestSynthesize(t *testing.T) {
+
+	item := &gofeed.Item{
+		Title:     "Fish & <Chips>",
+		Link:      `https://example.com/?a=1&b="2"`,
+		ITunesExt: &ext.ITunesItemExtension{Summary: "<script>alert(1)</script>"},
+	}
+	got := synthesize(item)
+	expected := `<p><a href="https://example.com/?a=1&amp;b=&#34;2&#34;">Fish &amp; &lt;Chips&gt;</a></p>
+<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>
+`
+	if got != expected {
+		t.Errorf("unexpected content:\n%s", got)
+	}
+
+	// Without a title the link is shown, without a link there's no
+	// anchor.
+	if got := synthesize(&gofeed.Item{Link: "https://example.com/"}); !strings.Contains(got, ">https://example.com/</a>") {
+		t.Errorf("the link wasn't used as the title:\n%s", got)
+	}
+	if got := synthesize(&gofeed.Item{Title: "Title"}); got != "<p>Title</p>\n" {
+		t.Errorf("unexpected content:\n%s", got)
+	}
+}
+
+// TestFillEmpty tests each of the ways of handling items without content.
+func TestFillEmpty(t *testing.T) {
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/article":
+			fmt.Fprintf(w, `<html><body><nav>Menu</nav><article><p>The story</p><script>track()</script></article></body></html>`)
+		case "/blank":
+			fmt.Fprintf(w, `<html><body><script>track()</script></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	p := New()
+
+	tests := []struct {
+		policy   string
+		link     string
+		content  string
+		send     bool
+		expected string
+	}{
+		// Items with content are left alone.
+		{policy: emptySkip, link: srv.URL + "/article", content: "<p>Hi</p>", send: true, expected: "<p>Hi</p>"},
+		{policy: emptySend, link: srv.URL + "/article", send: true, expected: ""},
+		{policy: emptySkip, link: srv.URL + "/article", send: false, expected: ""},
+		{policy: emptySynthesize, link: srv.URL + "/article", send: true, expected: "<p><a href="},
+		{policy: emptyFetch, link: srv.URL + "/article", send: true, expected: "<p>The story</p>"},
+
+		// Pages which fail, or are empty, are synthesized.
+		{policy: emptyFetch, link: srv.URL + "/missing", send: true, expected: "<p><a href="},
+		{policy: emptyFetch, link: srv.URL + "/blank", send: true, expected: "<p><a href="},
+		{policy: emptyFetch, link: "file:///etc/passwd", send: true, expected: "<p><a href="},
+	}
+
+	for _, test := range tests {
+		item := &gofeed.Item{Title: "Title", Link: test.link, Content: test.content}
+		send, err := p.fillEmpty(item, test.policy)
+		if err != nil {
+			t.Fatalf("%s %s: unexpected error: %s", test.policy, test.link, err)
+		}
+		if send != test.send {
+			t.Errorf("%s %s: expected send %v, got %v", test.policy, test.link, test.send, send)
+		}
+		if !strings.HasPrefix(item.Content, test.expected) || (test.expected == "" && item.Content != "") {
+			t.Errorf("%s %s: unexpected content %q", test.policy, test.link, item.Content)
+		}
+		if strings.Contains(item.Content, "track()") || strings.Contains(item.Content, "Menu") {
+			t.Errorf("%s %s: scripts and navigation should be removed: %q", test.policy, test.link, item.Content)
+		}
+	}
+
+	// Unknown policies are errors.
+	if _, err := p.fillEmpty(&gofeed.Item{Title: "Title"}, "ignore"); err == nil {
+		t.Errorf("expected an error for an invalid policy")
+	}
+}
+
+// TestEmptyContentDirective tests choosing the policy of a feed, via its
+// #empty-content comment.
+func TestEmptyContentDirective(t *testing.T) {
+
+	opts, errs := options(feedlist.Entry{URL: "https://example.com/", Comments: []string{"#empty-content fetch"}})
+	if len(errs) > 0 || opts.empty != emptyFetch {
+		t.Errorf("unexpected policy %q %v", opts.empty, errs)
+	}
+
+	_, errs = options(feedlist.Entry{URL: "https://example.com/", Comments: []string{"#empty-content ignore"}})
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "invalid empty-content policy") {
+		t.Errorf("expected an error, got %v", errs)
+	}
+}
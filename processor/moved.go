@@ -0,0 +1,72 @@
+package processor
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/skx/rss2email/feedlist"
+	"github.com/skx/rss2email/feedstate"
+)
+
+// checkMoved looks for feeds which have been permanently redirected to
+// a new location, updating the feed-list to use that location if we've
+// been asked to.  Otherwise the user is told about the move, once.
+func (p *Processor) checkMoved(list *feedlist.FeedList, uri string) []error {
+
+	state := feedstate.Load(uri)
+	if state.MovedTo == "" {
+		return nil
+	}
+
+	moved := movedURL(uri, state.MovedTo)
+	if moved == uri {
+		return nil
+	}
+	shown := feedlist.Redact(uri)
+
+	if !p.updateMoved {
+		if state.MoveReported == moved {
+			return nil
+		}
+		state.MoveReported = moved
+		if err := state.Save(); err != nil {
+			return []error{err}
+		}
+		return []error{fmt.Errorf("The feed %s has moved permanently to %s, update your feed-list, or run with -update-moved to do so automatically.", shown, feedlist.Redact(moved))}
+	}
+
+	list.Rename(uri, moved)
+	if err := list.Save(); err != nil {
+		return []error{err}
+	}
+
+	// The state of the feed moves along with it.
+	state.URL = moved
+	state.MovedTo = ""
+	state.MoveReported = ""
+	if err := state.Save(); err != nil {
+		return []error{err}
+	}
+
+	if p.verbose {
+		fmt.Printf("The feed %s has moved permanently, and now uses %s\n", shown, feedlist.Redact(moved))
+	}
+	return nil
+}
+
+// movedURL returns the location the feed has moved to, keeping any
+// credentials within its old URL if it remains on the same host.
+func movedURL(old string, location string) string {
+
+	o, err := url.Parse(old)
+	if err != nil || o.User == nil {
+		return location
+	}
+	u, err := url.Parse(location)
+	if err != nil || u.Host != o.Host {
+		return location
+	}
+
+	u.User = o.User
+	return u.String()
+}
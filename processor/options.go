@@ -0,0 +1,255 @@
+package processor
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/feedlist"
+	"github.com/skx/rss2email/network"
+	"github.com/skx/rss2email/processor/rewrite"
+	"github.com/skx/rss2email/scrape"
+	"github.com/skx/rss2email/withstate"
+)
+
+// feedOptions holds the settings which apply to a single feed, which are
+// read from the directives beneath it in the feed-list.
+type feedOptions struct {
+
+	// source is the URL of the feed, as it appears in the feed-list.
+	source string
+
+	// rules are the rewrite-rules applied to each item.
+	rules []rewrite.Rule
+
+	// headers are additional headers added to each email.
+	headers []string
+
+	// replyTo is the address replies should be sent to.
+	replyTo string
+
+	// smtpProfile is the SMTP profile to deliver via.
+	smtpProfile string
+
+	// preview is the size of the preview of each item to send.
+	preview string
+
+	// transcode is the command used to transcode enclosures.
+	transcode string
+
+	// credentials are used to authenticate when fetching the feed,
+	// as "username:password".
+	credentials string
+
+	// request holds the additional headers sent when fetching the
+	// feed, including any cookies.
+	request http.Header
+
+	// proxy is the proxy to fetch the feed via, "direct" to avoid
+	// that of the environment.
+	proxy string
+
+	// folder is the template naming the folder items are filed in.
+	folder string
+
+	// empty is how we handle items without content, overriding the
+	// global setting.
+	empty string
+
+	// tags are the tags of the feed.
+	tags []string
+
+	// identity is how items are identified, to tell whether they're
+	// new.
+	identity string
+
+	// tls holds the settings used to verify the server the feed is
+	// fetched from, and identify ourselves to it.
+	tls network.TLS
+
+	// scrape holds the rules to find the items within a page, if the
+	// feed is a page to be scraped.
+	scrape *scrape.Rules
+
+	// delivery holds the recipients, template, and filters of the
+	// feed's items.
+	delivery feedlist.Options
+}
+
+// options returns the settings for the given feed, along with any errors
+// found in them.
+func options(entry feedlist.Entry) (feedOptions, []error) {
+	uri := feedlist.Redact(entry.URL)
+	opts := feedOptions{source: uri}
+	var errors []error
+
+	// Find any rewrite-rules for this feed.
+	rules, ruleErrors := rewrite.ParseAll(entry.Directives("rewrite"))
+	for _, err := range ruleErrors {
+		errors = append(errors, fmt.Errorf("error processing %s - %s", uri, err))
+	}
+	opts.rules = rules
+
+	// How to verify the server, "#tls-ca ca.pem", and identify
+	// ourselves to it, "#tls-cert client.pem" and "#tls-key client.key".
+	// Files are relative to our configuration directory.
+	file := func(name string) string {
+		values := entry.Directives(name)
+		if len(values) == 0 || values[len(values)-1] == "" {
+			return ""
+		}
+		path := values[len(values)-1]
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(config.ConfigDirectory(), path)
+		}
+		return path
+	}
+	opts.tls = network.TLS{
+		CA:       file("tls-ca"),
+		Cert:     file("tls-cert"),
+		Key:      file("tls-key"),
+		Insecure: len(entry.Directives("tls-insecure")) > 0,
+	}
+	if _, err := opts.tls.Config(); err != nil {
+		errors = append(errors, fmt.Errorf("error processing %s - %s", uri, err.Error()))
+	}
+
+	// How to scrape a page which isn't a feed, "#scrape-item article".
+	if values := entry.Directives("scrape-item"); len(values) > 0 {
+		last := func(name string) string {
+			values := entry.Directives(name)
+			if len(values) == 0 {
+				return ""
+			}
+			return values[len(values)-1]
+		}
+		opts.scrape = &scrape.Rules{
+			Item:    values[len(values)-1],
+			Title:   last("scrape-title"),
+			Link:    last("scrape-link"),
+			Content: last("scrape-content"),
+		}
+		if err := opts.scrape.Validate(); err != nil {
+			errors = append(errors, fmt.Errorf("error processing %s - %s", uri, err.Error()))
+		}
+	}
+
+	// How to identify items, "#id link".
+	if values := entry.Directives("id"); len(values) > 0 {
+		opts.identity = values[len(values)-1]
+		if err := withstate.ValidIdentity(opts.identity); err != nil {
+			errors = append(errors, fmt.Errorf("error processing %s - %s", uri, err.Error()))
+		}
+	}
+
+	// How to handle items without content, "#empty-content fetch".
+	if values := entry.Directives("empty-content"); len(values) > 0 {
+		opts.empty = values[len(values)-1]
+		if err := validEmptyPolicy(opts.empty); err != nil {
+			errors = append(errors, fmt.Errorf("error processing %s - %s", uri, err.Error()))
+		}
+	}
+
+	// The folder to file items in, "#folder Feeds.{{.Tag}}".
+	if values := entry.Directives("folder"); len(values) > 0 {
+		opts.folder = values[len(values)-1]
+	}
+	opts.tags = entry.Tags()
+
+	// Additional headers, "#header X-Label: news".
+	opts.headers = entry.Directives("header")
+
+	// The address to reply to, "#reply-to steve@example.com", the
+	// last one wins.
+	if values := entry.Directives("reply-to"); len(values) > 0 {
+		opts.replyTo = values[len(values)-1]
+	}
+
+	// The SMTP profile to deliver via, "#smtp gmail".  An invalid
+	// profile will cause delivery to fail, rather than sending via the
+	// wrong route.
+	if values := entry.Directives("smtp"); len(values) > 0 {
+		opts.smtpProfile = values[len(values)-1]
+		if !config.ValidProfile(opts.smtpProfile) {
+			errors = append(errors, fmt.Errorf("error processing %s - invalid SMTP profile %q", uri, opts.smtpProfile))
+		}
+	}
+
+	// The size of the preview to send, "#preview 2p".
+	if values := entry.Directives("preview"); len(values) > 0 {
+		opts.preview = values[len(values)-1]
+	}
+
+	// The command to shrink enclosures with, "#transcode convert - -resize 800x800 jpeg:-".
+	if values := entry.Directives("transcode"); len(values) > 0 {
+		opts.transcode = values[len(values)-1]
+	}
+
+	// The credentials to fetch the feed with, "#auth bob:secret".
+	if values := entry.Directives("auth"); len(values) > 0 {
+		opts.credentials = values[len(values)-1]
+		if !strings.Contains(opts.credentials, ":") {
+			errors = append(errors, fmt.Errorf("error processing %s - invalid #auth, expected \"username:password\"", uri))
+		}
+	}
+
+	// Headers to fetch the feed with, "#request-header X-Api-Key: secret".
+	for _, value := range entry.Directives("request-header") {
+		parts := strings.SplitN(value, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			errors = append(errors, fmt.Errorf("error processing %s - invalid #request-header, expected \"Name: value\"", uri))
+			continue
+		}
+		if opts.request == nil {
+			opts.request = make(http.Header)
+		}
+		opts.request.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+
+	// The User-Agent to fetch the feed with, "#user-agent Mozilla/5.0 ...",
+	// the last one wins.
+	if values := entry.Directives("user-agent"); len(values) > 0 {
+		if opts.request == nil {
+			opts.request = make(http.Header)
+		}
+		opts.request.Set("User-Agent", values[len(values)-1])
+	}
+
+	// Cookies to fetch the feed with, "#cookie session=abc123".
+	var cookies []string
+	for _, value := range entry.Directives("cookie") {
+		if !strings.Contains(value, "=") {
+			errors = append(errors, fmt.Errorf("error processing %s - invalid #cookie, expected \"name=value\"", uri))
+			continue
+		}
+		cookies = append(cookies, value)
+	}
+	if len(cookies) > 0 {
+		if opts.request == nil {
+			opts.request = make(http.Header)
+		}
+		opts.request.Set("Cookie", strings.Join(cookies, "; "))
+	}
+
+	// The proxy to fetch the feed via, "#proxy socks5://127.0.0.1:9050".
+	if values := entry.Directives("proxy"); len(values) > 0 {
+		opts.proxy = values[len(values)-1]
+		if opts.proxy != "direct" {
+			if _, err := network.ParseProxy(opts.proxy); err != nil {
+				errors = append(errors, fmt.Errorf("error processing %s - %s", uri, err.Error()))
+			}
+		}
+	}
+
+	// Who to send items to, which items, and how, "#to bob@example.com",
+	// "#template minimal.tmpl", "#include golang", and "#exclude sponsored".
+	delivery, err := entry.Options()
+	if err != nil {
+		errors = append(errors, err)
+	}
+	opts.delivery = delivery
+
+	return opts, errors
+}
@@ -0,0 +1,321 @@
+// Package plaintext converts HTML content into a readable plain-text
+// rendering, which is used for the text/plain part of our emails.
+//
+// Block-level elements are separated by blank lines, list-items are
+// bulleted, and links are replaced by numbered references which are
+// listed as footnotes at the end of the text.  The text may optionally
+// be wrapped, and the rendering of links and lists changed, via Options.
+package plaintext
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// The ways in which links may be rendered.
+const (
+	// Footnotes replaces links with numbered references, which are
+	// listed at the end of the text.
+	Footnotes = "footnotes"
+
+	// Inline follows each link with its URL, in angle-brackets.
+	Inline = "inline"
+
+	// NoLinks omits the URLs of links entirely.
+	NoLinks = "none"
+)
+
+// Options control the rendering of the text.
+type Options struct {
+
+	// Width is the column at which lines are wrapped, or zero to
+	// leave lines unwrapped.  The contents of <pre> blocks, and words
+	// longer than the width, are never broken.
+	Width int
+
+	// Links is the way in which links are rendered, Footnotes, Inline,
+	// or NoLinks.
+	Links string
+
+	// Bullet is the marker placed before each item of an unordered
+	// list, by default "*".
+	Bullet string
+
+	// Numbered is true if the items of ordered lists should be
+	// numbered, rather than bulleted.
+	Numbered bool
+}
+
+// converter holds our state as we walk the HTML tree.
+type converter struct {
+
+	// opts holds the options we were given.
+	opts Options
+
+	// out holds the text we've generated.
+	out strings.Builder
+
+	// links holds the URLs we've seen, which become our footnotes.
+	links []string
+
+	// col is the width of the current line.
+	col int
+
+	// indent is the prefix of lines wrapped within a list-item, so
+	// that they align with the text of the item rather than its bullet.
+	indent string
+
+	// pre is non-zero when we're within a <pre> block.
+	pre int
+
+	// space is true if the last thing we output was whitespace.
+	space bool
+
+	// pending is true if we've seen whitespace which has not yet been
+	// output, because it might be collapsed.
+	pending bool
+
+	// newlines is the number of consecutive newlines we've output.
+	newlines int
+}
+
+// Convert returns a plain-text rendering of the given HTML.
+func Convert(input string) string {
+	return ConvertWith(input, Options{Links: Footnotes})
+}
+
+// Strip returns the text of the given HTML, without any markup, and
+// without footnotes for the links it contains.
+func Strip(input string) string {
+	return ConvertWith(input, Options{Links: NoLinks})
+}
+
+// ConvertWith returns a plain-text rendering of the given HTML, using
+// the given options.
+func ConvertWith(input string, opts Options) string {
+
+	doc, err := html.Parse(strings.NewReader(input))
+	if err != nil {
+		return input
+	}
+
+	if opts.Bullet == "" {
+		opts.Bullet = "*"
+	}
+
+	c := &converter{space: true, newlines: 2, opts: opts}
+	c.walk(doc)
+
+	text := strings.TrimSpace(c.out.String())
+
+	if len(c.links) > 0 {
+		text += "\n\n"
+		for i, link := range c.links {
+			text += fmt.Sprintf("[%d] %s\n", i+1, link)
+		}
+	}
+
+	return text
+}
+
+// block returns true if the given element should be separated from
+// its surroundings.
+func block(a atom.Atom) bool {
+	switch a {
+	case atom.P, atom.Div, atom.Blockquote, atom.Pre, atom.Ul, atom.Ol,
+		atom.Table, atom.Tr, atom.Section, atom.Article, atom.Header,
+		atom.Footer, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6,
+		atom.Hr, atom.Figure, atom.Dl:
+		return true
+	}
+	return false
+}
+
+// write appends the given string to our output, keeping track of the
+// width of the current line.
+func (c *converter) write(s string) {
+	c.out.WriteString(s)
+	if i := strings.LastIndex(s, "\n"); i >= 0 {
+		c.col = utf8.RuneCountInString(s[i+1:])
+	} else {
+		c.col += utf8.RuneCountInString(s)
+	}
+}
+
+// text appends the given text to our output, collapsing whitespace
+// unless we're inside a <pre> block.  If we're wrapping, lines are
+// broken between words as they reach the wrap column.
+func (c *converter) text(s string) {
+	if c.pre > 0 {
+		c.write(s)
+		c.newlines = 0
+		c.space = strings.HasSuffix(s, "\n")
+		c.pending = false
+		return
+	}
+
+	if strings.TrimLeft(s, " \t\r\n") != s {
+		c.pending = true
+	}
+
+	for i, word := range strings.Fields(s) {
+		if (i > 0 || c.pending) && !c.space {
+			width := c.opts.Width
+			if width > 0 && c.col > len(c.indent) && c.col+1+utf8.RuneCountInString(word) > width {
+				c.write("\n" + c.indent)
+			} else {
+				c.write(" ")
+			}
+		}
+		c.write(word)
+		c.space = false
+		c.pending = false
+		c.newlines = 0
+	}
+
+	if strings.TrimRight(s, " \t\r\n") != s {
+		c.pending = true
+	}
+}
+
+// newline ensures that we have output at least n newlines.
+func (c *converter) newline(n int) {
+	for c.newlines < n {
+		c.write("\n")
+		c.newlines++
+	}
+	c.space = true
+}
+
+// walk processes the given node, and its children.
+func (c *converter) walk(n *html.Node) {
+
+	switch n.Type {
+	case html.TextNode:
+		c.text(n.Data)
+		return
+	case html.CommentNode:
+		return
+	case html.ElementNode:
+	default:
+		c.children(n)
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Head, atom.Title:
+		return
+	case atom.Br:
+		c.newline(1)
+		return
+	case atom.Img:
+		alt := strings.TrimSpace(attr(n, "alt"))
+		if alt != "" {
+			c.text("[" + alt + "]")
+		}
+		return
+	case atom.Hr:
+		c.newline(2)
+		c.text("----")
+		c.newline(2)
+		return
+	case atom.Li:
+		c.newline(1)
+		marker := c.marker(n)
+		c.text(marker + " ")
+		indent := c.indent
+		c.indent += strings.Repeat(" ", utf8.RuneCountInString(marker)+1)
+		c.children(n)
+		c.indent = indent
+		c.newline(1)
+		return
+	case atom.A:
+		c.children(n)
+		href := strings.TrimSpace(attr(n, "href"))
+		if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(href, "javascript:") {
+			return
+		}
+		switch c.opts.Links {
+		case Footnotes:
+			c.links = append(c.links, href)
+			c.text(fmt.Sprintf("[%d]", len(c.links)))
+		case Inline:
+			// There's no need to repeat a URL which is its own text.
+			if strings.TrimSpace(content(n)) != href {
+				c.text(" <" + href + ">")
+			}
+		}
+		return
+	case atom.Pre:
+		c.newline(2)
+		c.pre++
+		c.children(n)
+		c.pre--
+		c.newline(2)
+		return
+	}
+
+	if block(n.DataAtom) {
+		c.newline(2)
+		c.children(n)
+		c.newline(2)
+		return
+	}
+
+	c.children(n)
+}
+
+// marker returns the marker to place before the given list-item, which
+// is either a bullet or, within an ordered list, its number.
+func (c *converter) marker(n *html.Node) string {
+
+	if !c.opts.Numbered || n.Parent == nil || n.Parent.DataAtom != atom.Ol {
+		return c.opts.Bullet
+	}
+
+	number := 1
+	if start, err := strconv.Atoi(attr(n.Parent, "start")); err == nil {
+		number = start
+	}
+	for sibling := n.PrevSibling; sibling != nil; sibling = sibling.PrevSibling {
+		if sibling.Type == html.ElementNode && sibling.DataAtom == atom.Li {
+			number++
+		}
+	}
+	return strconv.Itoa(number) + "."
+}
+
+// content returns the text contained within the given node.
+func content(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+
+	var out strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		out.WriteString(content(child))
+	}
+	return out.String()
+}
+
+// children processes each child of the given node.
+func (c *converter) children(n *html.Node) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		c.walk(child)
+	}
+}
+
+// attr returns the value of the named attribute of the given node.
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
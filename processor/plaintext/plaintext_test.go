@@ -0,0 +1,92 @@
+package plaintext
+
+import (
+	"testing"
+)
+
+// TestConvert tests some simple conversions.
+func TestConvert(t *testing.T) {
+
+	type TestCase struct {
+		Input  string
+		Output string
+	}
+
+	tests := []TestCase{
+		{Input: "Hello, World", Output: "Hello, World"},
+		{Input: "<p>One</p><p>Two</p>", Output: "One\n\nTwo"},
+		{Input: "Line<br>Break", Output: "Line\nBreak"},
+		{Input: "<p>Lots   of\n\n   space</p>", Output: "Lots of space"},
+		{Input: "<ul><li>One</li><li>Two</li></ul>", Output: "* One\n* Two"},
+		{Input: "<p>x<script>alert('x');</script>y</p>", Output: "xy"},
+		{Input: "<p>Fish &amp; Chips</p>", Output: "Fish & Chips"},
+		{Input: "<img src=\"x.png\" alt=\"A cat\">", Output: "[A cat]"},
+		{Input: "<pre>a\n  b</pre>", Output: "a\n  b"},
+		{Input: "Visit <a href=\"https://steve.fi/\">my site</a> today.",
+			Output: "Visit my site[1] today.\n\n[1] https://steve.fi/\n"},
+		{Input: "<a href=\"#top\">Top</a>", Output: "Top"},
+	}
+
+	for _, test := range tests {
+		out := Convert(test.Input)
+		if out != test.Output {
+			t.Errorf("converting %q - expected %q, got %q", test.Input, test.Output, out)
+		}
+	}
+}
+
+// TestStrip ensures links are not footnoted when stripping.
+func TestStrip(t *testing.T) {
+
+	out := Strip("<p>Visit <a href=\"https://steve.fi/\">my <b>site</b></a></p>")
+	if out != "Visit my site" {
+		t.Errorf("unexpected output: %q", out)
+	}
+}
+
+// TestConvertWith tests the options which control our rendering.
+func TestConvertWith(t *testing.T) {
+
+	type TestCase struct {
+		Input  string
+		Opts   Options
+		Output string
+	}
+
+	tests := []TestCase{
+		{Input: "<p>The quick brown fox jumps over the lazy dog</p>",
+			Opts:   Options{Width: 20},
+			Output: "The quick brown fox\njumps over the lazy\ndog"},
+		{Input: "<p>Supercalifragilistic expialidocious</p>",
+			Opts:   Options{Width: 10},
+			Output: "Supercalifragilistic\nexpialidocious"},
+		{Input: "<pre>The quick brown fox jumps</pre>",
+			Opts:   Options{Width: 10},
+			Output: "The quick brown fox jumps"},
+		{Input: "<ul><li>One two three four</li></ul>",
+			Opts:   Options{Width: 12},
+			Output: "* One two\n  three four"},
+		{Input: "<ol start=\"3\"><li>One</li><li>Two</li></ol><ul><li>Three</li></ul>",
+			Opts:   Options{Bullet: "-", Numbered: true},
+			Output: "3. One\n4. Two\n\n- Three"},
+		{Input: "<ol><li>One two three four</li></ol>",
+			Opts:   Options{Width: 12, Numbered: true},
+			Output: "1. One two\n   three\n   four"},
+		{Input: "Visit <a href=\"https://steve.fi/\">my site</a> today.",
+			Opts:   Options{Links: Inline},
+			Output: "Visit my site <https://steve.fi/> today."},
+		{Input: "Visit <a href=\"https://steve.fi/\">https://steve.fi/</a> today.",
+			Opts:   Options{Links: Inline},
+			Output: "Visit https://steve.fi/ today."},
+		{Input: "Visit <a href=\"https://steve.fi/\">my site</a> today.",
+			Opts:   Options{Links: NoLinks},
+			Output: "Visit my site today."},
+	}
+
+	for _, test := range tests {
+		out := ConvertWith(test.Input, test.Opts)
+		if out != test.Output {
+			t.Errorf("converting %q - expected %q, got %q", test.Input, test.Output, out)
+		}
+	}
+}
@@ -4,11 +4,22 @@
 package processor
 
 import (
+	"context"
 	"fmt"
+	"html"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/k3a/html2text"
+	"github.com/mmcdole/gofeed"
+	"github.com/skx/rss2email/config"
 	"github.com/skx/rss2email/feedlist"
+	"github.com/skx/rss2email/feedstate"
 	"github.com/skx/rss2email/processor/emailer"
+	"github.com/skx/rss2email/processor/plaintext"
+	"github.com/skx/rss2email/processor/rewrite"
 	"github.com/skx/rss2email/withstate"
 )
 
@@ -20,11 +31,68 @@ type Processor struct {
 
 	// verbose denotes how verbose we should be in execution.
 	verbose bool
+
+	// dryRun causes emails to be rendered and shown, rather than sent.
+	dryRun bool
+
+	// dryRunDirectory is the location to which dry-run emails are
+	// written, if empty they're written to STDOUT.
+	dryRunDirectory string
+
+	// lowMemory reduces our memory usage, at the cost of speed.
+	lowMemory bool
+
+	// tags restricts us to processing the feeds with these tags, if
+	// any are set.
+	tags []string
+
+	// drip is the minimum time between deliveries, if non-zero.
+	drip time.Duration
+
+	// lastDelivery is the time of our most recent delivery, when
+	// deliveries are paced.
+	lastDelivery time.Time
+
+	// deadline is the time by which the run should finish, if it has
+	// a budget, we don't wait beyond it to pace our deliveries.
+	deadline time.Time
+
+	// ctx may be cancelled to stop processing, after the current item.
+	ctx context.Context
+
+	// failureLimit is the number of runs in a row a feed may fail,
+	// before it is left alone for failureCooldown.
+	failureLimit    int
+	failureCooldown time.Duration
+
+	// version is our version, which may be recorded in our emails.
+	version string
+
+	// updateMoved causes feeds which have moved permanently to be
+	// updated in the feed-list, rather than reported.
+	updateMoved bool
+
+	// feed is the only feed to process, rather than those of the
+	// feed-list, if it is set.
+	feed string
+
+	// skip holds the feeds which shouldn't be processed, such as those
+	// which the daemon hasn't yet scheduled, or whose updates are pushed
+	// to us.
+	skip map[string]bool
 }
 
+// notFoundLimit is the number of consecutive runs in which a feed must
+// return "404 Not Found" before we disable it.
+const notFoundLimit = 3
+
+// lowMemoryFeedLimit is the maximum size of a feed we'll download
+// when running in low-memory mode.
+const lowMemoryFeedLimit = 2 * 1024 * 1024
+
 // New creates a new Processor object
 func New() *Processor {
-	return &Processor{send: true}
+	return &Processor{send: true, ctx: context.Background()}
 }
 
 // ProcessFeeds is the main workhorse here, we process each feed and send
@@ -39,14 +107,206 @@ func (p *Processor) ProcessFeeds(recipients []string) []error {
 
 	// Get the feed-list, from the default location.
 	list := feedlist.New("")
+	if err := list.Err(); err != nil {
+		return []error{err}
+	}
+
+	// If the last run ran out of time we resume where it stopped.
+	budget, err := runBudget()
+	if err != nil {
+		return []error{err}
+	}
+	started := time.Now()
+	checkpoint := p.checkpointName()
+	if budget > 0 {
+		p.deadline = started.Add(budget)
+	}
+
+	// Deliveries may be paced, rather than sent in a burst.
+	p.drip, err = dripInterval()
+	if err != nil {
+		return []error{err}
+	}
+	p.lastDelivery = loadLastDelivery()
+
+	// Feeds which keep failing are left alone for a while.
+	p.failureLimit, p.failureCooldown, err = breakerSettings()
+	if err != nil {
+		return []error{err}
+	}
+	var cooling, waiting []string
+	feeds := resume(list.Feeds(), loadCheckpoint(checkpoint))
+
+	// A single feed is processed on its own, using the settings it
+	// has in the feed-list, if it is there.  Such runs never resume.
+	resumable := p.feed == ""
+	if !resumable {
+		feeds = []feedlist.Entry{{URL: p.feed}}
+		for _, entry := range list.Feeds() {
+			if entry.URL == p.feed {
+				feeds = []feedlist.Entry{entry}
+			}
+		}
+	}
+
+	// Collect garbage more aggressively if we're short of memory.
+	if p.lowMemory {
+		old := debug.SetGCPercent(20)
+		defer debug.SetGCPercent(old)
+	}
 
 	// For each entry in the list ..
-	for _, uri := range list.Entries() {
+	completed := true
+	for _, entry := range feeds {
+
+		uri := entry.URL
+
+		// Credentials within the URL must not be shown.
+		shown := feedlist.Redact(uri)
+
+		// Stop once we've run out of time, recording where we
+		// should start next time.
+		if budget > 0 && time.Since(started) > budget && !p.dryRun && resumable {
+			if p.verbose {
+				fmt.Printf("Run budget of %s exceeded, the next run will resume from %s\n", budget, shown)
+			}
+			if err := saveCheckpoint(checkpoint, uri); err != nil {
+				errors = append(errors, err)
+			}
+			completed = false
+			break
+		}
+
+		// Skip feeds which have been disabled.  Their items are
+		// remembered, so that they aren't sent again if the feed
+		// is resumed.
+		if entry.Disabled() {
+			if p.verbose {
+				fmt.Printf("Skipping disabled feed: %s\n", shown)
+			}
+			if !p.dryRun {
+				withstate.Touch(entry.State().Seen...)
+			}
+			continue
+		}
+
+		// Skip feeds without the tags we're processing.  They're
+		// processed by other, perhaps less frequent, runs so their
+		// state mustn't be pruned by this one.
+		if len(p.tags) > 0 && !entry.HasTag(p.tags...) {
+			if p.verbose {
+				fmt.Printf("Skipping untagged feed: %s\n", shown)
+			}
+			if !p.dryRun {
+				withstate.Touch(entry.State().Seen...)
+			}
+			continue
+		}
+
+		// Skip feeds we've been told to.
+		if p.skip[uri] {
+			if p.verbose {
+				fmt.Printf("Skipping feed which isn't due: %s\n", shown)
+			}
+			if !p.dryRun {
+				withstate.Touch(entry.State().Seen...)
+			}
+			continue
+		}
+
+		// Skip feeds which keep failing, until they've cooled off.
+		// Their items are still present, as far as we know.  A feed
+		// we were asked to process alone is never skipped.
+		if state := entry.State(); state.Cooling(time.Now()) && resumable {
+			if p.verbose {
+				fmt.Printf("Skipping failing feed: %s, until %s\n", shown, state.CoolUntil.Format(time.RFC3339))
+			}
+			cooling = append(cooling, shown)
+			if !p.dryRun {
+				withstate.Touch(state.Seen...)
+			}
+			continue
+		}
+
+		// Skip feeds whose publishers asked us to wait, via the
+		// feed itself or Retry-After.
+		if state := entry.State(); state.Waiting(time.Now()) && resumable {
+			if p.verbose {
+				fmt.Printf("Skipping feed: %s, until %s, as its publisher asked\n", shown, state.NextFetch.Format(time.RFC3339))
+			}
+			waiting = append(waiting, shown)
+			if !p.dryRun {
+				withstate.Touch(state.Seen...)
+			}
+			continue
+		}
+
+		// Find the settings for this feed.
+		opts, optErrors := options(entry)
+		errors = append(errors, optErrors...)
+
+		// Send its items to its own recipients, if it has them.
+		to := recipients
+		if len(opts.delivery.To) > 0 {
+			to = opts.delivery.To
+		}
 
 		// Handle it.
-		err := p.processURL(uri, recipients)
+		err := p.processURL(uri, opts, to)
+
+		// If we were interrupted this feed is processed again
+		// by the next run, along with those which follow it.
+		if p.ctx.Err() != nil {
+			if !resumable {
+				errors = append(errors, fmt.Errorf("interrupted while processing %s", shown))
+				break
+			}
+			errors = append(errors, fmt.Errorf("interrupted, the next run will resume from %s", shown))
+			if !p.dryRun {
+				if err := saveCheckpoint(checkpoint, uri); err != nil {
+					errors = append(errors, err)
+				}
+			}
+			completed = false
+			break
+		}
+
 		if err != nil {
-			errors = append(errors, fmt.Errorf("error processing %s - %s", uri, err))
+			errors = append(errors, fmt.Errorf("error processing %s - %s", shown, err))
+		}
+
+		// Disable feeds which have gone away, and follow those
+		// which have moved.
+		if !p.dryRun {
+			errors = append(errors, p.checkGone(list, uri, err, to)...)
+			if err == nil {
+				errors = append(errors, p.checkMoved(list, uri)...)
+			}
+		}
+
+		// Return the memory used by this feed before we
+		// move on to the next.
+		if p.lowMemory {
+			debug.FreeOSMemory()
+		}
+	}
+
+	if p.verbose && len(cooling) > 0 {
+		fmt.Printf("Skipped %d failing feeds: %s\n", len(cooling), strings.Join(cooling, ", "))
+	}
+	if p.verbose && len(waiting) > 0 {
+		fmt.Printf("Skipped %d feeds which asked us to wait: %s\n", len(waiting), strings.Join(waiting, ", "))
+	}
+
+	// In dry-run mode we don't touch our state.
+	if p.dryRun {
+		return errors
+	}
+
+	// The next run starts from the top, if we got to the end.
+	if completed && resumable {
+		if err := saveCheckpoint(checkpoint, ""); err != nil {
+			errors = append(errors, err)
 		}
 	}
 
@@ -64,23 +324,163 @@ func (p *Processor) ProcessFeeds(recipients []string) []error {
 	return errors
 }
 
+// checkGone updates the state of the given feed, based upon the result
+// of fetching it, and disables it if it has gone away.
+//
+// A feed which returns "410 Gone" is disabled immediately, one which
+// returns "404 Not Found" is disabled once that has happened on
+// notFoundLimit consecutive runs.  When a feed is disabled the
+// recipients are notified, once.
+func (p *Processor) checkGone(list *feedlist.FeedList, uri string, fetchErr error, recipients []string) []error {
+
+	var errors []error
+
+	state := feedstate.Load(uri)
+
+	herr, ok := fetchErr.(*feedlist.HTTPError)
+	if !ok || herr.StatusCode != http.StatusNotFound {
+
+		// Reset the count of failures, if it was set.
+		if state.NotFound > 0 {
+			state.NotFound = 0
+			if err := state.Save(); err != nil {
+				errors = append(errors, err)
+			}
+		}
+
+		if !ok || herr.StatusCode != http.StatusGone {
+			return errors
+		}
+	} else {
+		state.NotFound++
+		if err := state.Save(); err != nil {
+			errors = append(errors, err)
+		}
+
+		if state.NotFound < notFoundLimit {
+			return errors
+		}
+	}
+
+	// The feed has gone, so disable it.
+	reason := fmt.Sprintf("%s on %s", herr.Status, time.Now().Format("2006-01-02"))
+	list.Disable(uri, reason)
+	if err := list.Save(); err != nil {
+		return append(errors, err)
+	}
+
+	shown := feedlist.Redact(uri)
+	msg := fmt.Sprintf("The feed %s has been disabled, because it returned %s.", shown, herr.Status)
+	errors = append(errors, fmt.Errorf("%s", msg))
+
+	// Let the recipients know.
+	if p.send {
+		feed := &gofeed.Feed{Title: shown, Link: shown}
+		item := withstate.FeedItem{Item: &gofeed.Item{
+			Title:   "Feed disabled: " + shown,
+			Link:    shown,
+			GUID:    "disabled:" + shown,
+			Content: "<p>" + html.EscapeString(msg) + "</p><p>Once the problem is resolved remove the '#disabled' comment from your feed-list to resume polling it.</p>",
+		}}
+
+		err := p.Deliver(feed, item, recipients)
+		if err != nil {
+			errors = append(errors, err)
+		}
+	}
+
+	return errors
+}
+
 // processURL takes an URL as input, fetches the contents, and then
 // processes each feed item found within it.
 //
-// Feed items which are new/unread will generate an email.
-func (p *Processor) processURL(input string, recipients []string) error {
+// Feed items which are new/unread will generate an email, after the
+// given rewrite-rules have been applied to them.
+func (p *Processor) processURL(input string, opts feedOptions, recipients []string) error {
 
 	// Show what we're doing.
 	if p.verbose {
-		fmt.Printf("Fetching: %s\n", input)
+		fmt.Printf("Fetching: %s\n", feedlist.Redact(input))
+	}
+
+	// Fetch with the credentials of the feed, if it has any.
+	target := input
+	if opts.credentials != "" {
+		var err error
+		target, err = feedlist.WithCredentials(input, opts.credentials)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Fetch the feed for the input URL
-	feed, err := feedlist.Feed(input)
+	limit := int64(0)
+	if p.lowMemory {
+		limit = lowMemoryFeedLimit
+	}
+	fetched := time.Now()
+	state := feedstate.Load(input)
+	feed, err := feedlist.FeedWith(target, feedlist.FetchOptions{Limit: limit, State: state, Header: opts.request, Proxy: opts.proxy, Context: p.ctx, TLS: opts.tls, Scrape: opts.scrape, Revalidate: p.feed != ""})
+
+	// Record failures, so that a feed which keeps failing is left
+	// alone for a while.  Being interrupted isn't the feed's fault.
+	if err != nil && err != feedlist.ErrNotModified {
+		if p.dryRun || p.ctx.Err() != nil {
+			return err
+		}
+		if herr, ok := err.(*feedlist.HTTPError); ok && herr.RetryAfter > 0 &&
+			(herr.StatusCode == http.StatusTooManyRequests || herr.StatusCode == http.StatusServiceUnavailable) {
+			state.Defer(herr.RetryAfter, time.Now())
+		}
+		if state.Failed(err, p.failureLimit, p.failureCooldown, time.Now()) {
+			err = fmt.Errorf("%s\nThis feed has failed %d runs in a row, so it won't be fetched again until %s", err.Error(), state.Failures, state.CoolUntil.Format(time.RFC3339))
+		}
+		if serr := state.Save(); serr != nil {
+			return serr
+		}
+		return err
+	}
+	state.Succeeded()
+
+	// If the feed hasn't changed there's nothing new, but its items
+	// are still present.
+	if err == feedlist.ErrNotModified {
+		if p.verbose {
+			fmt.Printf("\tNot modified\n")
+		}
+		if p.dryRun {
+			return nil
+		}
+		withstate.Touch(state.Seen...)
+		state.LastFetched = fetched
+		state.NextFetch = state.Schedule.Next(fetched)
+		return state.Save()
+	}
 	if err != nil {
 		return err
 	}
 
+	// Items may be sent again, if they reappear long after they
+	// were first seen.
+	days, err := strconv.Atoi(config.Get(config.ResendAfter))
+	if err != nil || days < 0 {
+		return fmt.Errorf("invalid %s %q, expected a number of days", config.ResendAfter, config.Get(config.ResendAfter))
+	}
+	resendAfter := time.Duration(days) * 24 * time.Hour
+
+	// We warn if many items reappear under new GUIDs.
+	storm, err := strconv.Atoi(config.Get(config.DuplicateStorm))
+	if err != nil || storm < 0 || storm > 100 {
+		return fmt.Errorf("invalid %s %q, expected a percentage", config.DuplicateStorm, config.Get(config.DuplicateStorm))
+	}
+	suppressed, churned, deferred := 0, 0, 0
+	var links, seen []string
+
+	// If the way items are identified has changed every item has a new
+	// key, but those we saw last time aren't new.
+	reidentified := state.Identity != opts.identity
+
 	if p.verbose {
 		fmt.Printf("\tFound %d entries\n", len(feed.Items))
 	}
@@ -89,10 +489,63 @@ func (p *Processor) processURL(input string, recipients []string) error {
 	for _, xp := range feed.Items {
 
 		// Wrap it so we can use our helper methods
-		item := withstate.FeedItem{Item: xp}
+		item := withstate.FeedItem{Item: xp, Identity: opts.identity}
+		seen = append(seen, item.Key())
+
+		// A new item which has the link of one we saw last time
+		// suggests that the feed changed its GUIDs.
+		isNew := item.IsNew()
+		if isNew && state.HadLink(item.Link) {
+			if reidentified {
+				if p.verbose {
+					fmt.Printf("\t\tRe-identified Entry: %s\n", item.Title)
+				}
+				isNew = false
+			} else {
+				churned++
+			}
+		}
+
+		// Items which have been promoted again are new once more.
+		if !isNew && resendAfter > 0 && item.Reappeared(state.LastFetched, resendAfter) {
+			if p.verbose {
+				fmt.Printf("\t\tReappeared Entry: %s\n", item.Title)
+			}
+			if !p.dryRun {
+				err = item.Forget()
+				if err != nil {
+					return err
+				}
+			}
+			isNew = true
+		}
 
-		// If we've not already notified about this one.
-		if item.IsNew() {
+		// Otherwise we suppress the duplicate.
+		if !isNew {
+			suppressed++
+		}
+
+		// Items the feed's filters reject are never sent, but
+		// they're recorded, so they aren't considered again.
+		if isNew && !opts.delivery.Wanted(xp.Title, xp.Description+" "+xp.Content) {
+			if p.verbose {
+				fmt.Printf("\t\tFiltered Entry: %s\n", item.Title)
+			}
+			isNew = false
+		} else if isNew {
+
+			// Pace our deliveries, waiting for our turn, or
+			// leaving this item for a later run if the run's
+			// budget doesn't allow that.  Its link isn't
+			// recorded, so it won't look like a changed GUID
+			// when we return to it.
+			if p.deferDelivery() {
+				if p.verbose {
+					fmt.Printf("\t\tDeferred Entry: %s\n", item.Title)
+				}
+				deferred++
+				continue
+			}
 
 			// Show the new item.
 			if p.verbose {
@@ -100,34 +553,167 @@ func (p *Processor) processURL(input string, recipients []string) error {
 			}
 
 			// If we're supposed to send email then do that
-			if p.send {
-				content, err := item.HTMLContent()
-				if err != nil {
-					content = item.RawContent()
-				}
+			if p.send || p.dryRun {
 
-				// Convert the content to text.
-				text := html2text.HTML2Text(content)
+				// Rewrite a copy of the item, so that the
+				// identity of the original is unchanged.
+				rewritten := *xp
+				rewrite.ApplyAll(opts.rules, &rewritten)
 
-				// Send the mail
-				helper := emailer.New(feed, item)
-				err = helper.Sendmail(recipients, text, content)
+				// Items without content may be filled in,
+				// or skipped.
+				fill, err := p.fillEmpty(&rewritten, opts.empty)
 				if err != nil {
 					return err
 				}
+
+				if fill {
+					err = p.deliver(feed, withstate.FeedItem{Item: &rewritten, Identity: opts.identity}, recipients, opts, true)
+					if err != nil {
+						return err
+					}
+					err = p.delivered()
+					if err != nil {
+						return err
+					}
+				}
 			}
 		}
+		links = append(links, item.Link)
+
+		// A dry-run never records state, so that the item
+		// will be processed for real next time.
+		if p.dryRun {
+			continue
+		}
 
 		// Mark the item as having been seen, after the
 		// email was sent.
 		//
-		// This does run the risk that sending mail
-		// fails, due to error, and that keeps happening
-		// forever...
-		item.RecordSeen()
+		// If delivery failed we don't reach here, so the
+		// item will be retried on the next run; deliveries
+		// which succeeded were recorded, and won't repeat.
+		err = item.RecordSeen()
+		if err != nil {
+			return err
+		}
+	}
+
+	// A feed which changed the GUIDs of its items will flood the
+	// recipients, so make sure somebody notices.
+	var warning error
+	stormed := storm > 0 && churned > 1 && churned*100 > storm*len(feed.Items)
+	if stormed {
+		warning = fmt.Errorf("possible duplicate storm, %d of %d items reappeared with new GUIDs", churned, len(feed.Items))
 	}
 
-	return nil
+	if p.verbose {
+		fmt.Printf("\tSuppressed %d seen entries, %d entries reappeared with new GUIDs\n", suppressed, churned)
+		if deferred > 0 {
+			fmt.Printf("\tDeferred %d entries, to pace deliveries\n", deferred)
+		}
+	}
+
+	// If we left items for later the next fetch mustn't be skipped
+	// because the feed is unchanged, or because it asked us to wait.
+	state.NextFetch = state.Schedule.Next(fetched)
+	if deferred > 0 {
+		state.ETag = ""
+		state.LastModified = ""
+		state.NextFetch = time.Time{}
+	}
+
+	// Record when we fetched the feed, so that we can tell which
+	// items were missing from it, along with our statistics.
+	if !p.dryRun {
+		state.LastFetched = fetched
+		state.Dedup.Record(len(feed.Items), suppressed, churned, stormed)
+		state.SetLinks(links)
+		state.Seen = seen
+		state.Identity = opts.identity
+		if err := state.Save(); err != nil {
+			return err
+		}
+		if err := feedstate.NewSnapshot(input, feed).Save(); err != nil {
+			return err
+		}
+	}
+
+	return warning
+}
+
+// Deliver renders the email for the given item, and sends it to each
+// of the recipients.
+//
+// In dry-run mode the email is shown rather than being sent.  No state
+// is consulted, or updated, here.
+func (p *Processor) Deliver(feed *gofeed.Feed, item withstate.FeedItem, recipients []string) error {
+	return p.deliver(feed, item, recipients, feedOptions{}, false)
+}
+
+// deliver renders the email for the given item, using the settings of
+// its feed, and sends it to each of the recipients.  If deduplicate is
+// true deliveries are recorded against the item, and those made
+// previously are skipped.
+func (p *Processor) deliver(feed *gofeed.Feed, item withstate.FeedItem, recipients []string, opts feedOptions, deduplicate bool) error {
+
+	content, err := item.HTMLContent()
+	if err != nil {
+		content = item.RawContent()
+	}
+
+	// Convert the content to text.
+	format, err := textOptions()
+	if err != nil {
+		return err
+	}
+	text := plaintext.ConvertWith(content, format)
+
+	helper := emailer.New(feed, item)
+	helper.SetLowMemory(p.lowMemory)
+	helper.SetDeduplicate(deduplicate)
+	helper.SetHeaders(opts.headers)
+	helper.SetSource(opts.source)
+	helper.SetReplyTo(opts.replyTo)
+	helper.SetSMTPProfile(opts.smtpProfile)
+	helper.SetPreview(opts.preview)
+	helper.SetTranscode(opts.transcode)
+	helper.SetFolder(opts.folder)
+	helper.SetTags(opts.tags)
+	helper.SetTemplate(opts.delivery.Template)
+	helper.SetVersion(p.version)
+
+	// Show the mail, rather than sending it.
+	if p.dryRun {
+		return helper.DryRun(recipients, text, content, p.dryRunDirectory)
+	}
+
+	// Send the mail
+	return helper.Sendmail(recipients, text, content)
+}
+
+// textOptions returns the options used to render the text part of our
+// emails, as configured.
+func textOptions() (plaintext.Options, error) {
+
+	width, err := strconv.Atoi(config.Get(config.TextWrap))
+	if err != nil || width < 0 {
+		return plaintext.Options{}, fmt.Errorf("invalid %s %q, expected a column number", config.TextWrap, config.Get(config.TextWrap))
+	}
+
+	links := config.Get(config.TextLinks)
+	switch links {
+	case plaintext.Footnotes, plaintext.Inline, plaintext.NoLinks:
+	default:
+		return plaintext.Options{}, fmt.Errorf("invalid %s %q, expected \"footnotes\", \"inline\", or \"none\"", config.TextLinks, links)
+	}
+
+	return plaintext.Options{
+		Width:    width,
+		Links:    links,
+		Bullet:   config.Get(config.TextBullet),
+		Numbered: config.Get(config.TextNumbered) == "true",
+	}, nil
 }
 
 // SetVerbose updates the verbosity state of this object.
@@ -140,3 +726,65 @@ func (p *Processor) SetVerbose(state bool) {
 func (p *Processor) SetSendEmail(state bool) {
 	p.send = state
 }
+
+// SetDryRun updates the state of this object, when the dry-run flag is
+// true emails are rendered and shown rather than being sent, and no
+// state is updated.
+func (p *Processor) SetDryRun(state bool) {
+	p.dryRun = state
+}
+
+// SetDryRunDirectory sets the directory to which dry-run emails are
+// written, as `.eml` files.  If empty they are written to STDOUT.
+func (p *Processor) SetDryRunDirectory(dir string) {
+	p.dryRunDirectory = dir
+}
+
+// SetTags restricts processing to the feeds which have any of the given
+// tags.  If no tags are given all feeds are processed.
+func (p *Processor) SetTags(tags []string) {
+	p.tags = tags
+}
+
+// SetContext sets the context of our run, when it is cancelled we stop
+// fetching feeds, abandoning the one in progress.
+func (p *Processor) SetContext(ctx context.Context) {
+	p.ctx = ctx
+}
+
+// SetUpdateMoved controls whether feeds which have moved permanently are
+// updated in the feed-list, rather than just reported.
+func (p *Processor) SetUpdateMoved(state bool) {
+	p.updateMoved = state
+}
+
+// SetFeed causes only the given feed to be processed, rather than those
+// of the feed-list.  It may be a file:// URL, or feedlist.Stdin.
+//
+// Such a feed is fetched even if it has been failing, or asked us to
+// wait, and regardless of our copy of it, since we've been told to.
+func (p *Processor) SetFeed(uri string) {
+	p.feed = uri
+}
+
+// SetSkip causes the given feeds to be skipped, such as those which the
+// daemon hasn't yet scheduled, or whose updates are pushed to us via
+// WebSub.  Their items are still present, as far as we know.
+func (p *Processor) SetSkip(feeds []string) {
+	p.skip = make(map[string]bool)
+	for _, feed := range feeds {
+		p.skip[feed] = true
+	}
+}
+
+// SetVersion records our version, which is added to the headers of our
+// emails if INSTANCE_HEADERS is set.
+func (p *Processor) SetVersion(version string) {
+	p.version = version
+}
+
+// SetLowMemory updates the state of this object, when the low-memory
+// flag is true we try to minimize our memory usage.
+func (p *Processor) SetLowMemory(state bool) {
+	p.lowMemory = state
+}
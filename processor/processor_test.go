@@ -0,0 +1,82 @@
+package processor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/skx/rss2email/config"
+)
+
+// TestMain stores our state beneath a temporary directory, which is
+// shared by every test since the state directories are only found once.
+func TestMain(m *testing.M) {
+
+	dir, err := ioutil.TempDir("", "processor")
+	if err != nil {
+		fmt.Printf("failed to create temporary directory: %s\n", err)
+		os.Exit(1)
+	}
+	config.SetDirectory(dir)
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// feedServer serves an RSS feed containing an item for each of the
+// given names, which it returns along with its URL.
+func feedServer(t *testing.T, names *[]string) string {
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var items strings.Builder
+		for _, name := range *names {
+			fmt.Fprintf(&items, `<item><title>%s</title><guid>%s-%s</guid><link>https://example.com/%s</link><description>About %s</description></item>`, name, r.URL.Path, name, name, name)
+		}
+		fmt.Fprintf(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>Test</title><link>https://example.com/</link>%s</channel></rss>`, items.String())
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/" + strings.ReplaceAll(t.Name(), "/", "-")
+}
+
+// sent returns the number of emails written to the given dry-run
+// directory.
+func sent(t *testing.T, dir string) int {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("failed to read %s: %s", dir, err)
+	}
+	return len(files)
+}
+
+// TestReidentified tests that changing how items are identified doesn't
+// send the items of the feed again, only those which are new.
+func TestReidentified(t *testing.T) {
+
+	names := []string{"one", "two"}
+	uri := feedServer(t, &names)
+	recipients := []string{"steve@example.com"}
+
+	p := New()
+	p.send = false
+	if err := p.processURL(uri, feedOptions{}, recipients); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Items we saw, identified by their links, aren't new.
+	names = append(names, "three")
+	dir := t.TempDir()
+	p = New()
+	p.dryRun = true
+	p.dryRunDirectory = dir
+	if err := p.processURL(uri, feedOptions{identity: "link"}, recipients); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n := sent(t, dir); n != 1 {
+		t.Errorf("expected only the new item to be sent, got %d emails", n)
+	}
+}
@@ -0,0 +1,110 @@
+// Package rewrite implements simple regular-expression based rewriting
+// of feed items, before they are processed.
+//
+// Rules are read from "#rewrite" directives in the feed-list, and take
+// the form:
+//
+//	#rewrite FIELD /REGEXP/REPLACEMENT/
+//
+// The field is one of "title", "link", or "body", and the delimiter may
+// be any character - the first character after the field-name is used.
+// The replacement may refer to sub-matches via $1, ${name}, etc.
+package rewrite
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Rule is a single rewrite rule.
+type Rule struct {
+
+	// Field is the name of the field the rule applies to.
+	Field string
+
+	// Pattern is the regular expression to find.
+	Pattern *regexp.Regexp
+
+	// Replacement is the text which replaces each match.
+	Replacement string
+}
+
+// Parse parses a rule, as found in a "#rewrite" directive.
+func Parse(directive string) (Rule, error) {
+
+	directive = strings.TrimSpace(directive)
+
+	fields := strings.SplitN(directive, " ", 2)
+	if len(fields) != 2 {
+		return Rule{}, fmt.Errorf("malformed rewrite rule %q", directive)
+	}
+
+	field := fields[0]
+	switch field {
+	case "title", "link", "body":
+	default:
+		return Rule{}, fmt.Errorf("unknown field %q in rewrite rule %q", field, directive)
+	}
+
+	// The expression is delimited by its first character.
+	expr := strings.TrimSpace(fields[1])
+	if len(expr) < 3 {
+		return Rule{}, fmt.Errorf("malformed rewrite rule %q", directive)
+	}
+	delim := expr[:1]
+	if !strings.HasSuffix(expr, delim) {
+		return Rule{}, fmt.Errorf("unterminated rewrite rule %q", directive)
+	}
+
+	parts := strings.Split(expr[1:len(expr)-1], delim)
+	if len(parts) != 2 {
+		return Rule{}, fmt.Errorf("malformed rewrite rule %q", directive)
+	}
+
+	re, err := regexp.Compile(parts[0])
+	if err != nil {
+		return Rule{}, fmt.Errorf("invalid regular expression in rewrite rule %q: %s", directive, err.Error())
+	}
+
+	return Rule{Field: field, Pattern: re, Replacement: parts[1]}, nil
+}
+
+// ParseAll parses each of the given directives, returning the rules
+// which were valid along with errors for those which were not.
+func ParseAll(directives []string) ([]Rule, []error) {
+	var rules []Rule
+	var errors []error
+
+	for _, d := range directives {
+		r, err := Parse(d)
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		rules = append(rules, r)
+	}
+	return rules, errors
+}
+
+// Apply applies the rule to the given item.
+func (r Rule) Apply(item *gofeed.Item) {
+	switch r.Field {
+	case "title":
+		item.Title = r.Pattern.ReplaceAllString(item.Title, r.Replacement)
+	case "link":
+		item.Link = r.Pattern.ReplaceAllString(item.Link, r.Replacement)
+	case "body":
+		item.Content = r.Pattern.ReplaceAllString(item.Content, r.Replacement)
+		item.Description = r.Pattern.ReplaceAllString(item.Description, r.Replacement)
+	}
+}
+
+// ApplyAll applies each of the given rules to the item, in order.
+func ApplyAll(rules []Rule, item *gofeed.Item) {
+	for _, r := range rules {
+		r.Apply(item)
+	}
+}
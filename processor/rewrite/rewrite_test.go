@@ -0,0 +1,74 @@
+package rewrite
+
+import (
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// TestParse tests that valid and invalid rules are handled.
+func TestParse(t *testing.T) {
+
+	valid := []string{
+		`title /^\[Sponsored\] //`,
+		`link |http://|https://|`,
+		`body /foo/bar/`,
+	}
+	for _, txt := range valid {
+		_, err := Parse(txt)
+		if err != nil {
+			t.Errorf("unexpected error parsing %q: %s", txt, err)
+		}
+	}
+
+	invalid := []string{
+		``,
+		`title`,
+		`author /a/b/`,
+		`title /a/b`,
+		`title /a/b/c/`,
+		`title /[/b/`,
+	}
+	for _, txt := range invalid {
+		_, err := Parse(txt)
+		if err == nil {
+			t.Errorf("expected error parsing %q", txt)
+		}
+	}
+
+	rules, errs := ParseAll(append(valid, invalid...))
+	if len(rules) != len(valid) || len(errs) != len(invalid) {
+		t.Errorf("unexpected results: %d rules, %d errors", len(rules), len(errs))
+	}
+}
+
+// TestApply tests that rules are applied.
+func TestApply(t *testing.T) {
+
+	rules, errs := ParseAll([]string{
+		`title /^\[Sponsored\] //`,
+		`link |^http://(.*)$|https://$1|`,
+		`body /colour/color/`,
+	})
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	item := &gofeed.Item{
+		Title:       "[Sponsored] Buy things",
+		Link:        "http://example.com/buy",
+		Content:     "A nice colour",
+		Description: "colour!",
+	}
+	ApplyAll(rules, item)
+
+	if item.Title != "Buy things" {
+		t.Errorf("unexpected title: %s", item.Title)
+	}
+	if item.Link != "https://example.com/buy" {
+		t.Errorf("unexpected link: %s", item.Link)
+	}
+	if item.Content != "A nice color" || item.Description != "color!" {
+		t.Errorf("unexpected body: %s / %s", item.Content, item.Description)
+	}
+}
@@ -0,0 +1,140 @@
+package processor
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/skx/rss2email/feedlist"
+	"github.com/skx/rss2email/feedstate"
+)
+
+// The health of a feed, as found by Validate.
+const (
+	StatusOK      = "OK"
+	StatusMoved   = "moved"
+	StatusHTTP    = "HTTP error"
+	StatusParse   = "parse error"
+	StatusFetch   = "fetch error"
+	StatusInvalid = "invalid settings"
+)
+
+// Check describes the health of a single feed.
+type Check struct {
+
+	// URL is the feed, as it appears in the feed-list.
+	URL string
+
+	// Status summarises the health of the feed.
+	Status string
+
+	// Items is the number of items the feed contains, once parsed.
+	Items int
+
+	// MovedTo is where the feed has moved to, if it was redirected
+	// permanently.
+	MovedTo string
+
+	// Err is the reason the feed is broken, if it is.
+	Err error
+}
+
+// Broken returns true if the feed cannot be processed.  A feed which has
+// moved still works, for now.
+func (c Check) Broken() bool {
+	return c.Status != StatusOK && c.Status != StatusMoved
+}
+
+// Validate fetches, and parses, each enabled feed in our feed-list, with
+// its own settings, to find those which are broken.  No items are sent,
+// and the state of the feeds isn't updated.
+//
+// Up to concurrency feeds are fetched at once, and the results are
+// returned in the order of the feed-list.
+func (p *Processor) Validate(concurrency int) ([]Check, error) {
+
+	list := feedlist.New("")
+	if err := list.Err(); err != nil {
+		return nil, err
+	}
+
+	var feeds []feedlist.Entry
+	for _, entry := range list.Feeds() {
+		if entry.Disabled() || (len(p.tags) > 0 && !entry.HasTag(p.tags...)) {
+			continue
+		}
+		feeds = append(feeds, entry)
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	checks := make([]Check, len(feeds))
+	pending := make(chan int)
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range pending {
+				checks[n] = p.validate(feeds[n])
+			}
+		}()
+	}
+
+	for n := range feeds {
+		pending <- n
+	}
+	close(pending)
+	wg.Wait()
+
+	return checks, nil
+}
+
+// validate fetches, and parses, a single feed.
+func (p *Processor) validate(entry feedlist.Entry) Check {
+
+	check := Check{URL: feedlist.Redact(entry.URL)}
+
+	opts, optErrors := options(entry)
+	if len(optErrors) > 0 {
+		check.Status, check.Err = StatusInvalid, optErrors[0]
+		return check
+	}
+
+	target := entry.URL
+	if opts.credentials != "" {
+		var err error
+		target, err = feedlist.WithCredentials(entry.URL, opts.credentials)
+		if err != nil {
+			check.Status, check.Err = StatusInvalid, fmt.Errorf("error processing %s - %s", check.URL, err.Error())
+			return check
+		}
+	}
+
+	// A fresh state makes the request unconditional, and leaves the
+	// real state alone.
+	state := &feedstate.State{}
+	feed, err := feedlist.FeedWith(target, feedlist.FetchOptions{State: state, Header: opts.request, Proxy: opts.proxy, Context: p.ctx, TLS: opts.tls, Scrape: opts.scrape, Revalidate: true})
+	if err != nil {
+		check.Err = err
+		switch err.(type) {
+		case *feedlist.HTTPError:
+			check.Status = StatusHTTP
+		case *feedlist.ParseError:
+			check.Status = StatusParse
+		default:
+			check.Status = StatusFetch
+		}
+		return check
+	}
+
+	check.Status, check.Items = StatusOK, len(feed.Items)
+	if state.MovedTo != "" {
+		if moved := movedURL(entry.URL, state.MovedTo); moved != entry.URL {
+			check.Status, check.MovedTo = StatusMoved, feedlist.Redact(moved)
+		}
+	}
+	return check
+}
@@ -0,0 +1,160 @@
+// Package receipts records the deliveries made to each recipient, so that
+// the user can confirm that mail is flowing.
+//
+// The receipts are stored as a single JSON file within our state
+// directory.
+package receipts
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/skx/rss2email/atomicfile"
+	"github.com/skx/rss2email/config"
+)
+
+// statePrefix holds the path to our file, and is used to allow changes
+// during testing.
+var statePrefix string
+
+// mutex serializes updates to our file.
+var mutex sync.Mutex
+
+// Receipt holds the delivery statistics of a single recipient.
+type Receipt struct {
+
+	// Address is the recipient.
+	Address string `json:"address"`
+
+	// Delivered is the number of messages delivered successfully.
+	Delivered int `json:"delivered"`
+
+	// LastDelivered is the time of the last successful delivery.
+	LastDelivered time.Time `json:"last_delivered"`
+
+	// Failed is the number of messages which couldn't be delivered.
+	Failed int `json:"failed"`
+
+	// LastFailed is the time of the last failed delivery.
+	LastFailed time.Time `json:"last_failed"`
+
+	// LastError is the error of the last failed delivery.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// path returns the file which holds our receipts.
+func path() string {
+	if statePrefix != "" {
+		return statePrefix
+	}
+	return filepath.Join(config.StateDirectory(), "receipts.json")
+}
+
+// read returns the receipts from our file, keyed by address.
+func read() (map[string]*Receipt, error) {
+
+	out := make(map[string]*Receipt)
+
+	data, err := ioutil.ReadFile(path())
+	if os.IsNotExist(err) {
+		return out, nil
+	}
+	if err != nil {
+		return out, err
+	}
+
+	var list []*Receipt
+	err = json.Unmarshal(data, &list)
+	if err != nil {
+		return out, fmt.Errorf("failed to parse %s: %s", path(), err.Error())
+	}
+
+	for _, r := range list {
+		out[r.Address] = r
+	}
+	return out, nil
+}
+
+// All returns the receipts of each recipient, sorted by address.
+func All() ([]Receipt, error) {
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	found, err := read()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Receipt
+	for _, r := range found {
+		out = append(out, *r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Address < out[j].Address
+	})
+	return out, nil
+}
+
+// Record updates the receipts of the given recipients, after a message
+// was sent to them.  If err is non-nil the delivery failed.
+func Record(addresses []string, err error) error {
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	found, rerr := read()
+	if rerr != nil {
+		return rerr
+	}
+
+	now := time.Now()
+	for _, addr := range addresses {
+		r, ok := found[addr]
+		if !ok {
+			r = &Receipt{Address: addr}
+			found[addr] = r
+		}
+
+		if err == nil {
+			r.Delivered++
+			r.LastDelivered = now
+		} else {
+			r.Failed++
+			r.LastFailed = now
+			r.LastError = err.Error()
+		}
+	}
+
+	var list []*Receipt
+	for _, r := range found {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Address < list[j].Address
+	})
+
+	data, merr := json.MarshalIndent(list, "", "  ")
+	if merr != nil {
+		return merr
+	}
+
+	file := path()
+	werr := os.MkdirAll(filepath.Dir(file), os.ModePerm)
+	if werr != nil {
+		return werr
+	}
+
+	// Write atomically, so that a reader never sees a partial file.
+	werr = atomicfile.WriteFile(file, data, 0644)
+	if werr != nil {
+		return fmt.Errorf("failed to write receipts: %s", werr.Error())
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package receipts
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestRecord ensures receipts are recorded, and persisted.
+func TestRecord(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "receipts")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	old := statePrefix
+	statePrefix = filepath.Join(dir, "receipts.json")
+	defer func() { statePrefix = old }()
+
+	all, err := All()
+	if err != nil || len(all) != 0 {
+		t.Fatalf("unexpected initial receipts: %v %v", all, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		err = Record([]string{"steve@example.com", "bob@example.com"}, nil)
+		if err != nil {
+			t.Fatalf("failed to record: %s", err)
+		}
+	}
+	err = Record([]string{"bob@example.com"}, errors.New("mailbox full"))
+	if err != nil {
+		t.Fatalf("failed to record: %s", err)
+	}
+
+	all, err = All()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(all) != 2 || all[0].Address != "bob@example.com" {
+		t.Fatalf("unexpected receipts: %v", all)
+	}
+
+	bob, steve := all[0], all[1]
+	if bob.Delivered != 2 || bob.Failed != 1 || bob.LastError != "mailbox full" || bob.LastFailed.IsZero() {
+		t.Errorf("unexpected receipt: %v", bob)
+	}
+	if steve.Delivered != 2 || steve.Failed != 0 || steve.LastDelivered.IsZero() {
+		t.Errorf("unexpected receipt: %v", steve)
+	}
+}
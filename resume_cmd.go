@@ -0,0 +1,70 @@
+//
+// Resume feeds which were paused.
+//
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/skx/rss2email/feedlist"
+	"github.com/skx/subcommands"
+)
+
+// Structure for our options and state.
+type resumeCmd struct {
+
+	// We embed the NoFlags option, because we accept no command-line flags.
+	subcommands.NoFlags
+}
+
+// Info is part of the subcommand-API
+func (r *resumeCmd) Info() (string, string) {
+	return "resume", `Resume polling feeds which were paused.
+
+Remove the '#disabled' comments from one or more URLs in our feed-list,
+whether they were added by 'rss2email pause', or because the feed
+appeared to have gone away.  Items we saw before the feed was paused
+aren't sent again, but those published meanwhile are new.
+
+Example:
+
+    $ rss2email resume https://blog.steve.fi/index.rss
+`
+}
+
+//
+// Entry-point.
+//
+func (r *resumeCmd) Execute(args []string) int {
+
+	if readOnly("resume feeds") {
+		return 1
+	}
+
+	// Get the feed-list, from the default location.
+	list := feedlist.New("")
+
+	// Enable each feed which is disabled.
+	changed := false
+	for _, uri := range args {
+		if list.IsDisabled(uri) {
+			list.Enable(uri)
+			changed = true
+		}
+	}
+
+	// If we made a change then save it.
+	if changed {
+		if err := list.Save(); err != nil {
+			fmt.Printf("%s\n", err.Error())
+			return 1
+		}
+	} else {
+		fmt.Printf("Feed list unchanged.\n")
+		fmt.Printf("Use 'rss2email list' to check your current feed list.\n")
+	}
+
+	// All done.
+	return 0
+}
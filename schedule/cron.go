@@ -0,0 +1,195 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed cron expression, with the five traditional fields of
+// minute, hour, day of the month, month, and day of the week.
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+
+	// anyDay is true if either of the day fields is "*", in which case
+	// only the other is consulted; otherwise a day matching either of
+	// them will do, as in cron(8).
+	anyDay bool
+}
+
+// field describes the range and names of one of the fields.
+type field struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of the month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: []string{"", "JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}}
+	dowField    = field{name: "day of the week", min: 0, max: 7, names: []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}}
+)
+
+// macros are the shorthands cron(8) understands.
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses a cron expression, such as "0 8 * * MON-FRI", or one
+// of the macros such as "@daily".
+//
+// Each field may be "*", a value, a range such as "1-5", or a list of
+// them such as "1,3,5", and each of those may be followed by a step such
+// as "*/15".  Months and days of the week may be given by name.
+func ParseCron(spec string) (*Cron, error) {
+
+	if m, ok := macros[strings.ToLower(strings.TrimSpace(spec))]; ok {
+		spec = m
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q, expected five fields", spec)
+	}
+
+	c := &Cron{}
+	var err error
+	for i, f := range []struct {
+		def  field
+		bits *uint64
+	}{
+		{minuteField, &c.minute},
+		{hourField, &c.hour},
+		{domField, &c.dom},
+		{monthField, &c.month},
+		{dowField, &c.dow},
+	} {
+		*f.bits, err = f.def.parse(fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q, %s", spec, err.Error())
+		}
+	}
+
+	// Sunday may be 0 or 7.
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.anyDay = fields[2] == "*" || fields[4] == "*"
+
+	if c.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("invalid cron expression %q, it never matches", spec)
+	}
+	return c, nil
+}
+
+// parse returns the values the given field matches, as a bitset.
+func (f field) parse(text string) (uint64, error) {
+
+	var bits uint64
+	for _, part := range strings.Split(text, ",") {
+
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step in %s %q", f.name, part)
+			}
+			step = n
+			part = part[:i]
+		}
+
+		lo, hi := f.min, f.max
+		if part != "*" {
+			var err error
+			bounds := strings.SplitN(part, "-", 2)
+			lo, err = f.value(bounds[0])
+			if err != nil {
+				return 0, err
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				hi, err = f.value(bounds[1])
+				if err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				// As in "5/15", which runs to the end.
+				hi = f.max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("invalid range in %s %q", f.name, part)
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// value parses a single value of the field, which may be a name.
+func (f field) value(text string) (int, error) {
+
+	for i, name := range f.names {
+		if name != "" && strings.EqualFold(text, name) {
+			return i, nil
+		}
+	}
+
+	v, err := strconv.Atoi(text)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s %q, expected %d-%d", f.name, text, f.min, f.max)
+	}
+	return v, nil
+}
+
+// matches returns true if the given bitset includes the value.
+func matches(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
+
+// day returns true if the expression matches the day of the given time.
+func (c *Cron) day(t time.Time) bool {
+	dom := matches(c.dom, t.Day())
+	dow := matches(c.dow, int(t.Weekday()))
+	if c.anyDay {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first time the expression matches after the given
+// time, in the same location, or the zero time if it doesn't match
+// within the next five years.
+func (c *Cron) Next(from time.Time) time.Time {
+
+	loc := from.Location()
+	t := from.Truncate(time.Minute).Add(time.Minute)
+	limit := from.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case !matches(c.month, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.day(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case !matches(c.hour, t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case !matches(c.minute, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,131 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skx/rss2email/feedlist"
+)
+
+// TestParseCron ensures we reject invalid expressions.
+func TestParseCron(t *testing.T) {
+
+	valid := []string{
+		"* * * * *",
+		"0 8 * * MON-FRI",
+		"*/15 9-17 * * 1-5",
+		"0 0 1,15 * *",
+		"30 6 * jan,Jul sun",
+		"0 0 * * 7",
+		"5/10 * * * *",
+		"@daily",
+		"@Hourly",
+	}
+	for _, spec := range valid {
+		if _, err := ParseCron(spec); err != nil {
+			t.Fatalf("%q: unexpected error: %s", spec, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * * SOMEDAY",
+		"0 0 30 2 *",
+		"@sometimes",
+	}
+	for _, spec := range invalid {
+		if _, err := ParseCron(spec); err == nil {
+			t.Fatalf("%q: expected an error", spec)
+		}
+	}
+}
+
+// TestCronNext ensures we find the next matching time.
+func TestCronNext(t *testing.T) {
+
+	type TestCase struct {
+		spec string
+		from string
+		next string
+	}
+
+	// 2024-01-05 is a Friday.
+	tests := []TestCase{
+		{"* * * * *", "2024-01-05 10:00:30", "2024-01-05 10:01"},
+		{"0 8 * * MON-FRI", "2024-01-05 07:59:00", "2024-01-05 08:00"},
+		{"0 8 * * MON-FRI", "2024-01-05 08:00:00", "2024-01-08 08:00"},
+		{"*/15 * * * *", "2024-01-05 10:07:00", "2024-01-05 10:15"},
+		{"0 0 1 * *", "2024-01-05 10:00:00", "2024-02-01 00:00"},
+		{"0 0 * * 7", "2024-01-05 10:00:00", "2024-01-07 00:00"},
+		{"0 12 29 2 *", "2024-03-01 00:00:00", "2028-02-29 12:00"},
+		{"@yearly", "2024-12-31 23:59:00", "2025-01-01 00:00"},
+
+		// Either day field may match, if neither is "*".
+		{"0 0 13 * FRI", "2024-01-05 10:00:00", "2024-01-12 00:00"},
+		{"0 0 6 * FRI", "2024-01-05 10:00:00", "2024-01-06 00:00"},
+	}
+
+	for _, tst := range tests {
+		c, err := ParseCron(tst.spec)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %s", tst.spec, err)
+		}
+
+		from, _ := time.Parse("2006-01-02 15:04:05", tst.from)
+		next := c.Next(from).Format("2006-01-02 15:04")
+		if next != tst.next {
+			t.Fatalf("%q from %s: expected %s, got %s", tst.spec, tst.from, tst.next, next)
+		}
+	}
+}
+
+// TestCronDue ensures feeds with a cron expression are polled when it
+// matches, rather than at once.
+func TestCronDue(t *testing.T) {
+
+	entry := feedlist.Entry{URL: "https://example.com/", Comments: []string{"#interval 5m", "#cron 0 8 * * *"}}
+	feeds := []feedlist.Entry{entry}
+
+	s := New()
+	now := time.Date(2024, 1, 5, 7, 0, 0, 0, time.UTC)
+
+	due, _ := s.Due(feeds, now)
+	if len(due) != 0 {
+		t.Fatalf("expected nothing to be due, got %v", due)
+	}
+	if next := s.Next(feeds, 15*time.Minute, now); !next.Equal(now.Add(15 * time.Minute)) {
+		t.Fatalf("unexpected next poll %s", next)
+	}
+
+	now = time.Date(2024, 1, 5, 8, 0, 20, 0, time.UTC)
+	due, _ = s.Due(feeds, now)
+	if len(due) != 1 {
+		t.Fatalf("expected the feed to be due, got %v", due)
+	}
+	if err := s.Polled(entry, 15*time.Minute, now); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The expression takes precedence over the interval.
+	if next := s.Next(feeds, 24*time.Hour, now); !next.Equal(time.Date(2024, 1, 6, 8, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected next poll %s", next)
+	}
+
+	// An invalid expression is reported, and the interval used.
+	entry.Comments = []string{"#interval 5m", "#cron 0 8 * *"}
+	if err := s.Polled(entry, 15*time.Minute, now); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if next := s.Next([]feedlist.Entry{entry}, time.Hour, now); !next.Equal(now.Add(5 * time.Minute)) {
+		t.Fatalf("unexpected next poll %s", next)
+	}
+}
@@ -0,0 +1,183 @@
+// Package schedule decides when the daemon should poll each feed.
+//
+// Feeds are polled every SLEEP minutes, unless an "#interval" comment
+// above one in the feed-list gives it an interval of its own, such as
+// "#interval 4h" for a feed which is rarely updated, or a "#cron" comment
+// gives the times at which it should be polled, such as
+// "#cron 0 8 * * MON-FRI".
+package schedule
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/feedlist"
+)
+
+// defaultInterval is used if SLEEP is invalid.
+const defaultInterval = 15 * time.Minute
+
+// Schedule records when each feed is next due to be polled.
+type Schedule struct {
+
+	// next holds the time each feed is next due, those we haven't
+	// polled are due at once.
+	next map[string]time.Time
+
+	// jitter is the most by which each feed is randomly delayed,
+	// beyond the time it would otherwise be due.
+	jitter time.Duration
+}
+
+// New returns a schedule in which every feed is due.
+func New() *Schedule {
+	return &Schedule{next: make(map[string]time.Time)}
+}
+
+// Default returns the interval between polls of the feeds which don't
+// have their own, from SLEEP.
+func Default() time.Duration {
+	mins, err := strconv.Atoi(config.Get(config.Sleep))
+	if err != nil || mins < 1 {
+		return defaultInterval
+	}
+	return time.Duration(mins) * time.Minute
+}
+
+// Jitter returns the most by which fetches should be randomly delayed,
+// from FETCH_JITTER, so that they're spread out.
+func Jitter() (time.Duration, error) {
+	value := config.Get(config.FetchJitter)
+	jitter, err := time.ParseDuration(value)
+	if err != nil || jitter < 0 {
+		return 0, fmt.Errorf("invalid %s %q, expected a duration such as \"5m\"", config.FetchJitter, value)
+	}
+	return jitter, nil
+}
+
+// jitterRand supplies the randomness for our delays, so that several
+// hosts started at the same moment don't fetch in lock-step.
+var (
+	jitterRand  = rand.New(rand.NewSource(time.Now().UnixNano()))
+	jitterMutex sync.Mutex
+)
+
+// Delay returns a random delay of up to max.
+func Delay(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+
+	jitterMutex.Lock()
+	defer jitterMutex.Unlock()
+	return time.Duration(jitterRand.Int63n(int64(max)))
+}
+
+// SetJitter sets the most by which each feed is randomly delayed, once
+// it has been polled, beyond the time it would otherwise be due.
+func (s *Schedule) SetJitter(jitter time.Duration) {
+	s.jitter = jitter
+}
+
+// Interval returns the interval between polls of the given feed, which
+// is def unless the feed has its own.
+func Interval(entry feedlist.Entry, def time.Duration) (time.Duration, error) {
+
+	values := entry.Directives("interval")
+	if len(values) == 0 {
+		return def, nil
+	}
+
+	value := values[len(values)-1]
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval < time.Minute {
+		return def, fmt.Errorf("error processing %s - invalid interval %q, expected a duration of at least a minute, such as \"4h\"", feedlist.Redact(entry.URL), value)
+	}
+	return interval, nil
+}
+
+// Expression returns the cron expression which controls when the given
+// feed is polled, or nil if it doesn't have one.
+func Expression(entry feedlist.Entry) (*Cron, error) {
+
+	values := entry.Directives("cron")
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	c, err := ParseCron(values[len(values)-1])
+	if err != nil {
+		return nil, fmt.Errorf("error processing %s - %s", feedlist.Redact(entry.URL), err.Error())
+	}
+	return c, nil
+}
+
+// Due returns the feeds which are due to be polled at the given time,
+// and those which aren't.
+//
+// Feeds we haven't seen before are due at once, unless they have a cron
+// expression, in which case they're due when it next matches.  Feeds which
+// are no longer present are forgotten, so that they're new if they return.
+func (s *Schedule) Due(feeds []feedlist.Entry, now time.Time) ([]string, []string) {
+
+	var due, waiting []string
+	next := make(map[string]time.Time)
+	for _, entry := range feeds {
+		t, ok := s.next[entry.URL]
+		if !ok {
+			if c, err := Expression(entry); c != nil && err == nil {
+				t, ok = c.Next(now.Add(-time.Minute)), true
+			}
+		}
+		if ok {
+			next[entry.URL] = t
+		}
+		if !ok || !now.Before(t) {
+			due = append(due, entry.URL)
+		} else {
+			waiting = append(waiting, entry.URL)
+		}
+	}
+	s.next = next
+	return due, waiting
+}
+
+// Polled records that the given feed was polled at the given time, so
+// that it isn't due again until its interval has passed, or its cron
+// expression next matches, plus a random delay of up to our jitter.
+func (s *Schedule) Polled(entry feedlist.Entry, def time.Duration, now time.Time) error {
+
+	c, err := Expression(entry)
+	if c != nil {
+		s.next[entry.URL] = c.Next(now).Add(Delay(s.jitter))
+		return nil
+	}
+
+	interval, ierr := Interval(entry, def)
+	s.next[entry.URL] = now.Add(interval + Delay(s.jitter))
+	if err != nil {
+		return err
+	}
+	return ierr
+}
+
+// Next returns the time at which the first of the given feeds is due, or
+// after def if there are none.
+func (s *Schedule) Next(feeds []feedlist.Entry, def time.Duration, now time.Time) time.Time {
+
+	next := now.Add(def)
+	for _, entry := range feeds {
+		t, ok := s.next[entry.URL]
+		if !ok {
+			return now
+		}
+		if t.Before(next) {
+			next = t
+		}
+	}
+	return next
+}
@@ -0,0 +1,131 @@
+package schedule
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/feedlist"
+)
+
+// TestInterval ensures feeds may have their own interval.
+func TestInterval(t *testing.T) {
+
+	type TestCase struct {
+		comments []string
+		interval time.Duration
+		valid    bool
+	}
+
+	tests := []TestCase{
+		{nil, 15 * time.Minute, true},
+		{[]string{"#interval 4h"}, 4 * time.Hour, true},
+		{[]string{"#interval 1h", "#interval 90m"}, 90 * time.Minute, true},
+		{[]string{"#intervals 4h"}, 15 * time.Minute, true},
+		{[]string{"#interval soon"}, 15 * time.Minute, false},
+		{[]string{"#interval 10s"}, 15 * time.Minute, false},
+	}
+
+	for _, tst := range tests {
+		entry := feedlist.Entry{URL: "https://example.com/", Comments: tst.comments}
+
+		interval, err := Interval(entry, 15*time.Minute)
+		if (err == nil) != tst.valid {
+			t.Fatalf("%v: unexpected error %v", tst.comments, err)
+		}
+		if interval != tst.interval {
+			t.Fatalf("%v: expected %s, got %s", tst.comments, tst.interval, interval)
+		}
+	}
+}
+
+// TestDue ensures feeds are due once their interval has passed.
+func TestDue(t *testing.T) {
+
+	fast := feedlist.Entry{URL: "https://example.com/fast"}
+	slow := feedlist.Entry{URL: "https://example.com/slow", Comments: []string{"#interval 1h"}}
+	feeds := []feedlist.Entry{fast, slow}
+
+	s := New()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Everything is due at first.
+	due, waiting := s.Due(feeds, now)
+	if len(due) != 2 || len(waiting) != 0 {
+		t.Fatalf("expected all feeds to be due, got %v and %v", due, waiting)
+	}
+	if next := s.Next(feeds, 15*time.Minute, now); !next.Equal(now) {
+		t.Fatalf("expected to be due at once, got %s", next)
+	}
+
+	for _, entry := range feeds {
+		if err := s.Polled(entry, 15*time.Minute, now); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	if next := s.Next(feeds, 15*time.Minute, now); !next.Equal(now.Add(15 * time.Minute)) {
+		t.Fatalf("unexpected next poll %s", next)
+	}
+
+	due, waiting = s.Due(feeds, now.Add(15*time.Minute))
+	if len(due) != 1 || due[0] != fast.URL || len(waiting) != 1 || waiting[0] != slow.URL {
+		t.Fatalf("expected only the fast feed to be due, got %v and %v", due, waiting)
+	}
+
+	due, _ = s.Due(feeds, now.Add(time.Hour))
+	if len(due) != 2 {
+		t.Fatalf("expected all feeds to be due, got %v", due)
+	}
+
+	// A feed which was removed, and returns, is due at once.
+	s.Due([]feedlist.Entry{fast}, now)
+	due, _ = s.Due(feeds, now)
+	if len(due) != 1 || due[0] != slow.URL {
+		t.Fatalf("expected the returning feed to be due, got %v", due)
+	}
+}
+
+// TestJitter ensures feeds are delayed by up to our jitter.
+func TestJitter(t *testing.T) {
+
+	os.Setenv(config.FetchJitter, "soon")
+	defer os.Unsetenv(config.FetchJitter)
+	if _, err := Jitter(); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	os.Setenv(config.FetchJitter, "10m")
+	jitter, err := Jitter()
+	if err != nil || jitter != 10*time.Minute {
+		t.Fatalf("unexpected jitter %s %v", jitter, err)
+	}
+
+	if Delay(0) != 0 {
+		t.Fatalf("expected no delay without jitter")
+	}
+
+	entry := feedlist.Entry{URL: "https://example.com/"}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	s := New()
+	s.SetJitter(jitter)
+
+	varied := false
+	for i := 0; i < 50; i++ {
+		s.Due([]feedlist.Entry{entry}, now)
+		s.Polled(entry, time.Hour, now)
+
+		next := s.Next([]feedlist.Entry{entry}, 24*time.Hour, now)
+		if next.Before(now.Add(time.Hour)) || !next.Before(now.Add(time.Hour+jitter)) {
+			t.Fatalf("unexpected next poll %s", next)
+		}
+		if !next.Equal(now.Add(time.Hour)) {
+			varied = true
+		}
+	}
+	if !varied {
+		t.Fatalf("expected the next poll to vary")
+	}
+}
@@ -0,0 +1,143 @@
+// Package scrape turns web pages which have no feed into feeds, using
+// CSS selectors to find the items within them.
+package scrape
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"github.com/mmcdole/gofeed"
+)
+
+// Rules describe how the items are found within a page.
+//
+// Each item is an element matched by Item.  The other selectors are
+// matched within it, and are optional.
+type Rules struct {
+
+	// Item selects each item within the page.
+	Item string
+
+	// Title selects the title of an item, by default the text of
+	// its link is used.
+	Title string
+
+	// Link selects the link of an item, which is the element itself
+	// if it has a href, or otherwise the first link within it.  By
+	// default this is the item, or the first link within it.
+	Link string
+
+	// Content selects the content of an item, by default the whole
+	// item is used.
+	Content string
+}
+
+// Validate returns an error if any of the selectors is invalid, or there
+// is no selector for the items.
+func (r Rules) Validate() error {
+
+	if r.Item == "" {
+		return fmt.Errorf("no selector was given for the items")
+	}
+
+	for _, s := range []string{r.Item, r.Title, r.Link, r.Content} {
+		if s == "" {
+			continue
+		}
+		if _, err := cascadia.Compile(s); err != nil {
+			return fmt.Errorf("invalid selector %q: %s", s, err.Error())
+		}
+	}
+	return nil
+}
+
+// Parse reads the page from the given URL, returning a feed holding the
+// items the rules find within it.
+//
+// Links are made absolute.  Items without a link or a title are skipped,
+// and it is an error if no items are found, as the page has probably
+// changed beneath us.
+func Parse(body io.Reader, page string, r Rules) (*gofeed.Feed, error) {
+
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+
+	base, err := url.Parse(page)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := goquery.NewDocumentFromReader(body)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &gofeed.Feed{
+		Title:    strings.TrimSpace(doc.Find("title").First().Text()),
+		Link:     page,
+		FeedType: "scrape",
+	}
+
+	doc.Find(r.Item).Each(func(i int, s *goquery.Selection) {
+
+		item := &gofeed.Item{}
+
+		// The link, made absolute.
+		link := s
+		if r.Link != "" {
+			link = s.Find(r.Link).First()
+		}
+		if _, ok := link.Attr("href"); !ok {
+			link = link.Find("a[href]").First()
+		}
+		if href, ok := link.Attr("href"); ok {
+			if ref, err := base.Parse(strings.TrimSpace(href)); err == nil {
+				item.Link = ref.String()
+			}
+		}
+
+		// The title.
+		if r.Title != "" {
+			item.Title = text(s.Find(r.Title).First())
+		} else if link.Length() > 0 {
+			item.Title = text(link)
+		}
+		if item.Title == "" {
+			item.Title = item.Link
+		}
+
+		// The content.
+		content := s
+		if r.Content != "" {
+			content = s.Find(r.Content).First()
+		}
+		if html, err := content.Html(); err == nil {
+			item.Content = strings.TrimSpace(html)
+		}
+
+		switch {
+		case item.Link != "":
+		case item.Title != "":
+			item.GUID = "scraped:" + item.Title
+		default:
+			return
+		}
+		feed.Items = append(feed.Items, item)
+	})
+
+	if len(feed.Items) == 0 {
+		return nil, fmt.Errorf("no items matched %q", r.Item)
+	}
+	return feed, nil
+}
+
+// text returns the text of the selection, with runs of whitespace
+// collapsed.
+func text(s *goquery.Selection) string {
+	return strings.Join(strings.Fields(s.Text()), " ")
+}
@@ -0,0 +1,96 @@
+package scrape
+
+import (
+	"strings"
+	"testing"
+)
+
+// page is a page of news, without a feed.
+var page = `<html><head><title> Steve's News </title></head><body>
+<div class="post">
+  <h2><a href="/one">First   post</a></h2>
+  <p class="summary">The first.</p>
+</div>
+<div class="post">
+  <h2>Second post</h2>
+  <a class="more" href="https://example.org/two">Read more</a>
+  <p class="summary">The second.</p>
+</div>
+<div class="post"></div>
+<a class="post" href="three">Third post</a>
+</body></html>`
+
+// TestParse ensures items are found as the rules describe.
+func TestParse(t *testing.T) {
+
+	feed, err := Parse(strings.NewReader(page), "https://example.com/news/", Rules{Item: ".post"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if feed.Title != "Steve's News" || feed.Link != "https://example.com/news/" {
+		t.Errorf("unexpected feed %v", feed)
+	}
+	if len(feed.Items) != 3 {
+		t.Fatalf("expected three items, got %d", len(feed.Items))
+	}
+
+	expected := []struct{ title, link string }{
+		{"First post", "https://example.com/one"},
+		{"Read more", "https://example.org/two"},
+		{"Third post", "https://example.com/news/three"},
+	}
+	for i, e := range expected {
+		if feed.Items[i].Title != e.title || feed.Items[i].Link != e.link {
+			t.Errorf("item %d: expected %s <%s>, got %s <%s>", i, e.title, e.link, feed.Items[i].Title, feed.Items[i].Link)
+		}
+	}
+	if !strings.Contains(feed.Items[0].Content, "The first.") {
+		t.Errorf("unexpected content %q", feed.Items[0].Content)
+	}
+
+	// With selectors for each part.
+	feed, err = Parse(strings.NewReader(page), "https://example.com/news/", Rules{Item: "div.post", Title: "h2", Link: "a.more", Content: ".summary"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(feed.Items) != 2 {
+		t.Fatalf("expected two items, got %d", len(feed.Items))
+	}
+	if feed.Items[1].Title != "Second post" || feed.Items[1].Link != "https://example.org/two" || feed.Items[1].Content != "The second." {
+		t.Errorf("unexpected item %v", feed.Items[1])
+	}
+
+	// An item without a link is identified by its title.
+	if feed.Items[0].Link != "" || feed.Items[0].GUID != "scraped:First post" {
+		t.Errorf("unexpected item %v", feed.Items[0])
+	}
+
+	// A page without any items has probably changed.
+	_, err = Parse(strings.NewReader(page), "https://example.com/news/", Rules{Item: "article"})
+	if err == nil {
+		t.Errorf("expected an error without any items")
+	}
+}
+
+// TestValidate ensures bad selectors are reported.
+func TestValidate(t *testing.T) {
+
+	tests := []struct {
+		rules Rules
+		valid bool
+	}{
+		{Rules{Item: "article"}, true},
+		{Rules{Item: "article", Title: "h1, h2", Link: "a[href]", Content: "div > p"}, true},
+		{Rules{}, false},
+		{Rules{Title: "h2"}, false},
+		{Rules{Item: "article["}, false},
+		{Rules{Item: "article", Content: "p::"}, false},
+	}
+
+	for _, test := range tests {
+		err := test.rules.Validate()
+		if (err == nil) != test.valid {
+			t.Errorf("%v: expected valid %v, got %v", test.rules, test.valid, err)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+//
+// Update our binary to the most recent release.
+//
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/network"
+)
+
+// releaseURL is the location of the details of our latest release.
+var releaseURL = "https://api.github.com/repos/skx/rss2email/releases/latest"
+
+// release holds the parts of the GitHub release API we care about.
+type release struct {
+	TagName string         `json:"tag_name"`
+	Assets  []releaseAsset `json:"assets"`
+}
+
+// checksumAsset is the name of the release asset holding the checksums of
+// the binaries, as published by .github/build.
+const checksumAsset = "rss2email-SHA256SUMS"
+
+// releaseAsset is a single file attached to a release.
+type releaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// Structure for our options and state.
+type selfUpdateCmd struct {
+
+	// Should we only report whether an update is available?
+	checkOnly bool
+
+	// Should we update even if we appear to be up to date?
+	force bool
+}
+
+// Info is part of the subcommand-API
+func (s *selfUpdateCmd) Info() (string, string) {
+	return "self-update", `Update this binary to the latest release.
+
+This sub-command checks the GitHub releases of this project, and if a
+newer version is available it will be downloaded and used to replace the
+running binary.
+
+The download is verified against the SHA256 checksums published with the
+release before the binary is replaced, if no checksum can be found for
+the download the update is aborted.  The checksums come from the same
+release as the binary, and no signature is checked, so this guards only
+against a corrupted download, not a compromised release.
+
+If you merely wish to see whether an update is available add '-check-only'.
+
+Example:
+
+    $ rss2email self-update -check-only
+    $ rss2email self-update
+`
+}
+
+// Arguments handles our flag-setup.
+func (s *selfUpdateCmd) Arguments(f *flag.FlagSet) {
+	f.BoolVar(&s.checkOnly, "check-only", false, "Only report whether an update is available.")
+	f.BoolVar(&s.force, "force", false, "Update even if we're already running the latest release.")
+}
+
+// fetch returns the body of the given URL.
+func (s *selfUpdateCmd) fetch(url string) ([]byte, error) {
+	client, err := network.HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", config.Get(config.UserAgent))
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: %s", url, resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// latestRelease returns the details of the most recent release.
+func (s *selfUpdateCmd) latestRelease() (*release, error) {
+	data, err := s.fetch(releaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &release{}
+	err = json.Unmarshal(data, r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse release information: %s", err.Error())
+	}
+	return r, nil
+}
+
+// findChecksum looks for the named file within a checksum-file, in the
+// format generated by sha256sum.
+func findChecksum(sums []byte, name string) string {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0])
+		}
+	}
+	return ""
+}
+
+// assetName returns the name of the release asset holding our binary for
+// the given system.
+func assetName(goos string, goarch string) string {
+	name := fmt.Sprintf("rss2email-%s-%s", goos, goarch)
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// findAssets returns the locations of the named binary within the given
+// release, and of the checksums published alongside it, either of which
+// is "" if it is missing.
+func findAssets(r *release, name string) (string, string) {
+	binURL := ""
+	sumURL := ""
+	for _, a := range r.Assets {
+		if a.Name == name {
+			binURL = a.URL
+		}
+		if a.Name == checksumAsset {
+			sumURL = a.URL
+		}
+	}
+	return binURL, sumURL
+}
+
+// replaceBinary writes the new content over the given executable.
+//
+// We write to a temporary file in the same directory, and rename it,
+// so that the replacement is atomic.  A symlink is followed, and its
+// target replaced.
+func replaceBinary(exe string, content []byte) error {
+	exe, err := filepath.EvalSymlinks(exe)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(exe), ".rss2email-update")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(content)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(tmp.Name(), 0755)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), exe)
+}
+
+//
+// Entry-point.
+//
+func (s *selfUpdateCmd) Execute(args []string) int {
+
+	if readOnly("update the binary") {
+		return 1
+	}
+
+	r, err := s.latestRelease()
+	if err != nil {
+		fmt.Printf("failed to find the latest release: %s\n", err.Error())
+		return 1
+	}
+
+	if r.TagName == version && !s.force {
+		fmt.Printf("You are running the latest release, %s.\n", version)
+		return 0
+	}
+
+	fmt.Printf("The latest release is %s, you are running %s.\n", r.TagName, version)
+	if s.checkOnly {
+		return 0
+	}
+
+	// Find the binary for this system, and the checksums.
+	name := assetName(runtime.GOOS, runtime.GOARCH)
+	binURL, sumURL := findAssets(r, name)
+	if binURL == "" {
+		fmt.Printf("release %s contains no binary for %s/%s\n", r.TagName, runtime.GOOS, runtime.GOARCH)
+		return 1
+	}
+	if sumURL == "" {
+		fmt.Printf("release %s contains no checksums, refusing to update\n", r.TagName)
+		return 1
+	}
+
+	sums, err := s.fetch(sumURL)
+	if err != nil {
+		fmt.Printf("failed to download checksums: %s\n", err.Error())
+		return 1
+	}
+	expected := findChecksum(sums, name)
+	if expected == "" {
+		fmt.Printf("no checksum found for %s, refusing to update\n", name)
+		return 1
+	}
+
+	content, err := s.fetch(binURL)
+	if err != nil {
+		fmt.Printf("failed to download %s: %s\n", name, err.Error())
+		return 1
+	}
+
+	sum := sha256.Sum256(content)
+	if hex.EncodeToString(sum[:]) != expected {
+		fmt.Printf("checksum mismatch for %s, refusing to update\n", name)
+		return 1
+	}
+
+	exe, err := os.Executable()
+	if err == nil {
+		err = replaceBinary(exe, content)
+	}
+	if err != nil {
+		fmt.Printf("failed to replace binary: %s\n", err.Error())
+		return 1
+	}
+
+	fmt.Printf("Updated to %s.\n", r.TagName)
+	return 0
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestFindChecksum tests finding a binary within the output of sha256sum.
+func TestFindChecksum(t *testing.T) {
+
+	sums := []byte(`ABCDEF0123  rss2email-linux-amd64
+9876543210 *rss2email-windows-amd64.exe
+malformed line
+`)
+
+	tests := map[string]string{
+		"rss2email-linux-amd64":       "abcdef0123",
+		"rss2email-windows-amd64.exe": "9876543210",
+		"rss2email-linux-arm64":       "",
+		"rss2email":                   "",
+	}
+	for name, expected := range tests {
+		if got := findChecksum(sums, name); got != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, got)
+		}
+	}
+}
+
+// TestFindAssets tests selecting our binary, and the checksums, from a
+// release.
+func TestFindAssets(t *testing.T) {
+
+	if assetName("linux", "amd64") != "rss2email-linux-amd64" || assetName("windows", "amd64") != "rss2email-windows-amd64.exe" {
+		t.Errorf("unexpected names")
+	}
+
+	r := &release{Assets: []releaseAsset{
+		{Name: "rss2email-linux-amd64.tar.gz", URL: "https://example.com/tar"},
+		{Name: "rss2email-linux-amd64", URL: "https://example.com/bin"},
+		{Name: "evil-SHA256SUMS", URL: "https://example.com/evil"},
+		{Name: "rss2email-SHA256SUMS", URL: "https://example.com/sums"},
+	}}
+	bin, sums := findAssets(r, "rss2email-linux-amd64")
+	if bin != "https://example.com/bin" || sums != "https://example.com/sums" {
+		t.Errorf("unexpected assets %q %q", bin, sums)
+	}
+
+	bin, sums = findAssets(&release{Assets: r.Assets[:3]}, "rss2email-linux-arm64")
+	if bin != "" || sums != "" {
+		t.Errorf("unexpected assets %q %q", bin, sums)
+	}
+}
+
+// TestReplaceBinary tests replacing a binary, via a symlink to it.
+func TestReplaceBinary(t *testing.T) {
+
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "rss2email")
+	if err := ioutil.WriteFile(exe, []byte("old"), 0700); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(exe, link); err != nil {
+		t.Fatalf("failed to link: %s", err)
+	}
+
+	if err := replaceBinary(link, []byte("new")); err != nil {
+		t.Fatalf("failed to replace: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(exe)
+	if err != nil || string(data) != "new" {
+		t.Errorf("unexpected content %q: %v", data, err)
+	}
+	fi, err := os.Lstat(link)
+	if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("the symlink was replaced: %v %v", fi, err)
+	}
+	fi, err = os.Stat(exe)
+	if err != nil || fi.Mode().Perm() != 0755 {
+		t.Errorf("unexpected permissions: %v %v", fi, err)
+	}
+
+	// No temporary files are left behind.
+	entries, _ := ioutil.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("unexpected files: %d", len(entries))
+	}
+
+	// A missing binary cannot be replaced.
+	if replaceBinary(filepath.Join(dir, "missing"), []byte("new")) == nil {
+		t.Errorf("expected an error")
+	}
+}
@@ -0,0 +1,119 @@
+// Package slug turns arbitrary titles into names which are safe to use
+// for files, folders, and newsgroups.
+//
+// Feed titles may be written in any script, so we offer three styles:
+// "ascii" drops everything but ASCII letters and digits, "transliterate"
+// first converts accented Latin, Greek, and Cyrillic letters to their
+// ASCII equivalents, and "unicode" keeps the letters and digits of every
+// script.
+package slug
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	// ASCII keeps only ASCII letters and digits.
+	ASCII = "ascii"
+
+	// Transliterate converts what letters it can to ASCII, and drops
+	// the rest.
+	Transliterate = "transliterate"
+
+	// Unicode keeps letters and digits from all scripts, as UTF-8.
+	Unicode = "unicode"
+)
+
+// Make returns the slug of the given title, in lower-case, with each run
+// of other characters replaced by a single separator.
+//
+// An unknown style is treated as ASCII.  The result may be empty, if
+// nothing in the title could be kept.
+func Make(title string, sep string, style string) string {
+
+	if style == Transliterate {
+		title = Translit(title)
+	}
+
+	var out strings.Builder
+	pending := false
+	for _, r := range strings.ToLower(title) {
+		keep := (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9')
+		if style == Unicode && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			keep = true
+		}
+
+		if !keep {
+			pending = true
+			continue
+		}
+		if pending && out.Len() > 0 {
+			out.WriteString(sep)
+		}
+		pending = false
+		out.WriteRune(r)
+	}
+	return out.String()
+}
+
+// Translit converts the accented Latin, Greek, and Cyrillic letters of
+// the given string to ASCII, leaving all other characters untouched.
+func Translit(s string) string {
+	var out strings.Builder
+	for _, r := range s {
+		if t, ok := table[r]; ok {
+			out.WriteString(t)
+			continue
+		}
+		if l, ok := table[unicode.ToLower(r)]; ok && unicode.IsUpper(r) {
+			if l != "" {
+				out.WriteString(strings.ToUpper(l[:1]) + l[1:])
+			}
+			continue
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
+}
+
+// table maps lower-case letters to their transliterations.
+var table = map[rune]string{
+
+	// Latin-1 and Latin Extended-A.
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "ae", 'å': "aa", 'æ': "ae",
+	'ā': "a", 'ă': "a", 'ą': "a",
+	'ç': "c", 'ć': "c", 'ĉ': "c", 'ċ': "c", 'č': "c",
+	'ď': "d", 'đ': "d", 'ð': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ĕ': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ĝ': "g", 'ğ': "g", 'ġ': "g", 'ģ': "g",
+	'ĥ': "h", 'ħ': "h",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ĩ': "i", 'ī': "i", 'ĭ': "i", 'į': "i", 'ı': "i",
+	'ĵ': "j", 'ķ': "k",
+	'ĺ': "l", 'ļ': "l", 'ľ': "l", 'ŀ': "l", 'ł': "l",
+	'ñ': "n", 'ń': "n", 'ņ': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "oe", 'ø': "oe", 'ō': "o", 'ŏ': "o", 'ő': "o", 'œ': "oe",
+	'ŕ': "r", 'ŗ': "r", 'ř': "r",
+	'ś': "s", 'ŝ': "s", 'ş': "s", 'š': "s", 'ß': "ss",
+	'ţ': "t", 'ť': "t", 'ŧ': "t", 'þ': "th",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "ue", 'ũ': "u", 'ū': "u", 'ŭ': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ŵ': "w", 'ý': "y", 'ÿ': "y", 'ŷ': "y",
+	'ź': "z", 'ż': "z", 'ž': "z",
+
+	// Greek.
+	'α': "a", 'ά': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'έ': "e",
+	'ζ': "z", 'η': "i", 'ή': "i", 'θ': "th", 'ι': "i", 'ί': "i", 'ϊ': "i",
+	'ΐ': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o",
+	'ό': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y",
+	'ύ': "y", 'ϋ': "y", 'ΰ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+	'ώ': "o",
+
+	// Cyrillic.
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+	'є': "ye", 'і': "i", 'ї': "yi", 'ґ': "g", 'ў': "u", 'ђ': "dj", 'ј': "j",
+	'љ': "lj", 'њ': "nj", 'ћ': "c", 'џ': "dz",
+}
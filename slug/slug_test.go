@@ -0,0 +1,44 @@
+package slug
+
+import "testing"
+
+// TestMake tests creating slugs in each style.
+func TestMake(t *testing.T) {
+
+	type TestCase struct {
+		title    string
+		style    string
+		expected string
+	}
+
+	tests := []TestCase{
+		{"Steve's Blog", ASCII, "steve.s.blog"},
+		{"  --Hello, World!--  ", ASCII, "hello.world"},
+		{"Café Müller", ASCII, "caf.m.ller"},
+		{"Café Müller", Transliterate, "cafe.mueller"},
+		{"Café Müller", Unicode, "café.müller"},
+		{"Ελληνικά Νέα", Transliterate, "ellinika.nea"},
+		{"Объявление", Transliterate, "obyavlenie"},
+		{"日本のニュース", ASCII, ""},
+		{"日本のニュース", Transliterate, ""},
+		{"日本のニュース 2021", Unicode, "日本のニュース.2021"},
+		{"Steve's Blog", "bogus", "steve.s.blog"},
+	}
+
+	for _, tst := range tests {
+		out := Make(tst.title, ".", tst.style)
+		if out != tst.expected {
+			t.Errorf("%s (%s): expected %q, got %q", tst.title, tst.style, tst.expected, out)
+		}
+	}
+}
+
+// TestTranslit tests that case is preserved, and unknown characters kept.
+func TestTranslit(t *testing.T) {
+	if Translit("Šťastný Жук!") != "Stastny Zhuk!" {
+		t.Errorf("unexpected result: %s", Translit("Šťastný Жук!"))
+	}
+	if Translit("日本") != "日本" {
+		t.Errorf("unexpected result: %s", Translit("日本"))
+	}
+}
@@ -0,0 +1,133 @@
+//
+// Maintain the state we record about our feeds.
+//
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/skx/rss2email/feedlist"
+	"github.com/skx/rss2email/feedstate"
+)
+
+// Structure for our options and state.
+type stateCmd struct {
+
+	// Should we show what we'd remove, rather than removing it?
+	dryRun bool
+
+	// Should we remove things without asking?
+	yes bool
+}
+
+// Info is part of the subcommand-API
+func (s *stateCmd) Info() (string, string) {
+	return "state", `Maintain the state recorded about our feeds.
+
+We record some state about each feed we poll, for example the number of
+times in a row it has been found to be missing.  When feeds are removed
+from the feed-list their state is left behind.
+
+The 'compact' action removes the state of feeds which are no longer in
+the feed-list, reporting how much space was reclaimed.  You'll be asked
+to confirm before anything is removed, unless you add '-yes'.  Add
+'-dry-run' to see what would be removed, without removing it.
+
+Example:
+
+    $ rss2email state compact -dry-run
+    $ rss2email state compact
+`
+}
+
+// Arguments handles our flag-setup.
+func (s *stateCmd) Arguments(f *flag.FlagSet) {
+	f.BoolVar(&s.dryRun, "dry-run", false, "Show what would be removed, without removing it.")
+	f.BoolVar(&s.yes, "yes", false, "Don't ask for confirmation before removing anything.")
+}
+
+// Execute is invoked if the user specifies `state` as the subcommand.
+func (s *stateCmd) Execute(args []string) int {
+
+	if len(args) < 1 || args[0] != "compact" {
+		fmt.Printf("Usage: rss2email state compact [-dry-run] [-yes]\n")
+		return 1
+	}
+
+	// Allow flags to follow the action too.
+	f := flag.NewFlagSet("state compact", flag.ContinueOnError)
+	f.BoolVar(&s.dryRun, "dry-run", s.dryRun, "Show what would be removed, without removing it.")
+	f.BoolVar(&s.yes, "yes", s.yes, "Don't ask for confirmation before removing anything.")
+	if err := f.Parse(args[1:]); err != nil {
+		return 1
+	}
+
+	return s.compact()
+}
+
+// compact removes the state of feeds which aren't in our feed-list.
+func (s *stateCmd) compact() int {
+
+	list := feedlist.New("")
+
+	orphans, err := feedstate.Orphans(list.Entries())
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return 1
+	}
+
+	size := int64(0)
+	for _, o := range orphans {
+		size += o.Size
+	}
+
+	if len(orphans) == 0 {
+		fmt.Printf("Nothing to remove.\n")
+		return 0
+	}
+
+	if s.dryRun {
+		for _, o := range orphans {
+			fmt.Printf("Would remove %s\n", o.Path)
+		}
+		fmt.Printf("Would remove %d records, reclaiming %d bytes.\n", len(orphans), size)
+		return 0
+	}
+
+	if readOnly("remove state") {
+		return 1
+	}
+
+	if !s.yes {
+		fmt.Printf("Remove %d records, reclaiming %d bytes? [y/N] ", len(orphans), size)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			fmt.Printf("Nothing removed.\n")
+			return 0
+		}
+	}
+
+	removed := 0
+	reclaimed := int64(0)
+	for _, o := range orphans {
+		err = os.Remove(o.Path)
+		if err != nil {
+			fmt.Printf("failed to remove %s: %s\n", o.Path, err.Error())
+			continue
+		}
+		removed++
+		reclaimed += o.Size
+	}
+
+	fmt.Printf("Removed %d records, reclaiming %d bytes.\n", removed, reclaimed)
+	if removed != len(orphans) {
+		return 1
+	}
+	return 0
+}
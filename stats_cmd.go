@@ -0,0 +1,156 @@
+//
+// Show the deliveries made to each recipient, or the duplicates
+// suppressed from each feed.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/skx/rss2email/feedstate"
+	"github.com/skx/rss2email/receipts"
+)
+
+// Structure for our options and state.
+type statsCmd struct {
+
+	// Should we output JSON?
+	json bool
+
+	// Should we show the feeds, rather than the recipients?
+	feeds bool
+}
+
+// Info is part of the subcommand-API
+func (s *statsCmd) Info() (string, string) {
+	return "stats", `Show the deliveries made to each recipient.
+
+Each time a message is delivered we record it against the recipient, as
+we do for failed deliveries.  This sub-command shows the number of each,
+and when they last happened, so that you can confirm mail is flowing
+after making configuration changes.
+
+The same information is available from the '/status' endpoint of the
+daemon, if it was started with '-status'.
+
+With '-feeds' we instead show, for each feed, how many of its items were
+suppressed because they'd been seen before, in the last run and in total.
+We also show how many new items had the link of an item we'd seen under a
+different GUID, which means the feed changed its GUIDs and those items were
+sent again.  If that happens to many items at once we warn of a "duplicate
+storm", see DUPLICATE_STORM.
+
+Example:
+
+    $ rss2email stats
+    $ rss2email stats -json
+    $ rss2email stats -feeds
+`
+}
+
+// Arguments handles our flag-setup.
+func (s *statsCmd) Arguments(f *flag.FlagSet) {
+	f.BoolVar(&s.json, "json", false, "Output the statistics as JSON.")
+	f.BoolVar(&s.feeds, "feeds", false, "Show the duplicates suppressed from each feed.")
+}
+
+// when formats the given time for display.
+func when(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// showFeeds shows the deduplication statistics of each feed.
+func (s *statsCmd) showFeeds() int {
+
+	all, err := feedstate.All()
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return 1
+	}
+
+	if s.json {
+		type feedStats struct {
+			URL   string          `json:"url"`
+			Dedup feedstate.Dedup `json:"dedup"`
+		}
+
+		var out []feedStats
+		for _, f := range all {
+			out = append(out, feedStats{URL: f.URL, Dedup: f.Dedup})
+		}
+
+		data, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			fmt.Printf("%s\n", err.Error())
+			return 1
+		}
+		fmt.Printf("%s\n", data)
+		return 0
+	}
+
+	if len(all) == 0 {
+		fmt.Printf("No feeds have been processed.\n")
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "FEED\tRUNS\tLAST RUN\tSUPPRESSED\tRATE\tCHURNED\tSTORMS\tLAST STORM\n")
+	for _, f := range all {
+		d := f.Dedup
+		fmt.Fprintf(w, "%s\t%d\t%d/%d\t%d/%d\t%.0f%%\t%d\t%d\t%s\n", f.URL, d.Runs, d.LastSuppressed, d.LastItems, d.Suppressed, d.Items, d.Rate(), d.Churned, d.Storms, when(d.LastStorm))
+	}
+	w.Flush()
+	return 0
+}
+
+// Execute is invoked if the user specifies `stats` as the subcommand.
+func (s *statsCmd) Execute(args []string) int {
+
+	if s.feeds {
+		return s.showFeeds()
+	}
+
+	all, err := receipts.All()
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return 1
+	}
+
+	if s.json {
+		out, err := json.MarshalIndent(all, "", "  ")
+		if err != nil {
+			fmt.Printf("%s\n", err.Error())
+			return 1
+		}
+		fmt.Printf("%s\n", out)
+		return 0
+	}
+
+	if len(all) == 0 {
+		fmt.Printf("No deliveries have been made.\n")
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "RECIPIENT\tDELIVERED\tLAST DELIVERED\tFAILED\tLAST FAILED\n")
+	for _, r := range all {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%s\n", r.Address, r.Delivered, when(r.LastDelivered), r.Failed, when(r.LastFailed))
+	}
+	w.Flush()
+
+	for _, r := range all {
+		if r.LastError != "" && r.LastFailed.After(r.LastDelivered) {
+			fmt.Printf("\n%s last failed with: %s\n", r.Address, r.LastError)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,116 @@
+//
+// Preview the email which would be generated for a feed item.
+//
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/skx/rss2email/feedlist"
+	"github.com/skx/rss2email/processor"
+	"github.com/skx/rss2email/withstate"
+)
+
+// Structure for our options and state.
+type templatePreviewCmd struct {
+
+	// file is a saved item to render, rather than fetching a feed.
+	file string
+
+	// index is the item within the feed to render.
+	index int
+
+	// to is the recipient to show in the email.
+	to string
+}
+
+// Info is part of the subcommand-API
+func (t *templatePreviewCmd) Info() (string, string) {
+	return "template-preview", `Show the email which would be sent for a feed item.
+
+This sub-command fetches the given feed, and renders the email which
+would be sent for its first item using your current template, without
+sending anything or updating any state.  This makes it easy to test
+changes to '~/.rss2email/email.tmpl'.
+
+You may choose a different item from the feed with '-index', or render
+an item saved as JSON, in the format accepted by 'rss2email deliver',
+with '-file'.
+
+Example:
+
+    $ rss2email template-preview https://blog.steve.fi/index.rss
+    $ rss2email template-preview -index 3 https://blog.steve.fi/index.rss
+    $ rss2email template-preview -file item.json
+`
+}
+
+// Arguments handles our flag-setup.
+func (t *templatePreviewCmd) Arguments(f *flag.FlagSet) {
+	f.StringVar(&t.file, "file", "", "Render the item saved as JSON in this file, rather than fetching a feed.")
+	f.IntVar(&t.index, "index", 0, "The index of the item within the feed to render.")
+	f.StringVar(&t.to, "to", "user@example.com", "The recipient to show in the email.")
+}
+
+// load returns the feed and item we should render.
+func (t *templatePreviewCmd) load(args []string) (*gofeed.Feed, *gofeed.Item, error) {
+
+	if t.file != "" {
+		fh, err := os.Open(t.file)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer fh.Close()
+
+		items, err := readItems(fh)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s: %s", t.file, err.Error())
+		}
+		if t.index < 0 || t.index >= len(items) {
+			return nil, nil, fmt.Errorf("%s contains %d items, there is no item %d", t.file, len(items), t.index)
+		}
+		x := items[t.index]
+		return &x.Feed, &x.Item, nil
+	}
+
+	if len(args) != 1 {
+		return nil, nil, fmt.Errorf("usage: rss2email template-preview [flags] URL")
+	}
+
+	feed, err := feedlist.Feed(args[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	if t.index < 0 || t.index >= len(feed.Items) {
+		return nil, nil, fmt.Errorf("%s contains %d items, there is no item %d", args[0], len(feed.Items), t.index)
+	}
+	return feed, feed.Items[t.index], nil
+}
+
+//
+// Entry-point.
+//
+func (t *templatePreviewCmd) Execute(args []string) int {
+
+	feed, item, err := t.load(args)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return 1
+	}
+
+	// Render the email to STDOUT
+	p := processor.New()
+	p.SetDryRun(true)
+
+	err = p.Deliver(feed, withstate.FeedItem{Item: item}, []string{t.to})
+	if err != nil {
+		fmt.Printf("failed to render template: %s\n", err.Error())
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,117 @@
+//
+// Sort, and normalise, our feed-list.
+//
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/skx/rss2email/feedlist"
+	"github.com/skx/rss2email/feedstate"
+)
+
+// Structure for our options and state.
+type tidyCmd struct {
+
+	// Should we sort the feeds by their tags?
+	byTag bool
+
+	// Should we show the tidied list, rather than saving it?
+	dryRun bool
+}
+
+// Info is part of the subcommand-API
+func (t *tidyCmd) Info() (string, string) {
+	return "tidy", `Sort, and normalise, the feed-list.
+
+This subcommand sorts the feeds in the feed-list by their URLs, or with
+'-by-tag' by their first tag and then their URLs.  The comments above each
+feed, and its options, move along with it.
+
+The URL of each feed is normalised too: the scheme and host are made
+lower-case, default ports are removed, and repeated trailing slashes
+become one.  The state of a feed which is renamed moves with it, so its
+items aren't sent again.
+
+Feeds which are probably the same, as their URLs differ only in their
+scheme, a "www." prefix, a trailing slash, or the case of their paths,
+are reported, so that you may remove those you don't want.
+
+With '-dry-run' the tidied list is shown, rather than saved.
+
+Example:
+
+    $ rss2email tidy -dry-run
+    $ rss2email tidy -by-tag
+`
+}
+
+// Arguments handles our flag-setup.
+func (t *tidyCmd) Arguments(f *flag.FlagSet) {
+	f.BoolVar(&t.byTag, "by-tag", false, "Sort the feeds by their first tag, then their URLs.")
+	f.BoolVar(&t.dryRun, "dry-run", false, "Show the tidied feed-list, rather than saving it.")
+}
+
+// Execute is invoked if the user specifies `tidy` as the subcommand.
+func (t *tidyCmd) Execute(args []string) int {
+
+	if !t.dryRun && readOnly("tidy the feed-list") {
+		return 1
+	}
+
+	// Get the feed-list, from the default location.
+	list := feedlist.New("")
+	if err := list.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+
+	tidied := list.Tidy(t.byTag)
+
+	var renamed []string
+	for from := range tidied.Renamed {
+		renamed = append(renamed, from)
+	}
+	sort.Strings(renamed)
+
+	if t.dryRun {
+		list.WriteAllEntriesIncludingComments(os.Stdout, false)
+	} else {
+		if err := list.Save(); err != nil {
+			fmt.Printf("%s\n", err.Error())
+			return 1
+		}
+
+		// The state of the feeds we renamed moves along with them.
+		for _, from := range renamed {
+			to := tidied.Renamed[from]
+			state := feedstate.Load(from)
+			if state.LastFetched.IsZero() || !feedstate.Load(to).LastFetched.IsZero() {
+				continue
+			}
+			state.URL = to
+			if err := state.Save(); err != nil {
+				fmt.Printf("%s\n", err.Error())
+				return 1
+			}
+		}
+	}
+
+	for _, from := range renamed {
+		fmt.Fprintf(os.Stderr, "Normalised %s as %s\n", feedlist.Redact(from), feedlist.Redact(tidied.Renamed[from]))
+	}
+	for _, group := range tidied.Similar {
+		var shown []string
+		for _, uri := range group {
+			shown = append(shown, feedlist.Redact(uri))
+		}
+		fmt.Fprintf(os.Stderr, "These feeds are probably the same: %s\n", strings.Join(shown, ", "))
+	}
+
+	return 0
+}
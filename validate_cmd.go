@@ -0,0 +1,115 @@
+//
+// Check that each of our feeds can be fetched, and parsed.
+//
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/skx/rss2email/processor"
+)
+
+// Structure for our options and state.
+type validateCmd struct {
+
+	// How many feeds should we fetch at once?
+	concurrency int
+
+	// Only validate the feeds with these tags, comma-separated.
+	tag string
+}
+
+// Info is part of the subcommand-API
+func (v *validateCmd) Info() (string, string) {
+	return "validate", `Check that each of our feeds can be fetched, and parsed.
+
+This subcommand fetches and parses every feed in the feed-list, other than
+those which are disabled, using the settings each has in the feed-list.
+No emails are sent, and nothing is recorded, so it may be run at any time.
+
+The status of each feed is reported:
+
+    OK                The feed was fetched, and parsed.
+    moved             The feed was redirected permanently, so the
+                      feed-list should be updated.
+    HTTP error        The server returned an error, such as "404 Not Found".
+    parse error       The feed was fetched, but isn't a valid feed.
+    fetch error       The feed couldn't be fetched, perhaps because the
+                      server couldn't be reached.
+    invalid settings  The comments above the feed are invalid.
+
+The exit code is non-zero if any feed is broken, so that it may be run
+from cron, or a monitoring system.  A feed which has moved still works.
+
+Several feeds are fetched at once, the number may be changed with
+'-concurrency'.  With '-tag' only the feeds with that tag are checked.
+
+Example:
+
+    $ rss2email validate
+    $ rss2email validate -tag work
+`
+}
+
+// Arguments handles our flag-setup.
+func (v *validateCmd) Arguments(f *flag.FlagSet) {
+	f.IntVar(&v.concurrency, "concurrency", 4, "The number of feeds to fetch at once.")
+	f.StringVar(&v.tag, "tag", "", "Only validate the feeds with this tag, several may be comma-separated.")
+}
+
+// Execute is invoked if the user specifies `validate` as the subcommand.
+func (v *validateCmd) Execute(args []string) int {
+
+	p := processor.New()
+	p.SetTags(strings.FieldsFunc(v.tag, func(r rune) bool { return r == ',' }))
+
+	// Stop cleanly if we're interrupted.
+	ctx, stop := interruptible()
+	defer stop()
+	p.SetContext(ctx)
+
+	checks, err := p.Validate(v.concurrency)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+
+	if len(checks) == 0 {
+		fmt.Printf("There are no feeds to validate.\n")
+		return 0
+	}
+
+	broken := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "STATUS\tFEED\tDETAILS\n")
+	for _, c := range checks {
+		details := ""
+		switch {
+		case c.Err != nil:
+			details = c.Err.Error()
+		case c.MovedTo != "":
+			details = "moved to " + c.MovedTo
+		case c.Items == 1:
+			details = "1 item"
+		default:
+			details = fmt.Sprintf("%d items", c.Items)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", c.Status, c.URL, details)
+
+		if c.Broken() {
+			broken++
+		}
+	}
+	w.Flush()
+
+	if broken > 0 {
+		fmt.Printf("\n%d of %d feeds are broken.\n", broken, len(checks))
+		return 1
+	}
+	return 0
+}
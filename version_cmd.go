@@ -5,13 +5,21 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"runtime"
+
+	"github.com/skx/rss2email/processor/emailer"
 )
 
+// These values are populated at build-time, via the linker:
+//
+//	go build -ldflags "-X main.version=v1.2.3 -X main.commit=$(git rev-parse HEAD) -X main.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
 var (
 	version = "unreleased"
+	commit  = "unknown"
+	date    = "unknown"
 )
 
 // Structure for our options and state.
@@ -19,16 +27,55 @@ type versionCmd struct {
 	// verbose controls whether our version information includes
 	// the go-version.
 	verbose bool
+
+	// json controls whether we output our version information as JSON.
+	json bool
+}
+
+// buildInfo contains the information we report about our binary.
+type buildInfo struct {
+	Version   string   `json:"version"`
+	Commit    string   `json:"commit"`
+	Date      string   `json:"date"`
+	GoVersion string   `json:"go_version"`
+	Platform  string   `json:"platform"`
+	Backends  []string `json:"backends"`
 }
 
 // Info is part of the subcommand-API.
 func (v *versionCmd) Info() (string, string) {
-	return "version", `Report upon our version, and exit.`
+	return "version", `Report upon our version, and exit.
+
+By default only the version is shown, with '-verbose' details of the
+build are also included.  Adding '-json' will output all details of the
+build as a JSON object, which is suitable for scripting and bug reports.
+
+Example:
+
+    $ rss2email version
+    $ rss2email version -verbose
+    $ rss2email version -json
+`
 }
 
 // Arguments handles our flag-setup.
 func (v *versionCmd) Arguments(f *flag.FlagSet) {
-	f.BoolVar(&v.verbose, "verbose", false, "Show go version the binary was generated with.")
+	f.BoolVar(&v.verbose, "verbose", false, "Show details of the build, including the go version the binary was generated with.")
+	f.BoolVar(&v.json, "json", false, "Show details of the build as JSON.")
+}
+
+//
+// getBuildInfo returns the details of our build.
+//
+func getBuildInfo() buildInfo {
+	return buildInfo{
+		Version:   version,
+		Commit:    commit,
+		Date:      date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Backends:  emailer.Backends(),
+	}
 }
 
 //
@@ -37,7 +84,11 @@ func (v *versionCmd) Arguments(f *flag.FlagSet) {
 func showVersion(verbose bool) {
 	fmt.Printf("%s\n", version)
 	if verbose {
-		fmt.Printf("Built with %s\n", runtime.Version())
+		info := getBuildInfo()
+		fmt.Printf("Commit %s\n", info.Commit)
+		fmt.Printf("Built on %s\n", info.Date)
+		fmt.Printf("Built with %s for %s\n", info.GoVersion, info.Platform)
+		fmt.Printf("Backends %v\n", info.Backends)
 	}
 }
 
@@ -46,6 +97,16 @@ func showVersion(verbose bool) {
 //
 func (v *versionCmd) Execute(args []string) int {
 
+	if v.json {
+		out, err := json.MarshalIndent(getBuildInfo(), "", "  ")
+		if err != nil {
+			fmt.Printf("failed to encode version information: %s\n", err.Error())
+			return 1
+		}
+		fmt.Printf("%s\n", out)
+		return 0
+	}
+
 	showVersion(v.verbose)
 
 	return 0
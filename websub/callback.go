@@ -0,0 +1,160 @@
+package websub
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxNotification is the largest notification we'll read, in order to
+// check its signature.
+const maxNotification = 20 * 1024 * 1024
+
+// ServeHTTP handles the requests hubs make to our callback URL, which ends
+// with the ID of the feed they concern.
+//
+// GET requests ask us to verify a subscription, POST requests notify us
+// that the feed was updated.
+func (m *Manager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	key := path.Base(r.URL.Path)
+
+	m.mutex.Lock()
+	s, ok := m.subs[key]
+	var sub Subscription
+	if ok {
+		sub = *s
+	}
+	m.mutex.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		m.verify(w, r, key, ok, sub)
+	case http.MethodPost:
+		m.notify(w, r, ok, sub)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// verify answers the hub's request to verify our intent.
+func (m *Manager) verify(w http.ResponseWriter, r *http.Request, key string, known bool, sub Subscription) {
+
+	q := r.URL.Query()
+	switch q.Get("hub.mode") {
+	case "subscribe":
+		if !known || q.Get("hub.topic") != sub.Topic {
+			http.NotFound(w, r)
+			return
+		}
+
+		lease := Lease
+		if secs, err := strconv.Atoi(q.Get("hub.lease_seconds")); err == nil && secs > 0 {
+			lease = time.Duration(secs) * time.Second
+		}
+
+		m.mutex.Lock()
+		if s, ok := m.subs[key]; ok {
+			s.Expires = time.Now().Add(lease)
+			m.save()
+		}
+		m.mutex.Unlock()
+
+	case "unsubscribe":
+		// We never unsubscribe, other than by forgetting feeds.
+		if known {
+			http.NotFound(w, r)
+			return
+		}
+
+	case "denied":
+		// Anybody may make this request, since the callback is
+		// derived from the feed, so only a request the hub hasn't
+		// yet verified may be denied.  A subscription which has
+		// been verified lapses if the hub stops renewing it.
+		m.mutex.Lock()
+		if s, ok := m.subs[key]; ok && s.Expires.IsZero() && q.Get("hub.topic") == s.Topic {
+			delete(m.subs, key)
+			m.save()
+		}
+		m.mutex.Unlock()
+		return
+
+	default:
+		http.Error(w, "unknown hub.mode", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	io.WriteString(w, q.Get("hub.challenge"))
+}
+
+// notify handles the hub's notification that the feed was updated.
+//
+// Notifications which aren't signed with our secret are ignored, but
+// acknowledged all the same, as the specification requires.
+func (m *Manager) notify(w http.ResponseWriter, r *http.Request, known bool, sub Subscription) {
+
+	if !known {
+		http.Error(w, "no such subscription", http.StatusGone)
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxNotification))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if signed(body, sub.Secret, r.Header.Get("X-Hub-Signature")) {
+		select {
+		case m.pushed <- sub.Feed:
+		default:
+			// We're far behind, the feed will be polled.
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// signed returns true if the signature, "method=hex", is that of the
+// body with the given secret.
+func signed(body []byte, secret string, signature string) bool {
+
+	i := strings.Index(signature, "=")
+	if i < 0 {
+		return false
+	}
+
+	var h func() hash.Hash
+	switch strings.ToLower(signature[:i]) {
+	case "sha1":
+		h = sha1.New
+	case "sha256":
+		h = sha256.New
+	case "sha384":
+		h = sha512.New384
+	case "sha512":
+		h = sha512.New
+	default:
+		return false
+	}
+
+	expected, err := hex.DecodeString(signature[i+1:])
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(h, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
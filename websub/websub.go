@@ -0,0 +1,251 @@
+// Package websub subscribes to the feeds which advertise a WebSub hub,
+// formerly known as PubSubHubbub, so that their updates are pushed to us
+// as they happen, rather than our having to poll for them.
+//
+// We ask each hub to send its notifications to a callback URL of ours,
+// served by ServeHTTP, which hands the feeds which were updated to the
+// daemon via Pushed.  Subscriptions are recorded beneath our state
+// directory, so that they survive restarts, and are renewed before their
+// leases expire.
+package websub
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skx/rss2email/atomicfile"
+	"github.com/skx/rss2email/config"
+	"github.com/skx/rss2email/feedlist"
+	"github.com/skx/rss2email/network"
+)
+
+// Lease is the time for which we ask hubs to keep our subscriptions.
+const Lease = 10 * 24 * time.Hour
+
+// PollInterval is how often the feeds whose updates are pushed to us are
+// still polled, in case a notification was lost.
+const PollInterval = 24 * time.Hour
+
+// renewBefore is how long before a subscription expires that we renew it.
+const renewBefore = 24 * time.Hour
+
+// retryInterval is how long we wait for a hub to verify a subscription
+// before asking again.
+const retryInterval = time.Hour
+
+// Subscription is our subscription to a single feed.
+type Subscription struct {
+
+	// Feed is the feed, as it appears in our feed-list.
+	Feed string `json:"feed"`
+
+	// Hub is the hub we subscribed via, and Topic the URL by which
+	// the hub knows the feed.
+	Hub   string `json:"hub"`
+	Topic string `json:"topic"`
+
+	// Secret is used by the hub to sign its notifications.
+	Secret string `json:"secret"`
+
+	// Requested is the time we last asked the hub to subscribe us.
+	Requested time.Time `json:"requested"`
+
+	// Expires is the time the subscription expires, it is zero until
+	// the hub has verified it.
+	Expires time.Time `json:"expires"`
+}
+
+// Manager subscribes to feeds, and receives their notifications.
+type Manager struct {
+
+	// callback is the URL beneath which hubs reach ServeHTTP.
+	callback string
+
+	// mutex protects subs.
+	mutex sync.Mutex
+
+	// subs holds our subscriptions, keyed by the ID of their feed.
+	subs map[string]*Subscription
+
+	// pushed receives the feeds which hubs told us were updated.
+	pushed chan string
+}
+
+// New returns a manager whose hubs will send their notifications beneath
+// the given callback URL, loading our existing subscriptions.
+func New(callback string) (*Manager, error) {
+
+	u, err := url.Parse(callback)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid WebSub callback %q, expected a http:// or https:// URL", callback)
+	}
+
+	m := &Manager{
+		callback: strings.TrimSuffix(callback, "/"),
+		subs:     make(map[string]*Subscription),
+		pushed:   make(chan string, 100),
+	}
+
+	data, err := ioutil.ReadFile(statePath())
+	if err == nil {
+		var subs []*Subscription
+		if json.Unmarshal(data, &subs) == nil {
+			for _, s := range subs {
+				m.subs[id(s.Feed)] = s
+			}
+		}
+	}
+	return m, nil
+}
+
+// statePath returns the file which records our subscriptions.
+func statePath() string {
+	return filepath.Join(config.StateDirectory(), "websub.json")
+}
+
+// id returns the identifier of the given feed, used within the callback
+// URL which its hub notifies.
+func id(feed string) string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(feed)))
+}
+
+// save records our subscriptions, the caller must hold the mutex.
+func (m *Manager) save() error {
+
+	subs := make([]*Subscription, 0, len(m.subs))
+	for _, s := range m.subs {
+		subs = append(subs, s)
+	}
+
+	data, err := json.MarshalIndent(subs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file := statePath()
+	err = os.MkdirAll(filepath.Dir(file), os.ModePerm)
+	if err == nil {
+		err = atomicfile.WriteFile(file, data, 0600)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record WebSub subscriptions: %s", err.Error())
+	}
+	return nil
+}
+
+// Pushed returns the channel upon which we send the feeds which hubs have
+// told us were updated.
+func (m *Manager) Pushed() <-chan string {
+	return m.pushed
+}
+
+// Active returns true if the given feed's updates are being pushed to us.
+func (m *Manager) Active(feed string, now time.Time) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	s, ok := m.subs[id(feed)]
+	return ok && now.Before(s.Expires)
+}
+
+// Subscribe asks the given hub to push updates of the feed to us, unless
+// we're already subscribed, returning true if we asked.
+//
+// Subscriptions are renewed shortly before they expire, and requests the
+// hub hasn't verified are repeated after a while.
+func (m *Manager) Subscribe(feed string, hub string, topic string, now time.Time) (bool, error) {
+
+	m.mutex.Lock()
+	s, ok := m.subs[id(feed)]
+	if ok && s.Hub == hub && s.Topic == topic {
+		if s.Expires.Sub(now) > renewBefore || now.Sub(s.Requested) < retryInterval {
+			m.mutex.Unlock()
+			return false, nil
+		}
+	} else {
+		secret := make([]byte, 20)
+		if _, err := rand.Read(secret); err != nil {
+			m.mutex.Unlock()
+			return false, err
+		}
+		s = &Subscription{Feed: feed, Hub: hub, Topic: topic, Secret: hex.EncodeToString(secret)}
+		m.subs[id(feed)] = s
+	}
+
+	// The hub may verify our request before it responds to it, so it
+	// must be recorded first.
+	s.Requested = now
+	form := url.Values{
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {topic},
+		"hub.callback":      {m.callback + "/" + id(feed)},
+		"hub.secret":        {s.Secret},
+		"hub.lease_seconds": {fmt.Sprintf("%d", int(Lease.Seconds()))},
+	}
+	err := m.save()
+	m.mutex.Unlock()
+	if err != nil {
+		return false, err
+	}
+
+	client, err := network.HTTPClient()
+	if err != nil {
+		return false, err
+	}
+	client.Timeout = 30 * time.Second
+
+	req, err := http.NewRequest("POST", hub, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", config.Get(config.UserAgent))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to subscribe to %s via %s: %s", feedlist.Redact(feed), feedlist.Redact(hub), err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return false, fmt.Errorf("failed to subscribe to %s via %s: %s", feedlist.Redact(feed), feedlist.Redact(hub), resp.Status)
+	}
+	return true, nil
+}
+
+// Prune forgets our subscriptions to all but the given feeds, such as
+// those which have been removed from the feed-list.  Hubs are told they
+// have gone when they next notify us, or try to renew them.
+func (m *Manager) Prune(feeds []string) error {
+
+	keep := make(map[string]bool)
+	for _, feed := range feeds {
+		keep[id(feed)] = true
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	pruned := false
+	for key := range m.subs {
+		if !keep[key] {
+			delete(m.subs, key)
+			pruned = true
+		}
+	}
+	if !pruned {
+		return nil
+	}
+	return m.save()
+}
@@ -0,0 +1,64 @@
+package withstate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/skx/rss2email/atomicfile"
+)
+
+// deliveredPath returns the file which records the deliveries which have
+// been made for this item.
+func (item *FeedItem) deliveredPath() string {
+	return filepath.Join(deliveredDirectory(), filepath.Base(item.path()))
+}
+
+// deliveredDirectory returns the directory beneath which we record the
+// deliveries made for each item.
+func deliveredDirectory() string {
+	return filepath.Join(stateDirectory(), "delivered")
+}
+
+// Delivered reports whether this item has already been delivered to the
+// destination identified by the given key.
+//
+// Deliveries are recorded separately from the seen-state of the item, so
+// that if delivery to one destination fails we may retry only that one.
+func (item *FeedItem) Delivered(key string) bool {
+
+	data, err := ioutil.ReadFile(item.deliveredPath())
+	if err != nil {
+		return false
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == key {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordDelivered records that this item has been delivered to the
+// destination identified by the given key.
+//
+// The record is replaced atomically, so a crash never corrupts the
+// deliveries recorded previously.
+func (item *FeedItem) RecordDelivered(key string) error {
+
+	file := item.deliveredPath()
+
+	err := os.MkdirAll(filepath.Dir(file), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return atomicfile.WriteFile(file, append(data, []byte(key+"\n")...), 0644)
+}
@@ -8,16 +8,16 @@ package withstate
 import (
 	"crypto/sha1"
 	"fmt"
-	"io/ioutil"
 	"net/url"
 	"os"
-	"os/user"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/mmcdole/gofeed"
+	"github.com/skx/rss2email/atomicfile"
+	"github.com/skx/rss2email/config"
 )
 
 // statePrefix holds the prefix directory, and is used to
@@ -30,6 +30,10 @@ type FeedItem struct {
 
 	// Wrapped structure
 	*gofeed.Item
+
+	// Identity is how the item is identified, one of the Identity
+	// constants, by default its GUID.
+	Identity string
 }
 
 // IsNew reports whether this particular feed-item is new.
@@ -43,25 +47,53 @@ func (item *FeedItem) IsNew() bool {
 }
 
 // RecordSeen updates this item, to record the fact that it has been seen.
-func (item *FeedItem) RecordSeen() {
+//
+// The modification time of the state file is the time the item was last
+// seen, and the time it was first seen is recorded within it.
+//
+// The state file is written atomically, so a crash never leaves an item
+// half-recorded.  If it can't be written an error is returned, and the
+// item will be considered new again next time.
+func (item *FeedItem) RecordSeen() error {
 
 	// Get the file-path
 	file := item.path()
 
 	if _, err := os.Stat(file); !os.IsNotExist(err) {
+
+		// Files written by older releases lack the time
+		// the item was first seen, so start the clock now.
+		if item.FirstSeen().IsZero() {
+			return item.writeSeen(file)
+		}
+
 		t := time.Now()
-		_ = os.Chtimes(file, t, t)
-		return
+		return os.Chtimes(file, t, t)
 	}
 
 	// Ensure the parent directory exists
-	os.MkdirAll(filepath.Dir(file), os.ModePerm)
-
-	// We'll write out the link to the item in the file
-	d1 := []byte(item.Link)
+	err := os.MkdirAll(filepath.Dir(file), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed to record %s as seen: %s", item.Link, err.Error())
+	}
 
 	// Write it out
-	_ = ioutil.WriteFile(file, d1, 0644)
+	return item.writeSeen(file)
+}
+
+// writeSeen writes our state file.
+func (item *FeedItem) writeSeen(file string) error {
+	err := atomicfile.WriteFile(file, item.seenRecord(), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to record %s as seen: %s", item.Link, err.Error())
+	}
+	return nil
+}
+
+// seenRecord returns the content of our state file, the link to the item
+// and the time at which it was first seen.
+func (item *FeedItem) seenRecord() []byte {
+	return []byte(item.Link + "\n" + time.Now().Format(time.RFC3339) + "\n")
 }
 
 // RawContent provides content or fallback to description
@@ -158,38 +190,38 @@ func stateDirectory() string {
 		return statePrefix
 	}
 
-	// Default to using $HOME
-	home := os.Getenv("HOME")
-
-	if home == "" {
-		// Get the current user, and use their home if possible.
-		usr, err := user.Current()
-		if err == nil {
-			home = usr.HomeDir
-		}
-	}
-
 	// Store the path for the future, and return it.
-	statePrefix = filepath.Join(home, ".rss2email", "seen")
+	statePrefix = filepath.Join(config.StateDirectory(), "seen")
 	return statePrefix
 }
 
+// Key returns the name of the marker-file which records the state of
+// this item, which is derived from its identity, by default its GUID.
+func (item *FeedItem) Key() string {
+
+	// Hash the identity and convert to hexadecimal
+	return fmt.Sprintf("%x", sha1.Sum([]byte(item.identity())))
+}
+
 // path returns an appropriate marker-file, which is used to record
 // the seen vs. unseen state of a particular entry.
 func (item *FeedItem) path() string {
+	return filepath.Join(stateDirectory(), item.Key())
+}
 
-	guid := item.GUID
-	if guid == "" {
-		guid = item.Link
-	}
-
-	// Hash the item GUID and convert to hexadecimal
-	hexSha1 := fmt.Sprintf("%x", sha1.Sum([]byte(guid)))
-
-	// Finally join the path
-	out := filepath.Join(stateDirectory(), hexSha1)
-	return out
+// Touch records that the items with the given keys have been seen again,
+// without our having their content, so that their state isn't pruned.
+//
+// This is used when a feed hasn't changed since it was last fetched.
+func Touch(keys ...string) {
 
+	t := time.Now()
+	for _, key := range keys {
+		if len(key) != 40 || strings.ContainsAny(key, "./") {
+			continue
+		}
+		_ = os.Chtimes(filepath.Join(stateDirectory(), key), t, t)
+	}
 }
 
 // isSha1File returns true if a regular file has a name that looks
@@ -220,7 +252,17 @@ func isSha1File(fi os.FileInfo) bool {
 // It returns the number of files pruned and a slice of errors encountered.
 func PruneStateFiles() (int, []error) {
 
-	stateDirPath := stateDirectory()
+	prunedCount, errors := pruneDirectory(stateDirectory())
+
+	// The record of deliveries is pruned in the same way.
+	count, errs := pruneDirectory(deliveredDirectory())
+
+	return prunedCount + count, append(errors, errs...)
+}
+
+// pruneDirectory removes the state files beneath the given directory
+// which have not been touched for four days.
+func pruneDirectory(stateDirPath string) (int, []error) {
 
 	err := os.MkdirAll(stateDirPath, os.ModePerm)
 	if err != nil {
@@ -232,6 +274,7 @@ func PruneStateFiles() (int, []error) {
 		err = fmt.Errorf("failed to open state-file directory: %s", err.Error())
 		return 0, []error{err}
 	}
+	defer stateDir.Close()
 
 	fileInfos, err := stateDir.Readdir(0)
 	if err != nil {
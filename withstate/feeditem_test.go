@@ -1,6 +1,8 @@
 package withstate
 
 import (
+	"crypto/sha1"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -14,7 +16,7 @@ import (
 func TestBasics(t *testing.T) {
 
 	// Create an item
-	x := &FeedItem{&gofeed.Item{}}
+	x := &FeedItem{Item: &gofeed.Item{}}
 
 	// Give it an identity
 	x.GUID = "steve-test"
@@ -28,8 +30,11 @@ func TestBasics(t *testing.T) {
 	//
 	// The second time is designed to make sure that we handle
 	// the time-changing.
-	x.RecordSeen()
-	x.RecordSeen()
+	for i := 0; i < 2; i++ {
+		if err := x.RecordSeen(); err != nil {
+			t.Fatalf("failed to record item as seen: %s", err)
+		}
+	}
 
 	// Shouldn't be new any longer.
 	if x.IsNew() {
@@ -46,8 +51,8 @@ func TestCollision(t *testing.T) {
 	// So we want to have two feed items with the same
 	// GUID.  They should map to the same file, so we
 	// can confirm they would be treated as identical
-	a := &FeedItem{&gofeed.Item{}}
-	b := &FeedItem{&gofeed.Item{}}
+	a := &FeedItem{Item: &gofeed.Item{}}
+	b := &FeedItem{Item: &gofeed.Item{}}
 
 	a.GUID = "steve"
 	b.GUID = "steve"
@@ -64,6 +69,51 @@ func TestCollision(t *testing.T) {
 	}
 }
 
+// TestIdentity ensures items are identified as the feed asks.
+func TestIdentity(t *testing.T) {
+
+	item := func(guid, link, title, content string) *FeedItem {
+		return &FeedItem{Item: &gofeed.Item{GUID: guid, Link: link, Title: title, Content: content}}
+	}
+
+	tests := []struct {
+		identity string
+		a, b     *FeedItem
+		same     bool
+	}{
+		{"", item("1", "a", "T", "C"), item("2", "a", "T", "C"), false},
+		{"", item("", "a", "T", "C"), item("", "a", "U", "D"), true},
+		{IdentityGUID, item("1", "a", "T", "C"), item("1", "b", "U", "D"), true},
+		{IdentityLink, item("1", "a", "T", "C"), item("2", "a", "U", "D"), true},
+		{IdentityLink, item("1", "a", "T", "C"), item("1", "b", "T", "C"), false},
+		{IdentityTitleHash, item("1", "a", "T", "C"), item("2", "b", " T ", "D"), true},
+		{IdentityTitleHash, item("1", "a", "T", "C"), item("1", "a", "U", "C"), false},
+		{IdentityContentHash, item("1", "a", "T", "<p>C  D</p>"), item("2", "b", "U", "<p>C\nD</p>"), true},
+		{IdentityContentHash, item("1", "a", "T", "C"), item("1", "a", "T", "D"), false},
+
+		// Without a title we fall back to the GUID.
+		{IdentityTitleHash, item("1", "a", "", "C"), item("1", "b", "", "D"), true},
+	}
+
+	for _, test := range tests {
+		test.a.Identity = test.identity
+		test.b.Identity = test.identity
+
+		if (test.a.Key() == test.b.Key()) != test.same {
+			t.Errorf("%q: expected %v and %v to be the same %v", test.identity, test.a.Item, test.b.Item, test.same)
+		}
+	}
+
+	// The default is unchanged from older releases.
+	if item("steve", "", "", "").Key() != fmt.Sprintf("%x", sha1.Sum([]byte("steve"))) {
+		t.Errorf("default key changed")
+	}
+
+	if ValidIdentity(IdentityContentHash) != nil || ValidIdentity("hash") == nil {
+		t.Errorf("unexpected validation")
+	}
+}
+
 // TestCollisionMissingHome ensures that we can find the home-directory
 // of a user, even without the environment
 func TestCollisionMissingHome(t *testing.T) {
@@ -76,8 +126,8 @@ func TestCollisionMissingHome(t *testing.T) {
 	// So we want to have two feed items with the same
 	// GUID.  They should map to the same file, so we
 	// can confirm they would be treated as identical
-	a := &FeedItem{&gofeed.Item{}}
-	b := &FeedItem{&gofeed.Item{}}
+	a := &FeedItem{Item: &gofeed.Item{}}
+	b := &FeedItem{Item: &gofeed.Item{}}
 
 	a.GUID = "steve"
 	b.GUID = "steve"
@@ -199,3 +249,159 @@ func fileExists(filename string) bool {
 	}
 	return !info.IsDir()
 }
+
+// TestDelivered ensures that deliveries are recorded.
+func TestDelivered(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "delivered")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cur := statePrefix
+	statePrefix = dir
+	defer func() { statePrefix = cur }()
+
+	x := &FeedItem{Item: &gofeed.Item{}}
+	x.GUID = "steve-delivered"
+
+	if x.Delivered("smtp:steve@example.com") {
+		t.Fatalf("item regarded as delivered initially")
+	}
+
+	for _, key := range []string{"smtp:steve@example.com", "nntp"} {
+		err = x.RecordDelivered(key)
+		if err != nil {
+			t.Fatalf("failed to record delivery: %s", err)
+		}
+	}
+
+	if !x.Delivered("smtp:steve@example.com") || !x.Delivered("nntp") {
+		t.Fatalf("recorded deliveries were not found")
+	}
+	if x.Delivered("smtp:bob@example.com") || x.Delivered("smtp") {
+		t.Fatalf("unexpected delivery found")
+	}
+
+	// Old records are pruned.
+	old := time.Now().Add(-5 * 24 * time.Hour)
+	os.Chtimes(x.deliveredPath(), old, old)
+
+	count, errs := PruneStateFiles()
+	if count != 1 || len(errs) != 0 {
+		t.Fatalf("unexpected prune result %d %v", count, errs)
+	}
+	if x.Delivered("nntp") {
+		t.Fatalf("delivery remained after pruning")
+	}
+}
+
+// TestReappeared ensures that we can spot items which reappear in their
+// feeds, and forget them.
+func TestReappeared(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "reappeared")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cur := statePrefix
+	statePrefix = dir
+	defer func() { statePrefix = cur }()
+
+	x := &FeedItem{Item: &gofeed.Item{}}
+	x.GUID = "steve-reappeared"
+	x.Link = "https://example.com/evergreen"
+
+	if !x.FirstSeen().IsZero() || !x.LastSeen().IsZero() {
+		t.Fatalf("unseen item has seen times")
+	}
+
+	// Files from older releases have no first-seen time, until
+	// the item is seen again.
+	err = ioutil.WriteFile(x.path(), []byte(x.Link), 0644)
+	if err != nil {
+		t.Fatalf("failed to write state: %s", err)
+	}
+	if !x.FirstSeen().IsZero() {
+		t.Fatalf("legacy item has a first-seen time")
+	}
+	x.RecordSeen()
+	if time.Since(x.FirstSeen()) > time.Minute {
+		t.Fatalf("unexpected first-seen time %s", x.FirstSeen())
+	}
+
+	// Pretend the item was first seen ten days ago, and last seen
+	// two days ago.
+	first := time.Now().Add(-10 * 24 * time.Hour)
+	err = ioutil.WriteFile(x.path(), []byte(x.Link+"\n"+first.Format(time.RFC3339)+"\n"), 0644)
+	if err != nil {
+		t.Fatalf("failed to write state: %s", err)
+	}
+	last := time.Now().Add(-2 * 24 * time.Hour)
+	os.Chtimes(x.path(), last, last)
+
+	fetched := time.Now().Add(-time.Hour)
+	week := 7 * 24 * time.Hour
+
+	if !x.Reappeared(fetched, week) {
+		t.Fatalf("item didn't reappear")
+	}
+	if x.Reappeared(fetched, 14*24*time.Hour) {
+		t.Fatalf("item reappeared too soon")
+	}
+	if x.Reappeared(time.Time{}, week) {
+		t.Fatalf("item reappeared without a previous fetch")
+	}
+	if x.Reappeared(last.Add(-time.Hour), week) {
+		t.Fatalf("item reappeared, but it was present when last fetched")
+	}
+
+	// Once forgotten the item is new.
+	err = x.RecordDelivered("nntp")
+	if err != nil {
+		t.Fatalf("failed to record delivery: %s", err)
+	}
+	err = x.Forget()
+	if err != nil {
+		t.Fatalf("failed to forget item: %s", err)
+	}
+	if !x.IsNew() || x.Delivered("nntp") {
+		t.Fatalf("item remembered after being forgotten")
+	}
+}
+
+// TestTouch ensures items may be seen again by their keys alone.
+func TestTouch(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "touch")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cur := statePrefix
+	statePrefix = dir
+	defer func() { statePrefix = cur }()
+
+	x := &FeedItem{Item: &gofeed.Item{}}
+	x.GUID = "steve-touch"
+	x.RecordSeen()
+
+	old := time.Now().Add(-5 * 24 * time.Hour)
+	os.Chtimes(x.path(), old, old)
+
+	// Bogus keys are ignored, as are items we've not seen.
+	y := &FeedItem{Item: &gofeed.Item{}}
+	y.GUID = "steve-unseen"
+	Touch(x.Key(), y.Key(), "../../etc/passwd")
+
+	if time.Since(x.LastSeen()) > time.Minute {
+		t.Fatalf("item wasn't touched, last seen %s", x.LastSeen())
+	}
+	if !y.IsNew() {
+		t.Fatalf("unseen item was created")
+	}
+}
@@ -0,0 +1,64 @@
+package withstate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The ways in which an item may be identified, to tell whether we've
+// seen it before.
+const (
+	// IdentityGUID uses the GUID of the item, or its link if it has
+	// none.  This is the default.
+	IdentityGUID = "guid"
+
+	// IdentityLink uses the link of the item, for feeds whose GUIDs
+	// change while their links don't.
+	IdentityLink = "link"
+
+	// IdentityTitleHash uses the title of the item, for feeds whose
+	// GUIDs and links both change.
+	IdentityTitleHash = "title-hash"
+
+	// IdentityContentHash uses the content of the item, for feeds
+	// which reuse GUIDs, links, and titles.
+	IdentityContentHash = "content-hash"
+)
+
+// ValidIdentity returns an error if the given identity is unknown.
+func ValidIdentity(identity string) error {
+	switch identity {
+	case IdentityGUID, IdentityLink, IdentityTitleHash, IdentityContentHash:
+		return nil
+	}
+	return fmt.Errorf("invalid item identity %q, expected %q, %q, %q, or %q", identity, IdentityGUID, IdentityLink, IdentityTitleHash, IdentityContentHash)
+}
+
+// identity returns the string which identifies this item, using the
+// chosen strategy.  If the item lacks what that needs we fall back to
+// its GUID, or link.
+//
+// Titles and content are prefixed, so that they can't be mistaken for
+// the GUID of another item.
+func (item *FeedItem) identity() string {
+
+	switch item.Identity {
+	case IdentityLink:
+		if item.Link != "" {
+			return item.Link
+		}
+	case IdentityTitleHash:
+		if title := strings.TrimSpace(item.Title); title != "" {
+			return "title:" + title
+		}
+	case IdentityContentHash:
+		if content := strings.Join(strings.Fields(item.RawContent()), " "); content != "" {
+			return "content:" + content
+		}
+	}
+
+	if item.GUID != "" {
+		return item.GUID
+	}
+	return item.Link
+}
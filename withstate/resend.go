@@ -0,0 +1,66 @@
+package withstate
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// FirstSeen returns the time at which this item was first seen, which is
+// zero if it hasn't been seen, or we don't know.
+func (item *FeedItem) FirstSeen() time.Time {
+
+	data, err := ioutil.ReadFile(item.path())
+	if err != nil {
+		return time.Time{}
+	}
+
+	lines := strings.Split(string(data), "\n")
+	if len(lines) < 2 {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(lines[1]))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// LastSeen returns the time at which this item was last seen, which is
+// zero if it hasn't been seen.
+func (item *FeedItem) LastSeen() time.Time {
+
+	fi, err := os.Stat(item.path())
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+// Reappeared reports whether this item was first seen more than the given
+// duration ago, and is now being seen again after being missing from its
+// feed when it was last fetched, at the given time.
+func (item *FeedItem) Reappeared(lastFetched time.Time, after time.Duration) bool {
+
+	first := item.FirstSeen()
+	if first.IsZero() || lastFetched.IsZero() {
+		return false
+	}
+
+	return time.Since(first) > after && item.LastSeen().Before(lastFetched)
+}
+
+// Forget removes the record of this item, and of its deliveries, so that
+// it will be regarded as new.
+func (item *FeedItem) Forget() error {
+
+	for _, file := range []string{item.path(), item.deliveredPath()} {
+		err := os.Remove(file)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}